@@ -0,0 +1,86 @@
+package chequebook
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// CoverageGrade grades how much of the uncashed part of a received cheque the chequebook could pay out now
+// grades are ordered, a higher grade is a better covered cheque
+type CoverageGrade int
+
+const (
+	WouldBounce      CoverageGrade = iota // the liquid balance available to the beneficiary pays nothing of the uncashed part
+	PartiallyCovered                      // cashing now pays some of the uncashed part and the cheque bounces for the rest
+	FullyCovered                          // cashing now pays all of the uncashed part, also if nothing is left uncashed
+)
+
+func (g CoverageGrade) String() string {
+	switch g {
+	case FullyCovered:
+		return "full"
+	case PartiallyCovered:
+		return "partial"
+	}
+	return "bounce"
+}
+
+// MarshalText encodes the grade as its name
+func (g CoverageGrade) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// ParseCoverageGrade parses the name of a grade as printed by String
+func ParseCoverageGrade(name string) (CoverageGrade, error) {
+	for _, grade := range []CoverageGrade{WouldBounce, PartiallyCovered, FullyCovered} {
+		if grade.String() == name {
+			return grade, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown coverage %q, expected full, partial or bounce", name)
+}
+
+// gradeCoverage grades what cashing would pay of the owed amount
+func gradeCoverage(coverage *PayoutCoverage) CoverageGrade {
+	switch {
+	case coverage.Payable.Cmp(coverage.Owed) >= 0:
+		return FullyCovered
+	case coverage.Payable.Sign() > 0:
+		return PartiallyCovered
+	}
+	return WouldBounce
+}
+
+// AcceptResult is the outcome of AcceptCheque
+type AcceptResult struct {
+	Grade    CoverageGrade
+	Coverage *PayoutCoverage // the uncashed part of the cheque as Owed and what liquidBalanceFor covers of it as Payable
+}
+
+// AcceptCheque verifies a received cheque like VerifyReceived and grades whether the liquid balance available to its beneficiary
+// covers the part not yet paid out, so the caller can decide how much further credit to extend to the issuer
+// the grade only holds until the issuer withdraws or other beneficiaries cash, a hard deposit keeps it
+func (c *Chequebook) AcceptCheque(ctx context.Context, signed *SignedCheque, chainID *big.Int, typed bool) (*AcceptResult, error) {
+	if err := c.VerifyReceived(ctx, signed, chainID, typed); err != nil {
+		return nil, err
+	}
+	coverage, err := c.Coverage(ctx, &signed.ChequeParams)
+	if err != nil {
+		return nil, err
+	}
+	// a cheque behind what was already paid out leaves nothing to cover
+	if coverage.Owed.Sign() < 0 {
+		coverage.Owed.SetInt64(0)
+		coverage.Payable.SetInt64(0)
+	}
+	return &AcceptResult{Grade: gradeCoverage(coverage), Coverage: coverage}, nil
+}
+
+// checkCoverage returns ErrChequeNotCoveredByBalance if result is graded below min
+func checkCoverage(result *AcceptResult, min CoverageGrade) error {
+	if result.Grade >= min {
+		return nil
+	}
+	return fmt.Errorf("%w: liquid balance covers %v of the uncashed %v, %s coverage is required", ErrChequeNotCoveredByBalance, result.Coverage.Payable, result.Coverage.Owed, min)
+}
@@ -0,0 +1,256 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrChequeUndelivered is matched by a *DeliveryError
+var ErrChequeUndelivered = errors.New("cheque issued but not delivered")
+
+// DeliveryError is returned by Settlement.Pay if the cheque was issued but could not be handed to the peer
+// the debt is paid by the cheque, only its delivery has to be retried
+type DeliveryError struct {
+	Cheque *SignedCheque // the issued cheque
+	Err    error         // why delivering it failed
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("cheque paying %v to %s issued but not delivered: %v", e.Cheque.CumulativePayout, e.Cheque.Beneficiary.Hex(), e.Err)
+}
+
+// Is matches ErrChequeUndelivered
+func (e *DeliveryError) Is(target error) bool {
+	return target == ErrChequeUndelivered
+}
+
+// Unwrap returns the delivery failure
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Settlement moves the value Accounting tracks on chain
+type Settlement interface {
+	// Pay hands peer a cheque paying amount more than the previous ones
+	// a cheque issued but not delivered is reported with a *DeliveryError
+	Pay(ctx context.Context, peer common.Address, amount *big.Int) error
+	// Resend hands peer again the cheque whose delivery failed, or a later one of the peer
+	Resend(ctx context.Context, peer common.Address, cheque *SignedCheque) error
+	// Cashout cashes cheque, the last cheque received from peer
+	Cashout(ctx context.Context, peer common.Address, cheque *SignedCheque) error
+}
+
+// PeerBalance is the state Accounting keeps for a single peer
+type PeerBalance struct {
+	Balance      *big.Int      // value the peer owes us, negative if we owe the peer
+	Uncashed     *big.Int      // value of received cheques not cashed yet
+	LastReceived *SignedCheque // last cheque received from the peer, nil if there is none
+	Undelivered  *SignedCheque // last cheque issued to the peer whose delivery failed, nil if every cheque was delivered
+}
+
+// Accounting tracks the balance with each peer like swap does in Swarm:
+// once we owe a peer PaymentThreshold it is paid with a cheque,
+// once received cheques of a peer are worth CashoutThreshold they are cashed
+// settlements run while Accounting is locked so a debt is never paid twice
+type Accounting struct {
+	PaymentThreshold *big.Int // debt to a peer at which it is paid, nil never pays
+	CashoutThreshold *big.Int // uncashed value received from a peer at which it is cashed, nil never cashes
+
+	settlement Settlement
+
+	mu    sync.Mutex
+	peers map[common.Address]*PeerBalance
+}
+
+// NewAccounting creates an accounting settling through settlement with the given thresholds
+func NewAccounting(settlement Settlement, paymentThreshold *big.Int, cashoutThreshold *big.Int) *Accounting {
+	return &Accounting{
+		PaymentThreshold: paymentThreshold,
+		CashoutThreshold: cashoutThreshold,
+		settlement:       settlement,
+		peers:            make(map[common.Address]*PeerBalance),
+	}
+}
+
+func (a *Accounting) peer(peer common.Address) *PeerBalance {
+	balance, ok := a.peers[peer]
+	if !ok {
+		balance = &PeerBalance{Balance: new(big.Int), Uncashed: new(big.Int)}
+		a.peers[peer] = balance
+	}
+	return balance
+}
+
+// Balance returns a copy of the state kept for peer
+func (a *Accounting) Balance(peer common.Address) PeerBalance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	balance := a.peer(peer)
+	return PeerBalance{
+		Balance:      new(big.Int).Set(balance.Balance),
+		Uncashed:     new(big.Int).Set(balance.Uncashed),
+		LastReceived: balance.LastReceived,
+		Undelivered:  balance.Undelivered,
+	}
+}
+
+// Credit records that peer owes us amount more, for a service we provided
+func (a *Accounting) Credit(peer common.Address, amount *big.Int) error {
+	if amount == nil {
+		return errors.New("no credited amount")
+	}
+	if amount.Sign() < 0 {
+		return errors.New("credited amount must not be negative")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	balance := a.peer(peer)
+	balance.Balance.Add(balance.Balance, amount)
+	return nil
+}
+
+// Debit records that we owe peer amount more and pays the whole debt once it reaches the payment threshold
+// if no cheque could be issued the debt is kept and the error returned, the next debit tries again
+// a cheque issued but not delivered settles the debt, the next debit only resends it
+func (a *Accounting) Debit(ctx context.Context, peer common.Address, amount *big.Int) error {
+	if amount == nil {
+		return errors.New("no debited amount")
+	}
+	if amount.Sign() < 0 {
+		return errors.New("debited amount must not be negative")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	balance := a.peer(peer)
+	balance.Balance.Sub(balance.Balance, amount)
+
+	debt := new(big.Int).Neg(balance.Balance)
+	if a.PaymentThreshold == nil || debt.Cmp(a.PaymentThreshold) < 0 {
+		return a.resend(ctx, peer, balance)
+	}
+
+	// a new cheque pays out everything the undelivered one did, so it replaces the resend
+	err := a.settlement.Pay(ctx, peer, debt)
+	var undelivered *DeliveryError
+	if errors.As(err, &undelivered) {
+		balance.Balance.SetInt64(0)
+		balance.Undelivered = undelivered.Cheque
+		return fmt.Errorf("paying %v to %s: %w", debt, peer.Hex(), err)
+	}
+	if err != nil {
+		return fmt.Errorf("paying %v to %s: %w", debt, peer.Hex(), err)
+	}
+	log.Debug("paid peer", "peer", peer, "amount", debt)
+	balance.Balance.SetInt64(0)
+	balance.Undelivered = nil
+	return nil
+}
+
+// resend retries delivering the cheque issued to peer whose delivery failed, if there is one
+func (a *Accounting) resend(ctx context.Context, peer common.Address, balance *PeerBalance) error {
+	if balance.Undelivered == nil {
+		return nil
+	}
+	if err := a.settlement.Resend(ctx, peer, balance.Undelivered); err != nil {
+		return fmt.Errorf("resending the cheque paying %v to %s: %w", balance.Undelivered.CumulativePayout, peer.Hex(), err)
+	}
+	log.Debug("resent cheque to peer", "peer", peer, "cumulativePayout", balance.Undelivered.CumulativePayout)
+	balance.Undelivered = nil
+	return nil
+}
+
+// ReceiveCheque credits what cheque pays on top of the last cheque received from peer against its balance
+// and cashes it once the uncashed value reaches the cashout threshold
+// the caller has to verify the cheque before, see Chequebook.VerifyReceived
+func (a *Accounting) ReceiveCheque(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	balance := a.peer(peer)
+	previous := new(big.Int)
+	if last := balance.LastReceived; last != nil {
+		if last.Contract != cheque.Contract || last.Beneficiary != cheque.Beneficiary {
+			return fmt.Errorf("cheque of chequebook %s for %s does not continue the cheques of peer %s", cheque.Contract.Hex(), cheque.Beneficiary.Hex(), peer.Hex())
+		}
+		previous = last.CumulativePayout
+	}
+	amount := new(big.Int).Sub(cheque.CumulativePayout, previous)
+	if amount.Sign() <= 0 {
+		return fmt.Errorf("%w: %v after %v", ErrNonIncreasingPayout, cheque.CumulativePayout, previous)
+	}
+
+	balance.Balance.Sub(balance.Balance, amount)
+	balance.Uncashed.Add(balance.Uncashed, amount)
+	balance.LastReceived = cheque
+
+	if a.CashoutThreshold == nil || balance.Uncashed.Cmp(a.CashoutThreshold) < 0 {
+		return nil
+	}
+
+	if err := a.settlement.Cashout(ctx, peer, cheque); err != nil {
+		return fmt.Errorf("cashing cheques of %s: %w", peer.Hex(), err)
+	}
+	log.Debug("cashed cheques of peer", "peer", peer, "amount", balance.Uncashed)
+	balance.Uncashed.SetInt64(0)
+	return nil
+}
+
+// ChequeSettlement is a Settlement paying with cheques of Issuer and cashing received cheques as their beneficiary
+type ChequeSettlement struct {
+	Issuer  *Issuer
+	Deliver func(ctx context.Context, peer common.Address, cheque *SignedCheque) error // hands an issued cheque to peer
+	Backend EthBackend
+	Wallet  WalletBackend // holds the beneficiary account of received cheques
+}
+
+// Pay issues a cheque for peer as the beneficiary and delivers it
+// the issued cheque is already stored as the peer's last one, so a failed delivery is a *DeliveryError
+func (s *ChequeSettlement) Pay(ctx context.Context, peer common.Address, amount *big.Int) error {
+	cheque, err := s.Issuer.Issue(ctx, peer, amount)
+	if err != nil {
+		return err
+	}
+	if err := s.Deliver(ctx, peer, cheque); err != nil {
+		return &DeliveryError{Cheque: cheque, Err: err}
+	}
+	return nil
+}
+
+// Resend delivers the last cheque stored for peer, which is cheque unless a later one was issued since
+func (s *ChequeSettlement) Resend(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+	last, err := s.Issuer.store.Last(s.Issuer.book.address, peer)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		last = cheque
+	}
+	return s.Deliver(ctx, peer, last)
+}
+
+// Cashout cashes cheque to its beneficiary
+func (s *ChequeSettlement) Cashout(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+	book, err := NewChequebook(cheque.Contract, s.Backend, s.Wallet)
+	if err != nil {
+		return err
+	}
+	result, err := book.CashCheque(ctx, &cheque.ChequeParams, cheque.Beneficiary, cheque.Signature)
+	if err != nil {
+		return err
+	}
+	if result.Revert != nil {
+		return result.Revert
+	}
+	return nil
+}
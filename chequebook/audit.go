@@ -0,0 +1,266 @@
+package chequebook
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrAuditLogTampered is returned for an audit log whose entries do not chain up
+var ErrAuditLogTampered = errors.New("audit log tampered")
+
+// AuditEntry is one record of an AuditLog
+type AuditEntry struct {
+	Seq    uint64            `json:"seq"`
+	Time   time.Time         `json:"time"`
+	Kind   string            `json:"kind"`  // sign-data, sign-tx, send-tx or cashout
+	Phase  string            `json:"phase"` // request before the signer or node is asked, result after it answered
+	Fields map[string]string `json:"fields"`
+	Prev   common.Hash       `json:"prev"` // hash of the previous entry, zero for the first
+}
+
+// auditLine is a line of the log file, the hash covers the entry exactly as written
+type auditLine struct {
+	Hash  common.Hash     `json:"hash"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// AuditLog is an append-only file of json lines, each hashing the entry before it, so changing, removing or reordering
+// entries breaks the chain from there on, cutting off the end is only noticed by comparing the head with one noted before
+// a request is recorded before it is passed on and refused if that fails, its result is recorded after
+// every method is a no-op on a nil *AuditLog
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	head common.Hash
+}
+
+// OpenAuditLog opens the audit log at path for appending, creating it if missing
+// an existing log is verified first, nothing is appended to a broken chain
+func OpenAuditLog(path string) (*AuditLog, error) {
+	seq, head, err := VerifyAuditLog(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file, seq: seq, head: head}, nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at path and returns the number of entries and the hash of the last one
+func VerifyAuditLog(path string) (uint64, common.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	defer file.Close()
+
+	var seq uint64
+	var head common.Hash
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var stored auditLine
+		if err := json.Unmarshal(scanner.Bytes(), &stored); err != nil {
+			return seq, head, fmt.Errorf("%w: line %d of %s is not an entry: %v", ErrAuditLogTampered, line, path, err)
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(stored.Entry, &entry); err != nil {
+			return seq, head, fmt.Errorf("%w: line %d of %s is not an entry: %v", ErrAuditLogTampered, line, path, err)
+		}
+		if hash := sha256.Sum256(stored.Entry); common.Hash(hash) != stored.Hash {
+			return seq, head, fmt.Errorf("%w: entry %d on line %d of %s does not match its hash", ErrAuditLogTampered, entry.Seq, line, path)
+		}
+		if entry.Prev != head || entry.Seq != seq+1 {
+			return seq, head, fmt.Errorf("%w: entry %d on line %d of %s does not follow entry %d", ErrAuditLogTampered, entry.Seq, line, path, seq)
+		}
+		seq, head = entry.Seq, stored.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return seq, head, err
+	}
+	return seq, head, nil
+}
+
+// Head returns the number of entries and the hash of the last one, worth noting somewhere else to detect a cut off end
+func (l *AuditLog) Head() (uint64, common.Hash) {
+	if l == nil {
+		return 0, common.Hash{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.head
+}
+
+// Record appends an entry and syncs it to disk
+func (l *AuditLog) Record(kind string, phase string, fields map[string]string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := json.Marshal(AuditEntry{Seq: l.seq + 1, Time: time.Now().UTC(), Kind: kind, Phase: phase, Fields: fields, Prev: l.head})
+	if err != nil {
+		return err
+	}
+	hash := common.Hash(sha256.Sum256(data))
+	line, err := json.Marshal(auditLine{Hash: hash, Entry: data})
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.head = l.seq+1, hash
+	return nil
+}
+
+// result records the outcome of a request, which already happened and is not undone if the log cannot be written
+func (l *AuditLog) result(kind string, fields map[string]string, err error) {
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if recordErr := l.Record(kind, "result", fields); recordErr != nil {
+		log.Error("failed to write the audit log", "kind", kind, "err", recordErr)
+	}
+}
+
+// cashout records the outcome of a cashout of chequebook
+func (l *AuditLog) cashout(chequebook common.Address, result *CashResult) {
+	if l == nil {
+		return
+	}
+	fields := map[string]string{
+		"chequebook": chequebook.Hex(),
+		"tx":         result.TxHash.Hex(),
+		"gasUsed":    strconv.FormatUint(result.GasUsed, 10),
+	}
+	if cashout := result.Cashout; cashout != nil {
+		fields["beneficiary"] = cashout.Beneficiary.Hex()
+		fields["recipient"] = cashout.Recipient.Hex()
+		fields["cumulativePayout"] = cashout.CumulativePayout.String()
+		fields["totalPayout"] = cashout.TotalPayout.String()
+		fields["bounced"] = strconv.FormatBool(cashout.Bounced)
+	}
+	var err error
+	if result.Revert != nil {
+		err = result.Revert
+	}
+	l.result("cashout", fields, err)
+}
+
+// Close closes the log file
+func (l *AuditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// txFields describes tx for the audit log
+func txFields(tx *types.Transaction) map[string]string {
+	fields := map[string]string{
+		"nonce":    strconv.FormatUint(tx.Nonce(), 10),
+		"value":    tx.Value().String(),
+		"gas":      strconv.FormatUint(tx.Gas(), 10),
+		"gasPrice": tx.GasPrice().String(),
+		"data":     hexutil.Encode(tx.Data()),
+	}
+	if tx.To() != nil {
+		fields["to"] = tx.To().Hex()
+	}
+	return fields
+}
+
+// AuditedWallet is a WalletBackend recording every signing request and its result in an AuditLog
+type AuditedWallet struct {
+	WalletBackend
+	audit *AuditLog
+}
+
+// NewAuditedWallet wraps wallet to record its signing requests in audit
+func NewAuditedWallet(wallet WalletBackend, audit *AuditLog) *AuditedWallet {
+	return &AuditedWallet{WalletBackend: wallet, audit: audit}
+}
+
+func (w *AuditedWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	fields := map[string]string{"account": account.Address.Hex(), "mimetype": mimetype, "data": hexutil.Encode(data)}
+	if err := w.audit.Record("sign-data", "request", fields); err != nil {
+		return nil, fmt.Errorf("refusing to sign without an audit record: %w", err)
+	}
+	sig, err := w.WalletBackend.SignData(account, mimetype, data)
+	result := map[string]string{"account": account.Address.Hex()}
+	if err == nil {
+		result["signature"] = hexutil.Encode(sig)
+	}
+	w.audit.result("sign-data", result, err)
+	return sig, err
+}
+
+func (w *AuditedWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	fields := txFields(tx)
+	fields["account"] = account.Address.Hex()
+	fields["chainId"] = chainID.String()
+	if err := w.audit.Record("sign-tx", "request", fields); err != nil {
+		return nil, fmt.Errorf("refusing to sign without an audit record: %w", err)
+	}
+	signed, err := w.WalletBackend.SignTx(account, tx, chainID)
+	result := map[string]string{"account": account.Address.Hex()}
+	if err == nil {
+		result["tx"] = signed.Hash().Hex()
+	}
+	w.audit.result("sign-tx", result, err)
+	return signed, err
+}
+
+// AuditedBackend is an EthBackend recording every transaction it broadcasts in an AuditLog
+type AuditedBackend struct {
+	EthBackend
+	audit *AuditLog
+}
+
+// NewAuditedBackend wraps backend to record the transactions sent through it in audit
+func NewAuditedBackend(backend EthBackend, audit *AuditLog) *AuditedBackend {
+	return &AuditedBackend{EthBackend: backend, audit: audit}
+}
+
+func (b *AuditedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	raw, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	fields := txFields(tx)
+	fields["tx"] = tx.Hash().Hex()
+	fields["raw"] = hexutil.Encode(raw)
+	if sender, err := transactionSender(tx); err == nil {
+		fields["from"] = sender.Hex()
+	}
+	if err := b.audit.Record("send-tx", "request", fields); err != nil {
+		return fmt.Errorf("refusing to broadcast without an audit record: %w", err)
+	}
+	err = b.EthBackend.SendTransaction(ctx, tx)
+	b.audit.result("send-tx", map[string]string{"tx": tx.Hash().Hex()}, err)
+	return err
+}
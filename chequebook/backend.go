@@ -0,0 +1,42 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// EthBackend is the minimum needed from an ethereum node to deploy, fund and cash chequebooks
+type EthBackend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+// WalletBackend is minimum needed from go-ethereums wallet abstraction to support swap functions
+type WalletBackend interface {
+	Accounts() []accounts.Account
+	SignData(account accounts.Account, mimetype string, text []byte) ([]byte, error)
+	SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// NewWalletTransactor creates transaction options which sign with the given wallet account for the given chain
+func NewWalletTransactor(wallet WalletBackend, account accounts.Account, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: account.Address,
+		Signer: func(signer types.Signer, address common.Address, transaction *types.Transaction) (*types.Transaction, error) {
+			if address != account.Address {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return wallet.SignTx(account, transaction, chainID)
+		},
+	}
+}
@@ -0,0 +1,264 @@
+package chequebook
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BatchResult is the outcome of cashing one cheque of a batch
+type BatchResult struct {
+	Cheque  *SignedCheque
+	TxHash  common.Hash    // zero if the transaction was never sent
+	Status  uint64         // receipt status, only meaningful if Err is nil or a *RevertError
+	Cashout *CashoutResult // amounts reported by the chequebook, nil unless the cashout succeeded
+	Err     error
+}
+
+// BatchOptions configures how CashBatch builds and waits for the cashout transactions
+type BatchOptions struct {
+	GasBufferPercent uint64           // safety margin added on top of gas estimates in percent
+	GasPrice         *big.Int         // gas price of all cashouts, nil asks GasPricer
+	GasPricer        GasPricer        // strategy pricing every cashout without GasPrice, nil uses the node's suggestion
+	MaxFee           *big.Int         // highest gas price a cashout is sent with, a higher one fails it with a *GasPriceCapError
+	GasCap           uint64           // maximum gas limit of a single cashout, 0 disables the cap
+	MaxGasCostUSD    *big.Float       // maximum gas cost of a single cashout in USD, nil disables the check
+	USDOracle        USDOracle        // oracle used to convert gas into USD for MaxGasCostUSD
+	WaitTimeout      time.Duration    // maximum time to wait for a transaction to be mined
+	Confirmations    uint64           // blocks a cashout has to be buried under, counting its own block
+	RetryAttempts    int              // attempts for rpc calls failing with a transient error
+	Parallelism      int              // beneficiaries whose cashouts are sent at the same time, below 2 sends one cashout after the other
+	RecipientConsent RecipientConsent // asked before a cheque is cashed to a recipient other than its beneficiary, nil pays any recipient
+	Audit            *AuditLog        // records the outcome of every cashout, nil records nothing
+	Notifier         *Notifier        // posts cashouts, bounces and failed transactions to webhooks, nil posts nothing
+	TrustedFactories []common.Address // factories a chequebook has to be deployed by for its cheques to be cashed, empty trusts any
+	Contracts        ContractVersion  // release of every chequebook cashed on, nil detects it per chequebook
+	Typed            bool             // cheques are signed as EIP-712 typed data even on chequebooks of releases expecting personal-sign
+}
+
+// CashBatch cashes the cheques, each to recipient or to its own beneficiary if recipient is zero
+// nonces are handed out by a nonceTracker per beneficiary so back-to-back sends do not depend on the node's pending nonce
+// the cashouts of one beneficiary are sent in order, up to opts.Parallelism beneficiaries send theirs at the same time
+// a failing cheque is recorded in its result and does not stop the rest of the batch
+func CashBatch(ctx context.Context, backend EthBackend, wallet WalletBackend, cheques []*SignedCheque, recipient common.Address, opts BatchOptions) []*BatchResult {
+	results := make([]*BatchResult, len(cheques))
+	pending := make(map[*BatchResult]*types.Transaction)
+	nonces := newNonceTracker()
+
+	chainID, err := backend.ChainID(ctx)
+	var beneficiaries []common.Address
+	byBeneficiary := make(map[common.Address][]*BatchResult)
+	for i, cheque := range cheques {
+		results[i] = &BatchResult{Cheque: cheque}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if _, ok := byBeneficiary[cheque.Beneficiary]; !ok {
+			beneficiaries = append(beneficiaries, cheque.Beneficiary)
+		}
+		byBeneficiary[cheque.Beneficiary] = append(byBeneficiary[cheque.Beneficiary], results[i])
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+	var mu sync.Mutex // guards pending
+	var wg sync.WaitGroup
+	for _, beneficiary := range beneficiaries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(queue []*BatchResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			for _, result := range queue {
+				tx, err := sendBatchCheque(ctx, backend, wallet, result.Cheque, recipient, chainID, nonces, opts)
+				if err != nil {
+					result.Err = err
+					continue
+				}
+				result.TxHash = tx.Hash()
+				mu.Lock()
+				pending[result] = tx
+				mu.Unlock()
+			}
+		}(byBeneficiary[beneficiary])
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		tx, ok := pending[result]
+		if !ok {
+			continue
+		}
+
+		receipt, err := WaitConfirmed(ctx, backend, tx, opts.Confirmations, opts.WaitTimeout)
+		if err != nil {
+			result.Err = err
+			opts.Notifier.txFailed(result.Cheque.Contract, tx, err)
+			continue
+		}
+		result.Status = receipt.Status
+		cashed := &CashResult{TxHash: tx.Hash(), Receipt: receipt, GasUsed: receipt.GasUsed}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			revert := newRevertError(ctx, backend, tx, receipt)
+			result.Err = revert
+			cashed.Revert = revert
+			opts.Audit.cashout(result.Cheque.Contract, cashed)
+			opts.Notifier.cashout(result.Cheque.Contract, cashed)
+			continue
+		}
+
+		chequebook, err := openChequebookVersion(ctx, result.Cheque.Contract, backend, wallet, opts.Contracts)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		result.Cashout, result.Err = chequebook.ParseCashout(receipt)
+		cashed.Cashout = result.Cashout
+		opts.Audit.cashout(result.Cheque.Contract, cashed)
+		opts.Notifier.cashout(result.Cheque.Contract, cashed)
+	}
+	return results
+}
+
+// sendBatchCheque checks, signs and sends the cashout of a single cheque using the locally tracked nonce of its beneficiary
+func sendBatchCheque(ctx context.Context, backend EthBackend, wallet WalletBackend, cheque *SignedCheque, recipient common.Address, chainID *big.Int, nonces *nonceTracker, opts BatchOptions) (*types.Transaction, error) {
+	account, err := walletAccount(wallet, cheque.Beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChain("the cheque of "+cheque.Beneficiary.Hex(), cheque.ChainID, chainID); err != nil {
+		return nil, err
+	}
+
+	// the release of the chequebook decides how its cheques are signed
+	chequebook, err := openChequebookVersion(ctx, cheque.Contract, backend, wallet, opts.Contracts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTrustedFactory(ctx, backend, cheque.Contract, opts.TrustedFactories); err != nil {
+		return nil, err
+	}
+
+	// reject cheques which would revert anyway before paying for the transaction
+	signer, err := Verify(cheque, chainID, opts.Typed || chequebook.TypedCheques())
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := chequebook.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if signer != issuer {
+		return nil, fmt.Errorf("cheque signed by %s instead of the chequebook owner %s", signer.Hex(), issuer.Hex())
+	}
+
+	if (recipient == common.Address{}) {
+		recipient = cheque.Beneficiary
+	}
+	if err := approveRecipient(ctx, opts.RecipientConsent, &cheque.ChequeParams, recipient); err != nil {
+		return nil, err
+	}
+
+	callData, err := cashChequeBeneficiaryData(recipient, &cheque.ChequeParams, cheque.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := nonces.next(account.Address, func() (nonce uint64, err error) {
+		err = WithRetry(ctx, opts.RetryAttempts, func() (err error) {
+			nonce, err = backend.PendingNonceAt(ctx, account.Address)
+			return err
+		})
+		return nonce, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := cashoutTx(ctx, backend, account.Address, nonce, cheque.Contract, callData, opts.GasBufferPercent, TxOverrides{GasPrice: opts.GasPrice, GasPricer: opts.GasPricer, MaxFee: opts.MaxFee, GasCap: opts.GasCap}, opts.RetryAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkGasCostUSD(ctx, opts.USDOracle, tx.Gas(), opts.MaxGasCostUSD); err != nil {
+		return nil, err
+	}
+
+	tx, err = wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := false
+	err = WithRetry(ctx, opts.RetryAttempts, func() error {
+		err := backend.SendTransaction(ctx, tx)
+		if err != nil && sent && isKnownTransaction(err) {
+			return nil
+		}
+		sent = true
+		return err
+	})
+	if err != nil {
+		if isNonceTooLow(err) {
+			nonces.reset(account.Address)
+		}
+		return nil, err
+	}
+
+	nonces.sent(account.Address, nonce)
+	return tx, nil
+}
+
+// CashAll cashes every cheque of store with an uncashed part like CashBatch and records the successful cashouts in store
+// a cheque the chequebook already paid out in full is only marked as cashed and left out of the results
+func CashAll(ctx context.Context, backend EthBackend, wallet WalletBackend, store *ChequeStore, recipient common.Address, opts BatchOptions) ([]*BatchResult, error) {
+	outstanding, err := store.Outstanding()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*BatchResult
+	var cheques []*SignedCheque
+	for _, entry := range outstanding {
+		cheque := entry.Cheque
+		chequebook, err := openChequebookVersion(ctx, cheque.Contract, backend, wallet, opts.Contracts)
+		if err != nil {
+			results = append(results, &BatchResult{Cheque: cheque, Err: err})
+			continue
+		}
+		var paidOut *big.Int
+		err = WithRetry(ctx, opts.RetryAttempts, func() (err error) {
+			paidOut, err = chequebook.PaidOut(ctx, cheque.Beneficiary)
+			return err
+		})
+		if err != nil {
+			results = append(results, &BatchResult{Cheque: cheque, Err: err})
+			continue
+		}
+		// cashed elsewhere, by another process or before the store learned about it
+		if paidOut.Cmp(cheque.CumulativePayout) >= 0 {
+			if err := store.MarkCashed(cheque.Contract, cheque.Beneficiary, cheque.CumulativePayout); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		cheques = append(cheques, cheque)
+	}
+
+	for _, result := range CashBatch(ctx, backend, wallet, cheques, recipient, opts) {
+		if result.Err == nil {
+			result.Err = store.MarkCashed(result.Cheque.Contract, result.Cheque.Beneficiary, result.Cheque.CumulativePayout)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
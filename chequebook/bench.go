@@ -0,0 +1,277 @@
+package chequebook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// BenchOptions configures a Bench run
+type BenchOptions struct {
+	Cheques       int      // cheques issued and cashed in total
+	Beneficiaries int      // generated beneficiaries the cheques are spread over in turn
+	Amount        *big.Int // amount of every cheque
+	Funding       *big.Int // wei the issuer sends every beneficiary for the gas of its cashouts, nil sends nothing
+	Typed         bool     // sign the cheques as EIP-712 typed data
+}
+
+// LatencyStats summarizes the durations of one kind of operation of a Bench run
+type LatencyStats struct {
+	Count  int
+	Mean   time.Duration
+	Median time.Duration
+	P95    time.Duration
+	Max    time.Duration
+}
+
+func newLatencyStats(durations []time.Duration) LatencyStats {
+	stats := LatencyStats{Count: len(durations)}
+	if len(durations) == 0 {
+		return stats
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, duration := range sorted {
+		total += duration
+	}
+	stats.Mean = total / time.Duration(len(sorted))
+	stats.Median = sorted[len(sorted)/2]
+	stats.P95 = sorted[(len(sorted)*95-1)/100]
+	stats.Max = sorted[len(sorted)-1]
+	return stats
+}
+
+// BenchReport is what a Bench run measured
+type BenchReport struct {
+	Issued      int           // cheques signed and stored
+	Cashed      int           // cheques whose cashout succeeded
+	Failed      int           // cheques failing to be issued or cashed, including reverted cashouts
+	FirstErr    error         // the first of the failures
+	Duration    time.Duration // from issuing the first cheque to confirming the last cashout
+	Signing     LatencyStats  // signer requests for cheques and transactions of the issuer and the beneficiaries
+	Issuing     LatencyStats  // Issuer.Issue including its balance checks
+	Cashing     LatencyStats  // CashCheque from building the cashout to its confirmation
+	EndToEnd    LatencyStats  // from issuing a cheque to the confirmation of its cashout
+	TxPerSecond float64       // confirmed cashouts per second of Duration
+	GasUsed     uint64        // gas of all confirmed cashouts
+}
+
+// Bench issues opts.Cheques cheques to freshly generated beneficiaries as fast as the chain allows and cashes each as soon as it is issued
+// the beneficiaries, funded by the issuer with opts.Funding, send their cashouts in parallel to each other and one after the other themselves,
+// so the nonces of the issuer and every beneficiary are handed out back to back, and every cashout is followed by a TxMonitor
+// it is meant for development chains: the cheques really pay out, and the beneficiaries' keys and what they hold are lost after the run
+func (c *Chequebook) Bench(ctx context.Context, opts BenchOptions) (*BenchReport, error) {
+	if opts.Cheques < 1 || opts.Beneficiaries < 1 {
+		return nil, errors.New("a bench needs at least one cheque and one beneficiary")
+	}
+	if opts.Amount == nil || opts.Amount.Sign() <= 0 {
+		return nil, errors.New("cheque amount must be positive")
+	}
+
+	liquid, err := c.LiquidBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	needed := new(big.Int).Mul(opts.Amount, big.NewInt(int64(opts.Cheques)))
+	if needed.Cmp(liquid) > 0 {
+		return nil, fmt.Errorf("%w: %d cheques of %v need %v, liquid balance %v", ErrInsufficientLiquidity, opts.Cheques, opts.Amount, needed, liquid)
+	}
+
+	keys := make([]*ecdsa.PrivateKey, opts.Beneficiaries)
+	for i := range keys {
+		if keys[i], err = crypto.GenerateKey(); err != nil {
+			return nil, err
+		}
+	}
+	wallet := &benchWallet{WalletBackend: c.wallet, beneficiaries: NewKeyWallet(keys...)}
+	book := *c
+	book.wallet = wallet
+	if book.BumpTimeout == 0 {
+		book.BumpTimeout = DefaultBumpTimeout
+	}
+	beneficiaries := wallet.beneficiaries.Accounts()
+	if err := book.fundBeneficiaries(ctx, beneficiaries, opts.Funding); err != nil {
+		return nil, err
+	}
+	// the funding transactions are not part of the measurements
+	wallet.reset()
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	chainID, err := c.backend.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := NewIssuer(ctx, &book, store, chainID, opts.Typed)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BenchReport{}
+	var mu sync.Mutex // guards report and the latencies
+	var issuing, cashing, endToEnd []time.Duration
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Failed++
+		if report.FirstErr == nil {
+			report.FirstErr = err
+		}
+	}
+
+	queues := make([]chan benchCheque, len(beneficiaries))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range beneficiaries {
+		queues[i] = make(chan benchCheque, opts.Cheques/len(beneficiaries)+1)
+		wg.Add(1)
+		go func(queue <-chan benchCheque) {
+			defer wg.Done()
+			for cheque := range queue {
+				cashStart := time.Now()
+				result, err := book.CashCheque(ctx, &cheque.ChequeParams, cheque.Beneficiary, cheque.Signature)
+				if err == nil && result.Revert != nil {
+					err = result.Revert
+				}
+				if err != nil {
+					fail(fmt.Errorf("cashing cheque of %s: %w", cheque.Beneficiary.Hex(), err))
+					continue
+				}
+				mu.Lock()
+				report.Cashed++
+				report.GasUsed += result.GasUsed
+				cashing = append(cashing, time.Since(cashStart))
+				endToEnd = append(endToEnd, time.Since(cheque.issued))
+				mu.Unlock()
+			}
+		}(queues[i])
+	}
+
+	for i := 0; i < opts.Cheques && ctx.Err() == nil; i++ {
+		beneficiary := beneficiaries[i%len(beneficiaries)]
+		issued := time.Now()
+		signed, err := issuer.Issue(ctx, beneficiary.Address, opts.Amount)
+		if err != nil {
+			fail(fmt.Errorf("issuing cheque to %s: %w", beneficiary.Address.Hex(), err))
+			continue
+		}
+		mu.Lock()
+		report.Issued++
+		issuing = append(issuing, time.Since(issued))
+		mu.Unlock()
+		queues[i%len(beneficiaries)] <- benchCheque{SignedCheque: signed, issued: issued}
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	report.Signing = newLatencyStats(wallet.latencies())
+	report.Issuing = newLatencyStats(issuing)
+	report.Cashing = newLatencyStats(cashing)
+	report.EndToEnd = newLatencyStats(endToEnd)
+	if report.Duration > 0 {
+		report.TxPerSecond = float64(report.Cashed) / report.Duration.Seconds()
+	}
+	return report, ctx.Err()
+}
+
+// benchCheque is an issued cheque waiting in the queue of its beneficiary
+type benchCheque struct {
+	*SignedCheque
+	issued time.Time
+}
+
+// fundBeneficiaries sends amount wei from the issuer to every beneficiary, all transfers are sent before the first is waited for
+func (c *Chequebook) fundBeneficiaries(ctx context.Context, beneficiaries []accounts.Account, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil
+	}
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return err
+	}
+	opts.Value = amount
+	// a plain transfer to an account without code, which bind would refuse to estimate
+	opts.GasLimit = params.TxGas
+
+	txs := make([]*types.Transaction, len(beneficiaries))
+	for i, beneficiary := range beneficiaries {
+		if txs[i], err = bind.NewBoundContract(beneficiary.Address, abi.ABI{}, c.backend, c.backend, c.backend).Transfer(opts); err != nil {
+			return fmt.Errorf("funding beneficiary %s: %w", beneficiary.Address.Hex(), err)
+		}
+	}
+	for i, tx := range txs {
+		if _, err := c.waitSucceeded(ctx, tx); err != nil {
+			return fmt.Errorf("funding beneficiary %s: %w", beneficiaries[i].Address.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// benchWallet signs with the generated beneficiary keys next to the accounts of the chequebook's wallet, timing every request
+type benchWallet struct {
+	WalletBackend
+	beneficiaries *KeyWallet
+
+	mu        sync.Mutex
+	durations []time.Duration
+}
+
+func (w *benchWallet) Accounts() []accounts.Account {
+	return append(append([]accounts.Account(nil), w.WalletBackend.Accounts()...), w.beneficiaries.Accounts()...)
+}
+
+// signer returns the wallet holding the key of account
+func (w *benchWallet) signer(account accounts.Account) WalletBackend {
+	if _, err := w.beneficiaries.key(account); err == nil {
+		return w.beneficiaries
+	}
+	return w.WalletBackend
+}
+
+func (w *benchWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	defer w.record(time.Now())
+	return w.signer(account).SignData(account, mimetype, data)
+}
+
+func (w *benchWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	defer w.record(time.Now())
+	return w.signer(account).SignTx(account, tx, chainID)
+}
+
+func (w *benchWallet) record(start time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.durations = append(w.durations, time.Since(start))
+}
+
+func (w *benchWallet) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.durations = nil
+}
+
+func (w *benchWallet) latencies() []time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]time.Duration(nil), w.durations...)
+}
@@ -0,0 +1,20 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrUnknownBytecode is returned if the code at a chequebook address is not the ERC20SimpleSwap runtime code
+var ErrUnknownBytecode = errors.New("contract is not an ERC20SimpleSwap chequebook")
+
+// minRuntimeLength rules out trivially short code, any byte string is found in the creation code if it is short enough
+const minRuntimeLength = 1024
+
+// VerifyChequebook checks that the contract at address runs the ERC20SimpleSwap code of the v0.2.3 contracts
+// the contract has no immutables, so the runtime code of every deployment is embedded verbatim in the creation code of the bindings
+func VerifyChequebook(ctx context.Context, backend EthBackend, address common.Address) error {
+	return VerifyChequebookVersion(ctx, backend, address, ContractsV023)
+}
@@ -0,0 +1,145 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// cashoutEncodingLength is the length of the encoding the beneficiary signs to authorize a cashCheque:
+// chequebook address (20 bytes) ++ sender address (20 bytes) ++ cumulative payout as uint256 (32 bytes) ++
+// recipient address (20 bytes) ++ caller payout as uint256 (32 bytes)
+const cashoutEncodingLength = common.AddressLength + common.AddressLength + 32 + common.AddressLength + 32
+
+// validateCallerPayout checks that callerPayout is a uint256 which does not exceed the cumulative payout of the cheque
+func (cheque *ChequeParams) validateCallerPayout(callerPayout *big.Int) error {
+	if err := cheque.validate(); err != nil {
+		return err
+	}
+	if callerPayout == nil {
+		return errors.New("cashout has no caller payout")
+	}
+	if callerPayout.Sign() < 0 {
+		return errors.New("negative caller payout")
+	}
+	if callerPayout.Cmp(cheque.CumulativePayout) > 0 {
+		return fmt.Errorf("caller payout %v exceeds cumulative payout %v", callerPayout, cheque.CumulativePayout)
+	}
+	return nil
+}
+
+// encodeCashout encodes the beneficiary's authorization for sender to cash the cheque to recipient, paying callerPayout to sender
+func (cheque *ChequeParams) encodeCashout(sender common.Address, recipient common.Address, callerPayout *big.Int) ([]byte, error) {
+	if err := cheque.validateCallerPayout(callerPayout); err != nil {
+		return nil, err
+	}
+
+	input := make([]byte, 0, cashoutEncodingLength)
+	input = append(input, cheque.Contract.Bytes()...)
+	input = append(input, sender.Bytes()...)
+	input = append(input, math.PaddedBigBytes(cheque.CumulativePayout, 32)...)
+	input = append(input, recipient.Bytes()...)
+	input = append(input, math.PaddedBigBytes(callerPayout, 32)...)
+	if len(input) != cashoutEncodingLength {
+		return nil, fmt.Errorf("cashout encodes to %d bytes instead of %d", len(input), cashoutEncodingLength)
+	}
+	return input, nil
+}
+
+// cashoutSigHash hashes the cashout authorization using the prefix that would be added by eth_Sign
+func (cheque *ChequeParams) cashoutSigHash(sender common.Address, recipient common.Address, callerPayout *big.Int) ([]byte, error) {
+	input, err := cheque.encodeCashout(sender, recipient, callerPayout)
+	if err != nil {
+		return nil, err
+	}
+	return accounts.TextHash(crypto.Keccak256(input)), nil
+}
+
+// SignCashout signs the beneficiary's authorization for sender to cash the cheque to recipient with a payout of callerPayout to sender
+// the contract checks the signature against msg.sender, so it is only valid for the given sender
+func SignCashout(wallet WalletBackend, account accounts.Account, cheque *ChequeParams, sender common.Address, recipient common.Address, callerPayout *big.Int) ([]byte, error) {
+	input, err := cheque.encodeCashout(sender, recipient, callerPayout)
+	if err != nil {
+		return nil, err
+	}
+	// clef applies the eth_sign prefix to text/plain data itself, so it is given the unprefixed hash
+	return wallet.SignData(account, accounts.MimetypeTextPlain, crypto.Keccak256(input))
+}
+
+// VerifyCashout recovers the address which signed the cashout authorization in the personal-sign format
+func VerifyCashout(cheque *ChequeParams, sender common.Address, recipient common.Address, callerPayout *big.Int, sig []byte) (common.Address, error) {
+	hash, err := cheque.cashoutSigHash(sender, recipient, callerPayout)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return recoverSigner(hash, sig)
+}
+
+// VerifyCashChequeSignatures recovers the signers of both signatures of a cashCheque call
+// the cheque is valid for the contract if issuer is the chequebook owner and beneficiary is the cheque's beneficiary
+func VerifyCashChequeSignatures(cheque *ChequeParams, sender common.Address, recipient common.Address, callerPayout *big.Int, beneficiarySig []byte, ownerSig []byte) (issuer common.Address, beneficiary common.Address, err error) {
+	issuer, err = VerifyCheque(cheque, ownerSig)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	beneficiary, err = VerifyCashout(cheque, sender, recipient, callerPayout, beneficiarySig)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	return issuer, beneficiary, nil
+}
+
+// cashChequeData packs the call data for cashCheque
+func cashChequeData(recipient common.Address, cheque *ChequeParams, beneficiarySig []byte, callerPayout *big.Int, ownerSig []byte) ([]byte, error) {
+	abi, err := abi.JSON(strings.NewReader(simpleswapfactory.ERC20SimpleSwapABI))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cheque.validateCallerPayout(callerPayout); err != nil {
+		return nil, err
+	}
+
+	return abi.Pack("cashCheque", cheque.Beneficiary, recipient, cheque.CumulativePayout, beneficiarySig, callerPayout, ownerSig)
+}
+
+// CashChequeRequest builds the unsigned cashCheque transaction sent by caller on behalf of the cheque's beneficiary
+// the cheque is signed by the owner and the cashout by the beneficiary, so caller needs neither key and receives callerPayout
+// a nil callerPayout is treated as zero
+// the gas limit is estimated by the backend with gasBufferPercent added on top, gas price and nonce come from the node unless overridden
+func CashChequeRequest(ctx context.Context, backend EthBackend, caller common.Address, to common.Address, recipient common.Address, cheque *ChequeParams, beneficiarySig []byte, callerPayout *big.Int, ownerSig []byte, gasBufferPercent uint64, retryAttempts int, overrides TxOverrides) (*types.Transaction, error) {
+	if callerPayout == nil {
+		callerPayout = new(big.Int)
+	}
+
+	callData, err := cashChequeData(recipient, cheque, beneficiarySig, callerPayout, ownerSig)
+	if err != nil {
+		return nil, err
+	}
+
+	// the contract recovers the beneficiary signature over msg.sender, reject it before paying for a reverting transaction
+	beneficiary, err := VerifyCashout(cheque, caller, recipient, callerPayout, beneficiarySig)
+	if err != nil {
+		return nil, err
+	}
+	if beneficiary != cheque.Beneficiary {
+		return nil, fmt.Errorf("cashout for %s signed by %s instead of the beneficiary %s", caller.Hex(), beneficiary.Hex(), cheque.Beneficiary.Hex())
+	}
+
+	nonce, err := cashoutNonce(ctx, backend, caller, overrides, retryAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	return cashoutTx(ctx, backend, caller, nonce, to, callData, gasBufferPercent, overrides, retryAttempts)
+}
@@ -0,0 +1,187 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ChequeParams encapsulate all cheque parameters
+type ChequeParams struct {
+	Contract         common.Address // address of chequebook, needed to avoid cross-contract submission
+	Beneficiary      common.Address // address of the beneficiary, the contract which will redeem the cheque
+	CumulativePayout *big.Int       // cumulative amount of the cheque in currency
+}
+
+// validate checks that the cumulative payout can be represented as a uint256
+func (cheque *ChequeParams) validate() error {
+	if cheque.CumulativePayout == nil {
+		return errors.New("cheque has no cumulative payout")
+	}
+	if cheque.CumulativePayout.Sign() < 0 {
+		return errors.New("negative cumulative payout")
+	}
+	if cheque.CumulativePayout.BitLen() > 256 {
+		return errors.New("cumulative payout does not fit in 32 bytes")
+	}
+	return nil
+}
+
+// chequeEncodingLength is the length of the signature encoding of a cheque:
+// chequebook address (20 bytes) ++ beneficiary address (20 bytes) ++ cumulative payout as uint256 (32 bytes)
+const chequeEncodingLength = common.AddressLength + common.AddressLength + 32
+
+// encodeForSignature encodes the cheque params in the format used in the signing procedure
+// every signature depends on this exact layout, so any deviation from chequeEncodingLength is an error
+func (cheque *ChequeParams) encodeForSignature() ([]byte, error) {
+	if err := cheque.validate(); err != nil {
+		return nil, err
+	}
+
+	contractBytes := cheque.Contract.Bytes()
+	beneficiaryBytes := cheque.Beneficiary.Bytes()
+	if len(contractBytes) != common.AddressLength || len(beneficiaryBytes) != common.AddressLength {
+		return nil, errors.New("cheque address does not encode to 20 bytes")
+	}
+
+	// the payout is left-padded to 32 bytes in BigEndian because EVM uses BigEndian encoding
+	cumulativePayoutBytes := math.PaddedBigBytes(cheque.CumulativePayout, 32)
+	// construct the actual cheque
+	input := make([]byte, 0, chequeEncodingLength)
+	input = append(input, contractBytes...)
+	input = append(input, beneficiaryBytes...)
+	input = append(input, cumulativePayoutBytes...)
+	if len(input) != chequeEncodingLength {
+		return nil, fmt.Errorf("cheque encodes to %d bytes instead of %d", len(input), chequeEncodingLength)
+	}
+	return input, nil
+}
+
+// chequeID is the hash identifying a cheque, the keccak256 of its signature encoding
+func (cheque *ChequeParams) chequeID() (common.Hash, error) {
+	input, err := cheque.encodeForSignature()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(input), nil
+}
+
+// sigHash hashes the cheque params using the prefix that would be added by eth_Sign
+func (cheque *ChequeParams) sigHash() ([]byte, error) {
+	id, err := cheque.chequeID()
+	if err != nil {
+		return nil, err
+	}
+	input := id.Bytes()
+	withPrefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(input), input)
+	return crypto.Keccak256([]byte(withPrefix)), nil
+}
+
+// cashChequeBeneficiaryData packs the call data for cashChequeBeneficiary
+func cashChequeBeneficiaryData(recipient common.Address, cheque *ChequeParams, ownerSig []byte) ([]byte, error) {
+	abi, err := abi.JSON(strings.NewReader(simpleswapfactory.ERC20SimpleSwapABI))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cheque.validate(); err != nil {
+		return nil, err
+	}
+
+	return abi.Pack("cashChequeBeneficiary", recipient, cheque.CumulativePayout, ownerSig)
+}
+
+// fallbackGasLimit is the gas limit used for the cashout if the node cannot estimate it for a reason other than a revert
+const fallbackGasLimit = 1000000
+
+// DefaultGasBufferPercent is the default safety margin added on top of gas estimates
+const DefaultGasBufferPercent = 20
+
+// CashChequeBeneficiaryRequest builds the unsigned cashChequeBeneficiary transaction sent by caller
+// the contract pays out to msg.sender so caller has to be the cheque's beneficiary, the cheque itself is signed by the owner
+// the gas limit is estimated by the backend with gasBufferPercent added on top, gas price and nonce come from the node unless overridden
+// a cashout which would revert is not built, the error wraps ErrWouldRevert
+func CashChequeBeneficiaryRequest(ctx context.Context, backend EthBackend, caller common.Address, to common.Address, recipient common.Address, cheque *ChequeParams, ownerSig []byte, gasBufferPercent uint64, retryAttempts int, overrides TxOverrides) (*types.Transaction, error) {
+	callData, err := cashChequeBeneficiaryData(recipient, cheque, ownerSig)
+	if err != nil {
+		return nil, err
+	}
+
+	if caller != cheque.Beneficiary {
+		return nil, fmt.Errorf("cheque for %s cannot be cashed by %s", cheque.Beneficiary.Hex(), caller.Hex())
+	}
+
+	nonce, err := cashoutNonce(ctx, backend, caller, overrides, retryAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	return cashoutTx(ctx, backend, caller, nonce, to, callData, gasBufferPercent, overrides, retryAttempts)
+}
+
+// cashoutNonce returns the overridden nonce once it passed checkOverrides and the pending nonce of caller otherwise
+func cashoutNonce(ctx context.Context, backend EthBackend, caller common.Address, overrides TxOverrides, retryAttempts int) (uint64, error) {
+	if overrides.Nonce != nil {
+		if err := checkOverrides(ctx, backend, caller, overrides, retryAttempts); err != nil {
+			return 0, err
+		}
+		return *overrides.Nonce, nil
+	}
+
+	var nonce uint64
+	err := WithRetry(ctx, retryAttempts, func() (err error) {
+		nonce, err = backend.PendingNonceAt(ctx, caller)
+		return err
+	})
+	return nonce, err
+}
+
+// cashoutTx builds the unsigned cashout transaction sent by caller with the given call data and nonce
+// the gas price and gas cap are taken from overrides, a gas price above their cap is refused before anything is estimated
+func cashoutTx(ctx context.Context, backend EthBackend, caller common.Address, nonce uint64, to common.Address, callData []byte, gasBufferPercent uint64, overrides TxOverrides, retryAttempts int) (*types.Transaction, error) {
+	gasPrice, err := transactionGasPrice(ctx, backend, overrides, retryAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{
+		From: caller,
+		To:   &to,
+		Data: callData,
+	}
+
+	var gasLimit uint64
+	err = WithRetry(ctx, retryAttempts, func() (err error) {
+		gasLimit, err = backend.EstimateGas(ctx, msg)
+		return err
+	})
+	if err != nil {
+		// estimation fails for calls which always revert, sending those only burns gas
+		if reason, reverted := callRevertReason(ctx, backend, msg); reverted {
+			return nil, newWouldRevertError(reason)
+		}
+		log.Warn("gas estimation failed, using fallback gas limit", "gasLimit", fallbackGasLimit, "err", err)
+		gasLimit = fallbackGasLimit
+	} else {
+		if overrides.GasCap != 0 && gasLimit > overrides.GasCap {
+			return nil, fmt.Errorf("estimated gas %d exceeds the gas cap %d", gasLimit, overrides.GasCap)
+		}
+		gasLimit += gasLimit * gasBufferPercent / 100
+	}
+	if overrides.GasCap != 0 && gasLimit > overrides.GasCap {
+		gasLimit = overrides.GasCap
+	}
+
+	return types.NewTransaction(nonce, to, big.NewInt(0), gasLimit, gasPrice, callData), nil
+}
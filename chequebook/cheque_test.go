@@ -0,0 +1,1531 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// goldenCheque is a fixed cheque whose encoding and hashes are pinned below
+// changing any of these values invalidates every cheque signed so far
+var goldenCheque = &ChequeParams{
+	Contract:         common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3"),
+	Beneficiary:      common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB"),
+	CumulativePayout: big.NewInt(100),
+}
+
+const (
+	goldenEncoding = "5fbdb2315678afecb367f032d93f642f64180aa3" +
+		"ad4f6efc6594fe9305bf9a69bab8bd942adaecdb" +
+		"0000000000000000000000000000000000000000000000000000000000000064"
+	goldenChequeID = "b00b954e34ce378c6f0ff6d1d1fafe31365b4e8fa235992cc6080e9212c17f3e"
+	goldenSigHash  = "c928b857748e603036b55da63da3aaa2ee3a409abb443e64d97bf7d7a7d3b4da"
+)
+
+func TestEncodeForSignatureGolden(t *testing.T) {
+	encoding, err := goldenCheque.encodeForSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoding) != chequeEncodingLength {
+		t.Fatalf("encoding has length %d, expected %d", len(encoding), chequeEncodingLength)
+	}
+	if got := hex.EncodeToString(encoding); got != goldenEncoding {
+		t.Fatalf("encoding %s, expected %s", got, goldenEncoding)
+	}
+
+	id, err := goldenCheque.chequeID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(id.Bytes()); got != goldenChequeID {
+		t.Fatalf("cheque id %s, expected %s", got, goldenChequeID)
+	}
+
+	hash, err := goldenCheque.sigHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != goldenSigHash {
+		t.Fatalf("signature hash %s, expected %s", got, goldenSigHash)
+	}
+}
+
+// a payout of 2^128 + 1 spans both halves of its uint256 word, unlike any payout fitting an int64
+const (
+	largePayoutEncoding = "5fbdb2315678afecb367f032d93f642f64180aa3" +
+		"ad4f6efc6594fe9305bf9a69bab8bd942adaecdb" +
+		"0000000000000000000000000000000100000000000000000000000000000001"
+	largePayoutChequeID = "573d6ee26755d6f0eae433b1eb7d75816f318bf9d67f638c14f231b152e2e481"
+	largePayoutSigHash  = "2aa306566bc56a6916867c687a4cf3d17e12bb778dce15da238136886a16e634"
+	// signature of the key 4f3edf98...b23b1d of 0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1 as eth_sign returns it
+	largePayoutSignature = "15bc72bd3f7a2876cd5333508c36dc836d285367c536ee24b62cfdf2da3ba973" +
+		"23e90089a6f1bc0b343ac9183b9300770d841e37cdaba4884b3f6227444db0cd" + "1c"
+)
+
+func TestLargePayoutGolden(t *testing.T) {
+	payout, _ := new(big.Int).SetString("340282366920938463463374607431768211457", 10)
+	cheque := &ChequeParams{Contract: goldenCheque.Contract, Beneficiary: goldenCheque.Beneficiary, CumulativePayout: payout}
+
+	encoding, err := cheque.encodeForSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(encoding); got != largePayoutEncoding {
+		t.Fatalf("encoding %s, expected %s", got, largePayoutEncoding)
+	}
+	id, err := cheque.chequeID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(id.Bytes()); got != largePayoutChequeID {
+		t.Fatalf("cheque id %s, expected %s", got, largePayoutChequeID)
+	}
+	hash, err := cheque.sigHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != largePayoutSigHash {
+		t.Fatalf("signature hash %s, expected %s", got, largePayoutSigHash)
+	}
+
+	key, err := crypto.HexToECDSA("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewKeyWallet(key)
+	issuer := wallet.Accounts()[0]
+	if issuer.Address != common.HexToAddress("0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1") {
+		t.Fatalf("key belongs to %s", issuer.Address.Hex())
+	}
+	// signatures are deterministic, so the pinned one is what the key signs today
+	sig, err := SignCheque(wallet, issuer, cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(sig); got != largePayoutSignature {
+		t.Fatalf("signature %s, expected %s", got, largePayoutSignature)
+	}
+	pinned, _ := hex.DecodeString(largePayoutSignature)
+	if err := VerifyChequeIssuer(cheque, pinned, issuer.Address); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// EIP-712 hashes of goldenCheque on chain 1 as the Bee chequebooks verify them
+const (
+	goldenDomainSeparator = "6e9de3ff7db6cde9c21658f483281ba4eefb92aa1995df47741061001c21f224"
+	goldenTypedHash       = "d28a2a70ed4890ec7cf2ce1c3fa0891fe3b6df691007db6bdf883be2ef598d2a"
+	goldenTypedSignature  = "1b6ba2b2b1d3492d2e27c66bea85af4bdd119160884c8d2a44eeebb29f2f5478" +
+		"0cacf1cf860ef9e9390f8635124ad1fff048c8ac16bf201947ddcaaa5503565c" + "1b"
+)
+
+func TestTypedChequeGolden(t *testing.T) {
+	chainID := big.NewInt(1)
+	typedData := goldenCheque.typedData(chainID)
+	domain, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(domain); got != goldenDomainSeparator {
+		t.Fatalf("domain separator %s, expected %s", got, goldenDomainSeparator)
+	}
+	hash, err := goldenCheque.typedDataHash(chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != goldenTypedHash {
+		t.Fatalf("typed data hash %s, expected %s", got, goldenTypedHash)
+	}
+
+	key, err := crypto.HexToECDSA("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewKeyWallet(key)
+	issuer := wallet.Accounts()[0]
+	sig, err := SignCheque(wallet, issuer, goldenCheque, chainID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(sig); got != goldenTypedSignature {
+		t.Fatalf("typed signature %s, expected %s", got, goldenTypedSignature)
+	}
+	if signer, err := VerifyTypedCheque(goldenCheque, chainID, sig); err != nil || signer != issuer.Address {
+		t.Fatalf("typed signature recovered %s, %v", signer.Hex(), err)
+	}
+
+	// the signature does not carry over to another chain or another chequebook
+	if signer, err := VerifyTypedCheque(goldenCheque, big.NewInt(100), sig); err == nil && signer == issuer.Address {
+		t.Fatal("typed signature verified on another chain")
+	}
+	other := &ChequeParams{Contract: goldenCheque.Beneficiary, Beneficiary: goldenCheque.Beneficiary, CumulativePayout: goldenCheque.CumulativePayout}
+	if signer, err := VerifyTypedCheque(other, chainID, sig); err == nil && signer == issuer.Address {
+		t.Fatal("typed signature verified for another chequebook")
+	}
+}
+
+func TestEncodeForSignatureInvalidPayout(t *testing.T) {
+	for _, payout := range []*big.Int{
+		nil,
+		big.NewInt(-1),
+		new(big.Int).Lsh(big.NewInt(1), 256),
+	} {
+		cheque := &ChequeParams{
+			Contract:         goldenCheque.Contract,
+			Beneficiary:      goldenCheque.Beneficiary,
+			CumulativePayout: payout,
+		}
+		if _, err := cheque.encodeForSignature(); err == nil {
+			t.Fatalf("payout %v encoded without error", payout)
+		}
+	}
+}
+
+func TestSignerError(t *testing.T) {
+	if err := signerError(errors.New("Request denied")); !errors.Is(err, ErrSignerRejected) {
+		t.Fatalf("denied request not reported as ErrSignerRejected: %v", err)
+	}
+	if err := signerError(errors.New("connection refused")); errors.Is(err, ErrSignerRejected) {
+		t.Fatalf("connection error reported as rejection: %v", err)
+	}
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	// Error("SimpleSwap: invalid issuerSig") as encoded by solidity
+	data, err := hex.DecodeString("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000001d" +
+		"53696d706c65537761703a20696e76616c696420697373756572536967000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, ok := decodeRevertReason(data)
+	if !ok || reason != "SimpleSwap: invalid issuerSig" {
+		t.Fatalf("decoded %q, %v", reason, ok)
+	}
+
+	if _, ok := decodeRevertReason(data[4:]); ok {
+		t.Fatal("decoded revert data without the Error(string) selector")
+	}
+
+	revertErr := &RevertError{Reason: "execution reverted: " + reason}
+	revertErr.Err = simpleSwapError(revertErr.Reason)
+	if !errors.Is(revertErr, ErrInvalidIssuerSignature) || !errors.Is(revertErr, ErrChequeInvalidSignature) || !errors.Is(revertErr, ErrTxReverted) {
+		t.Fatalf("revert %q not matched as ErrInvalidIssuerSignature", revertErr.Reason)
+	}
+	if simpleSwapError("ERC20: transfer amount exceeds balance") != nil {
+		t.Fatal("matched a reason which is not a SimpleSwap one")
+	}
+}
+
+func TestSignedChequeEncoding(t *testing.T) {
+	signed := &SignedCheque{ChequeParams: *goldenCheque, Signature: make([]byte, 65)}
+	signed.Signature[64] = 27
+
+	data, err := signed.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SignedCheque
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Contract != signed.Contract || decoded.Beneficiary != signed.Beneficiary || decoded.CumulativePayout.Cmp(signed.CumulativePayout) != 0 || !bytes.Equal(decoded.Signature, signed.Signature) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, signed)
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error for a truncated cheque")
+	}
+
+	// the encoding does not check the signature, decoding refuses anything but 65 bytes
+	signed.Signature = signed.Signature[:64]
+	data, err = signed.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error for a short signature")
+	}
+}
+
+func TestParseGwei(t *testing.T) {
+	for value, expected := range map[string]int64{"1": 1000000000, "1.5": 1500000000, "0.000000001": 1} {
+		wei, err := ParseGwei(value)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		if wei.Cmp(big.NewInt(expected)) != 0 {
+			t.Fatalf("%s gwei parsed as %v wei, expected %d", value, wei, expected)
+		}
+	}
+
+	for _, value := range []string{"", "0", "-1", "0.0000000001", "abc"} {
+		if _, err := ParseGwei(value); err == nil {
+			t.Fatalf("invalid gwei amount %q accepted", value)
+		}
+	}
+}
+
+func TestChequeStore(t *testing.T) {
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cheque := func(payout int64) *SignedCheque {
+		return &SignedCheque{
+			ChequeParams: ChequeParams{
+				Contract:         goldenCheque.Contract,
+				Beneficiary:      goldenCheque.Beneficiary,
+				CumulativePayout: big.NewInt(payout),
+			},
+			Signature: make([]byte, 65),
+		}
+	}
+
+	if err := store.Put(cheque(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(cheque(100)); !errors.Is(err, ErrNonIncreasingPayout) {
+		t.Fatalf("expected ErrNonIncreasingPayout, got %v", err)
+	}
+	if err := store.Put(cheque(250)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkCashed(goldenCheque.Contract, goldenCheque.Beneficiary, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := store.Last(goldenCheque.Contract, goldenCheque.Beneficiary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.CumulativePayout.Cmp(big.NewInt(250)) != 0 {
+		t.Fatalf("last cheque %v, expected a payout of 250", last)
+	}
+
+	outstanding, err := store.Outstanding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outstanding) != 1 || outstanding[0].Amount.Cmp(big.NewInt(150)) != 0 {
+		t.Fatalf("outstanding %v, expected a single cheque with 150 left", outstanding)
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	for _, test := range []struct {
+		amount   int64
+		decimals uint8
+		expected string
+	}{
+		{1500, 3, "1.5"},
+		{5, 3, "0.005"},
+		{2000, 3, "2"},
+		{-1250, 2, "-12.5"},
+		{42, 0, "42"},
+	} {
+		if formatted := FormatUnits(big.NewInt(test.amount), test.decimals); formatted != test.expected {
+			t.Fatalf("%d with %d decimals formatted as %q, expected %q", test.amount, test.decimals, formatted, test.expected)
+		}
+	}
+}
+
+func TestDenomination(t *testing.T) {
+	bzz := Denomination{Symbol: "BZZ", Decimals: 16}
+	for _, test := range []struct {
+		value    string
+		expected string // base units, empty if parsing fails
+	}{
+		{"1.5 BZZ", "15000000000000000"},
+		{"1.5 bzz", "15000000000000000"},
+		{"0.0000000000000001 BZZ", "1"},
+		{"2.500 BZZ", "25000000000000000"},
+		{"50000", "50000"},
+		{"0.00000000000000001 BZZ", ""},
+		{"1.5", ""},
+		{"1.5 ETH", ""},
+		{"-1 BZZ", ""},
+		{"1. BZZ", ""},
+		{".5 BZZ", ""},
+		{"1e3 BZZ", ""},
+	} {
+		amount, err := bzz.Parse(test.value)
+		if test.expected == "" {
+			if err == nil {
+				t.Fatalf("parsed %q as %v", test.value, amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parsing %q: %v", test.value, err)
+		}
+		if amount.String() != test.expected {
+			t.Fatalf("parsed %q as %v, expected %s", test.value, amount, test.expected)
+		}
+		if parsed, err := bzz.Parse(bzz.Format(amount)); err != nil || parsed.Cmp(amount) != 0 {
+			t.Fatalf("%v formatted as %q does not parse back: %v", amount, bzz.Format(amount), err)
+		}
+	}
+
+	if _, err := bzz.Parse("0.00000000000000001 BZZ"); !errors.Is(err, ErrPrecisionLoss) {
+		t.Fatalf("expected ErrPrecisionLoss, got %v", err)
+	}
+	if formatted := bzz.Format(big.NewInt(15000000000000000)); formatted != "1.5 BZZ" {
+		t.Fatalf("formatted as %q", formatted)
+	}
+}
+
+// derSigner is a DigestSigner returning DER signatures with the high s value a KMS may return
+type derSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *derSigner) SignDigest(digest []byte) ([]byte, error) {
+	r, sv, err := ecdsa.Sign(rand.Reader, s.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	if sv.Cmp(secp256k1HalfN) <= 0 {
+		sv.Sub(crypto.S256().Params().N, sv)
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sv})
+}
+
+func TestRemoteKeyWallet(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewRemoteKeyWallet(&derSigner{key}, &key.PublicKey)
+	account := wallet.Accounts()[0]
+	if account.Address != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("account %s does not belong to the key", account.Address.Hex())
+	}
+
+	for i := 0; i < 4; i++ {
+		cheque := &ChequeParams{Contract: goldenCheque.Contract, Beneficiary: goldenCheque.Beneficiary, CumulativePayout: big.NewInt(int64(100 + i))}
+		sig, err := SignCheque(wallet, account, cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyChequeIssuer(cheque, sig, account.Address); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chainID := big.NewInt(5)
+	tx, err := wallet.SignTx(account, types.NewTransaction(0, goldenCheque.Beneficiary, big.NewInt(1), 21000, big.NewInt(1), nil), chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != account.Address {
+		t.Fatalf("transaction sent by %s, expected %s", sender.Hex(), account.Address.Hex())
+	}
+}
+
+// recordingSettlement records the settlements of an Accounting, failing them while fail is set
+type recordingSettlement struct {
+	paid   []*big.Int
+	resent []*SignedCheque
+	cashed []*SignedCheque
+	fail   bool
+}
+
+func (s *recordingSettlement) Pay(ctx context.Context, peer common.Address, amount *big.Int) error {
+	if s.fail {
+		return errors.New("settlement failed")
+	}
+	s.paid = append(s.paid, new(big.Int).Set(amount))
+	return nil
+}
+
+func (s *recordingSettlement) Resend(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+	if s.fail {
+		return errors.New("settlement failed")
+	}
+	s.resent = append(s.resent, cheque)
+	return nil
+}
+
+func (s *recordingSettlement) Cashout(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+	if s.fail {
+		return errors.New("settlement failed")
+	}
+	s.cashed = append(s.cashed, cheque)
+	return nil
+}
+
+func TestAccounting(t *testing.T) {
+	settlement := &recordingSettlement{}
+	accounting := NewAccounting(settlement, big.NewInt(100), big.NewInt(250))
+	peer := goldenCheque.Beneficiary
+	ctx := context.Background()
+
+	for _, amount := range []int64{60, 30} {
+		if err := accounting.Debit(ctx, peer, big.NewInt(amount)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(settlement.paid) != 0 {
+		t.Fatalf("paid %v below the payment threshold", settlement.paid)
+	}
+
+	// a failed payment keeps the debt for the next debit
+	settlement.fail = true
+	if err := accounting.Debit(ctx, peer, big.NewInt(20)); err == nil {
+		t.Fatal("expected the failed payment to be reported")
+	}
+	settlement.fail = false
+	if err := accounting.Debit(ctx, peer, big.NewInt(5)); err != nil {
+		t.Fatal(err)
+	}
+	if len(settlement.paid) != 1 || settlement.paid[0].Cmp(big.NewInt(115)) != 0 {
+		t.Fatalf("paid %v, expected the whole debt of 115", settlement.paid)
+	}
+	if balance := accounting.Balance(peer); balance.Balance.Sign() != 0 {
+		t.Fatalf("balance %v after paying, expected 0", balance.Balance)
+	}
+
+	if err := accounting.Debit(ctx, peer, nil); err == nil {
+		t.Fatal("expected an error for a nil debit")
+	}
+	if err := accounting.Credit(peer, nil); err == nil {
+		t.Fatal("expected an error for a nil credit")
+	}
+
+	if err := accounting.Credit(peer, big.NewInt(300)); err != nil {
+		t.Fatal(err)
+	}
+	cheque := func(payout int64) *SignedCheque {
+		return &SignedCheque{ChequeParams: ChequeParams{Contract: goldenCheque.Contract, Beneficiary: goldenCheque.Beneficiary, CumulativePayout: big.NewInt(payout)}}
+	}
+	if err := accounting.ReceiveCheque(ctx, peer, cheque(200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounting.ReceiveCheque(ctx, peer, cheque(200)); !errors.Is(err, ErrNonIncreasingPayout) {
+		t.Fatalf("expected ErrNonIncreasingPayout, got %v", err)
+	}
+	if err := accounting.ReceiveCheque(ctx, peer, cheque(300)); err != nil {
+		t.Fatal(err)
+	}
+	if len(settlement.cashed) != 1 || settlement.cashed[0].CumulativePayout.Cmp(big.NewInt(300)) != 0 {
+		t.Fatalf("cashed %d cheques, expected the one paying 300", len(settlement.cashed))
+	}
+
+	balance := accounting.Balance(peer)
+	if balance.Balance.Sign() != 0 || balance.Uncashed.Sign() != 0 {
+		t.Fatalf("balance %v and uncashed %v, expected both settled", balance.Balance, balance.Uncashed)
+	}
+}
+
+func TestMockWalletSignCheque(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	wallet := &MockWallet{Owned: []accounts.Account{owner}, Key: key}
+
+	sig, err := SignCheque(wallet, owner, goldenCheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallet.DataRequests) != 1 || wallet.DataRequests[0].Mimetype != accounts.MimetypeTextPlain {
+		t.Fatalf("wallet received %+v, expected a single text/plain request", wallet.DataRequests)
+	}
+	id, err := goldenCheque.chequeID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wallet.DataRequests[0].Data, id.Bytes()) {
+		t.Fatalf("wallet signed %x, expected the unprefixed cheque id %x", wallet.DataRequests[0].Data, id.Bytes())
+	}
+
+	// the contract recovers the issuer from the prefixed hash with the recovery id offset removed
+	hash, err := goldenCheque.sigHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoverable := common.CopyBytes(sig)
+	recoverable[crypto.RecoveryIDOffset] -= 27
+	pub, err := crypto.SigToPub(hash, recoverable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer := crypto.PubkeyToAddress(*pub); signer != owner.Address {
+		t.Fatalf("recovered signer %s, expected %s", signer.Hex(), owner.Address.Hex())
+	}
+
+	wallet.Err = ErrSignerRejected
+	if _, err := SignCheque(wallet, owner, goldenCheque, nil, false); !errors.Is(err, ErrSignerRejected) {
+		t.Fatalf("signing with a rejecting wallet returned %v", err)
+	}
+}
+
+func TestMockCashChequeBeneficiaryRequest(t *testing.T) {
+	backend := &MockBackend{
+		Gas:      100000,
+		GasPrice: big.NewInt(2),
+		Nonces:   map[common.Address]uint64{goldenCheque.Beneficiary: 7},
+	}
+	ownerSig := bytes.Repeat([]byte{1}, crypto.SignatureLength)
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	tx, err := CashChequeBeneficiaryRequest(context.Background(), backend, goldenCheque.Beneficiary, goldenCheque.Contract, recipient, goldenCheque, ownerSig, 20, 1, TxOverrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.To() == nil || *tx.To() != goldenCheque.Contract || tx.Nonce() != 7 || tx.Gas() != 120000 || tx.GasPrice().Cmp(big.NewInt(2)) != 0 || tx.Value().Sign() != 0 {
+		t.Fatalf("cashout to %v with nonce %d, gas %d and price %v", tx.To(), tx.Nonce(), tx.Gas(), tx.GasPrice())
+	}
+	for _, method := range []string{"PendingNonceAt", "SuggestGasPrice", "EstimateGas"} {
+		if backend.Called(method) != 1 {
+			t.Fatalf("%s called %d times, expected once", method, backend.Called(method))
+		}
+	}
+
+	// selector, recipient, payout, offset and length of the signature, then the signature padded to 96 bytes
+	data := tx.Data()
+	selector := crypto.Keccak256([]byte("cashChequeBeneficiary(address,uint256,bytes)"))[:4]
+	if len(data) != 4+5*32+64 || !bytes.Equal(data[:4], selector) {
+		t.Fatalf("call data %x does not call cashChequeBeneficiary", data)
+	}
+	if common.BytesToAddress(data[4:36]) != recipient || new(big.Int).SetBytes(data[36:68]).Cmp(goldenCheque.CumulativePayout) != 0 {
+		t.Fatalf("call data %x does not pass the recipient and cumulative payout", data)
+	}
+	if new(big.Int).SetBytes(data[68:100]).Uint64() != 96 || new(big.Int).SetBytes(data[100:132]).Uint64() != crypto.SignatureLength || !bytes.Equal(data[132:132+crypto.SignatureLength], ownerSig) {
+		t.Fatalf("call data %x does not carry the signature", data)
+	}
+
+	if _, err := CashChequeBeneficiaryRequest(context.Background(), backend, recipient, goldenCheque.Contract, recipient, goldenCheque, ownerSig, 20, 1, TxOverrides{}); err == nil {
+		t.Fatal("cashout built for a caller other than the beneficiary")
+	}
+	if len(backend.Sent) != 0 {
+		t.Fatalf("building requests sent %d transactions", len(backend.Sent))
+	}
+}
+
+func TestMockDeployment(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	wallet := &MockWallet{Owned: []accounts.Account{owner}, Key: key}
+	backend := &MockBackend{DeployedCode: []byte{0x60, 0x00}}
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	opts := NewWalletTransactor(wallet, owner, big.NewInt(1337))
+	opts.Context = ctx
+	if _, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetupFactory(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations); err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Token != crypto.CreateAddress(owner.Address, 0) || state.Factory != crypto.CreateAddress(owner.Address, 1) {
+		t.Fatalf("recorded token %s and factory %s, expected the creation addresses of the owner's first nonces", state.Token.Hex(), state.Factory.Hex())
+	}
+	if len(backend.Sent) != 2 || len(wallet.SignedTxs) != 2 {
+		t.Fatalf("sent %d and signed %d transactions, expected 2", len(backend.Sent), len(wallet.SignedTxs))
+	}
+	// the factory is deployed with the token as its constructor argument
+	factoryData := backend.Sent[1].Data()
+	if backend.Sent[1].To() != nil || common.BytesToAddress(factoryData[len(factoryData)-32:]) != state.Token {
+		t.Fatal("factory deployment is not a contract creation for the token")
+	}
+
+	// a second setup reuses both contracts
+	if _, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.Sent) != 2 {
+		t.Fatalf("setup with a recorded token sent %d transactions", len(backend.Sent)-2)
+	}
+}
+
+func TestENSNameHash(t *testing.T) {
+	for name, want := range map[string]string{
+		"":        "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"eth":     "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae",
+		"foo.eth": "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f",
+	} {
+		if got := ENSNameHash(name); got != common.HexToHash(want) {
+			t.Fatalf("namehash of %q is %s, expected %s", name, got.Hex(), want)
+		}
+	}
+	for value, want := range map[string]bool{
+		"alice.eth": true,
+		"0x00000000000000000000000000000000000000aa": false,
+		"http://localhost:8545":                      false,
+		"eth":                                        false,
+	} {
+		if IsENSName(value) != want {
+			t.Fatalf("IsENSName(%q) is %v", value, !want)
+		}
+	}
+}
+
+func TestENSResolver(t *testing.T) {
+	registry := common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	resolver := common.HexToAddress("0x00000000000000000000000000000000000000e2")
+	alice := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	mallory := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	reverseNode := func(address common.Address) common.Hash {
+		return ENSNameHash(strings.ToLower(address.Hex()[2:]) + ".addr.reverse")
+	}
+	addresses := map[common.Hash]common.Address{ENSNameHash("alice.eth"): alice}
+	// mallory claims alice's name in its reverse record
+	names := map[common.Hash]string{reverseNode(alice): "alice.eth", reverseNode(mallory): "alice.eth"}
+
+	selector := func(signature string) string { return string(crypto.Keccak256([]byte(signature))[:4]) }
+	word := func(address common.Address) []byte { return common.LeftPadBytes(address.Bytes(), 32) }
+	backend := &MockBackend{Call: func(call ethereum.CallMsg) ([]byte, error) {
+		node := common.BytesToHash(call.Data[4:36])
+		_, hasAddress := addresses[node]
+		_, hasName := names[node]
+		switch {
+		case *call.To == registry && string(call.Data[:4]) == selector("resolver(bytes32)"):
+			if hasAddress || hasName {
+				return word(resolver), nil
+			}
+			return word(common.Address{}), nil
+		case *call.To == resolver && string(call.Data[:4]) == selector("addr(bytes32)"):
+			return word(addresses[node]), nil
+		case *call.To == resolver && string(call.Data[:4]) == selector("name(bytes32)"):
+			name := names[node]
+			output := append(common.LeftPadBytes(big.NewInt(32).Bytes(), 32), common.LeftPadBytes(big.NewInt(int64(len(name))).Bytes(), 32)...)
+			return append(output, common.RightPadBytes([]byte(name), (len(name)+31)/32*32)...), nil
+		}
+		return nil, nil
+	}}
+	ens, err := NewENSResolver(backend, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	address, err := ens.Resolve(ctx, "Alice.eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != alice {
+		t.Fatalf("alice.eth resolved to %s", address.Hex())
+	}
+	calls := backend.Called("CallContract")
+	if _, err := ens.Resolve(ctx, "alice.eth"); err != nil || backend.Called("CallContract") != calls {
+		t.Fatalf("second lookup of alice.eth failed with %v or was not cached", err)
+	}
+	if _, err := ens.Resolve(ctx, "bob.eth"); !errors.Is(err, ErrENSNameNotFound) {
+		t.Fatalf("name without a resolver resolved with %v", err)
+	}
+
+	name, err := ens.Reverse(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice.eth" {
+		t.Fatalf("alice reverse resolved to %q", name)
+	}
+	if _, err := ens.Reverse(ctx, mallory); !errors.Is(err, ErrENSNameNotFound) {
+		t.Fatalf("reverse record not matching its forward record accepted with %v", err)
+	}
+	calls = backend.Called("CallContract")
+	if _, err := ens.Reverse(ctx, mallory); !errors.Is(err, ErrENSNameNotFound) || backend.Called("CallContract") != calls {
+		t.Fatalf("failed reverse lookup was not cached, got %v", err)
+	}
+
+	// a chain without the registry has no code answering the calls
+	missing, err := NewENSResolver(&MockBackend{}, common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Resolve(ctx, "alice.eth"); !errors.Is(err, ErrENSNameNotFound) {
+		t.Fatalf("name resolved without a registry with %v", err)
+	}
+}
+
+func TestRecipientConsent(t *testing.T) {
+	beneficiary := goldenCheque.Beneficiary
+	trusted := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	stranger := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	policy := &RecipientPolicy{Beneficiaries: map[common.Address][]common.Address{beneficiary: {trusted}}}
+	if !policy.Allows(beneficiary, beneficiary) || !policy.Allows(beneficiary, trusted) || policy.Allows(beneficiary, stranger) || policy.Allows(stranger, trusted) {
+		t.Fatal("policy allows the wrong recipients")
+	}
+
+	var asked []common.Address
+	fallback := func(ctx context.Context, cheque *ChequeParams, recipient common.Address) error {
+		asked = append(asked, recipient)
+		return errors.New("declined")
+	}
+	backend := &MockBackend{}
+	book, err := NewChequebook(goldenCheque.Contract, backend, &MockWallet{Owned: []accounts.Account{{Address: beneficiary}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.RecipientConsent = policy.Consent(fallback)
+
+	ctx := context.Background()
+	if _, err := book.CashCheque(ctx, goldenCheque, stranger, nil); !errors.Is(err, ErrRecipientNotApproved) {
+		t.Fatalf("cashout to a declined recipient failed with %v", err)
+	}
+	if len(asked) != 1 || asked[0] != stranger || backend.Called("CallContract") != 0 {
+		t.Fatalf("asked for %v and called the chequebook %d times", asked, backend.Called("CallContract"))
+	}
+	// the trusted recipient and the beneficiary itself get past the consent to the paid out check
+	for _, recipient := range []common.Address{trusted, beneficiary} {
+		if _, err := book.CashCheque(ctx, goldenCheque, recipient, nil); errors.Is(err, ErrRecipientNotApproved) {
+			t.Fatalf("cashout to %s was not approved", recipient.Hex())
+		}
+	}
+	if len(asked) != 1 {
+		t.Fatalf("asked again for approved recipients %v", asked[1:])
+	}
+
+	if err := policy.Consent(nil)(ctx, goldenCheque, stranger); !errors.Is(err, ErrRecipientNotApproved) {
+		t.Fatalf("policy without a fallback let %s through with %v", stranger.Hex(), err)
+	}
+}
+
+func TestGenerateClefRules(t *testing.T) {
+	other := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	opts := ClefRulesOptions{
+		ChainID:      big.NewInt(12345),
+		Chequebooks:  []common.Address{goldenCheque.Contract, other, goldenCheque.Contract},
+		MaxIncrement: big.NewInt(1000),
+		Issued: []*SignedCheque{
+			{ChequeParams: *goldenCheque},
+			{ChequeParams: ChequeParams{Contract: common.HexToAddress("0x00000000000000000000000000000000000000c2"), Beneficiary: goldenCheque.Beneficiary, CumulativePayout: big.NewInt(5)}},
+		},
+	}
+	rules, err := GenerateClefRules(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(rules)
+	chequebook := strings.ToLower(goldenCheque.Contract.Hex())
+	for _, want := range []string{
+		`var chainId = "12345"`,
+		`var maxIncrement = new BigNumber("1000")`,
+		`var approveTxs = false`,
+		`"` + chequebook + `": true,`,
+		`"` + strings.ToLower(other.Hex()) + `": true`,
+		`"` + chequebook + ":" + strings.ToLower(goldenCheque.Beneficiary.Hex()) + `": "` + goldenCheque.CumulativePayout.String() + `"`,
+		"function ApproveSignData(req)",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("rules lack %s:\n%s", want, script)
+		}
+	}
+	if strings.Count(script, chequebook+`": true`) != 1 || strings.Contains(script, "00000000000000000000000000000000000000c2") {
+		t.Fatalf("rules list duplicate or unknown chequebooks:\n%s", script)
+	}
+
+	sum := sha256.Sum256(rules)
+	if ClefRulesHash(rules) != hex.EncodeToString(sum[:]) {
+		t.Fatal("rules hash is not the sha256 clef attests")
+	}
+
+	opts.MaxIncrement = nil
+	if _, err := GenerateClefRules(opts); err == nil {
+		t.Fatal("rules generated without an amount cap")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	audit, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &MockWallet{Owned: []accounts.Account{owner}, Key: key}
+	wallet := NewAuditedWallet(mock, audit)
+	backend := NewAuditedBackend(&MockBackend{}, audit)
+
+	if _, err := SignCheque(wallet, owner, goldenCheque, big.NewInt(1337), false); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := wallet.SignTx(owner, types.NewTransaction(0, goldenCheque.Beneficiary, big.NewInt(1), 21000, big.NewInt(1), nil), big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	entries, head := audit.Head()
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a request and a result each for the cheque, the transaction and its broadcast
+	if verified, verifiedHead, err := VerifyAuditLog(path); err != nil || verified != 6 || entries != 6 || verifiedHead != head {
+		t.Fatalf("verified %d of %d entries up to %s instead of %s: %v", verified, entries, verifiedHead.Hex(), head.Hex(), err)
+	}
+
+	// reopening continues the chain
+	audit, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Record("note", "request", map[string]string{"reason": "test"}); err != nil {
+		t.Fatal(err)
+	}
+	audit.Close()
+	if verified, _, err := VerifyAuditLog(path); err != nil || verified != 7 {
+		t.Fatalf("verified %d entries after reopening: %v", verified, err)
+	}
+
+	// a closed log refuses the request instead of signing unrecorded
+	requests := len(mock.DataRequests)
+	if _, err := wallet.SignData(owner, accounts.MimetypeTextPlain, []byte("unrecorded")); err == nil || len(mock.DataRequests) != requests {
+		t.Fatalf("signed without an audit record: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(data, []byte(`"kind":"sign-tx"`), []byte(`"kind":"sign-tz"`), 1)
+	if err := ioutil.WriteFile(path, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if verified, _, err := VerifyAuditLog(path); !errors.Is(err, ErrAuditLogTampered) || verified != 2 {
+		t.Fatalf("tampered entry verified up to %d: %v", verified, err)
+	}
+	if _, err := OpenAuditLog(path); !errors.Is(err, ErrAuditLogTampered) {
+		t.Fatalf("opened a tampered log: %v", err)
+	}
+
+	// dropping an entry breaks the chain as well
+	lines := bytes.Split(data, []byte("\n"))
+	dropped := bytes.Join(append(append([][]byte{}, lines[:1]...), lines[2:]...), []byte("\n"))
+	if err := ioutil.WriteFile(path, dropped, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyAuditLog(path); !errors.Is(err, ErrAuditLogTampered) {
+		t.Fatalf("log with a dropped entry verified: %v", err)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	secret := []byte("webhook secret")
+	var mu sync.Mutex
+	var events []*WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if !VerifyWebhook(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("event %s posted with signature %q not matching its body", body, r.Header.Get(WebhookSignatureHeader))
+		}
+		event := new(WebhookEvent)
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(WebhookEventHeader) != event.Kind {
+			t.Errorf("event header %q, expected %q", r.Header.Get(WebhookEventHeader), event.Kind)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var none *Notifier
+	none.cashout(goldenCheque.Contract, &CashResult{})
+
+	notifier := NewNotifier([]string{server.URL}, secret)
+	cheque := &SignedCheque{ChequeParams: *goldenCheque}
+	notifier.issued(cheque, big.NewInt(100))
+	notifier.cashout(goldenCheque.Contract, &CashResult{TxHash: common.HexToHash("0x01"), Cashout: &CashoutResult{
+		Beneficiary:      goldenCheque.Beneficiary,
+		Recipient:        goldenCheque.Beneficiary,
+		TotalPayout:      big.NewInt(40),
+		CumulativePayout: goldenCheque.CumulativePayout,
+		Bounced:          true,
+	}})
+	if err := notifier.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("%d events posted, expected 2", len(events))
+	}
+	kinds := map[string]*WebhookEvent{}
+	for _, event := range events {
+		kinds[event.Kind] = event
+	}
+	if issued := kinds[EventChequeIssued]; issued == nil || issued.Amount != "100" || *issued.Beneficiary != goldenCheque.Beneficiary {
+		t.Fatalf("issued event %+v, expected 100 to %s", issued, goldenCheque.Beneficiary.Hex())
+	}
+	if bounced := kinds[EventChequeBounced]; bounced == nil || bounced.Amount != "40" {
+		t.Fatalf("bounced event %+v, expected a partial payout of 40", bounced)
+	}
+	if VerifyWebhook([]byte("other secret"), []byte("{}"), SignWebhook(secret, []byte("{}"))) {
+		t.Fatal("signature verified with another secret")
+	}
+}
+
+func TestChequeExpiry(t *testing.T) {
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	cheque := &SignedCheque{ChequeParams: *goldenCheque, Signature: make([]byte, 65), IssuedAt: issuedAt, Expires: issuedAt.Add(time.Hour)}
+
+	data, err := json.Marshal(cheque)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(SignedCheque)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IssuedAt.Equal(cheque.IssuedAt) || !decoded.Expires.Equal(cheque.Expires) {
+		t.Fatalf("json window %v to %v, expected %v to %v", decoded.IssuedAt, decoded.Expires, cheque.IssuedAt, cheque.Expires)
+	}
+	binary, err := cheque.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = new(SignedCheque)
+	if err := decoded.UnmarshalBinary(binary); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IssuedAt.Equal(cheque.IssuedAt) || !decoded.Expires.Equal(cheque.Expires) {
+		t.Fatalf("binary window %v to %v, expected %v to %v", decoded.IssuedAt, decoded.Expires, cheque.IssuedAt, cheque.Expires)
+	}
+	if cheque.Expired(issuedAt) || !cheque.Expired(cheque.Expires) {
+		t.Fatal("expected the cheque to be valid until it expires")
+	}
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	expired := *cheque
+	expired.Expires = time.Now().Add(-time.Minute)
+	if err := store.Put(&expired); !errors.Is(err, ErrChequeExpired) {
+		t.Fatalf("expected ErrChequeExpired, got %v", err)
+	}
+	if err := store.Put(cheque); err != nil {
+		t.Fatal(err)
+	}
+	// the same payout is only taken again with a longer validity window
+	if err := store.Put(cheque); !errors.Is(err, ErrNonIncreasingPayout) {
+		t.Fatalf("expected ErrNonIncreasingPayout, got %v", err)
+	}
+	renewed := *cheque
+	renewed.Expires = cheque.Expires.Add(time.Hour)
+	if err := store.Put(&renewed); err != nil {
+		t.Fatal(err)
+	}
+	last, err := store.Last(cheque.Contract, cheque.Beneficiary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Expires.Equal(renewed.Expires) || last.CumulativePayout.Cmp(cheque.CumulativePayout) != 0 {
+		t.Fatalf("stored cheque expires %v for %v, expected the renewal", last.Expires, last.CumulativePayout)
+	}
+}
+
+func TestNetworkProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "networks.json")
+	if err := ioutil.WriteFile(path, []byte(`{"1337": {"name": "Local", "rpc": "http://localhost:7545", "gasPrice": "2", "confirmations": 2}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	networks, err := LoadNetworks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID, network, ok := networks.ByName("local")
+	if !ok || chainID.Uint64() != 1337 || network.RPC != "http://localhost:7545" || *network.Confirmations != 2 {
+		t.Fatalf("unexpected profile %v on chain %v", network, chainID)
+	}
+	if _, _, ok := networks.ByName("sepolia"); !ok {
+		t.Fatal("expected the bundled profiles to remain")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"1337": {"name": "Sepolia"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNetworks(path); err == nil {
+		t.Fatal("expected a name used by two chains to be refused")
+	}
+
+	cheque := &SignedCheque{ChequeParams: *goldenCheque, Signature: make([]byte, 65), ChainID: big.NewInt(100)}
+	data, err := json.Marshal(cheque)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(SignedCheque)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ChainID == nil || decoded.ChainID.Cmp(cheque.ChainID) != 0 {
+		t.Fatalf("json chain id %v, expected %v", decoded.ChainID, cheque.ChainID)
+	}
+	binary, err := cheque.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = new(SignedCheque)
+	if err := decoded.UnmarshalBinary(binary); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ChainID == nil || decoded.ChainID.Cmp(cheque.ChainID) != 0 {
+		t.Fatalf("binary chain id %v, expected %v", decoded.ChainID, cheque.ChainID)
+	}
+
+	if err := checkChain("cheque", cheque.ChainID, big.NewInt(11155111)); !errors.Is(err, ErrChainMismatch) {
+		t.Fatalf("expected ErrChainMismatch, got %v", err)
+	}
+	if err := checkChain("cheque", nil, big.NewInt(11155111)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file of a single state is taken as the chain's and keeps the state of another chain apart once converted
+	path := filepath.Join(dir, "state.json")
+	legacy, err := LoadDeploymentState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Token = common.HexToAddress("0x01")
+	if err := legacy.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err := LoadNetworkState(path, big.NewInt(12345))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Token != legacy.Token {
+		t.Fatalf("token %s, expected the token of the single state", dev.Token.Hex())
+	}
+	dev.Factory, dev.FactoryBlock = common.HexToAddress("0x02"), 7
+	if err := dev.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	gnosis, err := LoadNetworkState(path, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (gnosis.Token != common.Address{}) {
+		t.Fatalf("chain 100 got the token %s of chain 12345", gnosis.Token.Hex())
+	}
+	gnosis.Token = common.HexToAddress("0x03")
+	if err := gnosis.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadNetworkState(path, big.NewInt(12345))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Token != dev.Token || reloaded.Factory != dev.Factory || reloaded.FactoryBlock != 7 {
+		t.Fatalf("reloaded state %+v, expected %+v", reloaded, dev)
+	}
+}
+
+// feeHistoryService serves eth_feeHistory with a base fee of 10 gwei for the next block and tips of 1, 2 and 9 gwei
+type feeHistoryService struct{}
+
+func (feeHistoryService) FeeHistory(blocks hexutil.Uint64, newest string, percentiles []float64) (map[string]interface{}, error) {
+	tip := func(n int64) []*hexutil.Big { return []*hexutil.Big{(*hexutil.Big)(big.NewInt(n * params.GWei))} }
+	return map[string]interface{}{
+		"baseFeePerGas": []*hexutil.Big{(*hexutil.Big)(big.NewInt(8 * params.GWei)), (*hexutil.Big)(big.NewInt(10 * params.GWei))},
+		"reward":        [][]*hexutil.Big{tip(9), tip(1), tip(2)},
+	}, nil
+}
+
+func TestGasPricing(t *testing.T) {
+	ctx := context.Background()
+	backend := &MockBackend{GasPrice: big.NewInt(20 * params.GWei)}
+
+	price, err := (&SuggestedGasPrice{Percent: 150}).GasPrice(ctx, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Cmp(big.NewInt(30*params.GWei)) != 0 {
+		t.Fatalf("scaled suggestion %v, expected 30 gwei", price)
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", feeHistoryService{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	price, err = (&FeeHistoryGasPrice{Client: rpc.DialInProc(server), Percentile: 50}).GasPrice(ctx, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Cmp(big.NewInt(12*params.GWei)) != 0 {
+		t.Fatalf("fee history price %v, expected the next base fee plus the median tip of 12 gwei", price)
+	}
+
+	oracle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"slow": 1, "fast": "2.5"}`))
+	}))
+	defer oracle.Close()
+	price, err = (&OracleGasPrice{URL: oracle.URL, Field: "fast"}).GasPrice(ctx, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Cmp(big.NewInt(2500000000)) != 0 {
+		t.Fatalf("oracle price %v, expected 2.5 gwei", price)
+	}
+
+	// a cap below the price of the strategy stops the cashout before it is built
+	overrides := TxOverrides{GasPricer: &FixedGasPrice{Price: big.NewInt(50 * params.GWei)}, MaxFee: big.NewInt(40 * params.GWei)}
+	_, err = cashoutTx(ctx, backend, common.Address{1}, 0, common.Address{2}, nil, DefaultGasBufferPercent, overrides, 1)
+	var capErr *GasPriceCapError
+	if !errors.As(err, &capErr) || !errors.Is(err, ErrGasPriceAboveCap) || capErr.Price.Cmp(big.NewInt(50*params.GWei)) != 0 {
+		t.Fatalf("expected a *GasPriceCapError for 50 gwei, got %v", err)
+	}
+	overrides.MaxFee = big.NewInt(50 * params.GWei)
+	tx, err := cashoutTx(ctx, backend, common.Address{1}, 0, common.Address{2}, nil, DefaultGasBufferPercent, overrides, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.GasPrice().Cmp(big.NewInt(50*params.GWei)) != 0 {
+		t.Fatalf("cashout priced at %v, expected the fixed 50 gwei", tx.GasPrice())
+	}
+}
+
+// fixedDERSigner is a DigestSigner answering with the same DER signature for every digest
+type fixedDERSigner struct {
+	der []byte
+}
+
+func (s *fixedDERSigner) SignDigest(digest []byte) ([]byte, error) {
+	return s.der, nil
+}
+
+func TestRemoteSignatureDER(t *testing.T) {
+	key, err := crypto.HexToECDSA("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := hex.DecodeString("2c291d1e5bdcad6e07056bcbdbcdc57f12ae660d133a36fc83e26a9badef4a21")
+	expected, _ := hex.DecodeString("5defd1ca38bea96c6936f3ae654ae6d9e1265e911c097923e6de274504209b4d" + "0331c649de2a5910ed8fa3a8ebc60b2236602a4eaae4c10ba1d7373097e37d75" + "01")
+
+	// the same signature with the low s value and with the high s value n-s a KMS may return
+	for _, encoded := range []string{
+		"304402205defd1ca38bea96c6936f3ae654ae6d9e1265e911c097923e6de274504209b4d02200331c649de2a5910ed8fa3a8ebc60b2236602a4eaae4c10ba1d7373097e37d75",
+		"304502205defd1ca38bea96c6936f3ae654ae6d9e1265e911c097923e6de274504209b4d022100fcce39b621d5a6ef12705c571439f4dc844eb2980463df301dfb275c3852c3cc",
+	} {
+		der, _ := hex.DecodeString(encoded)
+		wallet := NewRemoteKeyWallet(&fixedDERSigner{der}, &key.PublicKey)
+		sig, err := wallet.sign(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, expected) {
+			t.Fatalf("signature %x, expected %x", sig, expected)
+		}
+	}
+
+	// a signature of another key is refused instead of being sent with the wrong recovery id
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := hex.DecodeString("304402205defd1ca38bea96c6936f3ae654ae6d9e1265e911c097923e6de274504209b4d02200331c649de2a5910ed8fa3a8ebc60b2236602a4eaae4c10ba1d7373097e37d75")
+	if _, err := NewRemoteKeyWallet(&fixedDERSigner{der}, &other.PublicKey).sign(hash); err == nil {
+		t.Fatal("expected the signature of another key to be refused")
+	}
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve, err := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 132, 0, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := crypto.FromECDSAPub(&key.PublicKey)
+	spki, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}, Parameters: asn1.RawValue{FullBytes: curve}},
+		asn1.BitString{Bytes: public, BitLength: 8 * len(public)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20260101/eu-central-1/kms/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=") {
+			http.Error(w, "unsigned request "+auth, http.StatusForbidden)
+			return
+		}
+		var request map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request["KeyId"] != "alias/swap" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string]interface{}{"KeySpec": "ECC_SECG_P256K1", "PublicKey": spki})
+		case "TrentService.Sign":
+			digest, _ := base64.StdEncoding.DecodeString(request["Message"])
+			signature, err := (&derSigner{key}).SignDigest(digest)
+			if err != nil || request["MessageType"] != "DIGEST" {
+				http.Error(w, "cannot sign", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"Signature": signature})
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+	}))
+	defer kms.Close()
+
+	signer := &AWSKMSSigner{
+		KeyID:           "alias/swap",
+		Region:          "eu-central-1",
+		Endpoint:        kms.URL,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		now:             func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) },
+	}
+	wallet, err := NewAWSKMSWallet(context.Background(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := wallet.Accounts()[0]
+	if account.Address != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("kms account %s does not belong to the key", account.Address.Hex())
+	}
+	sig, err := SignCheque(wallet, account, goldenCheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChequeIssuer(goldenCheque, sig, account.Address); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// merkleCheques returns n cheques of goldenCheque paying out 100, 200, ... as the leaves of the merkle golden tests
+func merkleCheques(n int) []*SignedCheque {
+	cheques := make([]*SignedCheque, n)
+	for i := range cheques {
+		cheques[i] = &SignedCheque{ChequeParams: ChequeParams{
+			Contract:         goldenCheque.Contract,
+			Beneficiary:      goldenCheque.Beneficiary,
+			CumulativePayout: big.NewInt(int64(100 * (i + 1))),
+		}}
+	}
+	return cheques
+}
+
+func TestMerkleRootGolden(t *testing.T) {
+	// roots as computed by sorted pair keccak256 trees such as OpenZeppelin's MerkleProof verifies them
+	for _, test := range []struct {
+		leaves int
+		root   string
+	}{
+		{1, goldenChequeID},
+		{2, "5c343da161b56b7eef8091eb73646689632c68c3e3193a751b45b34806dc3622"},
+		{3, "8fbae9f128a4c38e098d77247d5c4006e6cdda1f46c44886d69bf4a5f2d159e0"},
+		{5, "2073d07c52c86e62977c2b80d606c62312557a7d2017feeeecffc2e452638168"},
+	} {
+		cheques := merkleCheques(test.leaves)
+		root, proofs, err := MerkleRoot(cheques)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(root.Bytes()) != test.root {
+			t.Fatalf("root of %d cheques is %x, expected %s", test.leaves, root, test.root)
+		}
+		if len(proofs) != test.leaves {
+			t.Fatalf("got %d proofs for %d cheques", len(proofs), test.leaves)
+		}
+		for i, cheque := range cheques {
+			if !VerifyMerkleProof(root, cheque, proofs[i]) {
+				t.Fatalf("proof of cheque %d of %d does not verify", i, test.leaves)
+			}
+		}
+	}
+
+	// a single cheque is its own root and needs no proof
+	_, proofs, err := MerkleRoot(merkleCheques(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs[0]) != 0 {
+		t.Fatalf("single cheque has a proof of %d bytes", len(proofs[0]))
+	}
+}
+
+func TestMerkleProofGolden(t *testing.T) {
+	cheques := merkleCheques(5)
+	root, proofs, err := MerkleRoot(cheques)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first leaf climbs past its neighbour, the pair of the third and fourth leaf and the promoted fifth leaf
+	first := "e91f1317591b367ecfbc41fad9d04772e910a8941e0114911dc519f6d51850a3" +
+		"dc98730e2e239e35784e66aafe93b561c8afad004b3cfb403e8960bc32fdb5d6" +
+		"86e6c5b4a575530b614d1a0581e549d3b32839fc23ad708716fa5712c86cad18"
+	if hex.EncodeToString(proofs[0]) != first {
+		t.Fatalf("proof of the first cheque is %x, expected %s", proofs[0], first)
+	}
+	// the unpaired fifth leaf is promoted twice and only meets the root of the first four
+	last := "5b314134f7d6e74770f3c3a1698a88cb9e170ac5bd8ae6d10d65f526e5efc9cd"
+	if hex.EncodeToString(proofs[4]) != last {
+		t.Fatalf("proof of the last cheque is %x, expected %s", proofs[4], last)
+	}
+
+	if VerifyMerkleProof(root, cheques[1], proofs[0]) {
+		t.Fatal("proof of the first cheque verified another cheque")
+	}
+	if VerifyMerkleProof(root, cheques[0], proofs[0][:40]) {
+		t.Fatal("truncated proof verified")
+	}
+	if VerifyMerkleProof(root, nil, proofs[0]) {
+		t.Fatal("nil cheque verified")
+	}
+	if _, _, err := MerkleRoot(nil); err == nil {
+		t.Fatal("expected an error for no cheques")
+	}
+	if _, _, err := MerkleRoot([]*SignedCheque{cheques[0], nil}); err == nil {
+		t.Fatal("expected an error for a nil cheque")
+	}
+}
+
+func TestIncrementsRoundTrip(t *testing.T) {
+	increments := []*big.Int{big.NewInt(100), big.NewInt(0), big.NewInt(250), new(big.Int).Lsh(big.NewInt(1), 200)}
+	cumulative, err := CumulativeFromIncrements(increments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*big.Int{big.NewInt(100), big.NewInt(100), big.NewInt(350), new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 200), big.NewInt(350))}
+	for i := range expected {
+		if cumulative[i].Cmp(expected[i]) != 0 {
+			t.Fatalf("cumulative payout %d is %v, expected %v", i, cumulative[i], expected[i])
+		}
+	}
+	if err := ValidateCumulative(cumulative); err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, err := IncrementsFromCumulative(cumulative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, increment := range roundTrip {
+		if increment.Cmp(increments[i]) != 0 {
+			t.Fatalf("increment %d is %v after the round trip, expected %v", i, increment, increments[i])
+		}
+	}
+
+	// the cheque for the increments pays the same as the cumulative payout
+	cheque, err := ChequeForIncrement(goldenCheque, increments, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cheque.CumulativePayout.Cmp(new(big.Int).Add(goldenCheque.CumulativePayout, cumulative[2])) != 0 {
+		t.Fatalf("cheque for 3 increments pays %v", cheque.CumulativePayout)
+	}
+}
+
+func TestIncrementsRejected(t *testing.T) {
+	if _, err := CumulativeFromIncrements([]*big.Int{big.NewInt(1), big.NewInt(-1)}); err == nil {
+		t.Fatal("expected an error for a negative increment")
+	}
+	if _, err := CumulativeFromIncrements([]*big.Int{big.NewInt(1), nil}); err == nil {
+		t.Fatal("expected an error for a missing increment")
+	}
+	if _, err := ChequeForIncrement(goldenCheque, []*big.Int{nil}, 1); err == nil {
+		t.Fatal("expected an error for a cheque over a missing increment")
+	}
+
+	if err := ValidateCumulative([]*big.Int{big.NewInt(1), nil}); err == nil {
+		t.Fatal("expected an error for a missing cumulative payout")
+	}
+	if err := ValidateCumulative([]*big.Int{big.NewInt(5), big.NewInt(4)}); err == nil {
+		t.Fatal("expected an error for a decreasing cumulative payout")
+	}
+	if err := ValidateCumulative([]*big.Int{big.NewInt(-1)}); err == nil {
+		t.Fatal("expected an error for a negative cumulative payout")
+	}
+	if _, err := IncrementsFromCumulative([]*big.Int{big.NewInt(5), big.NewInt(4)}); err == nil {
+		t.Fatal("expected an error for the increments of a decreasing cumulative payout")
+	}
+	if _, err := IncrementsFromCumulative([]*big.Int{nil}); err == nil {
+		t.Fatal("expected an error for the increments of a missing cumulative payout")
+	}
+}
@@ -0,0 +1,424 @@
+// Package chequebook deploys, funds and cashes SimpleSwap chequebooks of the v0.2.3 swap contracts and of the later releases used by Bee
+// and issues and verifies the cheques drawn on them
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// Chequebook is a deployed ERC20SimpleSwap together with the backend and wallet used to interact with it
+type Chequebook struct {
+	address  common.Address
+	instance *simpleswapfactory.ERC20SimpleSwap
+	backend  EthBackend
+	wallet   WalletBackend
+
+	GasBufferPercent uint64           // safety margin added on top of gas estimates in percent
+	MaxGasCostUSD    *big.Float       // maximum gas cost of a cashout in USD, nil disables the check
+	USDOracle        USDOracle        // oracle used to convert gas into USD for MaxGasCostUSD
+	TokenPrice       TokenPriceSource // converts gas costs into token units for EstimateCashoutCost, nil reports them in wei only
+	WaitTimeout      time.Duration    // maximum time to wait for a transaction to be mined
+	Confirmations    uint64           // blocks a cashout, deposit or withdrawal has to be buried under, counting its own block
+	RetryAttempts    int              // attempts for rpc calls failing with a transient error
+	Overrides        TxOverrides      // gas price and nonce of the cashout replacing the node's values
+	BumpTimeout      time.Duration    // pending time after which the cashout is resent with a higher gas price, 0 never resends
+	MaxGasPrice      *big.Int         // gas price resending the cashout never exceeds, nil leaves it unlimited
+	Simulate         bool             // CashCheque first runs SimulateCashCheque and does not send a cashout which would revert
+	MinCashout       *big.Int         // smallest uncashed amount a cashout is sent for, nil only refuses cheques paying nothing new
+	Metrics          *Metrics         // records issued and cashed cheques and pending transactions, nil records nothing
+	Version          ContractVersion  // release the chequebook was deployed from, nil is v0.2.3, OpenChequebook detects it
+	RecipientConsent RecipientConsent // asked before CashCheque pays a recipient other than the beneficiary, nil pays any recipient
+	Audit            *AuditLog        // records the outcome of every cashout, nil records nothing
+	Notifier         *Notifier        // posts issued cheques, cashouts, bounces and failed transactions to webhooks, nil posts nothing
+	ChainID          *big.Int         // chain the chequebook and its cheques belong to, cashouts on another fail with ErrChainMismatch, nil cashes on any
+	TrustedFactories []common.Address // factories the chequebook has to be deployed by for its cheques to be accepted or cashed, empty trusts any
+}
+
+// NewChequebook binds to the chequebook deployed at address
+func NewChequebook(address common.Address, backend EthBackend, wallet WalletBackend) (*Chequebook, error) {
+	instance, err := simpleswapfactory.NewERC20SimpleSwap(address, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chequebook{
+		address:          address,
+		instance:         instance,
+		backend:          backend,
+		wallet:           wallet,
+		GasBufferPercent: DefaultGasBufferPercent,
+		WaitTimeout:      DefaultWaitTimeout,
+		Confirmations:    DefaultConfirmations,
+		RetryAttempts:    DefaultRetryAttempts,
+	}, nil
+}
+
+// Deploy deploys a new chequebook for issuer through the factory and binds to it once the deployment is mined
+// a reverted deployment is reported as a *RevertError
+func Deploy(ctx context.Context, backend EthBackend, wallet WalletBackend, opts *bind.TransactOpts, factory *simpleswapfactory.SimpleSwapFactory, issuer common.Address) (*Chequebook, *types.Transaction, error) {
+	tx, err := factory.DeploySimpleSwap(opts, issuer, big.NewInt(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	chequebook, err := deployedChequebook(ctx, backend, wallet, factory, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chequebook, tx, nil
+}
+
+// deployedChequebook waits for the deployment tx of factory and binds to the chequebook its SimpleSwapDeployed event reports
+func deployedChequebook(ctx context.Context, backend EthBackend, wallet WalletBackend, factory *simpleswapfactory.SimpleSwapFactory, tx *types.Transaction) (*Chequebook, error) {
+	receipt, err := waitMined(ctx, backend, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkReceipt(ctx, backend, tx, receipt); err != nil {
+		return nil, err
+	}
+
+	address := common.Address{}
+	for _, log := range receipt.Logs {
+		if event, err := factory.ParseSimpleSwapDeployed(*log); err == nil {
+			address = event.ContractAddress
+			break
+		}
+	}
+	if (address == common.Address{}) {
+		return nil, fmt.Errorf("%w: deployment %s emitted no SimpleSwapDeployed event", ErrChequebookNotDeployed, tx.Hash().Hex())
+	}
+	return NewChequebook(address, backend, wallet)
+}
+
+// waitSucceeded waits for tx to be confirmed and returns its receipt, along with a *RevertError if it failed
+func (c *Chequebook) waitSucceeded(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	done := c.Metrics.txPending()
+	receipt, err := WaitConfirmed(ctx, c.backend, tx, c.Confirmations, c.WaitTimeout)
+	done()
+	if err == nil {
+		receipt, err = checkReceipt(ctx, c.backend, tx, receipt)
+	}
+	c.Notifier.txFailed(c.address, tx, err)
+	return receipt, err
+}
+
+// version returns the release the chequebook was deployed from
+func (c *Chequebook) version() ContractVersion {
+	if c.Version == nil {
+		return ContractsV023
+	}
+	return c.Version
+}
+
+// TypedCheques reports whether the chequebook's release expects cheques signed as EIP-712 typed data
+func (c *Chequebook) TypedCheques() bool {
+	return c.version().TypedCheques()
+}
+
+// NativeToken reports whether the chequebook holds ether instead of an ERC20 token
+func (c *Chequebook) NativeToken() bool {
+	return c.version().NativeToken()
+}
+
+// requireV023 refuses operations whose signatures are only implemented in the format of the v0.2.3 contracts
+func (c *Chequebook) requireV023(operation string) error {
+	if version := c.version(); version != ContractsV023 {
+		return fmt.Errorf("%w: %s on a %s chequebook", ErrUnsupportedByVersion, operation, version.Name())
+	}
+	return nil
+}
+
+// Address returns the address of the chequebook contract
+func (c *Chequebook) Address() common.Address {
+	return c.address
+}
+
+// Issuer returns the owner of the chequebook who signs its cheques
+func (c *Chequebook) Issuer(ctx context.Context) (common.Address, error) {
+	return c.instance.Issuer(&bind.CallOpts{Context: ctx})
+}
+
+// ErrChequebookWiring is returned if a chequebook is not bound to the expected token or owner
+var ErrChequebookWiring = errors.New("chequebook misconfigured")
+
+// VerifyWiring checks that the chequebook pays out in token and that its cheques are issued by issuer
+// the token of a chequebook holding ether is the zero address
+func (c *Chequebook) VerifyWiring(ctx context.Context, token common.Address, issuer common.Address) error {
+	opts := &bind.CallOpts{Context: ctx}
+
+	actualToken, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	if actualToken != token {
+		return fmt.Errorf("%w: chequebook %s uses token %s, expected %s", ErrChequebookWiring, c.address.Hex(), actualToken.Hex(), token.Hex())
+	}
+
+	actualIssuer, err := c.instance.Issuer(opts)
+	if err != nil {
+		return err
+	}
+	if actualIssuer != issuer {
+		return fmt.Errorf("%w: chequebook %s is owned by %s, expected %s", ErrChequebookWiring, c.address.Hex(), actualIssuer.Hex(), issuer.Hex())
+	}
+	return nil
+}
+
+// Coverage reports how much of the cheque the chequebook could pay out if it was cashed now
+func (c *Chequebook) Coverage(ctx context.Context, cheque *ChequeParams) (*PayoutCoverage, error) {
+	return payoutCoverage(ctx, c.instance, cheque)
+}
+
+// ExpectedPayout computes the amount the recipient should receive if the cheque was cashed now with the given caller payout
+func (c *Chequebook) ExpectedPayout(ctx context.Context, cheque *ChequeParams, callerPayout *big.Int) (*big.Int, error) {
+	return expectedPayout(ctx, c.instance, cheque, callerPayout)
+}
+
+// CashResult is the outcome of a mined cashout transaction
+type CashResult struct {
+	TxHash  common.Hash
+	Receipt *types.Receipt
+	GasUsed uint64
+	Cashout *CashoutResult // amounts from the ChequeCashed event, nil if the transaction failed
+	Revert  *RevertError   // why the transaction failed, nil if it succeeded
+
+	Simulation *CashoutSimulation // what the cashout was simulated to pay, nil unless Simulate is set
+}
+
+// CashCheque cashes the cheque to recipient using cashChequeBeneficiary and waits for the transaction to be confirmed
+// the transaction is signed by the wallet account of the cheque's beneficiary once the chequebook passed VerifyChequebook
+// a mined but failed transaction is not an error, its result has no Cashout but the Revert reason instead
+// with Simulate set a cashout which would revert is not sent and fails with ErrWouldRevert
+// a cheque paying less than MinCashout on top of the beneficiary's paidOut fails with ErrNothingToCash
+// a recipient other than the beneficiary RecipientConsent refuses fails with ErrRecipientNotApproved
+func (c *Chequebook) CashCheque(ctx context.Context, cheque *ChequeParams, recipient common.Address, sig []byte) (*CashResult, error) {
+	account, err := walletAccount(c.wallet, cheque.Beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := approveRecipient(ctx, c.RecipientConsent, cheque, recipient); err != nil {
+		return nil, err
+	}
+	if err := c.checkUncashed(ctx, cheque); err != nil {
+		return nil, err
+	}
+
+	var simulation *CashoutSimulation
+	if c.Simulate {
+		simulation, err = c.simulateBeforeCash(ctx, cheque, recipient, sig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := c.sendCashout(ctx, account, func() (*types.Transaction, error) {
+		return CashChequeBeneficiaryRequest(ctx, c.backend, account.Address, c.address, recipient, cheque, sig, c.GasBufferPercent, c.RetryAttempts, c.Overrides)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Simulation = simulation
+	return result, nil
+}
+
+// CashChequeFor cashes the cheque on behalf of its beneficiary using cashCheque, sent by the wallet account caller
+// beneficiarySig is the beneficiary's SignCashout authorization for caller, recipient and callerPayout, which caller receives
+// the result is reported like the one of CashCheque
+func (c *Chequebook) CashChequeFor(ctx context.Context, caller common.Address, cheque *ChequeParams, recipient common.Address, beneficiarySig []byte, callerPayout *big.Int, ownerSig []byte) (*CashResult, error) {
+	if err := c.requireV023("cashing for the beneficiary"); err != nil {
+		return nil, err
+	}
+	account, err := walletAccount(c.wallet, caller)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkUncashed(ctx, cheque); err != nil {
+		return nil, err
+	}
+
+	return c.sendCashout(ctx, account, func() (*types.Transaction, error) {
+		return CashChequeRequest(ctx, c.backend, account.Address, c.address, recipient, cheque, beneficiarySig, callerPayout, ownerSig, c.GasBufferPercent, c.RetryAttempts, c.Overrides)
+	})
+}
+
+// ErrNothingToCash is returned instead of sending a cashout which would pay out nothing new, or less than MinCashout
+var ErrNothingToCash = errors.New("nothing to cash")
+
+// checkUncashed compares the cheque's cumulative payout with what its beneficiary was already paid out
+func (c *Chequebook) checkUncashed(ctx context.Context, cheque *ChequeParams) error {
+	var paidOut *big.Int
+	err := WithRetry(ctx, c.RetryAttempts, func() (err error) {
+		paidOut, err = c.PaidOut(ctx, cheque.Beneficiary)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	uncashed := new(big.Int).Sub(cheque.CumulativePayout, paidOut)
+	if uncashed.Sign() <= 0 {
+		return fmt.Errorf("%w: cumulative payout %v already paid out to %s", ErrNothingToCash, cheque.CumulativePayout, cheque.Beneficiary.Hex())
+	}
+	if c.MinCashout != nil && uncashed.Cmp(c.MinCashout) < 0 {
+		return fmt.Errorf("%w: %v uncashed, minimum %v", ErrNothingToCash, uncashed, c.MinCashout)
+	}
+	return nil
+}
+
+// sendCashout signs and sends the cashout built by request from account and waits for it to be confirmed
+func (c *Chequebook) sendCashout(ctx context.Context, account accounts.Account, request func() (*types.Transaction, error)) (*CashResult, error) {
+	if err := VerifyChequebookVersion(ctx, c.backend, c.address, c.version()); err != nil {
+		return nil, err
+	}
+	if err := checkTrustedFactory(ctx, c.backend, c.address, c.TrustedFactories); err != nil {
+		return nil, err
+	}
+
+	var chainID *big.Int
+	err := WithRetry(ctx, c.RetryAttempts, func() (err error) {
+		chainID, err = c.backend.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the same issuer key deploys its chequebooks to the same addresses on every chain, so personal-sign cheques are valid on all of them
+	if err := checkChain("chequebook "+c.address.Hex(), c.ChainID, chainID); err != nil {
+		return nil, err
+	}
+
+	tx, err := request()
+	if err != nil {
+		return nil, err
+	}
+	err = checkGasCostUSD(ctx, c.USDOracle, tx.Gas(), c.MaxGasCostUSD)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err = c.wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := false
+	err = WithRetry(ctx, c.RetryAttempts, func() error {
+		err := c.backend.SendTransaction(ctx, tx)
+		// a timed out attempt may still have reached the node, in which case resending reports the tx as known
+		if err != nil && sent && isKnownTransaction(err) {
+			return nil
+		}
+		sent = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	done := c.Metrics.txPending()
+	defer done()
+
+	if c.BumpTimeout > 0 {
+		monitor := NewTxMonitor(c.backend, c.wallet, chainID)
+		monitor.BumpTimeout = c.BumpTimeout
+		monitor.MaxGasPrice = c.MaxGasPrice
+		// the cap of the overrides holds for the replacements as well
+		if cap := c.Overrides.MaxFee; cap != nil && (monitor.MaxGasPrice == nil || cap.Cmp(monitor.MaxGasPrice) < 0) {
+			monitor.MaxGasPrice = cap
+		}
+		status := <-monitor.Watch(ctx, account, tx)
+		if status.Err != nil {
+			c.Notifier.txFailed(c.address, tx, status.Err)
+			return nil, status.Err
+		}
+		// a bumped replacement has a different hash, follow that one from here on
+		tx = status.Tx
+	}
+
+	receipt, err := WaitConfirmed(ctx, c.backend, tx, c.Confirmations, c.WaitTimeout)
+	if err != nil {
+		c.Notifier.txFailed(c.address, tx, err)
+		return nil, err
+	}
+
+	result := &CashResult{
+		TxHash:  tx.Hash(),
+		Receipt: receipt,
+		GasUsed: receipt.GasUsed,
+	}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		result.Cashout, err = c.ParseCashout(receipt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result.Revert = newRevertError(ctx, c.backend, tx, receipt)
+	}
+	c.Metrics.cashed(result)
+	c.Audit.cashout(c.address, result)
+	c.Notifier.cashout(c.address, result)
+	return result, nil
+}
+
+// ErrAmbiguousAccount is returned by SelectAccount if no account is given and the wallet has several
+var ErrAmbiguousAccount = errors.New("wallet has several accounts")
+
+// walletAccount finds the wallet account with the given address
+func walletAccount(wallet WalletBackend, address common.Address) (accounts.Account, error) {
+	available := wallet.Accounts()
+	for _, account := range available {
+		if account.Address == address {
+			return account, nil
+		}
+	}
+	return accounts.Account{}, fmt.Errorf("no wallet account for %s, the signer provides %s", address.Hex(), accountList(available))
+}
+
+// accountList formats the addresses of accounts for error messages
+func accountList(available []accounts.Account) string {
+	if len(available) == 0 {
+		return "no accounts"
+	}
+	addresses := make([]string, len(available))
+	for i, account := range available {
+		addresses[i] = account.Address.Hex()
+	}
+	return strings.Join(addresses, ", ")
+}
+
+// SelectAccount picks the wallet account to use
+// a zero address selects the only account of the wallet and fails if there is none or more than one
+func SelectAccount(wallet WalletBackend, address common.Address) (accounts.Account, error) {
+	if (address != common.Address{}) {
+		return walletAccount(wallet, address)
+	}
+
+	available := wallet.Accounts()
+	switch len(available) {
+	case 0:
+		return accounts.Account{}, errors.New("wallet has no accounts")
+	case 1:
+		return available[0], nil
+	}
+	return accounts.Account{}, fmt.Errorf("%w, select one with -account: %s", ErrAmbiguousAccount, accountList(available))
+}
+
+// AccountAt returns the wallet account at index in the order the wallet lists them
+func AccountAt(wallet WalletBackend, index int) (accounts.Account, error) {
+	available := wallet.Accounts()
+	if index < 0 || index >= len(available) {
+		return accounts.Account{}, fmt.Errorf("no wallet account %d, the signer provides %s", index, accountList(available))
+	}
+	return available[index], nil
+}
@@ -0,0 +1,2133 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+const testWaitTimeout = 10 * time.Second
+
+// newTestEnvironment creates a simulated backend with n funded accounts held by an in-memory wallet
+func newTestEnvironment(t *testing.T, n int) (*SimulatedBackend, *KeyWallet) {
+	backend, wallet, err := NewSimulatedEnvironment(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend, wallet
+}
+
+// newTestState creates an empty deployment state in a temporary directory
+func newTestState(t *testing.T) (*DeploymentState, string) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadDeploymentState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return state, dir
+}
+
+// deployTestChequebook deploys a token, factory and chequebook owned by the first wallet account and funds it with amount
+func deployTestChequebook(t *testing.T, backend *SimulatedBackend, wallet *KeyWallet, state *DeploymentState, amount int64) (*Chequebook, *simpleswapfactory.ERC20Mintable) {
+	ctx := context.Background()
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewWalletTransactor(wallet, wallet.accounts[0], chainID)
+	opts.Context = ctx
+
+	token, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory, err := SetupFactory(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chequebook, err := SetupChequebook(ctx, log.Root(), backend, wallet, opts, factory, state, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := token.Mint(opts, chequebook.Address(), big.NewInt(amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := WaitMined(ctx, backend, tx, testWaitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("mint failed")
+	}
+
+	return chequebook, token
+}
+
+func TestCashChequeSignatureMismatch(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+
+	owner := wallet.accounts[0]
+	other := wallet.accounts[1]
+	recipient := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+
+	cheque := &ChequeParams{
+		Contract:         chequebook.Address(),
+		Beneficiary:      owner.Address,
+		CumulativePayout: big.NewInt(100),
+	}
+
+	// the cheque is signed by an account which does not own the chequebook
+	sig, err := SignCheque(wallet, other, cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, err := VerifyCheque(cheque, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer != other.Address {
+		t.Fatalf("recovered issuer %s, expected %s", issuer.Hex(), other.Address.Hex())
+	}
+	if err := VerifyChequeIssuer(cheque, sig, owner.Address); !errors.Is(err, ErrWrongIssuer) || !errors.Is(err, ErrChequeInvalidSignature) {
+		t.Fatalf("expected ErrWrongIssuer, got %v", err)
+	}
+	err = chequebook.VerifyReceived(context.Background(), &SignedCheque{ChequeParams: *cheque, Signature: sig}, nil, false)
+	if !errors.Is(err, ErrWrongIssuer) {
+		t.Fatalf("expected ErrWrongIssuer from the on-chain issuer check, got %v", err)
+	}
+	ownerSig, err := SignCheque(wallet, owner, cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chequebook.VerifyReceived(context.Background(), &SignedCheque{ChequeParams: *cheque, Signature: ownerSig}, nil, false); err != nil {
+		t.Fatalf("cheque signed by the owner rejected: %v", err)
+	}
+
+	simulation, err := chequebook.SimulateCashCheque(context.Background(), cheque, recipient, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Success || !errors.Is(simulation.Err, ErrInvalidIssuerSignature) {
+		t.Fatalf("simulated cashout of a foreign cheque: success %v, reason %q", simulation.Success, simulation.Reason)
+	}
+	simulation, err = chequebook.SimulateCashCheque(context.Background(), cheque, recipient, ownerSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !simulation.Success || simulation.Payout.Cmp(big.NewInt(100)) != 0 || simulation.Bounced {
+		t.Fatalf("simulated cashout: success %v, payout %v, bounced %v", simulation.Success, simulation.Payout, simulation.Bounced)
+	}
+
+	// the cashout reverts during gas estimation and is never sent
+	chequebook.Simulate = true
+	_, err = chequebook.CashCheque(context.Background(), cheque, recipient, sig)
+	if !errors.Is(err, ErrWouldRevert) {
+		t.Fatalf("expected ErrWouldRevert, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "invalid issuerSig") {
+		t.Fatalf("revert reason missing from %v", err)
+	}
+
+	balance, err := token.BalanceOf(&bind.CallOpts{}, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Sign() != 0 {
+		t.Fatalf("recipient received %v", balance)
+	}
+}
+
+func TestCashChequeNothingToCash(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	chequebook.Metrics = NewMetrics()
+	beneficiary := wallet.accounts[1]
+	cash := func(payout int64) error {
+		cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(payout)}
+		sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = chequebook.CashCheque(context.Background(), &cheque, beneficiary.Address, sig)
+		return err
+	}
+
+	if err := cash(100); err != nil {
+		t.Fatal(err)
+	}
+	metrics := chequebook.Metrics
+	if metrics.chequesCashed.Count() != 1 || metrics.cashedTotal.Value() != 100 || metrics.cashoutGas.Count() == 0 || metrics.pendingTxs.Value() != 0 {
+		t.Fatalf("metrics after a cashout: cashed %d, total %v, gas %d, pending %d", metrics.chequesCashed.Count(), metrics.cashedTotal.Value(), metrics.cashoutGas.Count(), metrics.pendingTxs.Value())
+	}
+	if err := cash(100); !errors.Is(err, ErrNothingToCash) {
+		t.Fatalf("expected ErrNothingToCash for a cashed cheque, got %v", err)
+	}
+	chequebook.MinCashout = big.NewInt(50)
+	if err := cash(120); !errors.Is(err, ErrNothingToCash) {
+		t.Fatalf("expected ErrNothingToCash below the minimum, got %v", err)
+	}
+	if err := cash(150); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCashChequeUSDCap(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	beneficiary := wallet.accounts[1]
+	cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(100)}
+	sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cash := func() error {
+		_, err := chequebook.CashCheque(context.Background(), &cheque, beneficiary.Address, sig)
+		return err
+	}
+
+	// a cashout costs tens of thousands of gas, at a dollar per gas it is far above a one dollar cap
+	chequebook.MaxGasCostUSD = big.NewFloat(1)
+	chequebook.USDOracle = &FixedRateOracle{Rate: big.NewFloat(1)}
+	if err := cash(); !errors.Is(err, ErrGasCostExceedsUSDCap) {
+		t.Fatalf("expected ErrGasCostExceedsUSDCap, got %v", err)
+	}
+
+	chequebook.USDOracle = nil
+	if err := cash(); err == nil || errors.Is(err, ErrGasCostExceedsUSDCap) {
+		t.Fatalf("expected an error for a cap without an oracle, got %v", err)
+	}
+
+	chequebook.USDOracle = &FixedRateOracle{Rate: big.NewFloat(1e-9)}
+	if err := cash(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrustedFactories(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	beneficiary := wallet.accounts[1]
+	signed := &SignedCheque{ChequeParams: ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(100)}}
+	sig, err := SignCheque(wallet, wallet.accounts[0], &signed.ChequeParams, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Signature = sig
+	ctx := context.Background()
+
+	// a second factory which never deployed the chequebook
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewWalletTransactor(wallet, wallet.accounts[0], chainID)
+	opts.Context = ctx
+	other, otherDir := newTestState(t)
+	defer os.RemoveAll(otherDir)
+	other.Token = state.Token
+	if _, err := SetupFactory(ctx, log.Root(), backend, opts, other, testWaitTimeout, DefaultConfirmations); err != nil {
+		t.Fatal(err)
+	}
+	untrusted := []common.Address{other.Factory}
+
+	if err := VerifyTrustedFactory(ctx, backend, chequebook.Address(), []common.Address{state.Factory}); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyTrustedFactory(ctx, backend, chequebook.Address(), untrusted); !errors.Is(err, ErrUntrustedFactory) {
+		t.Fatalf("expected ErrUntrustedFactory, got %v", err)
+	}
+
+	chequebook.TrustedFactories = untrusted
+	if err := chequebook.VerifyReceived(ctx, signed, nil, false); !errors.Is(err, ErrUntrustedFactory) {
+		t.Fatalf("expected ErrUntrustedFactory accepting the cheque, got %v", err)
+	}
+	if _, err := chequebook.CashCheque(ctx, &signed.ChequeParams, beneficiary.Address, sig); !errors.Is(err, ErrUntrustedFactory) {
+		t.Fatalf("expected ErrUntrustedFactory cashing the cheque, got %v", err)
+	}
+	results := CashBatch(ctx, backend, wallet, []*SignedCheque{signed}, common.Address{}, BatchOptions{WaitTimeout: testWaitTimeout, TrustedFactories: untrusted})
+	if !errors.Is(results[0].Err, ErrUntrustedFactory) || results[0].TxHash != (common.Hash{}) {
+		t.Fatalf("expected the batch to refuse the cheque before sending, got %v", results[0].Err)
+	}
+
+	chequebook.TrustedFactories = []common.Address{other.Factory, state.Factory}
+	if err := chequebook.VerifyReceived(ctx, signed, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chequebook.CashCheque(ctx, &signed.ChequeParams, beneficiary.Address, sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDepositWithdraw(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+
+	opts := NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID)
+	tx, err := token.Mint(opts, owner.Address, big.NewInt(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WaitMined(ctx, backend, tx, testWaitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chequebook.Deposit(ctx, big.NewInt(501)); !errors.Is(err, ErrInsufficientTokenBalance) {
+		t.Fatalf("expected ErrInsufficientTokenBalance, got %v", err)
+	}
+
+	receipt, err := chequebook.Deposit(ctx, big.NewInt(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("deposit failed")
+	}
+
+	balance, err := chequebook.Balance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(1500)) != 0 {
+		t.Fatalf("balance after deposit %v, expected 1500", balance)
+	}
+
+	receipt, err = chequebook.Withdraw(ctx, big.NewInt(1200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("withdraw failed")
+	}
+
+	liquid, err := chequebook.LiquidBalance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if liquid.Cmp(big.NewInt(300)) != 0 {
+		t.Fatalf("liquid balance after withdraw %v, expected 300", liquid)
+	}
+
+	ownerBalance, err := token.BalanceOf(&bind.CallOpts{}, owner.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ownerBalance.Cmp(big.NewInt(1200)) != 0 {
+		t.Fatalf("owner balance after withdraw %v, expected 1200", ownerBalance)
+	}
+}
+
+func TestDepositWithPermitUnsupported(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+
+	opts := NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID)
+	tx, err := token.Mint(opts, owner.Address, big.NewInt(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WaitMined(ctx, backend, tx, testWaitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// the plain ERC20 of the v0.2.3 contracts has no permits, nothing is sent for it
+	deadline := time.Now().Add(time.Hour)
+	if _, err := chequebook.DepositWithPermit(ctx, big.NewInt(500), owner.Address, deadline); !errors.Is(err, ErrPermitUnsupported) {
+		t.Fatalf("expected ErrPermitUnsupported, got %v", err)
+	}
+	if _, err := chequebook.DepositWithPermit(ctx, big.NewInt(501), owner.Address, deadline); !errors.Is(err, ErrInsufficientTokenBalance) {
+		t.Fatalf("expected ErrInsufficientTokenBalance, got %v", err)
+	}
+
+	balance, err := chequebook.Balance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("balance after refused deposits %v, expected 1000", balance)
+	}
+}
+
+func TestCashBatch(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+	beneficiary := wallet.accounts[1]
+
+	signed := func(signer accounts.Account, payout int64) *SignedCheque {
+		cheque := ChequeParams{
+			Contract:         chequebook.Address(),
+			Beneficiary:      beneficiary.Address,
+			CumulativePayout: big.NewInt(payout),
+		}
+		sig, err := SignCheque(wallet, signer, &cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &SignedCheque{ChequeParams: cheque, Signature: sig}
+	}
+
+	// the cheque in the middle is not signed by the owner and must not stop the batch
+	cheques := []*SignedCheque{
+		signed(owner, 100),
+		signed(beneficiary, 200),
+		signed(owner, 150),
+	}
+
+	opts := BatchOptions{
+		GasBufferPercent: DefaultGasBufferPercent,
+		WaitTimeout:      testWaitTimeout,
+		RetryAttempts:    1,
+	}
+	results := CashBatch(context.Background(), backend, wallet, cheques, common.Address{}, opts)
+
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Fatalf("cheque %d: %v", i, results[i].Err)
+		}
+		if results[i].Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("cheque %d: cashout reverted", i)
+		}
+	}
+	if results[1].Err == nil {
+		t.Fatal("cheque not signed by the owner was cashed")
+	}
+	if results[0].Cashout.TotalPayout.Cmp(big.NewInt(100)) != 0 || results[2].Cashout.TotalPayout.Cmp(big.NewInt(50)) != 0 {
+		t.Fatalf("cashed %v and %v, expected 100 and 50", results[0].Cashout.TotalPayout, results[2].Cashout.TotalPayout)
+	}
+	if results[0].Cashout.Recipient != beneficiary.Address || results[0].Cashout.Caller != beneficiary.Address {
+		t.Fatalf("cashout event names recipient %s and caller %s, expected the beneficiary", results[0].Cashout.Recipient.Hex(), results[0].Cashout.Caller.Hex())
+	}
+
+	balance, err := token.BalanceOf(&bind.CallOpts{}, beneficiary.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(150)) != 0 {
+		t.Fatalf("beneficiary balance %v, expected 150", balance)
+	}
+}
+
+func TestCashAll(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 3)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var cheques []*SignedCheque
+	for i, payout := range []int64{100, 200} {
+		cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: wallet.accounts[i+1].Address, CumulativePayout: big.NewInt(payout)}
+		sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cheques = append(cheques, &SignedCheque{ChequeParams: cheque, Signature: sig})
+		if err := store.Put(cheques[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	opts := BatchOptions{
+		GasBufferPercent: DefaultGasBufferPercent,
+		WaitTimeout:      testWaitTimeout,
+		RetryAttempts:    1,
+		Parallelism:      2,
+	}
+	// the first cheque is cashed behind the store's back and must only be marked as cashed
+	if result := CashBatch(ctx, backend, wallet, cheques[:1], common.Address{}, opts)[0]; result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	results, err := CashAll(ctx, backend, wallet, store, common.Address{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Cheque.Beneficiary != wallet.accounts[2].Address {
+		t.Fatalf("%d results, expected only the cheque of the second beneficiary", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if results[0].Cashout.TotalPayout.Cmp(big.NewInt(200)) != 0 {
+		t.Fatalf("cashed %v, expected 200", results[0].Cashout.TotalPayout)
+	}
+
+	outstanding, err := store.Outstanding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outstanding) != 0 {
+		t.Fatalf("%d cheques outstanding after cashing all", len(outstanding))
+	}
+}
+
+func TestStateReader(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := wallet.accounts[1].Address
+
+	// without a multicall contract every read is its own eth_call, decoded the same way as the aggregated results
+	reader, err := NewStateReader(backend, common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := reader.Read(context.Background(), []StateQuery{{Chequebook: chequebook.Address(), Beneficiaries: []common.Address{beneficiary}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := states[0]
+	if read.Issuer != wallet.accounts[0].Address || read.Token != state.Token {
+		t.Fatalf("read issuer %s and token %s", read.Issuer.Hex(), read.Token.Hex())
+	}
+	if read.Balance.Cmp(big.NewInt(1000)) != 0 || read.LiquidBalance.Cmp(big.NewInt(1000)) != 0 || read.TotalPaidOut.Sign() != 0 {
+		t.Fatalf("read balance %v, liquid %v, paid out %v", read.Balance, read.LiquidBalance, read.TotalPaidOut)
+	}
+	if read.PaidOut[beneficiary] == nil || read.PaidOut[beneficiary].Sign() != 0 || read.HardDeposits[beneficiary].Amount.Sign() != 0 {
+		t.Fatalf("read paid out %v and hard deposit %+v of the beneficiary", read.PaidOut[beneficiary], read.HardDeposits[beneficiary])
+	}
+}
+
+// unavailableBackend fails every request for the chain id like a provider answering with a server error
+type unavailableBackend struct {
+	*SimulatedBackend
+	calls int
+}
+
+func (b *unavailableBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	b.calls++
+	return nil, errors.New("503 Service Unavailable")
+}
+
+func TestResilientBackend(t *testing.T) {
+	simulated, _ := newTestEnvironment(t, 1)
+	unavailable := &unavailableBackend{SimulatedBackend: simulated}
+	backend := NewResilientBackend([]EthBackend{unavailable, simulated}, []string{"unavailable", "simulated"}, ResilientOptions{RetryAttempts: 1})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := backend.ChainID(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// after failing over the working endpoint stays in use
+	if unavailable.calls != 1 {
+		t.Fatalf("unavailable endpoint called %d times, expected once", unavailable.calls)
+	}
+
+	limited := NewResilientBackend([]EthBackend{simulated}, []string{"simulated"}, ResilientOptions{RequestsPerSecond: 50, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := limited.ChainID(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("3 requests at 50 per second took %v", elapsed)
+	}
+}
+
+func TestCrossCheckHashing(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	ctx := context.Background()
+	checks, err := chequebook.CrossCheckHashing(ctx, DefaultHashVectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range checks {
+		if !check.Accepted {
+			t.Fatalf("contract did not accept the cheque for %s: %s", check.Cheque.Beneficiary.Hex(), check.Reason)
+		}
+	}
+	paidOut, err := chequebook.TotalPaidOut(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paidOut.Sign() != 0 {
+		t.Fatalf("cross check paid out %v", paidOut)
+	}
+
+	// a wallet signing something else than the locally computed hash is caught before asking the contract
+	forger := &MockWallet{Owned: wallet.Accounts(), Signature: bytes.Repeat([]byte{1}, 64)}
+	forged, err := NewChequebook(chequebook.Address(), backend, forger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forged.CrossCheckHashing(ctx, DefaultHashVectors[:1]); err == nil {
+		t.Fatal("cross check accepted a signature not made over the cheque hash")
+	}
+}
+
+func TestBench(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	ctx := context.Background()
+	report, err := chequebook.Bench(ctx, BenchOptions{
+		Cheques:       6,
+		Beneficiaries: 2,
+		Amount:        big.NewInt(10),
+		Funding:       big.NewInt(params.Ether),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FirstErr != nil {
+		t.Fatal(report.FirstErr)
+	}
+	if report.Issued != 6 || report.Cashed != 6 || report.EndToEnd.Count != 6 {
+		t.Fatalf("issued %d and cashed %d of 6 cheques", report.Issued, report.Cashed)
+	}
+	// every cheque is signed once and every cashout is a transaction of its beneficiary
+	if report.Signing.Count != 12 {
+		t.Fatalf("bench timed %d signer requests, expected 12", report.Signing.Count)
+	}
+
+	paidOut, err := chequebook.TotalPaidOut(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paidOut.Cmp(big.NewInt(60)) != 0 {
+		t.Fatalf("bench paid out %v, expected 60", paidOut)
+	}
+
+	if _, err := chequebook.Bench(ctx, BenchOptions{Cheques: 100, Beneficiaries: 1, Amount: big.NewInt(10)}); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Fatalf("bench beyond the liquid balance returned %v", err)
+	}
+}
+
+// staleNonceBackend reports the nonce the account had before any transaction was sent, like a node lagging behind
+type staleNonceBackend struct {
+	*SimulatedBackend
+}
+
+func (b *staleNonceBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 0, nil
+}
+
+func TestSelectAccount(t *testing.T) {
+	_, wallet := newTestEnvironment(t, 2)
+
+	if _, err := SelectAccount(wallet, common.Address{}); !errors.Is(err, ErrAmbiguousAccount) {
+		t.Fatalf("expected ErrAmbiguousAccount, got %v", err)
+	}
+	account, err := SelectAccount(wallet, wallet.accounts[1].Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account != wallet.accounts[1] {
+		t.Fatalf("selected %s, expected %s", account.Address.Hex(), wallet.accounts[1].Address.Hex())
+	}
+	if _, err := SelectAccount(wallet, common.HexToAddress("0x01")); err == nil || !strings.Contains(err.Error(), wallet.accounts[0].Address.Hex()) {
+		t.Fatalf("expected an error listing the available accounts, got %v", err)
+	}
+
+	account, err = AccountAt(wallet, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account != wallet.accounts[1] {
+		t.Fatalf("account 1 is %s, expected %s", account.Address.Hex(), wallet.accounts[1].Address.Hex())
+	}
+	if _, err := AccountAt(wallet, 2); err == nil {
+		t.Fatal("expected an error for an index past the last account")
+	}
+}
+
+func TestNonceTrackingBackend(t *testing.T) {
+	simulated, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	backend := NewNonceTrackingBackend(&staleNonceBackend{simulated})
+	owner := wallet.accounts[0]
+
+	opts := NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID)
+	opts.Context = ctx
+
+	// each send after the first would reuse nonce 0 without the tracker
+	token, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		tx, err := token.Mint(opts, owner.Address, big.NewInt(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Nonce() != uint64(i+1) {
+			t.Fatalf("mint %d sent with nonce %d, expected %d", i, tx.Nonce(), i+1)
+		}
+		if _, err := WaitMined(ctx, backend, tx, testWaitTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCashChequeRequest(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 3)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+	beneficiary := wallet.accounts[1]
+	relayer := wallet.accounts[2]
+	recipient := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+
+	cheque := &ChequeParams{
+		Contract:         chequebook.Address(),
+		Beneficiary:      beneficiary.Address,
+		CumulativePayout: big.NewInt(100),
+	}
+	callerPayout := big.NewInt(10)
+
+	ownerSig, err := SignCheque(wallet, owner, cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beneficiarySig, err := SignCashout(wallet, beneficiary, cheque, relayer.Address, recipient, callerPayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, signer, err := VerifyCashChequeSignatures(cheque, relayer.Address, recipient, callerPayout, beneficiarySig, ownerSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer != owner.Address || signer != beneficiary.Address {
+		t.Fatalf("recovered %s and %s, expected %s and %s", issuer.Hex(), signer.Hex(), owner.Address.Hex(), beneficiary.Address.Hex())
+	}
+
+	// the beneficiary signature only authorizes the relayer it was made for
+	if _, err := CashChequeRequest(ctx, backend, owner.Address, chequebook.Address(), recipient, cheque, beneficiarySig, callerPayout, ownerSig, DefaultGasBufferPercent, 1, TxOverrides{}); err == nil {
+		t.Fatal("cashout request by another sender was built")
+	}
+	if _, err := CashChequeRequest(ctx, backend, relayer.Address, chequebook.Address(), recipient, cheque, beneficiarySig, big.NewInt(101), ownerSig, DefaultGasBufferPercent, 1, TxOverrides{}); err == nil {
+		t.Fatal("cashout request with a caller payout above the cumulative payout was built")
+	}
+
+	result, err := chequebook.CashChequeFor(ctx, relayer.Address, cheque, recipient, beneficiarySig, callerPayout, ownerSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Cashout == nil {
+		t.Fatalf("cashCheque reverted: %v", result.Revert)
+	}
+	if result.Cashout.Caller != relayer.Address || result.Cashout.Beneficiary != beneficiary.Address || result.Cashout.CallerPayout.Cmp(callerPayout) != 0 {
+		t.Fatalf("unexpected cashout %+v", result.Cashout)
+	}
+
+	for address, expected := range map[common.Address]int64{recipient: 90, relayer.Address: 10} {
+		balance, err := token.BalanceOf(&bind.CallOpts{}, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(big.NewInt(expected)) != 0 {
+			t.Fatalf("balance of %s is %v, expected %d", address.Hex(), balance, expected)
+		}
+	}
+}
+
+// reorgedBackend loses the receipt of a transaction after it was read once and reports its nonce as used by another one
+type reorgedBackend struct {
+	*SimulatedBackend
+	reads int
+}
+
+func (b *reorgedBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	b.reads++
+	if b.reads > 1 {
+		return nil, ethereum.NotFound
+	}
+	return b.SimulatedBackend.TransactionReceipt(ctx, txHash)
+}
+
+func TestWaitConfirmedDropped(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	ctx := context.Background()
+	owner := wallet.accounts[0]
+
+	tx, err := wallet.SignTx(owner, types.NewTransaction(0, owner.Address, big.NewInt(1), 21000, big.NewInt(1), nil), params.AllEthashProtocolChanges.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mined, so the nonce of the owner moves past the transaction the reorged backend pretends to have lost
+	if err := backend.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	interval := confirmationPollInterval
+	confirmationPollInterval = 10 * time.Millisecond
+	defer func() { confirmationPollInterval = interval }()
+
+	_, err = WaitConfirmed(ctx, &reorgedBackend{SimulatedBackend: backend}, tx, 3, testWaitTimeout)
+	if !errors.Is(err, ErrTransactionDropped) {
+		t.Fatalf("expected ErrTransactionDropped, got %v", err)
+	}
+}
+
+// pollingBackend cannot subscribe to new heads, like a backend connected over http
+type pollingBackend struct {
+	*SimulatedBackend
+}
+
+func (b *pollingBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, rpc.ErrNotificationsUnsupported
+}
+
+func TestWaitMinedHeads(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	ctx := context.Background()
+	owner := wallet.accounts[0]
+
+	interval := minedPollInterval
+	minedPollInterval = 10 * time.Millisecond
+	defer func() { minedPollInterval = interval }()
+
+	for _, waitBackend := range []bind.DeployBackend{backend, &pollingBackend{backend}} {
+		nonce, err := backend.PendingNonceAt(ctx, owner.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := wallet.SignTx(owner, types.NewTransaction(nonce, owner.Address, big.NewInt(1), 21000, big.NewInt(1), nil), params.AllEthashProtocolChanges.ChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// sent without mining it, the block follows once the wait started
+		if err := backend.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			backend.Commit()
+		}()
+
+		receipt, err := WaitMined(ctx, waitBackend, tx, testWaitTimeout)
+		if err != nil {
+			t.Fatalf("%T: %v", waitBackend, err)
+		}
+		if receipt.TxHash != tx.Hash() {
+			t.Fatalf("%T: receipt of %s, expected %s", waitBackend, receipt.TxHash.Hex(), tx.Hash().Hex())
+		}
+	}
+}
+
+func TestWaitConfirmations(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	owner := wallet.accounts[0]
+	opts := NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID)
+	opts.Context = ctx
+
+	token, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := token.Mint(opts, owner.Address, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interval := confirmationPollInterval
+	confirmationPollInterval = 10 * time.Millisecond
+	defer func() { confirmationPollInterval = interval }()
+
+	// the mint is in the latest block, two more blocks bury it under three confirmations
+	go func() {
+		for i := 0; i < 2; i++ {
+			time.Sleep(50 * time.Millisecond)
+			backend.Commit()
+		}
+	}()
+
+	receipt, err := WaitConfirmed(ctx, backend, tx, 3, testWaitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := new(big.Int).Sub(head.Number, receipt.BlockNumber); depth.Cmp(big.NewInt(2)) < 0 {
+		t.Fatalf("returned at depth %v, expected at least 2", depth)
+	}
+}
+
+func TestChequeSettlementRedelivery(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	issuer, err := NewIssuer(ctx, chequebook, store, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delivered []*SignedCheque
+	failures := 1
+	settlement := &ChequeSettlement{
+		Issuer: issuer,
+		Deliver: func(ctx context.Context, peer common.Address, cheque *SignedCheque) error {
+			if failures > 0 {
+				failures--
+				return errors.New("peer unreachable")
+			}
+			delivered = append(delivered, cheque)
+			return nil
+		},
+	}
+	accounting := NewAccounting(settlement, big.NewInt(100), nil)
+	peer := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+
+	// the cheque for the debt of 150 is issued, only its delivery fails
+	if err := accounting.Debit(ctx, peer, big.NewInt(150)); !errors.Is(err, ErrChequeUndelivered) {
+		t.Fatalf("expected ErrChequeUndelivered, got %v", err)
+	}
+	balance := accounting.Balance(peer)
+	if balance.Balance.Sign() != 0 || balance.Undelivered == nil || balance.Undelivered.CumulativePayout.Cmp(big.NewInt(150)) != 0 {
+		t.Fatalf("balance %v with undelivered %v, expected the debt paid by an undelivered cheque of 150", balance.Balance, balance.Undelivered)
+	}
+
+	// a debit below the threshold resends the cheque without issuing another
+	if err := accounting.Debit(ctx, peer, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || delivered[0].CumulativePayout.Cmp(big.NewInt(150)) != 0 {
+		t.Fatalf("delivered %d cheques, expected the resent cheque of 150", len(delivered))
+	}
+
+	// the next cheque pays only the new debt on top
+	if err := accounting.Debit(ctx, peer, big.NewInt(90)); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 || delivered[1].CumulativePayout.Cmp(big.NewInt(250)) != 0 {
+		t.Fatalf("second cheque pays %v, expected 250", delivered[len(delivered)-1].CumulativePayout)
+	}
+	if balance := accounting.Balance(peer); balance.Balance.Sign() != 0 || balance.Undelivered != nil {
+		t.Fatalf("balance %v with undelivered %v after paying", balance.Balance, balance.Undelivered)
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	issuer, err := NewIssuer(ctx, chequebook, store, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+	bob := common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3")
+
+	if _, err := issuer.Issue(ctx, alice, big.NewInt(400)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Issue(ctx, bob, big.NewInt(400)); err != nil {
+		t.Fatal(err)
+	}
+	cheque, err := issuer.Issue(ctx, alice, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cheque.CumulativePayout.Cmp(big.NewInt(500)) != 0 {
+		t.Fatalf("cumulative payout %v, expected 500", cheque.CumulativePayout)
+	}
+	signer, err := cheque.Issuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != wallet.accounts[0].Address {
+		t.Fatalf("cheque signed by %s, expected the owner", signer.Hex())
+	}
+
+	// 500 + 400 are uncashed already, another 200 exceeds the balance of 1000
+	if _, err := issuer.Issue(ctx, bob, big.NewInt(200)); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Fatalf("expected ErrInsufficientLiquidity, got %v", err)
+	}
+	last, err := store.Last(chequebook.Address(), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.CumulativePayout.Cmp(big.NewInt(400)) != 0 {
+		t.Fatalf("refused cheque was stored, last payout %v", last.CumulativePayout)
+	}
+}
+
+func TestChequeService(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := wallet.accounts[1].Address
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	service := NewChequeService(backend, wallet, store, params.AllEthashProtocolChanges.ChainID, false)
+	service.TTL = time.Hour
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("swap", service); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var cheque *SignedCheque
+	if err := client.Call(&cheque, "swap_issueCheque", chequebook.Address(), beneficiary, "300"); err != nil {
+		t.Fatal(err)
+	}
+	if cheque.CumulativePayout.Cmp(big.NewInt(300)) != 0 {
+		t.Fatalf("cumulative payout %v, expected 300", cheque.CumulativePayout)
+	}
+	if cheque.IssuedAt.IsZero() || cheque.Expires.Sub(cheque.IssuedAt) != time.Hour {
+		t.Fatalf("cheque issued at %v expires at %v, expected a validity of an hour", cheque.IssuedAt, cheque.Expires)
+	}
+
+	var verification ChequeVerification
+	if err := client.Call(&verification, "swap_verifyCheque", cheque); err != nil {
+		t.Fatal(err)
+	}
+	if verification.Issuer != wallet.accounts[0].Address || verification.Claimable != "300" {
+		t.Fatalf("unexpected verification %+v", verification)
+	}
+
+	var reply CashoutReply
+	if err := client.Call(&reply, "swap_cashCheque", cheque); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Revert != "" || reply.TotalPayout != "300" {
+		t.Fatalf("unexpected cashout %+v", reply)
+	}
+
+	var status ChequebookStatus
+	if err := client.Call(&status, "swap_chequebookStatus", chequebook.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if status.Balance != "700" || status.TotalPaidOut != "300" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	var cheques []*SignedCheque
+	if err := client.Call(&cheques, "swap_listCheques"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cheques) != 1 || cheques[0].Beneficiary != beneficiary {
+		t.Fatalf("listed %d cheques, expected the issued one", len(cheques))
+	}
+}
+
+func TestRESTHandler(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server := httptest.NewServer(NewRESTHandler(NewChequeService(backend, wallet, store, nil, false)))
+	defer server.Close()
+
+	send := func(req *http.Request, expectedStatus int, result interface{}) {
+		method, path := req.Method, req.URL.Path
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			data, _ := ioutil.ReadAll(resp.Body)
+			t.Fatalf("%s %s returned %d %s, expected %d", method, path, resp.StatusCode, data, expectedStatus)
+		}
+		if result != nil {
+			if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	newRequest := func(method string, path string, body string) *http.Request {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req
+	}
+	request := func(method string, path string, body string, expectedStatus int, result interface{}) {
+		send(newRequest(method, path, body), expectedStatus, result)
+	}
+
+	issue := `{"chequebook": "` + chequebook.Address().Hex() + `", "beneficiary": "` + beneficiary.Hex() + `", "amount": "%s"}`
+	var cheque SignedCheque
+	request(http.MethodPost, "/cheques", fmt.Sprintf(issue, "250"), http.StatusCreated, &cheque)
+	if cheque.CumulativePayout.Cmp(big.NewInt(250)) != 0 || cheque.Beneficiary != beneficiary {
+		t.Fatalf("unexpected cheque %+v", cheque)
+	}
+	request(http.MethodPost, "/cheques", fmt.Sprintf(issue, "-1"), http.StatusBadRequest, nil)
+	request(http.MethodPost, "/cheques", fmt.Sprintf(issue, "5000"), http.StatusConflict, nil)
+
+	var cheques []*SignedCheque
+	request(http.MethodGet, "/cheques", "", http.StatusOK, &cheques)
+	if len(cheques) != 1 {
+		t.Fatalf("listed %d cheques, expected 1", len(cheques))
+	}
+
+	var status ChequebookStatus
+	request(http.MethodGet, "/chequebook/"+chequebook.Address().Hex(), "", http.StatusOK, &status)
+	if status.Issuer != wallet.accounts[0].Address || status.Balance != "1000" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	request(http.MethodGet, "/chequebook/0x1234", "", http.StatusBadRequest, nil)
+
+	// a web page can post json as text/plain or from its own origin, neither issues a cheque
+	plain := newRequest(http.MethodPost, "/cheques", fmt.Sprintf(issue, "10"))
+	plain.Header.Set("Content-Type", "text/plain")
+	send(plain, http.StatusUnsupportedMediaType, nil)
+	foreign := newRequest(http.MethodPost, "/cheques", fmt.Sprintf(issue, "10"))
+	foreign.Header.Set("Origin", "https://evil.example.com")
+	send(foreign, http.StatusForbidden, nil)
+	local := newRequest(http.MethodPost, "/cheques", fmt.Sprintf(issue, "10"))
+	local.Header.Set("Origin", server.URL)
+	send(local, http.StatusCreated, nil)
+
+	protected := httptest.NewServer(RequireToken("secret", NewRESTHandler(NewChequeService(backend, wallet, store, nil, false))))
+	defer protected.Close()
+	for token, expectedStatus := range map[string]int{"": http.StatusUnauthorized, "Bearer wrong": http.StatusUnauthorized, "Bearer secret": http.StatusOK} {
+		req, err := http.NewRequest(http.MethodGet, protected.URL+"/cheques", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		send(req, expectedStatus, nil)
+	}
+}
+
+func TestChequeExchange(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+
+	issued, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issued.Close()
+	received, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer received.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	issuer, err := NewIssuer(ctx, chequebook, issued, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeChequeExchange(ctx, listener, issuer)
+
+	receiver := NewChequeReceiver(backend, received, beneficiary, nil, false)
+	for _, step := range []struct{ amount, expected int64 }{{100, 100}, {50, 150}} {
+		cheque, err := receiver.Request(ctx, listener.Addr().String(), big.NewInt(step.amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cheque.CumulativePayout.Cmp(big.NewInt(step.expected)) != 0 {
+			t.Fatalf("cumulative payout %v, expected %d", cheque.CumulativePayout, step.expected)
+		}
+	}
+
+	last, err := received.Last(chequebook.Address(), beneficiary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.CumulativePayout.Cmp(big.NewInt(150)) != 0 {
+		t.Fatalf("last received cheque %+v, expected a payout of 150", last)
+	}
+
+	if _, err := receiver.Request(ctx, listener.Addr().String(), big.NewInt(5000)); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("expected the issuer to refuse a cheque above the liquid balance, got %v", err)
+	}
+}
+
+// recordingBackend records sent transactions instead of mining them
+type recordingBackend struct {
+	*SimulatedBackend
+	sent []*types.Transaction
+}
+
+func (b *recordingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+func TestTxMonitorBump(t *testing.T) {
+	simulated, wallet := newTestEnvironment(t, 1)
+	backend := &recordingBackend{SimulatedBackend: simulated}
+	account := wallet.accounts[0]
+
+	monitor := NewTxMonitor(backend, wallet, params.AllEthashProtocolChanges.ChainID)
+	monitor.MaxGasPrice = big.NewInt(1150)
+
+	tx := types.NewTransaction(3, common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB"), big.NewInt(0), 21000, big.NewInt(1000), nil)
+	bumped, err := monitor.bump(context.Background(), account, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bumped.Nonce() != 3 || bumped.GasPrice().Cmp(big.NewInt(1150)) != 0 {
+		t.Fatalf("bumped to nonce %d and gas price %v, expected nonce 3 at the maximum of 1150", bumped.Nonce(), bumped.GasPrice())
+	}
+	if len(backend.sent) != 1 || backend.sent[0].Hash() != bumped.Hash() {
+		t.Fatal("bumped transaction was not sent")
+	}
+
+	// no replacement fits between 1150 and the maximum
+	bumped, err = monitor.bump(context.Background(), account, bumped)
+	if err != nil || bumped != nil {
+		t.Fatalf("expected no replacement above the maximum gas price, got %v, %v", bumped, err)
+	}
+}
+
+func TestPersistentNonceBackend(t *testing.T) {
+	simulated, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "nonces.json")
+	backend, err := NewPersistentNonceBackend(simulated, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := wallet.accounts[0]
+
+	opts := NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID)
+	opts.Context = ctx
+	if _, err := SetupToken(ctx, log.Root(), backend, opts, state, testWaitTimeout, DefaultConfirmations); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := loadNonceJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := journal.pending[owner.Address][0]; !ok {
+		t.Fatal("sent transaction missing from the journal")
+	}
+
+	// a restarted run drops the mined transaction and continues after it
+	restarted, err := NewPersistentNonceBackend(simulated, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := restarted.PendingNonceAt(ctx, owner.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 1 {
+		t.Fatalf("restarted with nonce %d, expected 1", nonce)
+	}
+
+	journal, err = loadNonceJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.pending[owner.Address]) != 0 {
+		t.Fatalf("mined transactions left in the journal: %v", journal.pending[owner.Address])
+	}
+}
+
+func TestNonceJournalRecover(t *testing.T) {
+	simulated, wallet := newTestEnvironment(t, 1)
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "nonces.json")
+	owner := wallet.accounts[0]
+	lost, err := NewPersistentNonceBackend(&recordingBackend{SimulatedBackend: simulated}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := wallet.SignTx(owner, types.NewTransaction(0, common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB"), big.NewInt(1), params.TxGas, big.NewInt(1), nil), params.AllEthashProtocolChanges.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lost.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	inFlight, err := lost.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inFlight) != 1 || inFlight[0].Hash() != tx.Hash() {
+		t.Fatalf("in flight %v, expected the unmined transaction", inFlight)
+	}
+
+	// the node never saw the transaction, the restarted run resends it
+	restarted, err := NewPersistentNonceBackend(simulated, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulated.TransactionReceipt(ctx, tx.Hash()); err != nil {
+		t.Fatalf("journaled transaction was not resent: %v", err)
+	}
+	if inFlight, err = restarted.Recover(ctx); err != nil || len(inFlight) != 0 {
+		t.Fatalf("in flight after mining %v, %v", inFlight, err)
+	}
+}
+
+func TestVerifyChequebook(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 0)
+
+	if err := VerifyChequebook(ctx, backend, chequebook.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChequebook(ctx, backend, state.Token); !errors.Is(err, ErrUnknownBytecode) {
+		t.Fatalf("token accepted as chequebook: %v", err)
+	}
+	if err := VerifyChequebook(ctx, backend, wallet.accounts[0].Address); !errors.Is(err, ErrUnknownBytecode) || !errors.Is(err, ErrChequebookNotDeployed) {
+		t.Fatalf("account without code accepted as chequebook: %v", err)
+	}
+}
+
+func TestHardDeposit(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := wallet.accounts[1]
+
+	receipt, err := chequebook.IncreaseHardDeposit(ctx, beneficiary.Address, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := chequebook.ParseHardDepositChange(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Beneficiary != beneficiary.Address || change.Amount.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("hard deposit changed to %v for %s, expected 100 for the beneficiary", change.Amount, change.Beneficiary.Hex())
+	}
+
+	sig, err := SignHardDepositTimeout(wallet, beneficiary, chequebook.Address(), big.NewInt(3600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chequebook.SetCustomHardDepositTimeout(ctx, beneficiary.Address, big.NewInt(3600), sig); err != nil {
+		t.Fatal(err)
+	}
+
+	deposit, err := chequebook.HardDeposit(ctx, beneficiary.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deposit.Amount.Cmp(big.NewInt(100)) != 0 || deposit.Timeout.Cmp(big.NewInt(3600)) != 0 {
+		t.Fatalf("hard deposit %v with timeout %v, expected 100 with 3600", deposit.Amount, deposit.Timeout)
+	}
+
+	receipt, err = chequebook.PrepareDecreaseHardDeposit(ctx, beneficiary.Address, big.NewInt(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err = chequebook.ParseHardDepositChange(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.DecreaseAmount.Cmp(big.NewInt(40)) != 0 {
+		t.Fatalf("prepared decrease of %v, expected 40", change.DecreaseAmount)
+	}
+
+	liquid, err := chequebook.LiquidBalance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if liquid.Cmp(big.NewInt(900)) != 0 {
+		t.Fatalf("liquid balance %v, expected 900 next to the hard deposit", liquid)
+	}
+
+	// the hard deposit locks part of the balance, withdrawing all of it is refused before sending
+	if _, err := chequebook.Withdraw(ctx, big.NewInt(1000)); !errors.Is(err, ErrInsufficientLiquidBalance) {
+		t.Fatalf("expected ErrInsufficientLiquidBalance, got %v", err)
+	}
+}
+
+func TestCashoutScheduler(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	beneficiary := wallet.accounts[1]
+	cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(500)}
+	sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Put(&SignedCheque{ChequeParams: cheque, Signature: sig}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cost, err := chequebook.EstimateCashoutCost(ctx, &SignedCheque{ChequeParams: cheque, Signature: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Gas == 0 || cost.Wei.Sign() <= 0 || cost.Token != nil || cost.Net != nil {
+		t.Fatalf("estimated %+v, expected a cost in wei only without a token price", cost)
+	}
+	chequebook.TokenPrice = &FixedTokenPrice{Rate: big.NewFloat(0.5)}
+	if cost, err = chequebook.EstimateCashoutCost(ctx, &SignedCheque{ChequeParams: cheque, Signature: sig}); err != nil {
+		t.Fatal(err)
+	}
+	half := new(big.Int).Add(cost.Wei, big.NewInt(1))
+	half.Div(half, big.NewInt(2))
+	if cost.Token.Cmp(half) != 0 || cost.Net.Cmp(new(big.Int).Sub(big.NewInt(500), half)) != 0 {
+		t.Fatalf("token cost %v and net %v for %v wei, expected half the cost rounded up", cost.Token, cost.Net, cost.Wei)
+	}
+
+	scheduler := NewCashoutScheduler(backend, wallet, store, &FixedTokenPrice{Rate: big.NewFloat(0.001)})
+	scheduler.Configure = func(book *Chequebook) {
+		book.WaitTimeout = testWaitTimeout
+		book.RetryAttempts = 1
+	}
+
+	decision, err := scheduler.Evaluate(ctx, &SignedCheque{ChequeParams: cheque, Signature: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Payable.Cmp(big.NewInt(500)) != 0 || decision.Cost.Sign() <= 0 {
+		t.Fatalf("payable %v and cost %v, expected 500 and a positive cost", decision.Payable, decision.Cost)
+	}
+
+	// neither a margin above the net value nor a dry run may cash the cheque
+	scheduler.Margin = new(big.Int).Add(decision.Net, big.NewInt(1))
+	if err := scheduler.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Margin = nil
+	scheduler.DryRun = true
+	if err := scheduler.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	paidOut, err := chequebook.PaidOut(ctx, beneficiary.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paidOut.Sign() != 0 {
+		t.Fatalf("paid out %v without cashing", paidOut)
+	}
+
+	scheduler.DryRun = false
+	if err := scheduler.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if paidOut, err = chequebook.PaidOut(ctx, beneficiary.Address); err != nil {
+		t.Fatal(err)
+	}
+	if paidOut.Cmp(big.NewInt(500)) != 0 {
+		t.Fatalf("paid out %v, expected 500", paidOut)
+	}
+	outstanding, err := store.Outstanding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outstanding) != 0 {
+		t.Fatalf("%d cheques outstanding after cashing", len(outstanding))
+	}
+}
+
+func TestCashoutSchedulerResume(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	beneficiary := wallet.accounts[1]
+	cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(500)}
+	sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewMemoryChequeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Put(&SignedCheque{ChequeParams: cheque, Signature: sig}); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewCashoutScheduler(backend, wallet, store, &FixedTokenPrice{Rate: big.NewFloat(0.001)})
+	scheduler.Configure = func(book *Chequebook) {
+		book.WaitTimeout = testWaitTimeout
+		book.RetryAttempts = 1
+	}
+
+	// a stopped scheduler takes no new cheques
+	ctx := context.Background()
+	stop := make(chan struct{})
+	close(stop)
+	if err := scheduler.RunUntil(ctx, stop); err != nil {
+		t.Fatal(err)
+	}
+	paidOut, err := chequebook.PaidOut(ctx, beneficiary.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paidOut.Sign() != 0 {
+		t.Fatalf("stopped scheduler paid out %v", paidOut)
+	}
+
+	// a cashout confirmed after the scheduler stopped waiting for it is recorded on the next run
+	if _, err := chequebook.CashCheque(ctx, &cheque, beneficiary.Address, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	outstanding, err := store.Outstanding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outstanding) != 0 {
+		t.Fatalf("%d cheques outstanding after their cashout was confirmed", len(outstanding))
+	}
+}
+
+func TestChequeWatcher(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	beneficiary := wallet.accounts[1]
+	cash := func(payout int64) {
+		cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(payout)}
+		sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chequebook.CashCheque(context.Background(), &cheque, beneficiary.Address, sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first cashout happens before watching and is delivered by the catch-up
+	cash(100)
+
+	watcher, err := NewChequeWatcher(backend, chequebook.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.FromBlock = big.NewInt(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan ChequeEvent)
+	go watcher.Watch(ctx, events)
+
+	next := func() ChequeEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(testWaitTimeout):
+			t.Fatal("no cheque event delivered")
+			return ChequeEvent{}
+		}
+	}
+
+	event := next()
+	if event.Kind != ChequeCashedEvent || event.Cashout.TotalPayout.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("got %v paying %+v, expected the first cashout of 100", event.Kind, event.Cashout)
+	}
+
+	cash(250)
+	event = next()
+	if event.Kind != ChequeCashedEvent || event.Cashout.TotalPayout.Cmp(big.NewInt(150)) != 0 || event.Chequebook != chequebook.Address() {
+		t.Fatalf("got %v paying %+v, expected the second cashout of 150", event.Kind, event.Cashout)
+	}
+}
+
+func TestHistoryIndex(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	chequebook.WaitTimeout = testWaitTimeout
+	beneficiary := wallet.accounts[1]
+	cash := func(payout int64) {
+		cheque := ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary.Address, CumulativePayout: big.NewInt(payout)}
+		sig, err := SignCheque(wallet, wallet.accounts[0], &cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chequebook.CashCheque(context.Background(), &cheque, beneficiary.Address, sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cash(100)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "history.json")
+	index, err := OpenHistoryIndex(backend, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := index.Update(ctx, chequebook.Address(), state.Factory, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, entry := range history.Entries {
+		kinds = append(kinds, entry.Kind)
+	}
+	if strings.Join(kinds, ",") != "deployed,deposit,cashout" {
+		t.Fatalf("history %v, expected deployed, deposit and cashout", kinds)
+	}
+	if deposit := history.Entries[1]; deposit.Amount != "1000" {
+		t.Fatalf("deposit of %s, expected 1000", deposit.Amount)
+	}
+
+	// a reopened index only scans the blocks mined since
+	cash(250)
+	if index, err = OpenHistoryIndex(backend, path); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = index.Update(ctx, chequebook.Address(), state.Factory, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Entries) != 4 {
+		t.Fatalf("%d entries after the second cashout, expected 4", len(history.Entries))
+	}
+	if paid := history.Paid()[beneficiary.Address]; paid == nil || paid.Cmp(big.NewInt(250)) != 0 {
+		t.Fatalf("paid %v to the beneficiary, expected 250", paid)
+	}
+}
+
+func TestChequebookRegistry(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	book, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	other := common.HexToAddress("0x2")
+	beneficiary := wallet.accounts[1].Address
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "registry.json")
+	registry, err := OpenChequebookRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := RegisteredChequebook{Address: book.Address(), Issuer: wallet.accounts[0].Address, Token: state.Token, Factory: state.Factory}
+	if err := registry.Register(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(RegisteredChequebook{Address: other, Issuer: beneficiary}); err != nil {
+		t.Fatal(err)
+	}
+	// registering again only adds the beneficiary, the zero factory keeps the registered one
+	if err := registry.Register(RegisteredChequebook{Address: book.Address(), Beneficiaries: []common.Address{beneficiary}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first chequebook registered stays active across reopening
+	if registry, err = OpenChequebookRegistry(path); err != nil {
+		t.Fatal(err)
+	}
+	if active, ok := registry.Active(); !ok || active != book.Address() {
+		t.Fatalf("active chequebook %s, expected %s", active.Hex(), book.Address().Hex())
+	}
+	registered, err := registry.Get(book.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.Factory != state.Factory || len(registered.Beneficiaries) != 1 || registered.Beneficiaries[0] != beneficiary {
+		t.Fatalf("registered %+v, expected factory %s and beneficiary %s", registered, state.Factory.Hex(), beneficiary.Hex())
+	}
+	if books := registry.IssuedBy(wallet.accounts[0].Address); len(books) != 1 || books[0].Address != book.Address() {
+		t.Fatalf("issued by the owner %v, expected only %s", books, book.Address().Hex())
+	}
+
+	if _, err := registry.Open(ctx, book.Address(), backend, wallet); err != nil {
+		t.Fatal(err)
+	}
+	// the chain does not agree with an issuer registered by mistake
+	if err := registry.Register(RegisteredChequebook{Address: book.Address(), Issuer: beneficiary}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Open(ctx, book.Address(), backend, wallet); err == nil {
+		t.Fatal("opened a chequebook registered with another issuer")
+	}
+
+	if err := registry.Select(common.HexToAddress("0x3")); !errors.Is(err, ErrUnknownChequebook) {
+		t.Fatalf("selected an unregistered chequebook: %v", err)
+	}
+	if err := registry.Select(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Remove(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.Active(); ok {
+		t.Fatal("removed chequebook still active")
+	}
+}
+
+func TestDiscoverChequebook(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	book, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	issuer := wallet.accounts[0].Address
+
+	ctx := context.Background()
+	found, err := DiscoverChequebook(ctx, backend, state.Factory, issuer, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != book.Address() {
+		t.Fatalf("discovered %s, expected %s", found.Hex(), book.Address().Hex())
+	}
+	if _, err := DiscoverChequebook(ctx, backend, state.Factory, wallet.accounts[1].Address, 0); !errors.Is(err, ErrChequebookNotFound) {
+		t.Fatalf("discovered a chequebook of an account without one: %v", err)
+	}
+
+	// a state which lost its chequebook gets the discovered one back instead of a second deployment
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewWalletTransactor(wallet, wallet.accounts[0], chainID)
+	opts.Context = ctx
+	factory, err := simpleswapfactory.NewSimpleSwapFactory(state.Factory, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := &DeploymentState{Token: state.Token, Factory: state.Factory, FactoryTx: state.FactoryTx}
+	ensured, err := EnsureChequebook(ctx, log.Root(), backend, wallet, opts, factory, fresh, testWaitTimeout, DefaultConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ensured.Address() != book.Address() || fresh.Chequebook != book.Address() {
+		t.Fatalf("ensured chequebook %s, expected %s", ensured.Address().Hex(), book.Address().Hex())
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	book, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+
+	ctx := context.Background()
+	version, err := DetectVersion(ctx, backend, book.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != ContractsV023 {
+		t.Fatalf("detected %s, expected %s", version.Name(), ContractsV023.Name())
+	}
+	if _, err := DetectVersion(ctx, backend, state.Token); !errors.Is(err, ErrUnknownBytecode) {
+		t.Fatalf("detected a version for the token: %v", err)
+	}
+	if _, err := DetectVersion(ctx, backend, common.HexToAddress("0x1234")); !errors.Is(err, ErrChequebookNotDeployed) {
+		t.Fatalf("detected a version for an account without code: %v", err)
+	}
+
+	// a minimal proxy of a chequebook is what the later factories deploy
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewWalletTransactor(wallet, wallet.accounts[0], chainID)
+	opts.Context = ctx
+	runtime := append(append(append([]byte(nil), proxyPrefix...), book.Address().Bytes()...), proxySuffix...)
+	creation := append(common.FromHex("602d80600b6000396000f3"), runtime...)
+	proxy, tx, _, err := bind.DeployContract(opts, abi.ABI{}, creation, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitMined(ctx, backend, tx); err != nil {
+		t.Fatal(err)
+	}
+	if version, err = DetectVersion(ctx, backend, proxy); err != nil {
+		t.Fatal(err)
+	}
+	if version != ContractsBee || !version.TypedCheques() {
+		t.Fatalf("detected %s for a proxy, expected %s", version.Name(), ContractsBee.Name())
+	}
+
+	// cashing a cheque on behalf of its beneficiary is refused on the later releases
+	opened, err := OpenChequebook(ctx, proxy, backend, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheque := &ChequeParams{Contract: proxy, Beneficiary: wallet.accounts[0].Address, CumulativePayout: big.NewInt(1)}
+	if _, err := opened.CashChequeFor(ctx, wallet.accounts[0].Address, cheque, wallet.accounts[0].Address, nil, big.NewInt(0), nil); !errors.Is(err, ErrUnsupportedByVersion) {
+		t.Fatalf("cashed for the beneficiary on a proxy: %v", err)
+	}
+
+	// the service detects the release of the chequebooks it opens unless one is forced
+	service := NewChequeService(backend, wallet, nil, chainID, false)
+	if opened, err = service.open(ctx, proxy); err != nil {
+		t.Fatal(err)
+	}
+	if opened.Version != ContractsBee || !opened.TypedCheques() {
+		t.Fatalf("service opened a proxy as %v, expected %s", opened.Version, ContractsBee.Name())
+	}
+	service.Contracts = ContractsV023
+	if _, err := service.open(ctx, proxy); !errors.Is(err, ErrUnknownBytecode) {
+		t.Fatalf("service opened a proxy as %s: %v", ContractsV023.Name(), err)
+	}
+
+	if _, err := ContractVersionByName("v0.3.0"); err == nil {
+		t.Fatal("found an unsupported version")
+	}
+}
+
+func TestEtherChequebook(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	ctx := context.Background()
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewWalletTransactor(wallet, wallet.accounts[0], chainID)
+	opts.Context = ctx
+
+	// code which stops right away but dispatches the selectors of an ether chequebook behind that
+	runtime := []byte{0x00}
+	for _, signature := range etherSelectors {
+		runtime = append(append(runtime, 0x63), crypto.Keccak256([]byte(signature))[:4]...)
+	}
+	creation := append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, runtime...)
+	address, tx, _, err := bind.DeployContract(opts, abi.ABI{}, creation, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitMined(ctx, backend, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := OpenChequebook(ctx, address, backend, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Version != ContractsEther || !book.NativeToken() {
+		t.Fatalf("detected %s, expected %s", book.Version.Name(), ContractsEther.Name())
+	}
+	token, err := book.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (token != common.Address{}) {
+		t.Fatalf("ether chequebook has token %s", token.Hex())
+	}
+
+	// the balance of an ether chequebook is its account balance
+	opts.Value = big.NewInt(12345)
+	tx, err = bind.NewBoundContract(address, abi.ABI{}, backend, backend, backend).Transfer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitMined(ctx, backend, tx); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := book.Balance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(opts.Value) != 0 {
+		t.Fatalf("balance is %v, expected %v", balance, opts.Value)
+	}
+	read, err := (EtherBalances{Backend: backend}).BalanceOf(&bind.CallOpts{Context: ctx}, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Cmp(balance) != 0 {
+		t.Fatalf("ether balance read as %v, expected %v", read, balance)
+	}
+
+	// batches detect the release instead of refusing every chequebook but a v0.2.3 one
+	cheque := &SignedCheque{ChequeParams: ChequeParams{Contract: address, Beneficiary: wallet.accounts[0].Address, CumulativePayout: big.NewInt(100)}}
+	if cheque.Signature, err = SignCheque(wallet, wallet.accounts[0], &cheque.ChequeParams, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	batchOpts := BatchOptions{WaitTimeout: testWaitTimeout}
+	if results := CashBatch(ctx, backend, wallet, []*SignedCheque{cheque}, common.Address{}, batchOpts); results[0].Err == nil || errors.Is(results[0].Err, ErrUnknownBytecode) {
+		t.Fatalf("expected the stub to fail past the version check, got %v", results[0].Err)
+	}
+	batchOpts.Contracts = ContractsV023
+	if results := CashBatch(ctx, backend, wallet, []*SignedCheque{cheque}, common.Address{}, batchOpts); !errors.Is(results[0].Err, ErrUnknownBytecode) {
+		t.Fatalf("expected ErrUnknownBytecode with the v0.2.3 release forced, got %v", results[0].Err)
+	}
+}
+
+func TestTopUpMonitor(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 1)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	chequebook, token := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+	mint := func(amount int64) {
+		tx, err := token.Mint(NewWalletTransactor(wallet, owner, params.AllEthashProtocolChanges.ChainID), owner.Address, big.NewInt(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := WaitMined(ctx, backend, tx, testWaitTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewTopUpMonitor(chequebook, big.NewInt(2000), big.NewInt(1500)); err == nil {
+		t.Fatal("expected a high-water mark below the low-water mark to be rejected")
+	}
+	monitor, err := NewTopUpMonitor(chequebook, big.NewInt(1500), big.NewInt(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []*TopUpAlert
+	monitor.Alert = func(ctx context.Context, alert *TopUpAlert) { alerts = append(alerts, alert) }
+
+	check := func(deposited int64, liquid int64) {
+		t.Helper()
+		result, err := monitor.CheckOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deposited == 0 && result.Deposited != nil {
+			t.Fatalf("deposited %v, expected nothing", result.Deposited)
+		}
+		if deposited != 0 && (result.Deposited == nil || result.Deposited.Cmp(big.NewInt(deposited)) != 0) {
+			t.Fatalf("deposited %v, expected %d", result.Deposited, deposited)
+		}
+		balance, err := chequebook.LiquidBalance(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(big.NewInt(liquid)) != 0 {
+			t.Fatalf("liquid balance %v, expected %d", balance, liquid)
+		}
+	}
+
+	// the owner holds no tokens, which is alerted once however often it is checked
+	check(0, 1000)
+	check(0, 1000)
+	if len(alerts) != 1 || alerts[0].Needed.Cmp(big.NewInt(1000)) != 0 || alerts[0].Available.Sign() != 0 {
+		t.Fatalf("alerts %+v, expected one lacking 1000", alerts)
+	}
+
+	mint(300)
+	check(300, 1300)
+	mint(1000)
+	check(700, 2000)
+	check(0, 2000)
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts, expected the shortfall to be alerted once", len(alerts))
+	}
+}
+
+func TestAcceptCheque(t *testing.T) {
+	backend, wallet := newTestEnvironment(t, 2)
+	state, dir := newTestState(t)
+	defer os.RemoveAll(dir)
+
+	chequebook, _ := deployTestChequebook(t, backend, wallet, state, 1000)
+	owner := wallet.accounts[0]
+	beneficiary := wallet.accounts[1].Address
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		payout int64
+		grade  CoverageGrade
+	}{
+		{800, FullyCovered},
+		{1000, FullyCovered},
+		{1500, PartiallyCovered},
+	} {
+		cheque := &ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary, CumulativePayout: big.NewInt(test.payout)}
+		sig, err := SignCheque(wallet, owner, cheque, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := chequebook.AcceptCheque(ctx, &SignedCheque{ChequeParams: *cheque, Signature: sig}, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Grade != test.grade {
+			t.Fatalf("cheque paying %d graded %s, expected %s", test.payout, result.Grade, test.grade)
+		}
+		if test.grade == PartiallyCovered {
+			if err := checkCoverage(result, FullyCovered); !errors.Is(err, ErrChequeNotCoveredByBalance) {
+				t.Fatalf("expected ErrChequeNotCoveredByBalance, got %v", err)
+			}
+		}
+	}
+
+	// a cheque signed by anyone but the issuer is refused before it is graded
+	cheque := &ChequeParams{Contract: chequebook.Address(), Beneficiary: beneficiary, CumulativePayout: big.NewInt(100)}
+	sig, err := SignCheque(wallet, wallet.accounts[1], cheque, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chequebook.AcceptCheque(ctx, &SignedCheque{ChequeParams: *cheque, Signature: sig}, nil, false); !errors.Is(err, ErrWrongIssuer) {
+		t.Fatalf("expected ErrWrongIssuer, got %v", err)
+	}
+
+	if grade := gradeCoverage(&PayoutCoverage{Owed: big.NewInt(10), Payable: new(big.Int)}); grade != WouldBounce {
+		t.Fatalf("cheque with nothing payable graded %s", grade)
+	}
+}
@@ -0,0 +1,213 @@
+package chequebook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ClefOptions configures the http(s) connection to a clef running on another host
+type ClefOptions struct {
+	Header   http.Header // extra headers sent with every request
+	Username string      // basic auth user, empty sends no credentials
+	Password string      // basic auth password
+	TLS      *tls.Config // client tls settings of https endpoints, nil uses the system roots
+}
+
+// isZero reports whether no option is set, which is all an ipc endpoint supports
+func (o ClefOptions) isZero() bool {
+	return len(o.Header) == 0 && o.Username == "" && o.TLS == nil
+}
+
+// LoadClientTLS creates a tls configuration trusting the certificate authorities in caFile and,
+// if certFile and keyFile are given, presenting that client certificate
+// an empty caFile keeps the system roots
+func LoadClientTLS(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("a client certificate needs both the certificate and its key")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// DialClef connects to clef at endpoint, which is the path of its ipc socket or the url of its http(s) rpc
+// the options are only supported for http(s) urls
+func DialClef(ctx context.Context, endpoint string, opts ClefOptions) (WalletBackend, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		if !opts.isZero() {
+			return nil, fmt.Errorf("clef headers, credentials and tls are only supported for http endpoints, got %s", endpoint)
+		}
+		signer, err := external.NewExternalSigner(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return externalClef{signer}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+
+	header := make(http.Header)
+	for key, values := range opts.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	if opts.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + opts.Password))
+		header.Set("Authorization", "Basic "+credentials)
+	}
+	if strings.HasPrefix(endpoint, "http://") && header.Get("Authorization") != "" {
+		log.Warn("sending clef credentials over unencrypted http", "endpoint", endpoint)
+	}
+
+	client, err := rpc.DialHTTPWithClient(endpoint, &http.Client{
+		Transport: &headerTransport{header: header, base: transport},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &ClefSigner{client: client, endpoint: endpoint}
+	// clef answers account_version without asking the user, a failure means the endpoint or credentials are wrong
+	var version string
+	if err := client.CallContext(ctx, &version, "account_version"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to clef at %s: %w", endpoint, err)
+	}
+	log.Debug("connected to clef", "endpoint", endpoint, "version", version)
+	return signer, nil
+}
+
+// ClefSigner is a WalletBackend talking to clef's external api over an rpc client of its own
+// it is used for http endpoints, where go-ethereum's external signer cannot be given headers or tls settings
+type ClefSigner struct {
+	client   *rpc.Client
+	endpoint string
+}
+
+// Close closes the connection to clef
+func (s *ClefSigner) Close() {
+	s.client.Close()
+}
+
+// Accounts lists the accounts clef makes available, asking the user to approve the listing
+func (s *ClefSigner) Accounts() []accounts.Account {
+	var addresses []common.Address
+	if err := s.client.Call(&addresses, "account_list"); err != nil {
+		log.Error("listing clef accounts failed", "endpoint", s.endpoint, "err", err)
+		return nil
+	}
+
+	list := make([]accounts.Account, len(addresses))
+	for i, address := range addresses {
+		list[i] = accounts.Account{Address: address, URL: accounts.URL{Scheme: "extapi", Path: s.endpoint}}
+	}
+	return list
+}
+
+// SignData asks clef to sign data of the given mimetype with account
+func (s *ClefSigner) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	var sig hexutil.Bytes
+	if err := s.client.Call(&sig, "account_signData", mimetype, account.Address.Hex(), hexutil.Encode(data)); err != nil {
+		return nil, signerError(err)
+	}
+	return sig, nil
+}
+
+// clefTxArgs are the transaction fields of account_signTransaction
+type clefTxArgs struct {
+	From     string         `json:"from"`
+	To       *string        `json:"to"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big   `json:"gasPrice"`
+	Value    *hexutil.Big   `json:"value"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	Data     *hexutil.Bytes `json:"data"`
+	ChainID  *hexutil.Big   `json:"chainId,omitempty"`
+}
+
+// SignTx asks clef to sign tx with account
+// clef signs for the chain it was started with, so the result is checked against chainID
+func (s *ClefSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := clefTxArgs{
+		From:     account.Address.Hex(),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Value:    (*hexutil.Big)(tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     &data,
+		ChainID:  (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := tx.To().Hex()
+		args.To = &to
+	}
+
+	var result struct {
+		Raw hexutil.Bytes      `json:"raw"`
+		Tx  *types.Transaction `json:"tx"`
+	}
+	if err := s.client.Call(&result, "account_signTransaction", args); err != nil {
+		return nil, signerError(err)
+	}
+	if result.Tx == nil {
+		return nil, errors.New("clef returned no transaction")
+	}
+
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), result.Tx)
+	if err != nil || sender != account.Address {
+		return nil, fmt.Errorf("clef did not sign for chain %v with %s", chainID, account.Address.Hex())
+	}
+	return result.Tx, nil
+}
+
+// externalClef is go-ethereum's external signer for clef's ipc socket, reporting denied requests as ErrSignerRejected
+type externalClef struct {
+	*external.ExternalSigner
+}
+
+// SignData asks clef to sign data of the given mimetype with account
+func (s externalClef) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	sig, err := s.ExternalSigner.SignData(account, mimetype, data)
+	return sig, signerError(err)
+}
+
+// SignTx asks clef to sign tx with account
+func (s externalClef) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := s.ExternalSigner.SignTx(account, tx, chainID)
+	return signed, signerError(err)
+}
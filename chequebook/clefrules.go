@@ -0,0 +1,179 @@
+package chequebook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ClefRulesOptions configures the rules GenerateClefRules writes
+type ClefRulesOptions struct {
+	ChainID      *big.Int         // chain the cheques are signed for, typed cheques of other chains are left to manual approval
+	Chequebooks  []common.Address // chequebooks whose cheques and cashouts are approved automatically
+	MaxIncrement *big.Int         // most a cheque may raise its beneficiary's cumulative payout over the last approved one
+	Issued       []*SignedCheque  // cheques issued before the rules were installed, each the starting point of its beneficiary
+	ApproveTxs   bool             // approve transactions to the chequebooks sending no ether, such as cashouts and withdrawals
+}
+
+// clefRulesTemplate is written for the otto engine of clef, which only knows ES5 and provides bignumber.js and storage
+// clef leaves a request to its ui whenever the rules neither return "Approve" nor "Reject"
+var clefRulesTemplate = template.Must(template.New("rules").Parse(`// clef rules for swap chequebooks on chain {{.ChainID}}, generated by swap-clef-test clef-rules
+//
+// a cheque signed as EIP-712 typed data for one of the chequebooks below is approved as long as
+// its cumulative payout is at most {{.MaxIncrement}} above the last cheque of its beneficiary approved here,
+// every other signing request, including personal-sign cheques showing nothing but a hash, is left to manual approval
+
+var chainId = "{{.ChainID}}"
+var maxIncrement = new BigNumber("{{.MaxIncrement}}")
+var approveTxs = {{.ApproveTxs}}
+
+var chequebooks = {
+{{- range $i, $address := .Chequebooks}}{{if $i}},{{end}}
+  "{{$address}}": true
+{{- end}}
+}
+
+// cumulative payouts of cheques issued before these rules, keyed by chequebook and beneficiary
+var issued = {
+{{- range $i, $cheque := .Issued}}{{if $i}},{{end}}
+  "{{$cheque.Key}}": "{{$cheque.Payout}}"
+{{- end}}
+}
+
+function OnSignerStartup(info) {
+}
+
+function OnApprovedTx(resp) {
+}
+
+function ApproveListing(req) {
+  return "Approve"
+}
+
+function ApproveTx(req) {
+  var tx = req.transaction
+  if (approveTxs && tx.to && chequebooks[String(tx.to).toLowerCase()] && tx.value === "0x0") {
+    return "Approve"
+  }
+}
+
+function field(fields, name) {
+  for (var i = 0; i < fields.length; i++) {
+    if (fields[i].name === name) {
+      return fields[i].value
+    }
+  }
+  return ""
+}
+
+// clef shows typed integers as "decimal (0xhex)"
+function integer(value) {
+  return new BigNumber(String(value).split(" ")[0])
+}
+
+function ApproveSignData(req) {
+  if (req.content_type !== "data/typed" || !req.messages || req.messages.length !== 2) {
+    return
+  }
+  var domain = req.messages[0].value
+  var cheque = req.messages[1]
+  if (cheque.name !== "Cheque" || field(domain, "name") !== "Chequebook" || field(domain, "version") !== "1.0") {
+    return
+  }
+  if (!integer(field(domain, "chainId")).equals(chainId)) {
+    return
+  }
+  var chequebook = String(field(cheque.value, "chequebook")).toLowerCase()
+  if (!chequebooks[chequebook]) {
+    return
+  }
+
+  var key = chequebook + ":" + String(field(cheque.value, "beneficiary")).toLowerCase()
+  var payout = integer(field(cheque.value, "cumulativePayout"))
+  var last = new BigNumber(issued[key] || "0")
+  var stored = storage.get("cheque:" + key)
+  if (stored && new BigNumber(stored).greaterThan(last)) {
+    last = new BigNumber(stored)
+  }
+  if (payout.lessThan(last) || payout.minus(last).greaterThan(maxIncrement)) {
+    return
+  }
+  storage.put("cheque:" + key, payout.toString(10))
+  return "Approve"
+}
+`))
+
+// clefRulesCheque is an issued cheque as written into the rules
+type clefRulesCheque struct {
+	Key    string
+	Payout string
+}
+
+// GenerateClefRules writes a clef rules.js approving cheques of the chequebooks in opts without a manual click per cheque
+// only typed cheques can be checked by the rules, clef shows nothing but the hash of a personal-sign cheque
+// the last approved cumulative payout per beneficiary is kept in clef's rule storage, a cheque above the cap stays manual
+// and as clef tells the rules nothing about manual approvals, regenerating them with the issued cheques moves the starting points on
+func GenerateClefRules(opts ClefRulesOptions) ([]byte, error) {
+	if opts.ChainID == nil || opts.ChainID.Sign() <= 0 {
+		return nil, errors.New("clef rules need the chain id of the cheques")
+	}
+	if len(opts.Chequebooks) == 0 {
+		return nil, errors.New("clef rules need at least one chequebook")
+	}
+	if opts.MaxIncrement == nil || opts.MaxIncrement.Sign() <= 0 {
+		return nil, errors.New("the amount cap of clef rules must be positive")
+	}
+
+	known := make(map[common.Address]bool, len(opts.Chequebooks))
+	chequebooks := make([]string, 0, len(opts.Chequebooks))
+	for _, address := range opts.Chequebooks {
+		if !known[address] {
+			known[address] = true
+			chequebooks = append(chequebooks, strings.ToLower(address.Hex()))
+		}
+	}
+	sort.Strings(chequebooks)
+
+	// the highest payout wins if the same beneficiary appears several times
+	payouts := make(map[string]*big.Int)
+	for _, cheque := range opts.Issued {
+		if !known[cheque.Contract] {
+			continue
+		}
+		key := strings.ToLower(cheque.Contract.Hex()) + ":" + strings.ToLower(cheque.Beneficiary.Hex())
+		if payout, ok := payouts[key]; !ok || cheque.CumulativePayout.Cmp(payout) > 0 {
+			payouts[key] = cheque.CumulativePayout
+		}
+	}
+	issued := make([]clefRulesCheque, 0, len(payouts))
+	for key, payout := range payouts {
+		issued = append(issued, clefRulesCheque{Key: key, Payout: payout.String()})
+	}
+	sort.Slice(issued, func(i, j int) bool { return issued[i].Key < issued[j].Key })
+
+	var out bytes.Buffer
+	err := clefRulesTemplate.Execute(&out, struct {
+		ChainID      string
+		MaxIncrement string
+		ApproveTxs   bool
+		Chequebooks  []string
+		Issued       []clefRulesCheque
+	}{opts.ChainID.String(), opts.MaxIncrement.String(), opts.ApproveTxs, chequebooks, issued})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ClefRulesHash is the sha256 of rules in hex, which clef attest expects
+func ClefRulesHash(rules []byte) string {
+	hash := sha256.Sum256(rules)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,82 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrRecipientNotApproved is returned for cashouts to a third-party recipient which was not consented to
+var ErrRecipientNotApproved = errors.New("cashout recipient not approved")
+
+// RecipientConsent decides whether cheque may be cashed to recipient, which is never its own beneficiary
+// it returns nil to approve the cashout and an error to refuse it
+type RecipientConsent func(ctx context.Context, cheque *ChequeParams, recipient common.Address) error
+
+// RecipientPolicy lists the third-party recipients cheques may be cashed to without asking
+type RecipientPolicy struct {
+	Beneficiaries map[common.Address][]common.Address `json:"beneficiaries"` // recipients allowed for the cheques of a beneficiary
+	Any           []common.Address                    `json:"any"`           // recipients allowed for the cheques of every beneficiary
+}
+
+// LoadRecipientPolicy reads a json recipient policy from path
+func LoadRecipientPolicy(path string) (*RecipientPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy RecipientPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid recipient policy %s: %v", path, err)
+	}
+	return &policy, nil
+}
+
+// Allows reports whether the policy lets cheques of beneficiary be cashed to recipient
+func (p *RecipientPolicy) Allows(beneficiary common.Address, recipient common.Address) bool {
+	if recipient == beneficiary {
+		return true
+	}
+	for _, allowed := range p.Any {
+		if allowed == recipient {
+			return true
+		}
+	}
+	for _, allowed := range p.Beneficiaries[beneficiary] {
+		if allowed == recipient {
+			return true
+		}
+	}
+	return false
+}
+
+// Consent approves the recipients the policy allows and leaves the others to fallback, nil refuses them
+func (p *RecipientPolicy) Consent(fallback RecipientConsent) RecipientConsent {
+	return func(ctx context.Context, cheque *ChequeParams, recipient common.Address) error {
+		if p.Allows(cheque.Beneficiary, recipient) {
+			return nil
+		}
+		if fallback == nil {
+			return fmt.Errorf("%w: the recipient policy does not allow %s for cheques of %s", ErrRecipientNotApproved, recipient.Hex(), cheque.Beneficiary.Hex())
+		}
+		return fallback(ctx, cheque, recipient)
+	}
+}
+
+// approveRecipient asks consent for cashing cheque to recipient unless it is the beneficiary itself or consent is nil
+func approveRecipient(ctx context.Context, consent RecipientConsent, cheque *ChequeParams, recipient common.Address) error {
+	if consent == nil || recipient == cheque.Beneficiary {
+		return nil
+	}
+	if err := consent(ctx, cheque, recipient); err != nil {
+		if errors.Is(err, ErrRecipientNotApproved) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrRecipientNotApproved, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrChequebookNotFound is returned if a factory never deployed a chequebook for an issuer
+var ErrChequebookNotFound = errors.New("no chequebook of the issuer deployed by the factory")
+
+// DiscoverChequebook finds the chequebook factory deployed for issuer by scanning its SimpleSwapDeployed events from fromBlock
+// the event does not name the issuer, so every deployed chequebook is asked for its issuer, starting with the latest
+func DiscoverChequebook(ctx context.Context, backend EthBackend, factory common.Address, issuer common.Address, fromBlock uint64) (common.Address, error) {
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	query := ethereum.FilterQuery{Addresses: []common.Address{factory}, Topics: [][]common.Hash{{simpleSwapDeployedTopic}}}
+	logs, err := filterLogRange(ctx, backend, query, fromBlock, head.Number.Uint64(), DefaultHistoryBlockRange)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].Removed || len(logs[i].Data) != 32 {
+			continue
+		}
+		candidate := common.BytesToAddress(logs[i].Data)
+		book, err := NewChequebook(candidate, backend, ReadOnlyWallet{})
+		if err != nil {
+			return common.Address{}, err
+		}
+		owner, err := book.Issuer(ctx)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("reading issuer of chequebook %s: %w", candidate.Hex(), err)
+		}
+		if owner == issuer {
+			return candidate, nil
+		}
+	}
+	return common.Address{}, fmt.Errorf("%w: issuer %s, factory %s", ErrChequebookNotFound, issuer.Hex(), factory.Hex())
+}
+
+// EnsureChequebook returns the chequebook of the issuer opts.From deployed by the factory of the state, deploying one only if there is none
+// the state's chequebook is reused first, otherwise the factory's events are scanned from the block the state records for the factory
+// a discovered chequebook is recorded in the state like a deployed one, so repeating the call never deploys a second chequebook
+func EnsureChequebook(ctx context.Context, logger log.Logger, backend EthBackend, wallet WalletBackend, opts *bind.TransactOpts, factory *simpleswapfactory.SimpleSwapFactory, state *DeploymentState, timeout time.Duration, confirmations uint64) (*Chequebook, error) {
+	if (state.Chequebook == common.Address{}) && (state.Factory != common.Address{}) {
+		fromBlock := state.FactoryBlock
+		if fromBlock == 0 && (state.FactoryTx != common.Hash{}) {
+			receipt, err := backend.TransactionReceipt(ctx, state.FactoryTx)
+			if err != nil {
+				return nil, fmt.Errorf("looking up the factory deployment: %w", err)
+			}
+			fromBlock = receipt.BlockNumber.Uint64()
+		}
+
+		found, err := DiscoverChequebook(ctx, backend, state.Factory, opts.From, fromBlock)
+		switch {
+		case err == nil:
+			logger.Info("discovered chequebook", "address", found, "factory", state.Factory, "issuer", opts.From)
+			state.Chequebook = found
+			if err := state.Save(); err != nil {
+				return nil, err
+			}
+		case !errors.Is(err, ErrChequebookNotFound):
+			return nil, err
+		}
+	}
+	return SetupChequebook(ctx, logger, backend, wallet, opts, factory, state, timeout, confirmations)
+}
@@ -0,0 +1,219 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultENSRegistry is the ENS registry deployed at the same address on mainnet and the public testnets
+var DefaultENSRegistry = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// DefaultENSCacheTTL is how long an ENSResolver keeps what it resolved
+const DefaultENSCacheTTL = 5 * time.Minute
+
+// ErrENSNameNotFound is returned for names without a resolver or address, and for addresses without a verified reverse record
+var ErrENSNameNotFound = errors.New("ens name not found")
+
+// ensABI holds resolver of the registry and addr and name of the public resolvers
+const ensABI = `[
+{"inputs":[{"internalType":"bytes32","name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"internalType":"bytes32","name":"node","type":"bytes32"}],"name":"addr","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"internalType":"bytes32","name":"node","type":"bytes32"}],"name":"name","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"}
+]`
+
+// IsENSName reports whether value is written like an ENS name rather than a hex address
+func IsENSName(value string) bool {
+	return strings.Contains(value, ".") && !strings.ContainsAny(value, " \t\n/:")
+}
+
+// normalizeENSName lowercases name, which covers the ascii names ENS normalization leaves otherwise unchanged
+// names with other characters have to be given in their normalized form already
+func normalizeENSName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", fmt.Errorf("invalid ens name %q", name)
+		}
+	}
+	return name, nil
+}
+
+// ENSNameHash is the namehash of EIP-137 identifying name in the registry
+func ENSNameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := crypto.Keccak256Hash([]byte(labels[i]))
+		node = crypto.Keccak256Hash(node[:], label[:])
+	}
+	return node
+}
+
+// ensEntry is a cached lookup, a reverse lookup without a verified name is cached with an empty name
+type ensEntry struct {
+	address common.Address
+	name    string
+	expires time.Time
+}
+
+// ENSResolver resolves ENS names to addresses and addresses back to their primary names through the registry on the backend's chain
+// resolved names are cached for TTL, and so is every reverse lookup including those finding no verified name
+type ENSResolver struct {
+	backend  EthBackend
+	registry common.Address
+	abi      abi.ABI
+
+	TTL time.Duration // how long a lookup is cached, 0 does not cache
+
+	mu        sync.Mutex
+	names     map[string]ensEntry
+	addresses map[common.Address]ensEntry
+}
+
+// NewENSResolver creates a resolver reading the registry at registry, zero uses DefaultENSRegistry
+func NewENSResolver(backend EthBackend, registry common.Address) (*ENSResolver, error) {
+	parsed, err := abi.JSON(strings.NewReader(ensABI))
+	if err != nil {
+		return nil, err
+	}
+	if (registry == common.Address{}) {
+		registry = DefaultENSRegistry
+	}
+	return &ENSResolver{
+		backend:   backend,
+		registry:  registry,
+		abi:       parsed,
+		TTL:       DefaultENSCacheTTL,
+		names:     make(map[string]ensEntry),
+		addresses: make(map[common.Address]ensEntry),
+	}, nil
+}
+
+// call runs method of the ENS contract at to and unpacks its only result into result
+func (r *ENSResolver) call(ctx context.Context, to common.Address, result interface{}, method string, node common.Hash) error {
+	data, err := r.abi.Pack(method, [32]byte(node))
+	if err != nil {
+		return err
+	}
+	output, err := r.backend.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return err
+	}
+	if len(output) == 0 {
+		return fmt.Errorf("%w: %s has no contract answering %s", ErrENSNameNotFound, to.Hex(), method)
+	}
+	return r.abi.Unpack(result, method, output)
+}
+
+// resolver returns the resolver contract the registry has for node
+func (r *ENSResolver) resolver(ctx context.Context, node common.Hash, name string) (common.Address, error) {
+	resolver := new(common.Address)
+	if err := r.call(ctx, r.registry, resolver, "resolver", node); err != nil {
+		return common.Address{}, err
+	}
+	if (*resolver == common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s has no resolver", ErrENSNameNotFound, name)
+	}
+	return *resolver, nil
+}
+
+// fresh reports whether a cached entry has not expired yet, the zero entry of a missing one never is
+func (e ensEntry) fresh() bool {
+	return time.Now().Before(e.expires)
+}
+
+// Resolve returns the address name is set to
+func (r *ENSResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	name, err := normalizeENSName(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	r.mu.Lock()
+	entry := r.names[name]
+	r.mu.Unlock()
+	if entry.fresh() {
+		return entry.address, nil
+	}
+
+	node := ENSNameHash(name)
+	resolver, err := r.resolver(ctx, node, name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	address := new(common.Address)
+	if err := r.call(ctx, resolver, address, "addr", node); err != nil {
+		return common.Address{}, err
+	}
+	if (*address == common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s is not set to an address", ErrENSNameNotFound, name)
+	}
+
+	if r.TTL > 0 {
+		r.mu.Lock()
+		r.names[name] = ensEntry{address: *address, name: name, expires: time.Now().Add(r.TTL)}
+		r.mu.Unlock()
+	}
+	return *address, nil
+}
+
+// Reverse returns the primary name of address, which only counts if the name resolves back to address
+func (r *ENSResolver) Reverse(ctx context.Context, address common.Address) (string, error) {
+	r.mu.Lock()
+	entry := r.addresses[address]
+	r.mu.Unlock()
+	if entry.fresh() {
+		if entry.name == "" {
+			return "", fmt.Errorf("%w: %s has no primary name", ErrENSNameNotFound, address.Hex())
+		}
+		return entry.name, nil
+	}
+
+	name, err := r.reverse(ctx, address)
+	if err != nil && !errors.Is(err, ErrENSNameNotFound) {
+		return "", err
+	}
+	if r.TTL > 0 {
+		r.mu.Lock()
+		r.addresses[address] = ensEntry{address: address, name: name, expires: time.Now().Add(r.TTL)}
+		r.mu.Unlock()
+	}
+	return name, err
+}
+
+func (r *ENSResolver) reverse(ctx context.Context, address common.Address) (string, error) {
+	reverseName := strings.ToLower(address.Hex()[2:]) + ".addr.reverse"
+	node := ENSNameHash(reverseName)
+	resolver, err := r.resolver(ctx, node, reverseName)
+	if err != nil {
+		return "", err
+	}
+	name := new(string)
+	if err := r.call(ctx, resolver, name, "name", node); err != nil {
+		return "", err
+	}
+	if *name == "" {
+		return "", fmt.Errorf("%w: %s has no primary name", ErrENSNameNotFound, address.Hex())
+	}
+
+	// anyone can claim any name in their reverse record, only the forward record proves it
+	resolved, err := r.Resolve(ctx, *name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != address {
+		return "", fmt.Errorf("%w: %s claims %s, which resolves to %s", ErrENSNameNotFound, address.Hex(), *name, resolved.Hex())
+	}
+	return *name, nil
+}
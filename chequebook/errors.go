@@ -0,0 +1,30 @@
+package chequebook
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// kinds of failures callers branch on with errors.Is, the more specific errors of the package wrap one of them
+var (
+	// ErrChequeInvalidSignature is matched by cheques whose signature is malformed or not the issuer's
+	ErrChequeInvalidSignature = errors.New("invalid cheque signature")
+	// ErrChequeNotCoveredByBalance is matched if the chequebook's balance cannot back a cheque
+	ErrChequeNotCoveredByBalance = errors.New("cheque not covered by balance")
+	// ErrChequebookNotDeployed is matched if there is no chequebook at an address, it is an ErrUnknownBytecode as well
+	ErrChequebookNotDeployed = fmt.Errorf("%w: chequebook not deployed", ErrUnknownBytecode)
+	// ErrSignerRejected is matched if the user declined a signing request in clef
+	ErrSignerRejected = errors.New("signing request rejected")
+	// ErrTxReverted is matched by every *RevertError, whose Reason holds why the transaction failed
+	ErrTxReverted = errors.New("transaction reverted")
+)
+
+// signerError marks the errors clef returns for denied requests as ErrSignerRejected
+// clef only reports the denial in the message of its rpc error
+func signerError(err error) error {
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "request denied") {
+		return fmt.Errorf("%w: %v", ErrSignerRejected, err)
+	}
+	return err
+}
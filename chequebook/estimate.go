@@ -0,0 +1,92 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// setupSteps is the number of sequential on-chain transactions runChequebook waits for
+// (token deploy, factory deploy, chequebook deploy, mint and cashout)
+const setupSteps = 5
+
+// blockTimeSample is the number of recent blocks used to compute the average block time
+const blockTimeSample = 20
+
+// EstimateSetupDuration estimates how long the full setup will take by multiplying the number of sequential
+// on-chain steps with the average recent block time and the number of confirmations waited for per step
+func EstimateSetupDuration(ctx context.Context, backend EthBackend, confirmations uint64) (time.Duration, error) {
+	latest, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	sample := big.NewInt(blockTimeSample)
+	if latest.Number.Cmp(sample) < 0 {
+		sample.Set(latest.Number)
+	}
+	if sample.Sign() == 0 {
+		return 0, errors.New("not enough blocks to estimate the block time")
+	}
+
+	oldest, err := backend.HeaderByNumber(ctx, new(big.Int).Sub(latest.Number, sample))
+	if err != nil {
+		return 0, err
+	}
+
+	if confirmations == 0 {
+		confirmations = 1
+	}
+
+	blockTime := time.Duration(latest.Time-oldest.Time) * time.Second / time.Duration(sample.Int64())
+	return blockTime * setupSteps * time.Duration(confirmations), nil
+}
+
+// CashoutCost is the estimated cost of cashing a cheque with cashChequeBeneficiary and what it would pay net of it
+type CashoutCost struct {
+	Gas      uint64   // gas limit of the cashout including GasBufferPercent, so the cost is rather over- than underestimated
+	GasPrice *big.Int // gas price the cashout would be sent with
+	Wei      *big.Int // Gas times GasPrice
+	Token    *big.Int // Wei converted into token base units, nil without a TokenPrice
+	Payable  *big.Int // part of the cheque the chequebook would pay out now
+	Net      *big.Int // Payable minus Token, nil without a TokenPrice
+}
+
+// EstimateCashoutCost estimates what cashing cheque as its beneficiary would cost and pay right now
+// the cost is converted into token terms with TokenPrice if it is set, only then Net tells whether cashing is worth it
+func (c *Chequebook) EstimateCashoutCost(ctx context.Context, cheque *SignedCheque) (*CashoutCost, error) {
+	coverage, err := c.Coverage(ctx, &cheque.ChequeParams)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := CashChequeBeneficiaryRequest(ctx, c.backend, cheque.Beneficiary, c.address, cheque.Beneficiary, &cheque.ChequeParams, cheque.Signature, c.GasBufferPercent, c.RetryAttempts, c.Overrides)
+	if err != nil {
+		return nil, fmt.Errorf("estimating cashout gas: %w", err)
+	}
+
+	cost := &CashoutCost{
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Wei:      new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasPrice()),
+		Payable:  coverage.Payable,
+	}
+	if c.TokenPrice == nil {
+		return cost, nil
+	}
+
+	rate, err := c.TokenPrice.TokenPerWei(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// rounded up, a fraction of a token unit still has to be paid for
+	token := new(big.Float).Mul(new(big.Float).SetInt(cost.Wei), rate)
+	cost.Token, _ = token.Int(nil)
+	if new(big.Float).SetInt(cost.Token).Cmp(token) < 0 {
+		cost.Token.Add(cost.Token, big.NewInt(1))
+	}
+	cost.Net = new(big.Int).Sub(cost.Payable, cost.Token)
+	return cost, nil
+}
@@ -0,0 +1,65 @@
+package chequebook
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	chequeCashedTopic  = crypto.Keccak256Hash([]byte("ChequeCashed(address,address,address,uint256,uint256,uint256)"))
+	chequeBouncedTopic = crypto.Keccak256Hash([]byte("ChequeBounced()"))
+)
+
+// ErrNoChequeCashedEvent is returned if a cashout receipt does not contain a ChequeCashed event of the chequebook
+var ErrNoChequeCashedEvent = errors.New("no ChequeCashed event in receipt")
+
+// CashoutResult holds the amounts reported by the chequebook for a cashout
+type CashoutResult struct {
+	Beneficiary      common.Address // beneficiary of the cashed cheque
+	Recipient        common.Address // account receiving the payout minus the caller payout
+	Caller           common.Address // sender of the cashout transaction
+	TotalPayout      *big.Int       // amount transferred to the recipient and the caller
+	CumulativePayout *big.Int       // cumulative payout of the cashed cheque
+	CallerPayout     *big.Int       // amount transferred to the caller
+	Bounced          bool           // the chequebook could not cover the cheque and only paid out partially
+}
+
+// ParseCashout extracts the ChequeCashed and ChequeBounced events emitted by this chequebook from a cashout receipt
+func (c *Chequebook) ParseCashout(receipt *types.Receipt) (*CashoutResult, error) {
+	var result *CashoutResult
+	bounced := false
+	for _, log := range receipt.Logs {
+		if log.Address != c.address || len(log.Topics) == 0 {
+			continue
+		}
+
+		switch log.Topics[0] {
+		case chequeCashedTopic:
+			event, err := c.instance.ParseChequeCashed(*log)
+			if err != nil {
+				return nil, fmt.Errorf("parsing ChequeCashed event: %w", err)
+			}
+			result = &CashoutResult{
+				Beneficiary:      event.Beneficiary,
+				Recipient:        event.Recipient,
+				Caller:           event.Caller,
+				TotalPayout:      event.TotalPayout,
+				CumulativePayout: event.CumulativePayout,
+				CallerPayout:     event.CallerPayout,
+			}
+		case chequeBouncedTopic:
+			bounced = true
+		}
+	}
+
+	if result == nil {
+		return nil, ErrNoChequeCashedEvent
+	}
+	result.Bounced = bounced
+	return result, nil
+}
@@ -0,0 +1,278 @@
+package chequebook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// exchangeTimeout bounds a single cheque exchange on a connection
+const exchangeTimeout = 30 * time.Second
+
+// message types of the cheque exchange, sent as one json object per line:
+// the issuer greets with its chequebook, the beneficiary requests an amount and the issuer answers with a cheque or an error
+const (
+	exchangeHandshake = "handshake"
+	exchangeRequest   = "request"
+	exchangeCheque    = "cheque"
+	exchangeError     = "error"
+)
+
+// exchangeMessage is a single message of the cheque exchange
+type exchangeMessage struct {
+	Type        string          `json:"type"`
+	Chequebook  *common.Address `json:"chequebook,omitempty"`
+	ChainID     string          `json:"chainId,omitempty"`
+	Beneficiary *common.Address `json:"beneficiary,omitempty"`
+	Amount      string          `json:"amount,omitempty"`
+	Cheque      *SignedCheque   `json:"cheque,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// ServeChequeExchange answers cheque requests on listener with cheques of issuer until ctx is cancelled
+// beneficiaries are not authenticated, anyone reaching the listener can request cheques up to the chequebook's liquid balance
+func ServeChequeExchange(ctx context.Context, listener net.Listener, issuer *Issuer) error {
+	return ServeChequeExchangeUntil(ctx, ctx.Done(), listener, issuer)
+}
+
+// ServeChequeExchangeUntil answers cheque requests like ServeChequeExchange until stop is closed
+// it then accepts no further connections or requests and returns once the requests being answered are done,
+// those still get their cheque issued and stored unless ctx is cancelled as well
+func ServeChequeExchangeUntil(ctx context.Context, stop <-chan struct{}, listener net.Listener, issuer *Issuer) error {
+	var mu sync.Mutex // guards conns and stopping
+	conns := make(map[net.Conn]bool)
+	stopping := false
+	isStopping := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return stopping
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		mu.Lock()
+		stopping = true
+		// peers waiting to send their next request are hung up on, a request being answered sets its own deadline
+		for conn := range conns {
+			conn.SetReadDeadline(time.Now())
+		}
+		mu.Unlock()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if isStopping() {
+				return nil
+			}
+			return err
+		}
+		mu.Lock()
+		if stopping {
+			mu.Unlock()
+			conn.Close()
+			continue
+		}
+		conns[conn] = true
+		wg.Add(1)
+		mu.Unlock()
+
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+			if err := serveExchange(ctx, conn, issuer, isStopping); err != nil {
+				log.Warn("cheque exchange failed", "peer", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+// serveExchange greets the peer on conn and issues a cheque for each of its requests until stopping reports true
+func serveExchange(ctx context.Context, conn net.Conn, issuer *Issuer, stopping func() bool) error {
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+
+	chequebook := issuer.book.address
+	handshake := exchangeMessage{Type: exchangeHandshake, Chequebook: &chequebook}
+	if issuer.chainID != nil {
+		handshake.ChainID = issuer.chainID.String()
+	}
+	conn.SetDeadline(time.Now().Add(exchangeTimeout))
+	if err := encoder.Encode(handshake); err != nil {
+		return err
+	}
+
+	for !stopping() {
+		var request exchangeMessage
+		if err := decoder.Decode(&request); err != nil {
+			return nil // the peer hung up or went quiet after its last request
+		}
+		conn.SetDeadline(time.Now().Add(exchangeTimeout))
+
+		reply := exchangeMessage{Type: exchangeCheque}
+		cheque, err := issueRequested(ctx, issuer, &request)
+		if err != nil {
+			reply = exchangeMessage{Type: exchangeError, Error: err.Error()}
+		} else {
+			log.Info("sent cheque", "beneficiary", cheque.Beneficiary, "cumulativePayout", cheque.CumulativePayout)
+			reply.Cheque = cheque
+		}
+		if err := encoder.Encode(reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// issueRequested issues the cheque a request asks for
+func issueRequested(ctx context.Context, issuer *Issuer, request *exchangeMessage) (*SignedCheque, error) {
+	if request.Type != exchangeRequest || request.Beneficiary == nil {
+		return nil, fmt.Errorf("unexpected message %q", request.Type)
+	}
+	amount, ok := new(big.Int).SetString(request.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", request.Amount)
+	}
+	return issuer.Issue(ctx, *request.Beneficiary, amount)
+}
+
+// ChequeReceiver requests cheques from an issuer running ServeChequeExchange and keeps the verified ones in a store
+type ChequeReceiver struct {
+	backend     EthBackend
+	store       *ChequeStore // holds the last received cheque per chequebook
+	beneficiary common.Address
+	chainID     *big.Int
+	typed       bool
+
+	Metrics     *Metrics        // counts the accepted cheques, nil records nothing
+	Notifier    *Notifier       // posts the accepted cheques to webhooks, nil posts nothing
+	MinCoverage CoverageGrade   // lowest grade a cheque is accepted with, the zero value accepts cheques which would bounce
+	Contracts   ContractVersion // release of the chequebooks cheques are drawn on, nil detects it per chequebook
+}
+
+// NewChequeReceiver creates a receiver requesting cheques for beneficiary
+// cheques are expected as EIP-712 typed data for chainID if typed is set or the release of their chequebook signs typed cheques
+func NewChequeReceiver(backend EthBackend, store *ChequeStore, beneficiary common.Address, chainID *big.Int, typed bool) *ChequeReceiver {
+	return &ChequeReceiver{backend: backend, store: store, beneficiary: beneficiary, chainID: chainID, typed: typed}
+}
+
+// Request asks the issuer at address for a cheque paying amount more than before
+// the cheque is verified against the chequebook the issuer announced and stored before it is returned
+func (r *ChequeReceiver) Request(ctx context.Context, address string, amount *big.Int) (*SignedCheque, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("requested amount must be positive")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(exchangeTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	var handshake exchangeMessage
+	if err := decoder.Decode(&handshake); err != nil {
+		return nil, fmt.Errorf("reading handshake: %w", err)
+	}
+	if handshake.Type != exchangeHandshake || handshake.Chequebook == nil {
+		return nil, fmt.Errorf("unexpected message %q instead of the handshake", handshake.Type)
+	}
+	if r.chainID != nil && handshake.ChainID != "" && handshake.ChainID != r.chainID.String() {
+		return nil, fmt.Errorf("issuer is on chain %s, expected %v", handshake.ChainID, r.chainID)
+	}
+
+	beneficiary := r.beneficiary
+	request := exchangeMessage{Type: exchangeRequest, Beneficiary: &beneficiary, Amount: amount.String()}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, err
+	}
+
+	var reply exchangeMessage
+	if err := decoder.Decode(&reply); err != nil {
+		return nil, fmt.Errorf("reading cheque: %w", err)
+	}
+	switch {
+	case reply.Type == exchangeError:
+		return nil, fmt.Errorf("issuer refused the cheque: %s", reply.Error)
+	case reply.Type != exchangeCheque || reply.Cheque == nil:
+		return nil, fmt.Errorf("unexpected message %q instead of a cheque", reply.Type)
+	}
+
+	cheque := reply.Cheque
+	if err := r.accept(ctx, *handshake.Chequebook, cheque, amount); err != nil {
+		return nil, err
+	}
+	r.Metrics.chequeReceived()
+	r.Notifier.received(cheque)
+	return cheque, nil
+}
+
+// accept verifies that cheque is a cheque of chequebook for the beneficiary paying at least amount more than before and stores it
+// a cheque the chequebook's liquid balance covers worse than MinCoverage fails with ErrChequeNotCoveredByBalance
+func (r *ChequeReceiver) accept(ctx context.Context, chequebook common.Address, cheque *SignedCheque, amount *big.Int) error {
+	if cheque.Beneficiary != r.beneficiary {
+		return fmt.Errorf("cheque pays %s instead of %s", cheque.Beneficiary.Hex(), r.beneficiary.Hex())
+	}
+
+	book, err := openChequebookVersion(ctx, chequebook, r.backend, ReadOnlyWallet{}, r.Contracts)
+	if err != nil {
+		return err
+	}
+	accepted, err := book.AcceptCheque(ctx, cheque, r.chainID, r.typed || book.TypedCheques())
+	if err != nil {
+		return err
+	}
+	log.Debug("graded received cheque", "chequebook", chequebook, "coverage", accepted.Grade, "uncashed", accepted.Coverage.Owed, "payable", accepted.Coverage.Payable)
+	if err := checkCoverage(accepted, r.MinCoverage); err != nil {
+		return err
+	}
+
+	// whatever the chequebook paid out or a previous cheque promised is already owed
+	previous, err := book.instance.PaidOut(&bind.CallOpts{Context: ctx}, r.beneficiary)
+	if err != nil {
+		return err
+	}
+	last, err := r.store.Last(chequebook, r.beneficiary)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.CumulativePayout.Cmp(previous) > 0 {
+		previous = last.CumulativePayout
+	}
+	if increase := new(big.Int).Sub(cheque.CumulativePayout, previous); increase.Cmp(amount) < 0 {
+		return fmt.Errorf("cheque pays %v more than before, requested %v", increase, amount)
+	}
+
+	return r.store.Put(cheque)
+}
@@ -0,0 +1,42 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrUntrustedFactory is returned if a chequebook was not deployed by any of the trusted factories
+var ErrUntrustedFactory = errors.New("chequebook was not deployed by a trusted factory")
+
+// VerifyTrustedFactory checks that the chequebook at the given address was deployed by one of the trusted factories
+// the v0.2.3 chequebook does not know its factory, so every trusted factory is asked via its deployedContracts mapping
+func VerifyTrustedFactory(ctx context.Context, backend EthBackend, chequebook common.Address, trusted []common.Address) error {
+	for _, factoryAddress := range trusted {
+		factory, err := simpleswapfactory.NewSimpleSwapFactory(factoryAddress, backend)
+		if err != nil {
+			return err
+		}
+
+		deployed, err := factory.DeployedContracts(&bind.CallOpts{Context: ctx}, chequebook)
+		if err != nil {
+			return err
+		}
+		if deployed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUntrustedFactory, chequebook.Hex())
+}
+
+// checkTrustedFactory runs VerifyTrustedFactory unless the allowlist is empty, which trusts chequebooks of any factory
+func checkTrustedFactory(ctx context.Context, backend EthBackend, chequebook common.Address, trusted []common.Address) error {
+	if len(trusted) == 0 {
+		return nil
+	}
+	return VerifyTrustedFactory(ctx, backend, chequebook, trusted)
+}
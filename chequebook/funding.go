@@ -0,0 +1,180 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// Balance returns the token balance of the chequebook including hard deposits, the ether balance of a chequebook holding ether
+func (c *Chequebook) Balance(ctx context.Context) (*big.Int, error) {
+	if c.NativeToken() {
+		return c.backend.BalanceAt(ctx, c.address, nil)
+	}
+	return c.instance.Balance(&bind.CallOpts{Context: ctx})
+}
+
+// LiquidBalance returns the token balance of the chequebook not covering hard deposits
+func (c *Chequebook) LiquidBalance(ctx context.Context) (*big.Int, error) {
+	return c.instance.LiquidBalance(&bind.CallOpts{Context: ctx})
+}
+
+// TotalPaidOut returns the amount the chequebook paid out to all beneficiaries together
+func (c *Chequebook) TotalPaidOut(ctx context.Context) (*big.Int, error) {
+	return c.instance.TotalPaidOut(&bind.CallOpts{Context: ctx})
+}
+
+// PaidOut returns the cumulative amount the chequebook paid out to beneficiary
+func (c *Chequebook) PaidOut(ctx context.Context, beneficiary common.Address) (*big.Int, error) {
+	return c.instance.PaidOut(&bind.CallOpts{Context: ctx}, beneficiary)
+}
+
+// Token returns the address of the ERC20 token the chequebook pays out in, the zero address if it pays out ether
+func (c *Chequebook) Token(ctx context.Context) (common.Address, error) {
+	if c.NativeToken() {
+		return common.Address{}, nil
+	}
+	return c.instance.Token(&bind.CallOpts{Context: ctx})
+}
+
+// Denomination returns how amounts of the chequebook's token are written, see TokenDenomination
+func (c *Chequebook) Denomination(ctx context.Context) (Denomination, error) {
+	if c.NativeToken() {
+		return EtherDenomination, nil
+	}
+	token, err := c.Token(ctx)
+	if err != nil {
+		return Denomination{}, err
+	}
+	return TokenDenomination(ctx, c.backend, token), nil
+}
+
+var (
+	// ErrInsufficientTokenBalance is returned if the owner holds fewer tokens than a deposit transfers
+	ErrInsufficientTokenBalance = errors.New("insufficient token balance")
+	// ErrInsufficientEtherBalance is returned if the owner holds less ether than a deposit to a chequebook holding ether sends
+	ErrInsufficientEtherBalance = errors.New("insufficient ether balance")
+)
+
+// Deposit transfers amount of the chequebook's token from the owner to the chequebook and waits for the transaction to be confirmed
+// a plain ERC20 transfer is used so any token works, not only the mintable test token
+// a chequebook holding ether is sent amount wei by a transaction without call data instead
+func (c *Chequebook) Deposit(ctx context.Context, amount *big.Int) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("deposit amount must be positive")
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.NativeToken() {
+		return c.depositEther(ctx, opts, amount)
+	}
+
+	tokenAddress, err := c.instance.Token(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := simpleswapfactory.NewERC20(tokenAddress, c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Cmp(balance) > 0 {
+		return nil, fmt.Errorf("%w: depositing %v, owner %s holds %v", ErrInsufficientTokenBalance, amount, opts.From.Hex(), balance)
+	}
+
+	tx, err := token.Transfer(opts, c.address, amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// depositEther sends amount wei from the owner to the chequebook, a plain transfer is all it takes as its balance is its ether balance
+func (c *Chequebook) depositEther(ctx context.Context, opts *bind.TransactOpts, amount *big.Int) (*types.Receipt, error) {
+	balance, err := c.backend.BalanceAt(ctx, opts.From, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the gas of the deposit is paid from the same balance, the node rejects the transaction if that is missing
+	if amount.Cmp(balance) > 0 {
+		return nil, fmt.Errorf("%w: depositing %v wei, owner %s holds %v wei", ErrInsufficientEtherBalance, amount, opts.From.Hex(), balance)
+	}
+
+	opts.Value = amount
+	tx, err := bind.NewBoundContract(c.address, abi.ABI{}, c.backend, c.backend, c.backend).Transfer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// ErrInsufficientLiquidBalance is returned if a withdrawal exceeds the balance not locked by hard deposits
+var ErrInsufficientLiquidBalance = errors.New("insufficient liquid balance")
+
+// Withdraw withdraws amount of the liquid balance to the owner and waits for the transaction to be confirmed
+// the withdrawal is not sent if hard deposits lock so much of the balance that the contract would reject it
+func (c *Chequebook) Withdraw(ctx context.Context, amount *big.Int) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("withdraw amount must be positive")
+	}
+
+	liquid, err := c.LiquidBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Cmp(liquid) > 0 {
+		return nil, fmt.Errorf("%w: withdrawing %v, liquid balance %v", ErrInsufficientLiquidBalance, amount, liquid)
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.instance.Withdraw(opts, amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// ownerTransactor creates transaction options signing with the wallet account of the chequebook's issuer
+func (c *Chequebook) ownerTransactor(ctx context.Context) (*bind.TransactOpts, error) {
+	issuer, err := c.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := walletAccount(c.wallet, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainID *big.Int
+	err = WithRetry(ctx, c.RetryAttempts, func() (err error) {
+		chainID, err = c.backend.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := NewWalletTransactor(c.wallet, account, chainID)
+	opts.Context = ctx
+	return opts, nil
+}
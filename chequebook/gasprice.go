@@ -0,0 +1,206 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrGasPriceAboveCap is matched by a *GasPriceCapError
+var ErrGasPriceAboveCap = errors.New("gas price above cap")
+
+// GasPriceCapError is returned instead of sending a transaction whose gas price is above the configured cap
+type GasPriceCapError struct {
+	Price *big.Int // gas price the strategy asked for in wei
+	Cap   *big.Int // highest gas price allowed in wei
+}
+
+func (e *GasPriceCapError) Error() string {
+	return fmt.Sprintf("gas price %s gwei is above the cap of %s gwei, the chain is too expensive to send now", gwei(e.Price), gwei(e.Cap))
+}
+
+// Is matches ErrGasPriceAboveCap
+func (e *GasPriceCapError) Is(target error) bool {
+	return target == ErrGasPriceAboveCap
+}
+
+// gwei formats an amount of wei in gwei
+func gwei(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(params.GWei)).FloatString(3)
+}
+
+// GasPricer decides the gas price a transaction is sent with
+type GasPricer interface {
+	GasPrice(ctx context.Context, backend EthBackend) (*big.Int, error)
+}
+
+// FixedGasPrice always prices transactions at Price
+type FixedGasPrice struct {
+	Price *big.Int // gas price in wei
+}
+
+// GasPrice returns the fixed price
+func (p *FixedGasPrice) GasPrice(ctx context.Context, backend EthBackend) (*big.Int, error) {
+	if p.Price == nil || p.Price.Sign() <= 0 {
+		return nil, errors.New("no fixed gas price configured")
+	}
+	return new(big.Int).Set(p.Price), nil
+}
+
+// SuggestedGasPrice prices transactions at the node's suggestion scaled by Percent
+type SuggestedGasPrice struct {
+	Percent uint64 // share of the suggestion in percent, 0 takes the suggestion as it is
+}
+
+// GasPrice returns the scaled suggestion of the node
+func (p *SuggestedGasPrice) GasPrice(ctx context.Context, backend EthBackend) (*big.Int, error) {
+	price, err := backend.SuggestGasPrice(ctx)
+	if err != nil || p.Percent == 0 {
+		return price, err
+	}
+	price = new(big.Int).Mul(price, new(big.Int).SetUint64(p.Percent))
+	return price.Div(price, big.NewInt(100)), nil
+}
+
+// DefaultFeeHistoryBlocks is the number of recent blocks FeeHistoryGasPrice looks at without Blocks
+const DefaultFeeHistoryBlocks = 20
+
+// FeeHistoryGasPrice prices transactions at the base fee of the next block plus the median of the priority fees
+// paid at Percentile in recent blocks, read with eth_feeHistory from nodes supporting EIP-1559
+type FeeHistoryGasPrice struct {
+	Client     *rpc.Client
+	Blocks     uint64  // recent blocks looked at, 0 uses DefaultFeeHistoryBlocks
+	Percentile float64 // percentile of the priority fees of a block by gas used, between 0 and 100
+}
+
+// feeHistory is the result of eth_feeHistory
+type feeHistory struct {
+	BaseFee []*hexutil.Big   `json:"baseFeePerGas"` // one more entry than blocks, the last is the base fee of the next block
+	Reward  [][]*hexutil.Big `json:"reward"`
+}
+
+// GasPrice returns the base fee of the next block plus the median priority fee at the percentile
+func (p *FeeHistoryGasPrice) GasPrice(ctx context.Context, backend EthBackend) (*big.Int, error) {
+	if p.Percentile < 0 || p.Percentile > 100 {
+		return nil, fmt.Errorf("fee history percentile %v is not between 0 and 100", p.Percentile)
+	}
+	blocks := p.Blocks
+	if blocks == 0 {
+		blocks = DefaultFeeHistoryBlocks
+	}
+
+	var history feeHistory
+	if err := p.Client.CallContext(ctx, &history, "eth_feeHistory", hexutil.Uint64(blocks), "latest", []float64{p.Percentile}); err != nil {
+		return nil, fmt.Errorf("reading the fee history: %w", err)
+	}
+	if len(history.BaseFee) == 0 {
+		return nil, errors.New("the node reported no fee history")
+	}
+
+	var tips []*big.Int
+	for _, reward := range history.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			tips = append(tips, reward[0].ToInt())
+		}
+	}
+	price := new(big.Int).Set(history.BaseFee[len(history.BaseFee)-1].ToInt())
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		price.Add(price, tips[len(tips)/2])
+	}
+	return price, nil
+}
+
+// oracleTimeout bounds a request to a gas price oracle
+const oracleTimeout = 10 * time.Second
+
+// OracleGasPrice prices transactions at the gas price in gwei served as json by an external oracle
+type OracleGasPrice struct {
+	URL    string
+	Field  string       // key of the price in the json object served, empty if a bare number is served
+	Client *http.Client // nil uses a client with a timeout of ten seconds
+}
+
+// GasPrice fetches the price from the oracle
+func (p *OracleGasPrice) GasPrice(ctx context.Context, backend EthBackend) (*big.Int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: oracleTimeout}
+	}
+	req, err := http.NewRequest(http.MethodGet, p.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("gas price oracle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("gas price oracle answered %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid answer of gas price oracle: %v", err)
+	}
+	if p.Field != "" {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("gas price oracle served no object with %q", p.Field)
+		}
+		value = fields[p.Field]
+	}
+
+	var price string
+	switch value := value.(type) {
+	case json.Number:
+		price = value.String()
+	case string:
+		price = strings.TrimSpace(value)
+	default:
+		return nil, fmt.Errorf("gas price oracle served no price %q", p.Field)
+	}
+	amount, ok := new(big.Rat).SetString(price)
+	if !ok || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("gas price oracle served the invalid price %q", price)
+	}
+	// oracles report fractions of gwei, the remainder below a wei is dropped
+	amount.Mul(amount, new(big.Rat).SetInt64(params.GWei))
+	return new(big.Int).Quo(amount.Num(), amount.Denom()), nil
+}
+
+// transactionGasPrice returns the gas price of overrides, asking its pricer or the node if it sets none
+// a price above the cap of overrides is refused with a *GasPriceCapError
+func transactionGasPrice(ctx context.Context, backend EthBackend, overrides TxOverrides, retryAttempts int) (*big.Int, error) {
+	price := overrides.GasPrice
+	if price == nil {
+		pricer := overrides.GasPricer
+		if pricer == nil {
+			pricer = &SuggestedGasPrice{}
+		}
+		err := WithRetry(ctx, retryAttempts, func() (err error) {
+			price, err = pricer.GasPrice(ctx, backend)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if overrides.MaxFee != nil && price.Cmp(overrides.MaxFee) > 0 {
+		return nil, &GasPriceCapError{Price: price, Cap: overrides.MaxFee}
+	}
+	return price, nil
+}
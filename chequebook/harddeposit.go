@@ -0,0 +1,207 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	hardDepositAmountChangedTopic    = crypto.Keccak256Hash([]byte("HardDepositAmountChanged(address,uint256)"))
+	hardDepositDecreasePreparedTopic = crypto.Keccak256Hash([]byte("HardDepositDecreasePrepared(address,uint256)"))
+	hardDepositTimeoutChangedTopic   = crypto.Keccak256Hash([]byte("HardDepositTimeoutChanged(address,uint256)"))
+)
+
+// ErrNoHardDepositEvent is returned if a receipt does not contain any hard deposit event of the chequebook
+var ErrNoHardDepositEvent = errors.New("no hard deposit event in receipt")
+
+// HardDeposit is the part of the chequebook balance reserved for a single beneficiary
+type HardDeposit struct {
+	Amount           *big.Int // reserved amount
+	DecreaseAmount   *big.Int // amount a prepared decrease will release
+	Timeout          *big.Int // custom delay in seconds between preparing and executing a decrease, 0 uses the chequebook default
+	CanBeDecreasedAt *big.Int // unix time from which the prepared decrease can be executed, 0 if none is prepared
+}
+
+// HardDepositChange holds the values reported by the hard deposit events of a receipt, fields without an event are nil
+type HardDepositChange struct {
+	Beneficiary    common.Address
+	Amount         *big.Int // new reserved amount from HardDepositAmountChanged
+	DecreaseAmount *big.Int // prepared decrease from HardDepositDecreasePrepared
+	Timeout        *big.Int // new custom timeout from HardDepositTimeoutChanged
+}
+
+// HardDeposit reads the hard deposit of beneficiary
+func (c *Chequebook) HardDeposit(ctx context.Context, beneficiary common.Address) (*HardDeposit, error) {
+	deposit, err := c.instance.HardDeposits(&bind.CallOpts{Context: ctx}, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	return &HardDeposit{
+		Amount:           deposit.Amount,
+		DecreaseAmount:   deposit.DecreaseAmount,
+		Timeout:          deposit.Timeout,
+		CanBeDecreasedAt: deposit.CanBeDecreasedAt,
+	}, nil
+}
+
+// TotalHardDeposit returns the sum of the hard deposits of all beneficiaries
+func (c *Chequebook) TotalHardDeposit(ctx context.Context) (*big.Int, error) {
+	return c.instance.TotalHardDeposit(&bind.CallOpts{Context: ctx})
+}
+
+// IncreaseHardDeposit reserves another amount of the liquid balance for beneficiary and waits for the transaction to be confirmed
+func (c *Chequebook) IncreaseHardDeposit(ctx context.Context, beneficiary common.Address, amount *big.Int) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("hard deposit increase must be positive")
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.instance.IncreaseHardDeposit(opts, beneficiary, amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// PrepareDecreaseHardDeposit announces that amount of the hard deposit of beneficiary will be released
+// the decrease can be executed with DecreaseHardDeposit once the timeout of the hard deposit passed
+func (c *Chequebook) PrepareDecreaseHardDeposit(ctx context.Context, beneficiary common.Address, amount *big.Int) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("hard deposit decrease must be positive")
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.instance.PrepareDecreaseHardDeposit(opts, beneficiary, amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// DecreaseHardDeposit executes the prepared decrease of the hard deposit of beneficiary
+func (c *Chequebook) DecreaseHardDeposit(ctx context.Context, beneficiary common.Address) (*types.Receipt, error) {
+	deposit, err := c.HardDeposit(ctx, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	if deposit.CanBeDecreasedAt.Sign() == 0 {
+		return nil, fmt.Errorf("no hard deposit decrease prepared for %s", beneficiary.Hex())
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.instance.DecreaseHardDeposit(opts, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// encodeHardDepositTimeout encodes the custom timeout the beneficiary agrees to:
+// chequebook address (20 bytes) ++ beneficiary address (20 bytes) ++ timeout as uint256 (32 bytes)
+func encodeHardDepositTimeout(contract common.Address, beneficiary common.Address, timeout *big.Int) ([]byte, error) {
+	if timeout == nil || timeout.Sign() < 0 || timeout.BitLen() > 256 {
+		return nil, errors.New("invalid hard deposit timeout")
+	}
+
+	input := make([]byte, 0, 2*common.AddressLength+32)
+	input = append(input, contract.Bytes()...)
+	input = append(input, beneficiary.Bytes()...)
+	return append(input, math.PaddedBigBytes(timeout, 32)...), nil
+}
+
+// SignHardDepositTimeout signs the beneficiary's consent to a custom hard deposit timeout on the chequebook at contract
+func SignHardDepositTimeout(wallet WalletBackend, beneficiary accounts.Account, contract common.Address, timeout *big.Int) ([]byte, error) {
+	input, err := encodeHardDepositTimeout(contract, beneficiary.Address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// clef applies the eth_sign prefix to text/plain data itself, so it is given the unprefixed hash
+	return wallet.SignData(beneficiary, accounts.MimetypeTextPlain, crypto.Keccak256(input))
+}
+
+// SetCustomHardDepositTimeout sets the decrease timeout of the hard deposit of beneficiary in seconds
+// the beneficiary has to agree to it with a signature from SignHardDepositTimeout
+func (c *Chequebook) SetCustomHardDepositTimeout(ctx context.Context, beneficiary common.Address, timeout *big.Int, beneficiarySig []byte) (*types.Receipt, error) {
+	if err := c.requireV023("a custom hard deposit timeout"); err != nil {
+		return nil, err
+	}
+	input, err := encodeHardDepositTimeout(c.address, beneficiary, timeout)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := recoverSigner(accounts.TextHash(crypto.Keccak256(input)), beneficiarySig)
+	if err != nil {
+		return nil, err
+	}
+	if signer != beneficiary {
+		return nil, fmt.Errorf("timeout signed by %s instead of the beneficiary %s", signer.Hex(), beneficiary.Hex())
+	}
+
+	opts, err := c.ownerTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.instance.SetCustomHardDepositTimeout(opts, beneficiary, timeout, beneficiarySig)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
+
+// ParseHardDepositChange extracts the hard deposit events emitted by this chequebook from a receipt
+func (c *Chequebook) ParseHardDepositChange(receipt *types.Receipt) (*HardDepositChange, error) {
+	var change *HardDepositChange
+	for _, log := range receipt.Logs {
+		if log.Address != c.address || len(log.Topics) == 0 {
+			continue
+		}
+
+		switch log.Topics[0] {
+		case hardDepositAmountChangedTopic:
+			event, err := c.instance.ParseHardDepositAmountChanged(*log)
+			if err != nil {
+				return nil, fmt.Errorf("parsing HardDepositAmountChanged event: %w", err)
+			}
+			change = &HardDepositChange{Beneficiary: event.Beneficiary, Amount: event.Amount}
+		case hardDepositDecreasePreparedTopic:
+			event, err := c.instance.ParseHardDepositDecreasePrepared(*log)
+			if err != nil {
+				return nil, fmt.Errorf("parsing HardDepositDecreasePrepared event: %w", err)
+			}
+			change = &HardDepositChange{Beneficiary: event.Beneficiary, DecreaseAmount: event.DecreaseAmount}
+		case hardDepositTimeoutChangedTopic:
+			event, err := c.instance.ParseHardDepositTimeoutChanged(*log)
+			if err != nil {
+				return nil, fmt.Errorf("parsing HardDepositTimeoutChanged event: %w", err)
+			}
+			change = &HardDepositChange{Beneficiary: event.Beneficiary, Timeout: event.Timeout}
+		}
+	}
+
+	if change == nil {
+		return nil, ErrNoHardDepositEvent
+	}
+	return change, nil
+}
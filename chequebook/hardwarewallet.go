@@ -0,0 +1,126 @@
+package chequebook
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrNoHardwareWallet is returned if no Ledger or Trezor is connected
+var ErrNoHardwareWallet = errors.New("no hardware wallet found")
+
+// HardwareWalletConfig selects the device and account of OpenHardwareWallet
+type HardwareWalletConfig struct {
+	Path   accounts.DerivationPath                      // derivation path of the account, nil uses accounts.DefaultBaseDerivationPath
+	Choose func(wallets []accounts.Wallet) (int, error) // picks the device if several are connected, nil refuses to guess
+	PIN    func(wallet accounts.Wallet) (string, error) // asks for the PIN of a locked Trezor, nil fails on locked devices
+}
+
+// HardwareWallet is a WalletBackend signing with a single account of a Ledger or Trezor
+// go-ethereum's usbwallet devices only sign transactions, signing cheques reports accounts.ErrNotSupported
+type HardwareWallet struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+// hardwareHubs opens the usb hubs of all supported devices, hubs which cannot be opened on this system are skipped
+func hardwareHubs() []*usbwallet.Hub {
+	var hubs []*usbwallet.Hub
+	for _, candidate := range []struct {
+		name string
+		open func() (*usbwallet.Hub, error)
+	}{
+		{"ledger", usbwallet.NewLedgerHub},
+		{"trezor hid", usbwallet.NewTrezorHubWithHID},
+		{"trezor webusb", usbwallet.NewTrezorHubWithWebUSB},
+	} {
+		hub, err := candidate.open()
+		if err != nil {
+			log.Debug("usb hub not available", "hub", candidate.name, "err", err)
+			continue
+		}
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
+
+// OpenHardwareWallet opens a connected Ledger or Trezor and derives the account at cfg.Path on it
+func OpenHardwareWallet(cfg HardwareWalletConfig) (*HardwareWallet, error) {
+	var wallets []accounts.Wallet
+	for _, hub := range hardwareHubs() {
+		wallets = append(wallets, hub.Wallets()...)
+	}
+
+	var wallet accounts.Wallet
+	switch {
+	case len(wallets) == 0:
+		return nil, ErrNoHardwareWallet
+	case len(wallets) == 1:
+		wallet = wallets[0]
+	case cfg.Choose == nil:
+		return nil, fmt.Errorf("%d hardware wallets found, select one of them", len(wallets))
+	default:
+		index, err := cfg.Choose(wallets)
+		if err != nil {
+			return nil, err
+		}
+		if index < 0 || index >= len(wallets) {
+			return nil, fmt.Errorf("no hardware wallet %d", index)
+		}
+		wallet = wallets[index]
+	}
+
+	err := wallet.Open("")
+	if errors.Is(err, usbwallet.ErrTrezorPINNeeded) && cfg.PIN != nil {
+		var pin string
+		pin, err = cfg.PIN(wallet)
+		if err == nil {
+			err = wallet.Open(pin)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening hardware wallet %s: %w", wallet.URL(), err)
+	}
+
+	path := cfg.Path
+	if path == nil {
+		path = accounts.DefaultBaseDerivationPath
+	}
+	account, err := wallet.Derive(path, true)
+	if err != nil {
+		wallet.Close()
+		return nil, fmt.Errorf("deriving %s on %s: %w", path, wallet.URL(), err)
+	}
+	return &HardwareWallet{wallet: wallet, account: account}, nil
+}
+
+// Close closes the connection to the device
+func (w *HardwareWallet) Close() error {
+	return w.wallet.Close()
+}
+
+// Accounts returns the derived account
+func (w *HardwareWallet) Accounts() []accounts.Account {
+	return []accounts.Account{w.account}
+}
+
+// SignData asks the device to sign data, which the usbwallet devices do not support yet
+func (w *HardwareWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return w.wallet.SignData(w.account, mimetype, data)
+}
+
+// SignTx asks the device to sign tx, which has to be confirmed on it
+func (w *HardwareWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return w.wallet.SignTx(w.account, tx, chainID)
+}
@@ -0,0 +1,331 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// DefaultHistoryBlockRange is the default number of blocks covered by a single log query of the history indexer
+// nodes refuse or time out on queries over too many blocks
+const DefaultHistoryBlockRange = 10000
+
+var (
+	simpleSwapDeployedTopic = crypto.Keccak256Hash([]byte("SimpleSwapDeployed(address)"))
+	transferTopic           = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// history entry kinds
+const (
+	HistoryDeployed   = "deployed"   // the factory deployed the chequebook
+	HistoryDeposit    = "deposit"    // tokens were transferred to the chequebook
+	HistoryCashout    = "cashout"    // a cheque was cashed
+	HistoryWithdrawal = "withdrawal" // tokens left the chequebook other than through a cashout
+)
+
+// HistoryEntry is a single event in the history of a chequebook
+type HistoryEntry struct {
+	Kind             string          `json:"kind"`
+	Block            uint64          `json:"block"`
+	Time             uint64          `json:"time"` // unix time of the block
+	TxHash           common.Hash     `json:"txHash"`
+	LogIndex         uint            `json:"logIndex"`
+	Account          common.Address  `json:"account"`             // factory, depositor, beneficiary or withdrawal recipient
+	Recipient        *common.Address `json:"recipient,omitempty"` // recipient of a cashout
+	Amount           string          `json:"amount,omitempty"`    // tokens moved, the total payout of a cashout
+	CumulativePayout string          `json:"cumulativePayout,omitempty"`
+	CallerPayout     string          `json:"callerPayout,omitempty"`
+	Bounced          bool            `json:"bounced,omitempty"`
+}
+
+// ChequebookHistory is everything the indexer found about a chequebook, ordered by block and log index
+type ChequebookHistory struct {
+	Chequebook common.Address `json:"chequebook"`
+	Token      common.Address `json:"token"`
+	ScannedTo  uint64         `json:"scannedTo"` // last block scanned, the next update continues after it
+	Entries    []HistoryEntry `json:"entries"`
+}
+
+// Paid sums the total payout of all cashouts per beneficiary
+func (h *ChequebookHistory) Paid() map[common.Address]*big.Int {
+	paid := make(map[common.Address]*big.Int)
+	for _, entry := range h.Entries {
+		if entry.Kind != HistoryCashout {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(entry.Amount, 10)
+		if !ok {
+			continue
+		}
+		if paid[entry.Account] == nil {
+			paid[entry.Account] = new(big.Int)
+		}
+		paid[entry.Account].Add(paid[entry.Account], amount)
+	}
+	return paid
+}
+
+// HistoryIndex reconstructs the history of chequebooks from past logs and keeps it in a json file
+// updates only scan the blocks mined since the previous one
+type HistoryIndex struct {
+	backend EthBackend
+	path    string // file the histories are persisted to, empty keeps them in memory
+	parser  *simpleswapfactory.ERC20SimpleSwapFilterer
+
+	BlockRange uint64 // blocks covered by a single log query
+
+	mu        sync.Mutex
+	histories map[common.Address]*ChequebookHistory
+}
+
+// OpenHistoryIndex loads the index at path, a missing file or an empty path yield an empty index
+func OpenHistoryIndex(backend EthBackend, path string) (*HistoryIndex, error) {
+	parser, err := simpleswapfactory.NewERC20SimpleSwapFilterer(common.Address{}, backend)
+	if err != nil {
+		return nil, err
+	}
+	index := &HistoryIndex{
+		backend:    backend,
+		path:       path,
+		parser:     parser,
+		BlockRange: DefaultHistoryBlockRange,
+		histories:  make(map[common.Address]*ChequebookHistory),
+	}
+	if path == "" {
+		return index, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []*ChequebookHistory
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("invalid history index %s: %v", path, err)
+	}
+	for _, history := range stored {
+		index.histories[history.Chequebook] = history
+	}
+	return index, nil
+}
+
+// save writes the index, the caller has to hold mu
+func (x *HistoryIndex) save() error {
+	if x.path == "" {
+		return nil
+	}
+
+	stored := make([]*ChequebookHistory, 0, len(x.histories))
+	for _, history := range x.histories {
+		stored = append(stored, history)
+	}
+	sort.Slice(stored, func(a, b int) bool {
+		return stored[a].Chequebook.Hex() < stored[b].Chequebook.Hex()
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(x.path, data)
+}
+
+// History returns the indexed history of chequebook, nil if it was never updated
+func (x *HistoryIndex) History(chequebook common.Address) *ChequebookHistory {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.histories[chequebook]
+}
+
+// Update scans the blocks up to the current head for events of chequebook and returns its extended history
+// a chequebook indexed for the first time is scanned from fromBlock, a non-zero factory adds its deployment
+func (x *HistoryIndex) Update(ctx context.Context, chequebook common.Address, factory common.Address, fromBlock uint64) (*ChequebookHistory, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	history := x.histories[chequebook]
+	from := fromBlock
+	if history == nil {
+		book, err := NewChequebook(chequebook, x.backend, ReadOnlyWallet{})
+		if err != nil {
+			return nil, err
+		}
+		// a chequebook holding ether has no token to ask for, other code is indexed like a v0.2.3 chequebook
+		if version, err := DetectVersion(ctx, x.backend, chequebook); err == nil {
+			book.Version = version
+		}
+		token, err := book.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		history = &ChequebookHistory{Chequebook: chequebook, Token: token}
+	} else {
+		from = history.ScannedTo + 1
+	}
+
+	head, err := x.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	to := head.Number.Uint64()
+	if from > to {
+		return history, nil
+	}
+
+	var logs []types.Log
+	queries := []ethereum.FilterQuery{
+		{Addresses: []common.Address{chequebook}, Topics: [][]common.Hash{{chequeCashedTopic, chequeBouncedTopic}}},
+		{Addresses: []common.Address{history.Token}, Topics: [][]common.Hash{{transferTopic}, nil, {chequebook.Hash()}}},
+		{Addresses: []common.Address{history.Token}, Topics: [][]common.Hash{{transferTopic}, {chequebook.Hash()}}},
+	}
+	if (factory != common.Address{}) {
+		queries = append(queries, ethereum.FilterQuery{Addresses: []common.Address{factory}, Topics: [][]common.Hash{{simpleSwapDeployedTopic}}})
+	}
+	for _, query := range queries {
+		found, err := x.filterLogs(ctx, query, from, to)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, found...)
+	}
+
+	entries, err := x.entries(ctx, chequebook, logs)
+	if err != nil {
+		return nil, err
+	}
+
+	// the history is only replaced once the whole range was scanned, a failed update is repeated in full
+	updated := *history
+	updated.Entries = append(append([]HistoryEntry(nil), history.Entries...), entries...)
+	updated.ScannedTo = to
+	x.histories[chequebook] = &updated
+	if err := x.save(); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// filterLogs runs query over the blocks from to to in chunks of BlockRange
+func (x *HistoryIndex) filterLogs(ctx context.Context, query ethereum.FilterQuery, from uint64, to uint64) ([]types.Log, error) {
+	return filterLogRange(ctx, x.backend, query, from, to, x.BlockRange)
+}
+
+// filterLogRange runs query over the blocks from to to in chunks of blockRange, zero uses DefaultHistoryBlockRange
+func filterLogRange(ctx context.Context, backend EthBackend, query ethereum.FilterQuery, from uint64, to uint64, blockRange uint64) ([]types.Log, error) {
+	if blockRange == 0 {
+		blockRange = DefaultHistoryBlockRange
+	}
+
+	var logs []types.Log
+	for start := from; start <= to; start += blockRange {
+		end := start + blockRange - 1
+		if end > to {
+			end = to
+		}
+		query.FromBlock = new(big.Int).SetUint64(start)
+		query.ToBlock = new(big.Int).SetUint64(end)
+
+		var found []types.Log
+		err := WithRetry(ctx, DefaultRetryAttempts, func() (err error) {
+			found, err = backend.FilterLogs(ctx, query)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("querying logs of blocks %d to %d: %w", start, end, err)
+		}
+		logs = append(logs, found...)
+	}
+	return logs, nil
+}
+
+// entries turns the logs found for chequebook into history entries ordered by block and log index
+func (x *HistoryIndex) entries(ctx context.Context, chequebook common.Address, logs []types.Log) ([]HistoryEntry, error) {
+	sort.Slice(logs, func(a, b int) bool {
+		return logPosition{block: logs[b].BlockNumber, index: logs[b].Index}.after(logPosition{block: logs[a].BlockNumber, index: logs[a].Index})
+	})
+
+	// cashouts and bounces transfer tokens as well, those transfers are part of the cashout entry
+	cashoutTxs := make(map[common.Hash]bool)
+	bouncedTxs := make(map[common.Hash]bool)
+	for _, entry := range logs {
+		switch {
+		case len(entry.Topics) == 0:
+		case entry.Address == chequebook && entry.Topics[0] == chequeCashedTopic:
+			cashoutTxs[entry.TxHash] = true
+		case entry.Address == chequebook && entry.Topics[0] == chequeBouncedTopic:
+			bouncedTxs[entry.TxHash] = true
+		}
+	}
+
+	times := make(map[uint64]uint64)
+	var entries []HistoryEntry
+	for _, entry := range logs {
+		if entry.Removed || len(entry.Topics) == 0 {
+			continue
+		}
+		item := HistoryEntry{Block: entry.BlockNumber, TxHash: entry.TxHash, LogIndex: entry.Index}
+
+		switch entry.Topics[0] {
+		case simpleSwapDeployedTopic:
+			if len(entry.Data) != 32 || common.BytesToAddress(entry.Data) != chequebook {
+				continue
+			}
+			item.Kind = HistoryDeployed
+			item.Account = entry.Address
+		case chequeCashedTopic:
+			cashed, err := x.parser.ParseChequeCashed(entry)
+			if err != nil {
+				return nil, fmt.Errorf("parsing ChequeCashed event: %w", err)
+			}
+			recipient := cashed.Recipient
+			item.Kind = HistoryCashout
+			item.Account = cashed.Beneficiary
+			item.Recipient = &recipient
+			item.Amount = cashed.TotalPayout.String()
+			item.CumulativePayout = cashed.CumulativePayout.String()
+			item.CallerPayout = cashed.CallerPayout.String()
+			item.Bounced = bouncedTxs[entry.TxHash]
+		case transferTopic:
+			if len(entry.Topics) != 3 || len(entry.Data) != 32 || cashoutTxs[entry.TxHash] {
+				continue
+			}
+			from := common.BytesToAddress(entry.Topics[1].Bytes())
+			to := common.BytesToAddress(entry.Topics[2].Bytes())
+			item.Amount = new(big.Int).SetBytes(entry.Data).String()
+			if to == chequebook {
+				item.Kind = HistoryDeposit
+				item.Account = from
+			} else {
+				item.Kind = HistoryWithdrawal
+				item.Account = to
+			}
+		default:
+			continue
+		}
+
+		if _, ok := times[entry.BlockNumber]; !ok {
+			header, err := x.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(entry.BlockNumber))
+			if err != nil {
+				return nil, err
+			}
+			times[entry.BlockNumber] = header.Time
+		}
+		item.Time = times[entry.BlockNumber]
+		entries = append(entries, item)
+	}
+	return entries, nil
+}
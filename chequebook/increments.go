@@ -0,0 +1,126 @@
+package chequebook
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+)
+
+// CumulativeFromIncrements converts incremental payments into the cumulative payouts of the corresponding cheques
+// a missing or negative increment is an error, as no later cheque may pay out less than an earlier one
+func CumulativeFromIncrements(increments []*big.Int) ([]*big.Int, error) {
+	cumulative := make([]*big.Int, len(increments))
+	total := new(big.Int)
+	for i, increment := range increments {
+		if err := checkIncrement(increment, i); err != nil {
+			return nil, err
+		}
+		total.Add(total, increment)
+		cumulative[i] = new(big.Int).Set(total)
+	}
+	return cumulative, nil
+}
+
+// checkIncrement checks the increment at position i is set and not negative
+func checkIncrement(increment *big.Int, i int) error {
+	if increment == nil {
+		return fmt.Errorf("increment at position %d is missing", i)
+	}
+	if increment.Sign() < 0 {
+		return fmt.Errorf("negative increment %v at position %d", increment, i)
+	}
+	return nil
+}
+
+// IncrementsFromCumulative converts cumulative payouts into the incremental payments between them
+// a sequence ValidateCumulative rejects is an error, as it would yield missing or negative increments
+func IncrementsFromCumulative(cumulative []*big.Int) ([]*big.Int, error) {
+	if err := ValidateCumulative(cumulative); err != nil {
+		return nil, err
+	}
+	increments := make([]*big.Int, len(cumulative))
+	previous := new(big.Int)
+	for i, value := range cumulative {
+		increments[i] = new(big.Int).Sub(value, previous)
+		previous = value
+	}
+	return increments, nil
+}
+
+// ValidateCumulative checks that a sequence of cumulative payouts is non-negative and monotonically non-decreasing
+func ValidateCumulative(cumulative []*big.Int) error {
+	previous := new(big.Int)
+	for i, value := range cumulative {
+		if value == nil {
+			return fmt.Errorf("cumulative payout at position %d is missing", i)
+		}
+		if value.Cmp(previous) < 0 {
+			return fmt.Errorf("cumulative payout %v at position %d is below the previous value %v", value, i, previous)
+		}
+		previous = value
+	}
+	return nil
+}
+
+// ChequeForIncrement builds the cheque which pays out the first n increments on top of the base cheque
+func ChequeForIncrement(base *ChequeParams, increments []*big.Int, n int) (*ChequeParams, error) {
+	if n < 0 || n > len(increments) {
+		return nil, fmt.Errorf("increment %d out of range", n)
+	}
+	if err := base.validate(); err != nil {
+		return nil, err
+	}
+
+	cumulative := new(big.Int).Set(base.CumulativePayout)
+	for i, increment := range increments[:n] {
+		if err := checkIncrement(increment, i); err != nil {
+			return nil, err
+		}
+		cumulative.Add(cumulative, increment)
+	}
+
+	cheque := &ChequeParams{
+		Contract:         base.Contract,
+		Beneficiary:      base.Beneficiary,
+		CumulativePayout: cumulative,
+	}
+	if err := cheque.validate(); err != nil {
+		return nil, err
+	}
+	return cheque, nil
+}
+
+// IssueIncrementingCheques signs n cheques on top of base, the first paying base's cumulative payout
+// and every following one increment more, so the last cheque alone settles the whole balance
+func IssueIncrementingCheques(wallet WalletBackend, account accounts.Account, base *ChequeParams, increment *big.Int, n int, chainID *big.Int, typed bool) ([]*SignedCheque, error) {
+	if n < 1 {
+		return nil, errors.New("at least one cheque has to be issued")
+	}
+	if increment == nil {
+		return nil, errors.New("no increment")
+	}
+	if increment.Sign() < 0 {
+		return nil, errors.New("negative increment")
+	}
+
+	increments := make([]*big.Int, n-1)
+	for i := range increments {
+		increments[i] = increment
+	}
+
+	cheques := make([]*SignedCheque, n)
+	for i := range cheques {
+		cheque, err := ChequeForIncrement(base, increments, i)
+		if err != nil {
+			return nil, err
+		}
+
+		cheques[i], err = Issue(wallet, account, cheque, chainID, typed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cheques, nil
+}
@@ -0,0 +1,198 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrInsufficientLiquidity is returned if issuing a cheque would leave more uncashed cheques than the chequebook's liquid balance covers
+var ErrInsufficientLiquidity = fmt.Errorf("%w: liquid balance exceeded", ErrChequeNotCoveredByBalance)
+
+// Issuer issues cheques of a chequebook by amount, keeping the cumulative payout per beneficiary in a ChequeStore
+type Issuer struct {
+	book    *Chequebook
+	account accounts.Account
+	store   *ChequeStore // holds the last issued cheque per beneficiary
+	chainID *big.Int
+	typed   bool // sign as EIP-712 typed data instead of the personal-sign format
+
+	TTL time.Duration // validity window of issued cheques, 0 issues cheques which never expire
+
+	mu sync.Mutex // serializes issuing so two cheques never start from the same cumulative payout
+}
+
+// NewIssuer creates an Issuer for the chequebook signing with the wallet account of its owner
+// store should only be used for cheques issued by this chequebook, not for received ones
+func NewIssuer(ctx context.Context, book *Chequebook, store *ChequeStore, chainID *big.Int, typed bool) (*Issuer, error) {
+	owner, err := book.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := walletAccount(book.wallet, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		book:    book,
+		account: account,
+		store:   store,
+		chainID: chainID,
+		typed:   typed,
+	}, nil
+}
+
+// Issue signs and stores a cheque paying amount on top of everything issued to beneficiary so far
+// the cheque is refused if the uncashed part of all issued cheques including it exceeds the liquid balance
+func (i *Issuer) Issue(ctx context.Context, beneficiary common.Address, amount *big.Int) (*SignedCheque, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("cheque amount must be positive")
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	opts := &bind.CallOpts{Context: ctx}
+	paidOut, err := i.book.instance.PaidOut(opts, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	// without a stored cheque, or with one lost from the store, count from what was already paid out on chain
+	cumulativePayout := new(big.Int).Set(paidOut)
+	last, err := i.store.Last(i.book.address, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && last.CumulativePayout.Cmp(cumulativePayout) > 0 {
+		cumulativePayout.Set(last.CumulativePayout)
+	}
+	cumulativePayout.Add(cumulativePayout, amount)
+
+	uncashed, err := i.uncashed(ctx, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	uncashed.Add(uncashed, new(big.Int).Sub(cumulativePayout, paidOut))
+
+	liquidBalance, err := i.book.instance.LiquidBalance(opts)
+	if err != nil {
+		return nil, err
+	}
+	if uncashed.Cmp(liquidBalance) > 0 {
+		return nil, fmt.Errorf("%w: %v uncashed after issuing, liquid balance %v", ErrInsufficientLiquidity, uncashed, liquidBalance)
+	}
+
+	signed, err := i.sign(beneficiary, cumulativePayout)
+	if err != nil {
+		return nil, err
+	}
+	i.book.Metrics.chequeIssued(amount)
+	i.book.Notifier.issued(signed, amount)
+	return signed, nil
+}
+
+// sign signs and stores a cheque of beneficiary for cumulativePayout valid for TTL from now
+func (i *Issuer) sign(beneficiary common.Address, cumulativePayout *big.Int) (*SignedCheque, error) {
+	signed, err := Issue(i.book.wallet, i.account, &ChequeParams{
+		Contract:         i.book.address,
+		Beneficiary:      beneficiary,
+		CumulativePayout: cumulativePayout,
+	}, i.chainID, i.typed)
+	if err != nil {
+		return nil, err
+	}
+	if i.chainID != nil {
+		signed.ChainID = new(big.Int).Set(i.chainID)
+	}
+	signed.SetValidity(time.Now(), i.TTL)
+	if err := i.store.Put(signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// Expired lists the issued cheques whose validity window has passed with part of them still not paid out on chain
+// the beneficiary no longer cashes them by agreement, but the chequebook still would, so they keep counting against the liquid balance
+func (i *Issuer) Expired(ctx context.Context) ([]OutstandingCheque, error) {
+	cheques, err := i.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []OutstandingCheque
+	now := time.Now()
+	for _, cheque := range cheques {
+		if cheque.Contract != i.book.address || !cheque.Expired(now) {
+			continue
+		}
+		paidOut, err := i.book.instance.PaidOut(&bind.CallOpts{Context: ctx}, cheque.Beneficiary)
+		if err != nil {
+			return nil, err
+		}
+		if amount := new(big.Int).Sub(cheque.CumulativePayout, paidOut); amount.Sign() > 0 {
+			expired = append(expired, OutstandingCheque{Cheque: cheque, Amount: amount})
+		}
+	}
+	return expired, nil
+}
+
+// Renew supersedes the expired cheque of beneficiary with one for the same cumulative payout and a fresh validity window
+// nothing is added to the payout, so the part the expired cheque left unpaid is owed once and not twice
+// a further Issue also supersedes it, as every cheque includes the payout of the ones before
+func (i *Issuer) Renew(ctx context.Context, beneficiary common.Address) (*SignedCheque, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	last, err := i.store.Last(i.book.address, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no cheque issued to %s", beneficiary.Hex())
+	}
+	if !last.Expired(time.Now()) {
+		return nil, fmt.Errorf("the cheque of %s has not expired", beneficiary.Hex())
+	}
+	paidOut, err := i.book.instance.PaidOut(&bind.CallOpts{Context: ctx}, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+	if last.CumulativePayout.Cmp(paidOut) <= 0 {
+		return nil, fmt.Errorf("the expired cheque of %s was paid out in full", beneficiary.Hex())
+	}
+	return i.sign(beneficiary, last.CumulativePayout)
+}
+
+// uncashed sums the part of the stored cheques of the chequebook not paid out yet, leaving out the cheque of beneficiary
+func (i *Issuer) uncashed(ctx context.Context, beneficiary common.Address) (*big.Int, error) {
+	cheques, err := i.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	for _, cheque := range cheques {
+		if cheque.Contract != i.book.address || cheque.Beneficiary == beneficiary {
+			continue
+		}
+
+		paidOut, err := i.book.instance.PaidOut(&bind.CallOpts{Context: ctx}, cheque.Beneficiary)
+		if err != nil {
+			return nil, err
+		}
+		if cheque.CumulativePayout.Cmp(paidOut) > 0 {
+			total.Add(total, new(big.Int).Sub(cheque.CumulativePayout, paidOut))
+		}
+	}
+	return total, nil
+}
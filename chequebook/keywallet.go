@@ -0,0 +1,130 @@
+package chequebook
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// KeyWallet is a WalletBackend holding private keys in memory
+// it signs data the same way clef does so signatures verify identically
+type KeyWallet struct {
+	accounts []accounts.Account
+	keys     map[common.Address]*ecdsa.PrivateKey
+}
+
+// NewKeyWallet creates a wallet for the given keys, the first key becomes the first account
+func NewKeyWallet(keys ...*ecdsa.PrivateKey) *KeyWallet {
+	wallet := &KeyWallet{keys: make(map[common.Address]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if _, ok := wallet.keys[address]; ok {
+			continue
+		}
+		wallet.keys[address] = key
+		wallet.accounts = append(wallet.accounts, accounts.Account{Address: address})
+	}
+	return wallet
+}
+
+// LoadKeystoreWallet decrypts all key files in the keystore directory with password
+func LoadKeystoreWallet(dir string, password string) (*KeyWallet, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*ecdsa.PrivateKey
+	for _, file := range files {
+		// skip subdirectories and the editor and hidden files the keystore itself ignores
+		if file.IsDir() || file.Name()[0] == '.' || file.Name()[len(file.Name())-1] == '~' {
+			continue
+		}
+
+		keyJSON, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := keystore.DecryptKey(keyJSON, password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting key file %s: %w", file.Name(), err)
+		}
+		keys = append(keys, key.PrivateKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key files in keystore %s", dir)
+	}
+	return NewKeyWallet(keys...), nil
+}
+
+// Accounts returns the accounts of the wallet in the order the keys were added
+func (w *KeyWallet) Accounts() []accounts.Account {
+	return w.accounts
+}
+
+// SignData signs text/plain data with the eth_sign prefix or EIP-712 typed data
+// like clef the returned signature has a v value of 27 or 28
+func (w *KeyWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	key, err := w.key(account)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := dataHash(mimetype, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// dataHash returns the hash clef signs for data of the given mimetype
+func dataHash(mimetype string, data []byte) ([]byte, error) {
+	switch mimetype {
+	case accounts.MimetypeTextPlain:
+		return accounts.TextHash(data), nil
+	case accounts.MimetypeTypedData:
+		var typedData core.TypedData
+		if err := json.Unmarshal(data, &typedData); err != nil {
+			return nil, err
+		}
+		return hashTypedData(typedData)
+	default:
+		return nil, fmt.Errorf("unsupported mimetype %s", mimetype)
+	}
+}
+
+// SignTx signs the transaction for the given chain
+func (w *KeyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := w.key(account)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+}
+
+func (w *KeyWallet) key(account accounts.Account) (*ecdsa.PrivateKey, error) {
+	key, ok := w.keys[account.Address]
+	if !ok {
+		return nil, errors.New("unknown account")
+	}
+	return key, nil
+}
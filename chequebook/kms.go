@@ -0,0 +1,191 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// kmsTimeout bounds a single request to the KMS api
+const kmsTimeout = 30 * time.Second
+
+// AWSKMSSigner is a DigestSigner for an ECC_SECG_P256K1 key of AWS KMS
+// it calls the json api of KMS directly, signing the requests with signature version 4
+type AWSKMSSigner struct {
+	KeyID    string // id, arn or alias of the key
+	Region   string
+	Endpoint string // url of the KMS api, empty uses the regional endpoint of amazonaws.com
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // only needed for temporary credentials
+
+	Client *http.Client // nil uses a client with a timeout of thirty seconds
+	now    func() time.Time
+}
+
+// NewAWSKMSWallet creates a wallet signing with the KMS key of signer, whose public key is fetched from KMS
+func NewAWSKMSWallet(ctx context.Context, signer *AWSKMSSigner) (*RemoteKeyWallet, error) {
+	public, err := signer.PublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteKeyWallet(signer, public), nil
+}
+
+// PublicKey fetches the public key of the KMS key
+func (s *AWSKMSSigner) PublicKey(ctx context.Context) (*ecdsa.PublicKey, error) {
+	var reply struct {
+		PublicKey []byte
+		KeySpec   string
+	}
+	if err := s.call(ctx, "GetPublicKey", map[string]string{"KeyId": s.KeyID}, &reply); err != nil {
+		return nil, err
+	}
+	if reply.KeySpec != "" && reply.KeySpec != "ECC_SECG_P256K1" {
+		return nil, fmt.Errorf("kms key %s is a %s key, expected ECC_SECG_P256K1", s.KeyID, reply.KeySpec)
+	}
+	return ParsePublicKeyDER(reply.PublicKey)
+}
+
+// SignDigest has KMS sign the 32 byte digest as it is and returns the DER signature
+func (s *AWSKMSSigner) SignDigest(digest []byte) ([]byte, error) {
+	request := map[string]string{
+		"KeyId":            s.KeyID,
+		"Message":          base64.StdEncoding.EncodeToString(digest),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}
+	var reply struct {
+		Signature []byte
+	}
+	if err := s.call(context.Background(), "Sign", request, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Signature, nil
+}
+
+// endpoint returns the url of the KMS api
+func (s *AWSKMSSigner) endpoint() string {
+	if s.Endpoint != "" {
+		return s.Endpoint
+	}
+	return "https://kms." + s.Region + ".amazonaws.com/"
+}
+
+// call sends the KMS action with the json body request and decodes the answer into reply
+func (s *AWSKMSSigner) call(ctx context.Context, action string, request interface{}, reply interface{}) error {
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return errors.New("kms signer has no aws credentials")
+	}
+	if s.Region == "" {
+		return errors.New("kms signer has no aws region")
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	s.signRequest(req, body, now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: kmsTimeout}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("kms %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &failure)
+		return fmt.Errorf("kms %s answered %s: %s %s", action, resp.Status, failure.Type, failure.Message)
+	}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return fmt.Errorf("invalid answer to kms %s: %v", action, err)
+	}
+	return nil
+}
+
+// signRequest adds the signature version 4 authorization of the kms service to req
+func (s *AWSKMSSigner) signRequest(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if s.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	sort.Strings(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{req.Method, path, canonicalQuery(req.URL), canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:])}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + s.Region + "/kms/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "kms")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query of u sorted by key as signature version 4 expects it
+func canonicalQuery(u *url.URL) string {
+	return strings.Replace(u.Query().Encode(), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
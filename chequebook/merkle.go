@@ -0,0 +1,84 @@
+package chequebook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// hashPair hashes two nodes in sorted order, as done by OpenZeppelin's MerkleProof library
+func hashPair(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256(a, b)
+}
+
+// MerkleRoot computes the Merkle root over the cheque IDs using sorted pair hashing
+// the returned proofs are the concatenated 32-byte sibling hashes for each cheque, in the same order as the cheques
+// an unpaired node at the end of a level is promoted to the next level unchanged
+// the signatures are not part of the leaves, a verifier checks them separately against the cheque IDs
+func MerkleRoot(cheques []*SignedCheque) (common.Hash, [][]byte, error) {
+	if len(cheques) == 0 {
+		return common.Hash{}, nil, errors.New("no cheques")
+	}
+
+	level := make([][]byte, len(cheques))
+	// positions tracks the index within the current level of the node each leaf ended up in
+	positions := make([]int, len(cheques))
+	for i, cheque := range cheques {
+		if cheque == nil {
+			return common.Hash{}, nil, fmt.Errorf("cheque %d is nil", i)
+		}
+		id, err := cheque.chequeID()
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+		level[i] = id.Bytes()
+		positions[i] = i
+	}
+
+	proofs := make([][]byte, len(cheques))
+	for len(level) > 1 {
+		for leaf, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				proofs[leaf] = append(proofs[leaf], level[sibling]...)
+			}
+			positions[leaf] = pos / 2
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashPair(level[i], level[i+1]))
+		}
+		level = next
+	}
+
+	return common.BytesToHash(level[0]), proofs, nil
+}
+
+// VerifyMerkleProof checks that the cheque is included in the tree with the given root
+func VerifyMerkleProof(root common.Hash, cheque *SignedCheque, proof []byte) bool {
+	if cheque == nil || len(proof)%common.HashLength != 0 {
+		return false
+	}
+
+	id, err := cheque.chequeID()
+	if err != nil {
+		return false
+	}
+
+	node := id.Bytes()
+	for i := 0; i < len(proof); i += common.HashLength {
+		node = hashPair(node, proof[i:i+common.HashLength])
+	}
+	return bytes.Equal(node, root.Bytes())
+}
@@ -0,0 +1,241 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Metrics counts the cheques and transactions of a process for a prometheus endpoint
+// every method is a no-op on a nil *Metrics, so components record into it unconditionally
+type Metrics struct {
+	registry metrics.Registry
+
+	chequesIssued   metrics.Counter
+	chequesReceived metrics.Counter
+	chequesCashed   metrics.Counter
+	issuedTotal     metrics.GaugeFloat64 // token amounts do not fit an int64 counter
+	cashedTotal     metrics.GaugeFloat64
+	cashoutGas      metrics.Counter
+	pendingTxs      metrics.Gauge
+	signerLatency   metrics.Timer
+	rpcErrors       metrics.Counter
+
+	mu      sync.Mutex // guards the read-modify-write of the totals and pending
+	pending int64
+}
+
+// NewMetrics creates the chequebook metrics in a registry of their own
+// go-ethereum only collects metrics created while metrics.Enabled is set, so it is set for the whole process
+func NewMetrics() *Metrics {
+	metrics.Enabled = true
+	registry := metrics.NewRegistry()
+	return &Metrics{
+		registry:        registry,
+		chequesIssued:   metrics.NewRegisteredCounter("chequebook/cheques/issued", registry),
+		chequesReceived: metrics.NewRegisteredCounter("chequebook/cheques/received", registry),
+		chequesCashed:   metrics.NewRegisteredCounter("chequebook/cheques/cashed", registry),
+		issuedTotal:     metrics.NewRegisteredGaugeFloat64("chequebook/payout/issued", registry),
+		cashedTotal:     metrics.NewRegisteredGaugeFloat64("chequebook/payout/cashed", registry),
+		cashoutGas:      metrics.NewRegisteredCounter("chequebook/cashout/gas", registry),
+		pendingTxs:      metrics.NewRegisteredGauge("chequebook/tx/pending", registry),
+		signerLatency:   metrics.NewRegisteredTimer("chequebook/signer/latency", registry),
+		rpcErrors:       metrics.NewRegisteredCounter("chequebook/rpc/errors", registry),
+	}
+}
+
+// Handler serves the metrics in the prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return prometheus.Handler(m.registry)
+}
+
+func addFloat(gauge metrics.GaugeFloat64, amount *big.Int) {
+	value, _ := new(big.Float).SetInt(amount).Float64()
+	gauge.Update(gauge.Value() + value)
+}
+
+// chequeIssued records a cheque adding amount to the payout of its beneficiary
+func (m *Metrics) chequeIssued(amount *big.Int) {
+	if m == nil {
+		return
+	}
+	m.chequesIssued.Inc(1)
+	m.mu.Lock()
+	addFloat(m.issuedTotal, amount)
+	m.mu.Unlock()
+}
+
+// chequeReceived records a cheque accepted from an issuer
+func (m *Metrics) chequeReceived() {
+	if m == nil {
+		return
+	}
+	m.chequesReceived.Inc(1)
+}
+
+// cashed records a mined cashout
+func (m *Metrics) cashed(result *CashResult) {
+	if m == nil {
+		return
+	}
+	m.cashoutGas.Inc(int64(result.GasUsed))
+	if result.Cashout == nil {
+		return
+	}
+	m.chequesCashed.Inc(1)
+	m.mu.Lock()
+	addFloat(m.cashedTotal, result.Cashout.TotalPayout)
+	m.mu.Unlock()
+}
+
+// txPending records a transaction being waited for, the returned function records that the wait ended
+func (m *Metrics) txPending() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.mu.Lock()
+	m.pending++
+	m.pendingTxs.Update(m.pending)
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		m.pending--
+		m.pendingTxs.Update(m.pending)
+		m.mu.Unlock()
+	}
+}
+
+// rpcError counts err unless it is nil, only reports that the endpoint cannot subscribe or is a reverting call
+func (m *Metrics) rpcError(err error) error {
+	if m != nil && err != nil && !errors.Is(err, rpc.ErrNotificationsUnsupported) && !strings.Contains(err.Error(), "revert") {
+		m.rpcErrors.Inc(1)
+	}
+	return err
+}
+
+// MeteredWallet is a WalletBackend recording how long its signing requests take
+type MeteredWallet struct {
+	WalletBackend
+	metrics *Metrics
+}
+
+// NewMeteredWallet wraps wallet to record the latency of its signing requests in m
+func NewMeteredWallet(wallet WalletBackend, m *Metrics) *MeteredWallet {
+	return &MeteredWallet{WalletBackend: wallet, metrics: m}
+}
+
+func (w *MeteredWallet) SignData(account accounts.Account, mimetype string, text []byte) ([]byte, error) {
+	defer w.metrics.signerLatency.UpdateSince(time.Now())
+	return w.WalletBackend.SignData(account, mimetype, text)
+}
+
+func (w *MeteredWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	defer w.metrics.signerLatency.UpdateSince(time.Now())
+	return w.WalletBackend.SignTx(account, tx, chainID)
+}
+
+// MeteredBackend is an EthBackend counting the rpc calls which fail
+// receipts not found yet are expected while waiting for a transaction and are not counted
+type MeteredBackend struct {
+	EthBackend
+	metrics *Metrics
+}
+
+// NewMeteredBackend wraps backend to count its failing calls in m
+func NewMeteredBackend(backend EthBackend, m *Metrics) *MeteredBackend {
+	return &MeteredBackend{EthBackend: backend, metrics: m}
+}
+
+func (b *MeteredBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	code, err := b.EthBackend.CodeAt(ctx, contract, blockNumber)
+	return code, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	output, err := b.EthBackend.CallContract(ctx, call, blockNumber)
+	return output, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	code, err := b.EthBackend.PendingCodeAt(ctx, account)
+	return code, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	nonce, err := b.EthBackend.PendingNonceAt(ctx, account)
+	return nonce, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	price, err := b.EthBackend.SuggestGasPrice(ctx)
+	return price, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	gas, err := b.EthBackend.EstimateGas(ctx, call)
+	return gas, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return b.metrics.rpcError(b.EthBackend.SendTransaction(ctx, tx))
+}
+
+func (b *MeteredBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	logs, err := b.EthBackend.FilterLogs(ctx, query)
+	return logs, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	sub, err := b.EthBackend.SubscribeFilterLogs(ctx, query, ch)
+	return sub, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := b.EthBackend.TransactionReceipt(ctx, txHash)
+	if err == ethereum.NotFound {
+		return nil, err
+	}
+	return receipt, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	nonce, err := b.EthBackend.NonceAt(ctx, account, blockNumber)
+	return nonce, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	balance, err := b.EthBackend.BalanceAt(ctx, account, blockNumber)
+	return balance, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, err := b.EthBackend.HeaderByNumber(ctx, number)
+	return header, b.metrics.rpcError(err)
+}
+
+func (b *MeteredBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	id, err := b.EthBackend.ChainID(ctx)
+	return id, b.metrics.rpcError(err)
+}
+
+// SubscribeNewHead passes head subscriptions through so waiting for transactions keeps following new heads
+func (b *MeteredBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	subscriber, ok := b.EthBackend.(headSubscriber)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub, err := subscriber.SubscribeNewHead(ctx, ch)
+	return sub, b.metrics.rpcError(err)
+}
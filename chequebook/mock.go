@@ -0,0 +1,313 @@
+package chequebook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MockSignRequest is a SignData request received by a MockWallet
+type MockSignRequest struct {
+	Account  accounts.Account
+	Mimetype string
+	Data     []byte
+}
+
+// MockWallet is a WalletBackend for tests recording its signing requests and answering them with canned values
+type MockWallet struct {
+	Owned     []accounts.Account // returned by Accounts
+	Signature []byte             // returned by every SignData, nil signs with Key
+	Key       *ecdsa.PrivateKey  // signs data and transactions of every account, nil returns transactions unsigned
+	Err       error              // returned by every signing request instead of signing
+
+	mu           sync.Mutex
+	DataRequests []MockSignRequest
+	SignedTxs    []*types.Transaction
+}
+
+func (w *MockWallet) Accounts() []accounts.Account {
+	return w.Owned
+}
+
+func (w *MockWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	w.mu.Lock()
+	w.DataRequests = append(w.DataRequests, MockSignRequest{Account: account, Mimetype: mimetype, Data: common.CopyBytes(data)})
+	w.mu.Unlock()
+
+	switch {
+	case w.Err != nil:
+		return nil, w.Err
+	case w.Signature != nil:
+		return common.CopyBytes(w.Signature), nil
+	case w.Key == nil:
+		return nil, fmt.Errorf("mock wallet has neither a signature nor a key for %s", account.Address.Hex())
+	}
+
+	hash, err := dataHash(mimetype, data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(hash, w.Key)
+	if err != nil {
+		return nil, err
+	}
+	// like clef, the recovery id is offset by 27
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+func (w *MockWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if w.Err != nil {
+		return nil, w.Err
+	}
+	signed := tx
+	if w.Key != nil {
+		var err error
+		if signed, err = types.SignTx(tx, types.NewEIP155Signer(chainID), w.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.SignedTxs = append(w.SignedTxs, signed)
+	return signed, nil
+}
+
+// MockBackend is an EthBackend for tests recording the calls it receives and answering them with canned values
+// every sent transaction is mined at once in a block of its own with a successful receipt,
+// a contract creation gets DeployedCode at the address derived from its sender and nonce
+type MockBackend struct {
+	ChainIDValue *big.Int                               // nil reports chain 1337
+	GasPrice     *big.Int                               // suggested gas price, nil suggests 1 gwei
+	Gas          uint64                                 // gas estimate of every call, 0 estimates 100000
+	Nonces       map[common.Address]uint64              // pending nonces, raised by every sent transaction
+	Balances     map[common.Address]*big.Int            // ether balances, missing accounts have none
+	Code         map[common.Address][]byte              // contract code, filled in by mined contract creations
+	DeployedCode []byte                                 // code of created contracts, nil creates them without code
+	Receipts     map[common.Hash]*types.Receipt         // receipts returned instead of those of mined transactions
+	Logs         []types.Log                            // logs returned by FilterLogs for the queried addresses
+	Call         func(ethereum.CallMsg) ([]byte, error) // answers CallContract, nil returns empty output
+	Errors       map[string]error                       // errors returned by the methods of the given names instead of their results
+
+	mu    sync.Mutex
+	Calls []string             // names of the called methods in order
+	Sent  []*types.Transaction // transactions received by SendTransaction
+	head  uint64
+}
+
+// record notes the call of method and returns the error configured for it
+func (b *MockBackend) record(method string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Calls = append(b.Calls, method)
+	return b.Errors[method]
+}
+
+func (b *MockBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	if err := b.record("CodeAt"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Code[contract], nil
+}
+
+func (b *MockBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	if err := b.record("PendingCodeAt"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Code[account], nil
+}
+
+func (b *MockBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if err := b.record("CallContract"); err != nil {
+		return nil, err
+	}
+	if b.Call == nil {
+		return nil, nil
+	}
+	return b.Call(call)
+}
+
+func (b *MockBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	if err := b.record("PendingNonceAt"); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Nonces[account], nil
+}
+
+func (b *MockBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	if err := b.record("NonceAt"); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Nonces[account], nil
+}
+
+func (b *MockBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	if err := b.record("BalanceAt"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if balance, ok := b.Balances[account]; ok {
+		return new(big.Int).Set(balance), nil
+	}
+	return new(big.Int), nil
+}
+
+func (b *MockBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	if err := b.record("SuggestGasPrice"); err != nil {
+		return nil, err
+	}
+	if b.GasPrice == nil {
+		return big.NewInt(1000000000), nil
+	}
+	return new(big.Int).Set(b.GasPrice), nil
+}
+
+func (b *MockBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	if err := b.record("EstimateGas"); err != nil {
+		return 0, err
+	}
+	if b.Gas == 0 {
+		return 100000, nil
+	}
+	return b.Gas, nil
+}
+
+// SendTransaction mines tx right away, its sender is recovered from the signature or taken to be the zero address for unsigned transactions
+func (b *MockBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := b.record("SendTransaction"); err != nil {
+		return err
+	}
+	sender, err := transactionSender(tx)
+	if err != nil {
+		sender = common.Address{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Sent = append(b.Sent, tx)
+	b.head++
+	if b.Nonces == nil {
+		b.Nonces = make(map[common.Address]uint64)
+	}
+	if tx.Nonce() >= b.Nonces[sender] {
+		b.Nonces[sender] = tx.Nonce() + 1
+	}
+
+	receipt := &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		TxHash:      tx.Hash(),
+		GasUsed:     tx.Gas(),
+		BlockNumber: new(big.Int).SetUint64(b.head),
+	}
+	if tx.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(sender, tx.Nonce())
+		if b.DeployedCode != nil {
+			if b.Code == nil {
+				b.Code = make(map[common.Address][]byte)
+			}
+			b.Code[receipt.ContractAddress] = b.DeployedCode
+		}
+	}
+	if b.Receipts == nil {
+		b.Receipts = make(map[common.Hash]*types.Receipt)
+	}
+	if _, ok := b.Receipts[tx.Hash()]; !ok {
+		b.Receipts[tx.Hash()] = receipt
+	}
+	return nil
+}
+
+func (b *MockBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if err := b.record("TransactionReceipt"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	receipt, ok := b.Receipts[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func (b *MockBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if err := b.record("FilterLogs"); err != nil {
+		return nil, err
+	}
+	var logs []types.Log
+	for _, entry := range b.Logs {
+		for _, address := range query.Addresses {
+			if entry.Address == address {
+				logs = append(logs, entry)
+				break
+			}
+		}
+	}
+	return logs, nil
+}
+
+// SubscribeFilterLogs fails like an http endpoint, the mock pushes nothing
+func (b *MockBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if err := b.record("SubscribeFilterLogs"); err != nil {
+		return nil, err
+	}
+	return nil, rpc.ErrNotificationsUnsupported
+}
+
+// HeaderByNumber returns a header carrying only its number, nil is the block of the last mined transaction
+func (b *MockBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if err := b.record("HeaderByNumber"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if number == nil {
+		number = new(big.Int).SetUint64(b.head)
+	}
+	if !number.IsUint64() || number.Uint64() > b.head {
+		return nil, ethereum.NotFound
+	}
+	return &types.Header{Number: new(big.Int).Set(number)}, nil
+}
+
+func (b *MockBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	if err := b.record("ChainID"); err != nil {
+		return nil, err
+	}
+	if b.ChainIDValue == nil {
+		return big.NewInt(1337), nil
+	}
+	return new(big.Int).Set(b.ChainIDValue), nil
+}
+
+// Called reports how often method was called
+func (b *MockBackend) Called(method string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := 0
+	for _, call := range b.Calls {
+		if call == method {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,191 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DefaultBumpTimeout is the default time a transaction may stay pending before it is resent with a higher gas price
+const DefaultBumpTimeout = time.Minute
+
+// ErrReplaced is reported if the nonce of a watched transaction was used by a transaction the monitor did not send
+var ErrReplaced = errors.New("transaction replaced by another transaction with the same nonce")
+
+// monitorPollInterval is the delay between two checks of the watched transactions
+var monitorPollInterval = time.Second
+
+// TxStatus is the final state of a watched transaction
+type TxStatus struct {
+	Tx      *types.Transaction // the mined transaction, or the last one sent if none of them was mined
+	Receipt *types.Receipt     // nil unless Err is nil
+	Bumps   int                // number of times the transaction was resent with a higher gas price
+	Err     error
+}
+
+// TxMonitor watches sent transactions until one of them is mined
+// a transaction pending for longer than BumpTimeout is signed again with the same nonce and a gas price raised by BumpPercent
+type TxMonitor struct {
+	backend EthBackend
+	wallet  WalletBackend
+	chainID *big.Int
+
+	BumpTimeout time.Duration // pending time after which the gas price is bumped, 0 never bumps
+	BumpPercent uint64        // gas price increase per bump, raised to the minimum nodes accept for replacements
+	MaxGasPrice *big.Int      // gas price which is never exceeded by bumping, nil leaves it unlimited
+
+	mu      sync.Mutex
+	pending map[common.Address]map[uint64]bool // watched nonces per sender
+}
+
+// NewTxMonitor creates a monitor re-signing bumped transactions with the wallet for the given chain
+func NewTxMonitor(backend EthBackend, wallet WalletBackend, chainID *big.Int) *TxMonitor {
+	return &TxMonitor{
+		backend:     backend,
+		wallet:      wallet,
+		chainID:     chainID,
+		BumpTimeout: DefaultBumpTimeout,
+		BumpPercent: 2 * replacementBumpPercent,
+		pending:     make(map[common.Address]map[uint64]bool),
+	}
+}
+
+// Pending returns the nonces of account which are currently watched
+func (m *TxMonitor) Pending(account common.Address) []uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nonces := make([]uint64, 0, len(m.pending[account]))
+	for nonce := range m.pending[account] {
+		nonces = append(nonces, nonce)
+	}
+	return nonces
+}
+
+// Watch follows the already sent transaction tx of account until it or one of its bumped replacements is mined
+// the final status is delivered on the returned channel, which is closed afterwards
+func (m *TxMonitor) Watch(ctx context.Context, account accounts.Account, tx *types.Transaction) <-chan TxStatus {
+	result := make(chan TxStatus, 1)
+
+	m.mu.Lock()
+	if m.pending[account.Address][tx.Nonce()] {
+		m.mu.Unlock()
+		result <- TxStatus{Tx: tx, Err: fmt.Errorf("nonce %d of %s is already watched", tx.Nonce(), account.Address.Hex())}
+		close(result)
+		return result
+	}
+	if m.pending[account.Address] == nil {
+		m.pending[account.Address] = make(map[uint64]bool)
+	}
+	m.pending[account.Address][tx.Nonce()] = true
+	m.mu.Unlock()
+
+	go func() {
+		status := m.watch(ctx, account, tx)
+
+		m.mu.Lock()
+		delete(m.pending[account.Address], tx.Nonce())
+		m.mu.Unlock()
+
+		result <- status
+		close(result)
+	}()
+	return result
+}
+
+// watch polls the receipts of all transactions sent for the nonce of tx and bumps the gas price when BumpTimeout passes
+func (m *TxMonitor) watch(ctx context.Context, account accounts.Account, tx *types.Transaction) TxStatus {
+	sent := []*types.Transaction{tx}
+	status := TxStatus{Tx: tx}
+	lastSent := time.Now()
+
+	ticker := time.NewTicker(monitorPollInterval)
+	defer ticker.Stop()
+	for {
+		// the nonce is read before the receipts so a transaction of ours mined in between is not taken for a replacement
+		mined, nonceErr := m.backend.NonceAt(ctx, account.Address, nil)
+
+		for _, candidate := range sent {
+			receipt, err := m.backend.TransactionReceipt(ctx, candidate.Hash())
+			if err == nil {
+				status.Tx = candidate
+				status.Receipt = receipt
+				return status
+			}
+			if !errors.Is(err, ethereum.NotFound) {
+				log.Debug("reading receipt failed", "tx", candidate.Hash().Hex(), "err", err)
+			}
+		}
+
+		// once the nonce is used without any of our receipts showing up something else took its place
+		if nonceErr == nil && mined > tx.Nonce() {
+			status.Err = fmt.Errorf("%w: nonce %d of %s", ErrReplaced, tx.Nonce(), account.Address.Hex())
+			return status
+		}
+
+		if m.BumpTimeout > 0 && time.Since(lastSent) >= m.BumpTimeout {
+			bumped, err := m.bump(ctx, account, status.Tx)
+			if err != nil {
+				log.Warn("resending transaction with a higher gas price failed", "tx", status.Tx.Hash().Hex(), "err", err)
+			} else if bumped != nil {
+				log.Info("resent transaction with a higher gas price", "tx", bumped.Hash().Hex(), "replaces", status.Tx.Hash().Hex(), "gasPrice", bumped.GasPrice())
+				sent = append(sent, bumped)
+				status.Tx = bumped
+				status.Bumps++
+			}
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			status.Err = fmt.Errorf("watching transaction %s: %w", status.Tx.Hash().Hex(), ctx.Err())
+			return status
+		}
+	}
+}
+
+// bump signs and sends tx again with a higher gas price
+// nil is returned without an error if MaxGasPrice leaves no room for a replacement
+func (m *TxMonitor) bump(ctx context.Context, account accounts.Account, tx *types.Transaction) (*types.Transaction, error) {
+	percent := m.BumpPercent
+	if percent < replacementBumpPercent {
+		percent = replacementBumpPercent
+	}
+
+	gasPrice := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(100+percent))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+	if m.MaxGasPrice != nil && gasPrice.Cmp(m.MaxGasPrice) > 0 {
+		minimum := new(big.Int).Mul(tx.GasPrice(), big.NewInt(100+replacementBumpPercent))
+		minimum.Div(minimum, big.NewInt(100))
+		if minimum.Cmp(m.MaxGasPrice) > 0 {
+			return nil, nil
+		}
+		gasPrice.Set(m.MaxGasPrice)
+	}
+
+	var replacement *types.Transaction
+	if tx.To() == nil {
+		replacement = types.NewContractCreation(tx.Nonce(), tx.Value(), tx.Gas(), gasPrice, tx.Data())
+	} else {
+		replacement = types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), gasPrice, tx.Data())
+	}
+
+	signed, err := m.wallet.SignTx(account, replacement, m.chainID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.backend.SendTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
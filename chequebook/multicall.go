@@ -0,0 +1,204 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrMulticallUnavailable is returned if there is no Multicall3 contract at the configured address
+var ErrMulticallUnavailable = errors.New("no multicall contract")
+
+// MaxMulticallCalls is the number of calls aggregated into a single eth_call, larger reads are split
+const MaxMulticallCalls = 500
+
+// multicallABI is the aggregate3 function of Multicall3, every call is allowed to fail on its own
+const multicallABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+// multicallCall and multicallResult are the Call3 and Result structs of aggregate3
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// StateQuery names a chequebook and the beneficiaries whose paid out amount and hard deposit are read with it
+type StateQuery struct {
+	Chequebook    common.Address
+	Beneficiaries []common.Address
+}
+
+// ChequebookState is the state of a chequebook at a single block as read by a StateReader
+type ChequebookState struct {
+	Chequebook       common.Address
+	Issuer           common.Address
+	Token            common.Address // zero for chequebooks holding ether, which answer token() with nothing or a revert
+	Balance          *big.Int       // liquid balance plus hard deposits, like balance() computes it
+	LiquidBalance    *big.Int
+	TotalPaidOut     *big.Int
+	TotalHardDeposit *big.Int
+	PaidOut          map[common.Address]*big.Int
+	HardDeposits     map[common.Address]*HardDeposit
+}
+
+// StateReader reads the state of many chequebooks at once
+// with a Multicall3 contract all reads go out as one eth_call per MaxMulticallCalls calls, without one every read is an eth_call of its own
+type StateReader struct {
+	backend   EthBackend
+	multicall common.Address
+	swap      abi.ABI
+	aggregate abi.ABI
+}
+
+// NewStateReader creates a reader aggregating its calls through the Multicall3 contract at multicall, zero disables aggregation
+func NewStateReader(backend EthBackend, multicall common.Address) (*StateReader, error) {
+	swap, err := abi.JSON(strings.NewReader(simpleswapfactory.ERC20SimpleSwapABI))
+	if err != nil {
+		return nil, err
+	}
+	aggregate, err := abi.JSON(strings.NewReader(multicallABI))
+	if err != nil {
+		return nil, err
+	}
+	return &StateReader{backend: backend, multicall: multicall, swap: swap, aggregate: aggregate}, nil
+}
+
+// stateCall is a single read of a chequebook and where its decoded result goes
+type stateCall struct {
+	target   common.Address
+	method   string
+	data     []byte
+	optional bool // a failing call leaves the result at its zero value instead of failing the read
+	result   interface{}
+}
+
+// Read returns the state of every queried chequebook in the order of queries
+func (r *StateReader) Read(ctx context.Context, queries []StateQuery) ([]*ChequebookState, error) {
+	var calls []*stateCall
+	add := func(target common.Address, optional bool, result interface{}, method string, args ...interface{}) error {
+		data, err := r.swap.Pack(method, args...)
+		if err != nil {
+			return err
+		}
+		calls = append(calls, &stateCall{target: target, method: method, data: data, optional: optional, result: result})
+		return nil
+	}
+
+	states := make([]*ChequebookState, len(queries))
+	var paidOuts []func() // move the decoded paid out amounts into their maps
+	for i, query := range queries {
+		state := &ChequebookState{
+			Chequebook:       query.Chequebook,
+			LiquidBalance:    new(big.Int),
+			TotalPaidOut:     new(big.Int),
+			TotalHardDeposit: new(big.Int),
+			PaidOut:          make(map[common.Address]*big.Int),
+			HardDeposits:     make(map[common.Address]*HardDeposit),
+		}
+		states[i] = state
+
+		address := query.Chequebook
+		reads := []error{
+			add(address, false, &state.Issuer, "issuer"),
+			add(address, true, &state.Token, "token"),
+			add(address, false, &state.LiquidBalance, "liquidBalance"),
+			add(address, false, &state.TotalPaidOut, "totalPaidOut"),
+			add(address, false, &state.TotalHardDeposit, "totalHardDeposit"),
+		}
+		for _, beneficiary := range query.Beneficiaries {
+			beneficiary := beneficiary
+			paidOut, deposit := new(*big.Int), new(HardDeposit)
+			paidOuts = append(paidOuts, func() { state.PaidOut[beneficiary] = *paidOut })
+			state.HardDeposits[beneficiary] = deposit
+			reads = append(reads, add(address, false, paidOut, "paidOut", beneficiary), add(address, false, deposit, "hardDeposits", beneficiary))
+		}
+		for _, err := range reads {
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for start := 0; start < len(calls); start += MaxMulticallCalls {
+		end := start + MaxMulticallCalls
+		if end > len(calls) {
+			end = len(calls)
+		}
+		if err := r.execute(ctx, calls[start:end]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, set := range paidOuts {
+		set()
+	}
+	for _, state := range states {
+		state.Balance = new(big.Int).Add(state.LiquidBalance, state.TotalHardDeposit)
+	}
+	return states, nil
+}
+
+// execute sends calls, through aggregate3 if the reader has a multicall contract, and decodes their results
+func (r *StateReader) execute(ctx context.Context, calls []*stateCall) error {
+	results := make([]multicallResult, len(calls))
+	errs := make([]error, len(calls))
+
+	if (r.multicall == common.Address{}) {
+		for i, call := range calls {
+			data, err := r.backend.CallContract(ctx, ethereum.CallMsg{To: &call.target, Data: call.data}, nil)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			results[i] = multicallResult{Success: err == nil, ReturnData: data}
+			errs[i] = err
+		}
+	} else {
+		aggregated := make([]multicallCall, len(calls))
+		for i, call := range calls {
+			aggregated[i] = multicallCall{Target: call.target, AllowFailure: true, CallData: call.data}
+		}
+		input, err := r.aggregate.Pack("aggregate3", aggregated)
+		if err != nil {
+			return err
+		}
+		output, err := r.backend.CallContract(ctx, ethereum.CallMsg{To: &r.multicall, Data: input}, nil)
+		if err != nil {
+			return err
+		}
+		if len(output) == 0 {
+			return fmt.Errorf("%w at %s", ErrMulticallUnavailable, r.multicall.Hex())
+		}
+		if err := r.aggregate.Unpack(&results, "aggregate3", output); err != nil {
+			return err
+		}
+		if len(results) != len(calls) {
+			return fmt.Errorf("multicall %s returned %d results for %d calls", r.multicall.Hex(), len(results), len(calls))
+		}
+	}
+
+	for i, call := range calls {
+		err := errs[i]
+		if err == nil && !results[i].Success {
+			err = errors.New("call reverted")
+		}
+		if err == nil {
+			err = r.swap.Unpack(call.result, call.method, results[i].ReturnData)
+		}
+		if err != nil && !call.optional {
+			return fmt.Errorf("reading %s of chequebook %s: %w", call.method, call.target.Hex(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package chequebook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrChainMismatch is returned if a cheque or chequebook of one chain is about to be cashed on another
+var ErrChainMismatch = errors.New("chain mismatch")
+
+// Network is the profile of a chain: the canonical deployment of the swap contracts on it and how to talk to it
+type Network struct {
+	Name    string         `json:"name"`
+	Factory common.Address `json:"factory,omitempty"` // zero deploys a factory of its own
+	Token   common.Address `json:"token,omitempty"`   // token of the factory's chequebooks, zero leaves the token to the caller
+
+	Multicall common.Address `json:"multicall,omitempty"` // Multicall3 contract aggregating state reads, zero reads one call at a time
+
+	RPC           string  `json:"rpc,omitempty"`           // endpoint of the chain, several comma separated ones fail over to each other
+	GasPrice      string  `json:"gasPrice,omitempty"`      // gas price in gwei instead of the node's suggestion
+	MaxGasPrice   string  `json:"maxGasPrice,omitempty"`   // gas price in gwei a resent transaction never exceeds
+	GasBuffer     *uint64 `json:"gasBuffer,omitempty"`     // safety margin in percent on top of gas estimates
+	Confirmations *uint64 `json:"confirmations,omitempty"` // blocks a transaction has to be buried under, counting its own
+}
+
+// NetworkRegistry maps chain ids to their canonical deployments
+type NetworkRegistry map[uint64]Network
+
+// knownNetworks are the bundled network profiles
+// no canonical deployment of the v0.2.3 contracts is bundled yet, only the chains, factories are registered through LoadNetworks
+var knownNetworks = NetworkRegistry{
+	12345:    {Name: "dev", RPC: "http://localhost:8545"},
+	11155111: {Name: "sepolia"},
+	100:      {Name: "gnosis"},
+}
+
+// DefaultNetworks returns a copy of the bundled registry
+func DefaultNetworks() NetworkRegistry {
+	registry := make(NetworkRegistry, len(knownNetworks))
+	for chainID, network := range knownNetworks {
+		registry[chainID] = network
+	}
+	return registry
+}
+
+// LoadNetworks reads a json object of chain ids to networks from path on top of the bundled registry
+// entries in the file replace bundled entries of the same chain, a name may only be used by one chain
+func LoadNetworks(path string) (NetworkRegistry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]Network
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid networks file %s: %v", path, err)
+	}
+
+	registry := DefaultNetworks()
+	for key, network := range entries {
+		chainID, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain id %q in networks file %s", key, path)
+		}
+		registry[chainID] = network
+	}
+	names := make(map[string]uint64, len(registry))
+	for chainID, network := range registry {
+		name := strings.ToLower(network.Name)
+		if name == "" {
+			continue
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("networks file %s names chains %d and %d %s", path, other, chainID, network.Name)
+		}
+		names[name] = chainID
+	}
+	return registry, nil
+}
+
+// ByName returns the chain id and profile of the network called name, ignoring case
+func (r NetworkRegistry) ByName(name string) (*big.Int, Network, bool) {
+	for chainID, network := range r {
+		if strings.EqualFold(network.Name, name) {
+			return new(big.Int).SetUint64(chainID), network, true
+		}
+	}
+	return nil, Network{}, false
+}
+
+// Names lists the names of the networks in the registry, sorted
+func (r NetworkRegistry) Names() []string {
+	names := make([]string, 0, len(r))
+	for _, network := range r {
+		if network.Name != "" {
+			names = append(names, network.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkChain returns ErrChainMismatch unless expected is nil or actual
+func checkChain(what string, expected *big.Int, actual *big.Int) error {
+	if expected != nil && expected.Cmp(actual) != 0 {
+		return fmt.Errorf("%w: %s belongs to chain %v, the backend is on chain %v", ErrChainMismatch, what, expected, actual)
+	}
+	return nil
+}
+
+// Lookup returns the canonical deployment on the chain, chains without one are treated as private or development chains
+func (r NetworkRegistry) Lookup(chainID *big.Int) (Network, bool) {
+	if chainID == nil || !chainID.IsUint64() {
+		return Network{}, false
+	}
+	network, ok := r[chainID.Uint64()]
+	return network, ok
+}
@@ -0,0 +1,115 @@
+package chequebook
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// nonceTracker hands out nonces per account locally after seeding each account once from the node
+// nodes do not always reflect just-sent transactions in their pending nonce, which makes back-to-back sends collide
+type nonceTracker struct {
+	mu     sync.Mutex
+	nonces map[common.Address]uint64
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{nonces: make(map[common.Address]uint64)}
+}
+
+// next returns the next nonce of account, querying pendingNonce only if the account is not tracked yet
+func (t *nonceTracker) next(account common.Address, pendingNonce func() (uint64, error)) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if nonce, ok := t.nonces[account]; ok {
+		return nonce, nil
+	}
+
+	nonce, err := pendingNonce()
+	if err != nil {
+		return 0, err
+	}
+	t.nonces[account] = nonce
+	return nonce, nil
+}
+
+// sent records that a transaction with nonce was sent for account
+func (t *nonceTracker) sent(account common.Address, nonce uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if current, ok := t.nonces[account]; !ok || nonce >= current {
+		t.nonces[account] = nonce + 1
+	}
+}
+
+// tracked reports whether the nonces of account are handed out locally already
+func (t *nonceTracker) tracked(account common.Address) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.nonces[account]
+	return ok
+}
+
+// reset forgets the nonce of account so the next one is read from the node again
+func (t *nonceTracker) reset(account common.Address) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.nonces, account)
+}
+
+// isNonceTooLow reports whether err is the node rejecting a transaction because its nonce was already used
+func isNonceTooLow(err error) bool {
+	return strings.Contains(err.Error(), "nonce too low")
+}
+
+// NonceTrackingBackend is an EthBackend which serves PendingNonceAt from a nonceTracker
+// this covers the bind.TransactOpts signer path as well as the cashout requests since both get their nonce from the backend
+type NonceTrackingBackend struct {
+	EthBackend
+	tracker *nonceTracker
+	journal *nonceJournal // persists in-flight transactions, nil keeps the nonces in memory only
+}
+
+func NewNonceTrackingBackend(backend EthBackend) *NonceTrackingBackend {
+	return &NonceTrackingBackend{EthBackend: backend, tracker: newNonceTracker()}
+}
+
+func (b *NonceTrackingBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return b.tracker.next(account, func() (uint64, error) {
+		if b.journal != nil {
+			return b.journal.recover(ctx, b.EthBackend, account)
+		}
+		return b.EthBackend.PendingNonceAt(ctx, account)
+	})
+}
+
+// SendTransaction sends tx and advances the sender's nonce, a "nonce too low" error resyncs the sender from the node
+func (b *NonceTrackingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	err := b.EthBackend.SendTransaction(ctx, tx)
+
+	sender, senderErr := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if senderErr != nil {
+		return err
+	}
+
+	switch {
+	case err == nil || isKnownTransaction(err):
+		b.tracker.sent(sender, tx.Nonce())
+		if b.journal != nil {
+			if journalErr := b.journal.add(sender, tx); journalErr != nil {
+				log.Warn("recording sent transaction in the nonce journal failed", "tx", tx.Hash().Hex(), "err", journalErr)
+			}
+		}
+	case isNonceTooLow(err):
+		b.tracker.reset(sender)
+	}
+	return err
+}
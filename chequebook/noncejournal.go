@@ -0,0 +1,209 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// nonceJournal persists the signed transactions which were sent but not seen mined yet, per sender
+// after a restart they tell which nonces are still in flight and allow resending those the node forgot
+type nonceJournal struct {
+	path string
+
+	mu      sync.Mutex
+	pending map[common.Address]map[uint64]*types.Transaction
+}
+
+// loadNonceJournal reads the journal at path, a missing file yields an empty journal
+func loadNonceJournal(path string) (*nonceJournal, error) {
+	journal := &nonceJournal{path: path, pending: make(map[common.Address]map[uint64]*types.Transaction)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored map[common.Address][]*types.Transaction
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("invalid nonce journal %s: %v", path, err)
+	}
+	for sender, txs := range stored {
+		journal.pending[sender] = make(map[uint64]*types.Transaction)
+		for _, tx := range txs {
+			journal.pending[sender][tx.Nonce()] = tx
+		}
+	}
+	return journal, nil
+}
+
+// save writes the journal, replacing the previous file atomically
+// the caller has to hold mu
+func (j *nonceJournal) save() error {
+	stored := make(map[common.Address][]*types.Transaction)
+	for sender, txs := range j.pending {
+		for _, tx := range txs {
+			stored[sender] = append(stored[sender], tx)
+		}
+		sort.Slice(stored[sender], func(a, b int) bool {
+			return stored[sender][a].Nonce() < stored[sender][b].Nonce()
+		})
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path, data)
+}
+
+// add records the sent transaction tx of sender
+func (j *nonceJournal) add(sender common.Address, tx *types.Transaction) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pending[sender] == nil {
+		j.pending[sender] = make(map[uint64]*types.Transaction)
+	}
+	j.pending[sender][tx.Nonce()] = tx
+	return j.save()
+}
+
+// recover drops the transactions of sender below the mined nonce and resends those the node lost
+// so the nonces handed out next continue after the journal instead of leaving a gap, the next free nonce is returned
+func (j *nonceJournal) recover(ctx context.Context, backend EthBackend, sender common.Address) (uint64, error) {
+	mined, err := backend.NonceAt(ctx, sender, nil)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := backend.PendingNonceAt(ctx, sender)
+	if err != nil {
+		return 0, err
+	}
+
+	// a node lagging behind may report a pending nonce below what is already mined
+	if pending < mined {
+		pending = mined
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	txs := j.pending[sender]
+	for nonce := range txs {
+		if nonce < mined {
+			delete(txs, nonce)
+		}
+	}
+
+	for {
+		tx, ok := txs[pending]
+		if !ok {
+			break
+		}
+		if err := backend.SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) {
+			return 0, fmt.Errorf("resending journaled transaction %s with nonce %d: %w", tx.Hash().Hex(), pending, err)
+		}
+		log.Info("resent journaled transaction the node lost", "tx", tx.Hash().Hex(), "nonce", pending)
+		pending++
+	}
+	for nonce := range txs {
+		if nonce > pending {
+			log.Warn("journaled transaction cannot be resent, a nonce before it is missing", "tx", txs[nonce].Hash().Hex(), "nonce", nonce, "next", pending)
+		}
+	}
+
+	return pending, j.save()
+}
+
+// prune drops the transactions of sender below its mined nonce
+func (j *nonceJournal) prune(ctx context.Context, backend EthBackend, sender common.Address) error {
+	mined, err := backend.NonceAt(ctx, sender, nil)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for nonce := range j.pending[sender] {
+		if nonce < mined {
+			delete(j.pending[sender], nonce)
+		}
+	}
+	return j.save()
+}
+
+// senders returns the senders with journaled transactions
+func (j *nonceJournal) senders() []common.Address {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	senders := make([]common.Address, 0, len(j.pending))
+	for sender, txs := range j.pending {
+		if len(txs) > 0 {
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
+
+// transactions returns the journaled transactions of sender ordered by nonce
+func (j *nonceJournal) transactions(sender common.Address) []*types.Transaction {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	txs := make([]*types.Transaction, 0, len(j.pending[sender]))
+	for _, tx := range j.pending[sender] {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(a, b int) bool { return txs[a].Nonce() < txs[b].Nonce() })
+	return txs
+}
+
+// Recover checks the journaled transactions of every sender against the chain and returns those not mined yet
+// mined transactions are dropped from the journal, a sender which did not send yet is seeded from it like on its first send,
+// resending what the node lost, so a restart can wait for the transactions a previous run left in flight before taking new work
+// without a journal there is nothing to recover
+func (b *NonceTrackingBackend) Recover(ctx context.Context) ([]*types.Transaction, error) {
+	if b.journal == nil {
+		return nil, nil
+	}
+
+	var inFlight []*types.Transaction
+	for _, sender := range b.journal.senders() {
+		var err error
+		if b.tracker.tracked(sender) {
+			err = b.journal.prune(ctx, b.EthBackend, sender)
+		} else {
+			_, err = b.PendingNonceAt(ctx, sender)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inFlight = append(inFlight, b.journal.transactions(sender)...)
+	}
+	return inFlight, nil
+}
+
+// NewPersistentNonceBackend is a NewNonceTrackingBackend which journals sent transactions in the file at path
+// each sender is seeded from the journal the first time it sends, resending transactions the node no longer knows
+func NewPersistentNonceBackend(backend EthBackend, path string) (*NonceTrackingBackend, error) {
+	journal, err := loadNonceJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	tracking := NewNonceTrackingBackend(backend)
+	tracking.journal = journal
+	return tracking, nil
+}
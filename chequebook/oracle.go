@@ -0,0 +1,69 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrGasCostExceedsUSDCap is returned if the gas cost of a transaction converted into USD is above the configured cap
+var ErrGasCostExceedsUSDCap = errors.New("gas cost exceeds USD cap")
+
+// USDOracle provides the current cost of a unit of gas denominated in USD
+type USDOracle interface {
+	USDPerGas(ctx context.Context) (*big.Float, error)
+}
+
+// FixedRateOracle is a USDOracle which always reports the same rate
+type FixedRateOracle struct {
+	Rate *big.Float // cost of one unit of gas in USD
+}
+
+// USDPerGas returns the fixed rate
+func (o *FixedRateOracle) USDPerGas(ctx context.Context) (*big.Float, error) {
+	if o.Rate == nil {
+		return nil, errors.New("no rate configured")
+	}
+	return o.Rate, nil
+}
+
+// checkGasCostUSD converts the given amount of gas into USD using the oracle and returns ErrGasCostExceedsUSDCap if it is above maxCost
+// a nil maxCost disables the check, a cap without an oracle is an error rather than a transaction sent unchecked
+func checkGasCostUSD(ctx context.Context, oracle USDOracle, gas uint64, maxCost *big.Float) error {
+	if maxCost == nil {
+		return nil
+	}
+	if oracle == nil {
+		return errors.New("gas cost cap in USD is set without a USD oracle")
+	}
+
+	rate, err := oracle.USDPerGas(ctx)
+	if err != nil {
+		return err
+	}
+
+	cost := new(big.Float).Mul(new(big.Float).SetUint64(gas), rate)
+	if cost.Cmp(maxCost) > 0 {
+		return fmt.Errorf("%w: cost %s USD, cap %s USD", ErrGasCostExceedsUSDCap, cost.Text('f', 2), maxCost.Text('f', 2))
+	}
+	return nil
+}
+
+// TokenPriceSource provides the value of one wei of gas cost in base units of the chequebook token
+type TokenPriceSource interface {
+	TokenPerWei(ctx context.Context) (*big.Float, error)
+}
+
+// FixedTokenPrice is a TokenPriceSource which always reports the same rate
+type FixedTokenPrice struct {
+	Rate *big.Float // token base units one wei is worth
+}
+
+// TokenPerWei returns the fixed rate
+func (p *FixedTokenPrice) TokenPerWei(ctx context.Context) (*big.Float, error) {
+	if p.Rate == nil {
+		return nil, errors.New("no rate configured")
+	}
+	return p.Rate, nil
+}
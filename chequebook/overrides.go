@@ -0,0 +1,89 @@
+package chequebook
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// replacementBumpPercent is the minimum gas price increase nodes require to replace a pending transaction
+const replacementBumpPercent = 10
+
+// TxOverrides replaces values of a cashout transaction which are otherwise obtained from the node
+// this allows a stuck cashout to be replaced by sending it again with the same nonce and a higher gas price
+type TxOverrides struct {
+	GasPrice  *big.Int  // gas price in wei, nil asks GasPricer
+	GasPricer GasPricer // strategy pricing the cashout without GasPrice, nil uses the node's suggested gas price
+	MaxFee    *big.Int  // highest gas price in wei a cashout is sent with, a higher price fails with a *GasPriceCapError, nil leaves it unlimited
+	Nonce     *uint64   // nonce to send with, nil uses the pending nonce of the sender
+	GasCap    uint64    // maximum gas limit, a larger estimate is an error and the safety margin is cut to fit, 0 disables the cap
+}
+
+// ParseGwei parses a positive decimal amount of gwei into wei
+func ParseGwei(value string) (*big.Int, error) {
+	gwei, ok := new(big.Rat).SetString(value)
+	if !ok || gwei.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid gwei amount %q", value)
+	}
+
+	wei := gwei.Mul(gwei, new(big.Rat).SetInt64(params.GWei))
+	if !wei.IsInt() {
+		return nil, fmt.Errorf("gwei amount %q is not a whole number of wei", value)
+	}
+	return new(big.Int).Set(wei.Num()), nil
+}
+
+// checkOverrides checks that the overridden nonce of caller can be mined and
+// that reusing the nonce of a pending transaction comes with a gas price the node accepts as its replacement
+// the pending transaction itself cannot be looked up by nonce, so the price is compared to the node's current suggestion
+func checkOverrides(ctx context.Context, backend EthBackend, caller common.Address, overrides TxOverrides, retryAttempts int) error {
+	if overrides.Nonce == nil {
+		return nil
+	}
+	nonce := *overrides.Nonce
+
+	var mined, pending uint64
+	err := WithRetry(ctx, retryAttempts, func() (err error) {
+		mined, err = backend.NonceAt(ctx, caller, nil)
+		if err != nil {
+			return err
+		}
+		pending, err = backend.PendingNonceAt(ctx, caller)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case nonce < mined:
+		return fmt.Errorf("nonce %d of %s was already used by a mined transaction", nonce, caller.Hex())
+	case nonce > pending:
+		return fmt.Errorf("nonce %d of %s leaves a gap after the pending nonce %d", nonce, caller.Hex(), pending)
+	case nonce == pending:
+		return nil
+	}
+
+	if overrides.GasPrice == nil {
+		return fmt.Errorf("nonce %d of %s belongs to a pending transaction, replacing it needs a gas price override", nonce, caller.Hex())
+	}
+
+	var suggested *big.Int
+	err = WithRetry(ctx, retryAttempts, func() (err error) {
+		suggested, err = backend.SuggestGasPrice(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	minimum := new(big.Int).Mul(suggested, big.NewInt(100+replacementBumpPercent))
+	minimum.Div(minimum, big.NewInt(100))
+	if overrides.GasPrice.Cmp(minimum) < 0 {
+		return fmt.Errorf("gas price %v does not replace a pending transaction, at least %v is needed", overrides.GasPrice, minimum)
+	}
+	return nil
+}
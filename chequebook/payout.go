@@ -0,0 +1,181 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrPayoutMismatch is returned if the recipient's token balance did not change by the expected payout
+var ErrPayoutMismatch = errors.New("payout does not match expectation")
+
+// BalanceReader is the part of the ERC20 bindings needed to read token balances
+type BalanceReader interface {
+	BalanceOf(opts *bind.CallOpts, account common.Address) (*big.Int, error)
+}
+
+// EtherBalances reads ether balances like a BalanceReader reads token balances, for the payouts of chequebooks holding ether
+type EtherBalances struct {
+	Backend EthBackend
+}
+
+// BalanceOf returns the ether balance of account at the block of opts, the latest one if it is nil
+func (b EtherBalances) BalanceOf(opts *bind.CallOpts, account common.Address) (*big.Int, error) {
+	return b.Backend.BalanceAt(opts.Context, account, opts.BlockNumber)
+}
+
+// PayoutCoverage is how much of a cheque a chequebook can pay out right now
+type PayoutCoverage struct {
+	Owed    *big.Int // cumulative payout not yet paid out to the beneficiary
+	Payable *big.Int // part of Owed covered by the liquid balance available to the beneficiary
+}
+
+// Shortfall is the part of the owed amount the chequebook cannot cover, the cheque bounces if it is positive
+func (p *PayoutCoverage) Shortfall() *big.Int {
+	return new(big.Int).Sub(p.Owed, p.Payable)
+}
+
+// payoutCoverage reads paidOut and liquidBalanceFor of the cheque's beneficiary to compute what cashing it would pay now
+func payoutCoverage(ctx context.Context, swap *simpleswapfactory.ERC20SimpleSwap, cheque *ChequeParams) (*PayoutCoverage, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	paidOut, err := swap.PaidOut(opts, cheque.Beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	liquidBalance, err := swap.LiquidBalanceFor(opts, cheque.Beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	owed := new(big.Int).Sub(cheque.CumulativePayout, paidOut)
+	payable := new(big.Int).Set(owed)
+	if payable.Cmp(liquidBalance) > 0 {
+		payable.Set(liquidBalance)
+	}
+	return &PayoutCoverage{Owed: owed, Payable: payable}, nil
+}
+
+// expectedPayout computes the amount the recipient should receive when the cheque is cashed now
+// this mirrors the contract: only the part not yet paid out is transferred, limited by the liquid balance available to the beneficiary (bounce),
+// and the caller payout is deducted from what the recipient gets
+func expectedPayout(ctx context.Context, swap *simpleswapfactory.ERC20SimpleSwap, cheque *ChequeParams, callerPayout *big.Int) (*big.Int, error) {
+	coverage, err := payoutCoverage(ctx, swap, cheque)
+	if err != nil {
+		return nil, err
+	}
+	return coverage.Payable.Sub(coverage.Payable, callerPayout), nil
+}
+
+// VerifyPayout checks that the balance of recipient increased by exactly expected since balanceBefore was read
+func VerifyPayout(ctx context.Context, token BalanceReader, recipient common.Address, balanceBefore *big.Int, expected *big.Int) error {
+	balanceAfter, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, recipient)
+	if err != nil {
+		return err
+	}
+
+	actual := new(big.Int).Sub(balanceAfter, balanceBefore)
+	if actual.Cmp(expected) != 0 {
+		return fmt.Errorf("%w: expected %v, got %v", ErrPayoutMismatch, expected, actual)
+	}
+	return nil
+}
+
+// ErrPayoutBelowMinimum is returned if the simulated payout of a cashout is below the acceptable minimum
+var ErrPayoutBelowMinimum = errors.New("payout below minimum")
+
+// SimulateCashout executes the cashChequeBeneficiary call as the beneficiary without sending a transaction
+// it fails if the call would revert, otherwise it returns the amount the recipient would receive
+func SimulateCashout(ctx context.Context, backend EthBackend, chequebook common.Address, recipient common.Address, cheque *ChequeParams, ownerSig []byte) (*big.Int, error) {
+	callData, err := cashChequeBeneficiaryData(recipient, cheque, ownerSig)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = backend.CallContract(ctx, ethereum.CallMsg{
+		From: cheque.Beneficiary,
+		To:   &chequebook,
+		Data: callData,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cashout simulation failed: %v", err)
+	}
+
+	swap, err := simpleswapfactory.NewERC20SimpleSwap(chequebook, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return expectedPayout(ctx, swap, cheque, big.NewInt(0))
+}
+
+// CashoutSimulation is the outcome of a cashChequeBeneficiary call executed by SimulateCashCheque
+type CashoutSimulation struct {
+	Success bool     // the call did not revert
+	Reason  string   // revert reason of a failed call, empty if the node did not return one
+	Err     error    // SimpleSwap error of the revert reason if it is a known one
+	Payout  *big.Int // amount the recipient would receive, nil if the call reverts
+	Bounced bool     // the chequebook could not cover the cheque in full
+}
+
+// SimulateCashCheque executes the cashout CashCheque would send through eth_call from the cheque's beneficiary
+// a reverting call is reported in the simulation, the error is only set if the call could not be executed
+func (c *Chequebook) SimulateCashCheque(ctx context.Context, cheque *ChequeParams, recipient common.Address, sig []byte) (*CashoutSimulation, error) {
+	callData, err := cashChequeBeneficiaryData(recipient, cheque, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	err = WithRetry(ctx, c.RetryAttempts, func() (err error) {
+		output, err = c.backend.CallContract(ctx, ethereum.CallMsg{
+			From: cheque.Beneficiary,
+			To:   &c.address,
+			Data: callData,
+		}, nil)
+		return err
+	})
+	if err != nil && !strings.Contains(err.Error(), "revert") {
+		return nil, err
+	}
+	if err != nil {
+		return &CashoutSimulation{Reason: err.Error(), Err: simpleSwapError(err.Error())}, nil
+	}
+	if reason, reverted := decodeRevertReason(output); reverted {
+		return &CashoutSimulation{Reason: reason, Err: simpleSwapError(reason)}, nil
+	}
+
+	// the call returns nothing, what it pays follows from the same state it ran against
+	coverage, err := c.Coverage(ctx, cheque)
+	if err != nil {
+		return nil, err
+	}
+	return &CashoutSimulation{
+		Success: true,
+		Payout:  coverage.Payable,
+		Bounced: coverage.Shortfall().Sign() > 0,
+	}, nil
+}
+
+// simulateBeforeCash runs SimulateCashCheque for a cashout about to be sent and refuses to send one which would revert
+func (c *Chequebook) simulateBeforeCash(ctx context.Context, cheque *ChequeParams, recipient common.Address, sig []byte) (*CashoutSimulation, error) {
+	simulation, err := c.SimulateCashCheque(ctx, cheque, recipient, sig)
+	if err != nil {
+		return nil, fmt.Errorf("cashout simulation failed: %w", err)
+	}
+	if !simulation.Success {
+		log.Warn("simulated cashout reverts", "chequebook", c.address, "beneficiary", cheque.Beneficiary, "reason", simulation.Reason)
+		return nil, newWouldRevertError(simulation.Reason)
+	}
+	log.Info("simulated cashout", "chequebook", c.address, "beneficiary", cheque.Beneficiary, "payout", simulation.Payout, "bounced", simulation.Bounced)
+	return simulation, nil
+}
@@ -0,0 +1,246 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrPermitUnsupported is returned for tokens without EIP-2612 permits, or whose permit domain cannot be reproduced
+var ErrPermitUnsupported = errors.New("token does not support permits")
+
+// permitABI is the EIP-2612 extension of ERC20, version() is not part of it but commonly names the domain version
+const permitABI = `[
+{"inputs":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"},{"internalType":"uint256","name":"deadline","type":"uint256"},{"internalType":"uint8","name":"v","type":"uint8"},{"internalType":"bytes32","name":"r","type":"bytes32"},{"internalType":"bytes32","name":"s","type":"bytes32"}],"name":"permit","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"internalType":"address","name":"owner","type":"address"}],"name":"nonces","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"DOMAIN_SEPARATOR","outputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"name","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"version","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"}
+]`
+
+// permitTypes are the EIP-712 type definitions of an EIP-2612 permit
+var permitTypes = core.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	"Permit": {
+		{Name: "owner", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "value", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+}
+
+// Permit is an EIP-2612 approval of spender to transfer value of the owner's tokens, signed by the owner
+type Permit struct {
+	Token     common.Address
+	Owner     common.Address
+	Spender   common.Address
+	Value     *big.Int
+	Nonce     *big.Int
+	Deadline  *big.Int // unix time after which the token rejects the permit
+	Signature []byte
+}
+
+// permitToken binds the permit functions of the token at address
+func permitToken(backend EthBackend, address common.Address) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(permitABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, backend, backend, backend), nil
+}
+
+// permitDomain reproduces the EIP-712 domain of the token's permits and checks it against its DOMAIN_SEPARATOR
+// the domain version is read from version() where the token has it, "1" is what most tokens without it use
+func permitDomain(ctx context.Context, token *bind.BoundContract, address common.Address, chainID *big.Int) (core.TypedDataDomain, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	separator := new([32]byte)
+	if err := token.Call(opts, separator, "DOMAIN_SEPARATOR"); err != nil {
+		return core.TypedDataDomain{}, fmt.Errorf("%w: %s has no DOMAIN_SEPARATOR: %v", ErrPermitUnsupported, address.Hex(), err)
+	}
+	name := new(string)
+	if err := token.Call(opts, name, "name"); err != nil {
+		return core.TypedDataDomain{}, fmt.Errorf("%w: %s has no name: %v", ErrPermitUnsupported, address.Hex(), err)
+	}
+	version := new(string)
+	if err := token.Call(opts, version, "version"); err != nil || *version == "" {
+		*version = "1"
+	}
+
+	domain := core.TypedDataDomain{
+		Name:              *name,
+		Version:           *version,
+		ChainId:           (*math.HexOrDecimal256)(chainID),
+		VerifyingContract: address.Hex(),
+	}
+	typedData := core.TypedData{Types: permitTypes, Domain: domain}
+	computed, err := typedData.HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return core.TypedDataDomain{}, err
+	}
+	if !bytes.Equal(computed, separator[:]) {
+		return core.TypedDataDomain{}, fmt.Errorf("%w: domain separator of %s does not match name %q, version %q", ErrPermitUnsupported, address.Hex(), *name, *version)
+	}
+	return domain, nil
+}
+
+// SignPermit signs a permit of the wallet account owner allowing spender to transfer value of token until deadline
+// the permit is signed as EIP-712 typed data for the token's current nonce of owner, so it is used up by the next permit
+func SignPermit(ctx context.Context, backend EthBackend, wallet WalletBackend, owner accounts.Account, token common.Address, spender common.Address, value *big.Int, deadline time.Time) (*Permit, error) {
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	contract, err := permitToken(backend, token)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := permitDomain(ctx, contract, token, chainID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := new(*big.Int)
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, nonce, "nonces", owner.Address); err != nil {
+		return nil, fmt.Errorf("%w: %s has no nonces: %v", ErrPermitUnsupported, token.Hex(), err)
+	}
+
+	permit := &Permit{
+		Token:    token,
+		Owner:    owner.Address,
+		Spender:  spender,
+		Value:    new(big.Int).Set(value),
+		Nonce:    *nonce,
+		Deadline: big.NewInt(deadline.Unix()),
+	}
+	data, err := json.Marshal(core.TypedData{
+		Types:       permitTypes,
+		PrimaryType: "Permit",
+		Domain:      domain,
+		Message: core.TypedDataMessage{
+			"owner":    permit.Owner.Hex(),
+			"spender":  permit.Spender.Hex(),
+			"value":    permit.Value.String(),
+			"nonce":    permit.Nonce.String(),
+			"deadline": permit.Deadline.String(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if permit.Signature, err = wallet.SignData(owner, accounts.MimetypeTypedData, data); err != nil {
+		return nil, err
+	}
+	if len(permit.Signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("permit signature has %d bytes instead of %d", len(permit.Signature), crypto.SignatureLength)
+	}
+	return permit, nil
+}
+
+// Submit sends the permit to its token from opts.From, the transaction approves the spender like an approve of the owner
+func (p *Permit) Submit(opts *bind.TransactOpts, backend EthBackend) (*types.Transaction, error) {
+	contract, err := permitToken(backend, p.Token)
+	if err != nil {
+		return nil, err
+	}
+	var r, s [32]byte
+	copy(r[:], p.Signature[:32])
+	copy(s[:], p.Signature[32:64])
+	// tokens expect the recovery id offset by 27 like ecrecover
+	v := p.Signature[crypto.RecoveryIDOffset]
+	if v < 27 {
+		v += 27
+	}
+	return contract.Transact(opts, "permit", p.Owner, p.Spender, p.Value, p.Deadline, v, r, s)
+}
+
+// DepositWithPermit moves amount of the chequebook's token from the owner to the chequebook without a transaction of the owner
+// the owner signs a permit for the wallet account relayer, which submits it and pulls the tokens into the chequebook with transferFrom
+// the owner needs no ether for this, the relayer pays both transactions, and the receipt of the transfer is returned once both are confirmed
+func (c *Chequebook) DepositWithPermit(ctx context.Context, amount *big.Int, relayer common.Address, deadline time.Time) (*types.Receipt, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("deposit amount must be positive")
+	}
+	if c.NativeToken() {
+		return nil, fmt.Errorf("%w: the chequebook holds ether", ErrPermitUnsupported)
+	}
+
+	issuer, err := c.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := walletAccount(c.wallet, issuer)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := walletAccount(c.wallet, relayer)
+	if err != nil {
+		return nil, err
+	}
+	tokenAddress, err := c.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := simpleswapfactory.NewERC20(tokenAddress, c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, owner.Address)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Cmp(balance) > 0 {
+		return nil, fmt.Errorf("%w: depositing %v, owner %s holds %v", ErrInsufficientTokenBalance, amount, owner.Address.Hex(), balance)
+	}
+
+	permit, err := SignPermit(ctx, c.backend, c.wallet, owner, tokenAddress, sender.Address, amount, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainID *big.Int
+	err = WithRetry(ctx, c.RetryAttempts, func() (err error) {
+		chainID, err = c.backend.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	opts := NewWalletTransactor(c.wallet, sender, chainID)
+	opts.Context = ctx
+
+	tx, err := permit.Submit(opts, c.backend)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.waitSucceeded(ctx, tx); err != nil {
+		return nil, fmt.Errorf("permit: %w", err)
+	}
+
+	tx, err = token.TransferFrom(opts, owner.Address, c.address, amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitSucceeded(ctx, tx)
+}
@@ -0,0 +1,34 @@
+package chequebook
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrReadOnly is returned if a signing operation is attempted in read-only mode
+var ErrReadOnly = errors.New("operation requires a signer, not available in read-only mode")
+
+// ReadOnlyWallet is a WalletBackend without accounts which refuses every signing request
+// it is used in place of clef when only read functions are needed
+type ReadOnlyWallet struct{}
+
+func (ReadOnlyWallet) Accounts() []accounts.Account {
+	return nil
+}
+
+func (ReadOnlyWallet) SignData(account accounts.Account, mimetype string, text []byte) ([]byte, error) {
+	return nil, ErrReadOnly
+}
+
+func (ReadOnlyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, ErrReadOnly
+}
+
+// IsReadOnly returns true if the wallet cannot sign
+func IsReadOnly(wallet WalletBackend) bool {
+	_, ok := wallet.(ReadOnlyWallet)
+	return ok
+}
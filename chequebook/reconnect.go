@@ -0,0 +1,280 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxReconnectBackoff is the longest delay between two attempts to re-dial a dropped websocket connection
+const maxReconnectBackoff = 30 * time.Second
+
+// reconnectingBackend is an EthBackend for websocket endpoints which re-dials the node when the connection drops
+// calls failing because of the dropped connection are retried once on the new connection and
+// log subscriptions are re-established on it
+type reconnectingBackend struct {
+	url string
+
+	mu     sync.Mutex
+	client *ethclient.Client
+}
+
+// dialReconnecting connects to the websocket endpoint at url
+func dialReconnecting(ctx context.Context, url string) (*reconnectingBackend, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &reconnectingBackend{url: url, client: client}, nil
+}
+
+// isConnectionError reports whether err is caused by a closed or broken connection rather than by the request
+func isConnectionError(err error) bool {
+	if errors.Is(err, rpc.ErrClientQuit) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "use of closed network connection") || strings.Contains(msg, "websocket: close")
+}
+
+func (b *reconnectingBackend) current() *ethclient.Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.client
+}
+
+// reconnect replaces the failed client with a new connection, re-dialing with exponential backoff until ctx is done
+// if another caller already replaced the failed client its replacement is returned
+func (b *reconnectingBackend) reconnect(ctx context.Context, failed *ethclient.Client) (*ethclient.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != failed {
+		return b.client, nil
+	}
+
+	delay := retryBaseDelay
+	for {
+		client, err := ethclient.DialContext(ctx, b.url)
+		if err == nil {
+			failed.Close()
+			b.client = client
+			log.Info("reconnected", "url", b.url)
+			return client, nil
+		}
+
+		log.Warn("reconnecting failed", "url", b.url, "retry", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		delay *= 2
+		if delay > maxReconnectBackoff {
+			delay = maxReconnectBackoff
+		}
+	}
+}
+
+// call runs fn on the current client and once more on a new connection if it failed because the connection dropped
+func (b *reconnectingBackend) call(ctx context.Context, fn func(client *ethclient.Client) error) error {
+	client := b.current()
+	err := fn(client)
+	if err == nil || !isConnectionError(err) {
+		return err
+	}
+
+	client, reconnectErr := b.reconnect(ctx, client)
+	if reconnectErr != nil {
+		return err
+	}
+	return fn(client)
+}
+
+func (b *reconnectingBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		code, err = client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (b *reconnectingBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (result []byte, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (b *reconnectingBackend) PendingCodeAt(ctx context.Context, account common.Address) (code []byte, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		code, err = client.PendingCodeAt(ctx, account)
+		return err
+	})
+	return code, err
+}
+
+func (b *reconnectingBackend) PendingCallContract(ctx context.Context, call ethereum.CallMsg) (result []byte, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		result, err = client.PendingCallContract(ctx, call)
+		return err
+	})
+	return result, err
+}
+
+func (b *reconnectingBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		nonce, err = client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+func (b *reconnectingBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		balance, err = client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+func (b *reconnectingBackend) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+func (b *reconnectingBackend) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		price, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+func (b *reconnectingBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (gas uint64, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		gas, err = client.EstimateGas(ctx, call)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction sends tx, a resend after a reconnect which reports the transaction as known counts as sent
+func (b *reconnectingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	attempt := 0
+	return b.call(ctx, func(client *ethclient.Client) error {
+		attempt++
+		err := client.SendTransaction(ctx, tx)
+		if err != nil && attempt > 1 && isKnownTransaction(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (b *reconnectingBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		logs, err = client.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+// SubscribeFilterLogs subscribes to logs matching query and resubscribes on a new connection whenever the subscription fails
+// logs emitted while the connection was down are not delivered
+func (b *reconnectingBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	client := b.current()
+	sub, err := client.SubscribeFilterLogs(ctx, query, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.Resubscribe(maxReconnectBackoff, func(ctx context.Context) (event.Subscription, error) {
+		if sub != nil {
+			// the first subscription is the one established above
+			first := sub
+			sub = nil
+			return first, nil
+		}
+
+		var err error
+		client, err = b.reconnect(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		return client.SubscribeFilterLogs(ctx, query, ch)
+	}), nil
+}
+
+// SubscribeNewHead subscribes to new chain heads and resubscribes on a new connection whenever the subscription fails
+// heads mined while the connection was down are not delivered
+func (b *reconnectingBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	client := b.current()
+	sub, err := client.SubscribeNewHead(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.Resubscribe(maxReconnectBackoff, func(ctx context.Context) (event.Subscription, error) {
+		if sub != nil {
+			first := sub
+			sub = nil
+			return first, nil
+		}
+
+		var err error
+		client, err = b.reconnect(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		return client.SubscribeNewHead(ctx, ch)
+	}), nil
+}
+
+func (b *reconnectingBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		receipt, err = client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+func (b *reconnectingBackend) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		header, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (b *reconnectingBackend) ChainID(ctx context.Context) (chainID *big.Int, err error) {
+	err = b.call(ctx, func(client *ethclient.Client) (err error) {
+		chainID, err = client.ChainID(ctx)
+		return err
+	})
+	return chainID, err
+}
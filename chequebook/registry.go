@@ -0,0 +1,239 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrUnknownChequebook is returned for a chequebook not recorded in a registry
+var ErrUnknownChequebook = errors.New("chequebook not in registry")
+
+// RegisteredChequebook is what a registry knows about one chequebook of an issuer
+type RegisteredChequebook struct {
+	Address       common.Address   `json:"address"`
+	Issuer        common.Address   `json:"issuer"`
+	Token         common.Address   `json:"token"`
+	Factory       common.Address   `json:"factory,omitempty"`
+	ChainID       *big.Int         `json:"chainId,omitempty"`
+	Network       string           `json:"network,omitempty"`       // name of the network the chequebook is deployed on
+	Beneficiaries []common.Address `json:"beneficiaries,omitempty"` // accounts cheques were issued to, in the order they were first paid
+}
+
+// hasBeneficiary reports whether cheques drawn on the chequebook were issued to beneficiary
+func (b *RegisteredChequebook) hasBeneficiary(beneficiary common.Address) bool {
+	for _, known := range b.Beneficiaries {
+		if known == beneficiary {
+			return true
+		}
+	}
+	return false
+}
+
+// registryFile is the format a ChequebookRegistry is persisted in
+type registryFile struct {
+	Active      common.Address          `json:"active"`
+	Chequebooks []*RegisteredChequebook `json:"chequebooks"`
+}
+
+// ChequebookRegistry keeps the chequebooks operated by a process in a json file together with the one selected as active
+// every change is persisted before it returns so several processes can share the file as long as they do not write concurrently
+type ChequebookRegistry struct {
+	path string // file the registry is persisted to, empty keeps it in memory
+
+	mu          sync.Mutex
+	active      common.Address
+	chequebooks map[common.Address]*RegisteredChequebook
+}
+
+// OpenChequebookRegistry loads the registry at path, a missing file or an empty path yield an empty registry
+func OpenChequebookRegistry(path string) (*ChequebookRegistry, error) {
+	registry := &ChequebookRegistry{path: path, chequebooks: make(map[common.Address]*RegisteredChequebook)}
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored registryFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("invalid chequebook registry %s: %v", path, err)
+	}
+	for _, book := range stored.Chequebooks {
+		registry.chequebooks[book.Address] = book
+	}
+	registry.active = stored.Active
+	return registry, nil
+}
+
+// save writes the registry, the caller has to hold mu
+func (r *ChequebookRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(registryFile{Active: r.active, Chequebooks: r.list()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data)
+}
+
+// list returns copies of the registered chequebooks ordered by address, the caller has to hold mu
+func (r *ChequebookRegistry) list() []*RegisteredChequebook {
+	books := make([]*RegisteredChequebook, 0, len(r.chequebooks))
+	for _, book := range r.chequebooks {
+		copied := *book
+		copied.Beneficiaries = append([]common.Address(nil), book.Beneficiaries...)
+		books = append(books, &copied)
+	}
+	sort.Slice(books, func(a, b int) bool { return books[a].Address.Hex() < books[b].Address.Hex() })
+	return books
+}
+
+// List returns the registered chequebooks ordered by address
+func (r *ChequebookRegistry) List() []*RegisteredChequebook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list()
+}
+
+// IssuedBy returns the registered chequebooks of issuer ordered by address
+func (r *ChequebookRegistry) IssuedBy(issuer common.Address) []*RegisteredChequebook {
+	var books []*RegisteredChequebook
+	for _, book := range r.List() {
+		if book.Issuer == issuer {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
+// Get returns the registered chequebook at address
+func (r *ChequebookRegistry) Get(address common.Address) (*RegisteredChequebook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	book, ok := r.chequebooks[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChequebook, address.Hex())
+	}
+	copied := *book
+	copied.Beneficiaries = append([]common.Address(nil), book.Beneficiaries...)
+	return &copied, nil
+}
+
+// Register records book, fields left zero keep what was registered for the chequebook before
+// beneficiaries are added to the known ones and the first chequebook registered becomes the active one
+func (r *ChequebookRegistry) Register(book RegisteredChequebook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := &RegisteredChequebook{Address: book.Address}
+	if previous, ok := r.chequebooks[book.Address]; ok {
+		*merged = *previous
+		merged.Beneficiaries = append([]common.Address(nil), previous.Beneficiaries...)
+	}
+	if (book.Issuer != common.Address{}) {
+		merged.Issuer = book.Issuer
+	}
+	if (book.Token != common.Address{}) {
+		merged.Token = book.Token
+	}
+	if (book.Factory != common.Address{}) {
+		merged.Factory = book.Factory
+	}
+	if book.ChainID != nil {
+		merged.ChainID = new(big.Int).Set(book.ChainID)
+	}
+	if book.Network != "" {
+		merged.Network = book.Network
+	}
+	for _, beneficiary := range book.Beneficiaries {
+		if !merged.hasBeneficiary(beneficiary) {
+			merged.Beneficiaries = append(merged.Beneficiaries, beneficiary)
+		}
+	}
+
+	r.chequebooks[book.Address] = merged
+	if (r.active == common.Address{}) {
+		r.active = book.Address
+	}
+	return r.save()
+}
+
+// Remove forgets the chequebook at address, removing the active chequebook leaves none selected
+func (r *ChequebookRegistry) Remove(address common.Address) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.chequebooks[address]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChequebook, address.Hex())
+	}
+	delete(r.chequebooks, address)
+	if r.active == address {
+		r.active = common.Address{}
+	}
+	return r.save()
+}
+
+// Select makes the registered chequebook at address the active one
+func (r *ChequebookRegistry) Select(address common.Address) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.chequebooks[address]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChequebook, address.Hex())
+	}
+	r.active = address
+	return r.save()
+}
+
+// Active returns the address of the active chequebook, false if none is selected
+func (r *ChequebookRegistry) Active() (common.Address, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active, r.active != common.Address{}
+}
+
+// Open returns a handle for the registered chequebook at address
+// it is checked against the registry: a chequebook whose issuer or token changed on chain is refused
+// and it only cashes cheques on the chain it was registered on
+func (r *ChequebookRegistry) Open(ctx context.Context, address common.Address, backend EthBackend, wallet WalletBackend) (*Chequebook, error) {
+	registered, err := r.Get(address)
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := NewChequebook(address, backend, wallet)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := book.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if (registered.Issuer != common.Address{}) && issuer != registered.Issuer {
+		return nil, fmt.Errorf("chequebook %s is issued by %s, registered with issuer %s", address.Hex(), issuer.Hex(), registered.Issuer.Hex())
+	}
+	token, err := book.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if (registered.Token != common.Address{}) && token != registered.Token {
+		return nil, fmt.Errorf("chequebook %s holds token %s, registered with token %s", address.Hex(), token.Hex(), registered.Token.Hex())
+	}
+	book.ChainID = registered.ChainID
+	return book, nil
+}
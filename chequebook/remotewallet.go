@@ -0,0 +1,135 @@
+package chequebook
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DigestSigner signs 32 byte digests with a secp256k1 key it does not reveal, such as a key held by a cloud KMS
+// like AWS KMS and GCP KMS it returns the signature DER encoded, without a recovery id and with any s value
+type DigestSigner interface {
+	SignDigest(digest []byte) ([]byte, error)
+}
+
+// RemoteKeyWallet is a WalletBackend for the single account of a DigestSigner
+// it hashes cheques and transactions locally and turns the returned DER signatures into ethereum signatures
+type RemoteKeyWallet struct {
+	signer  DigestSigner
+	account accounts.Account
+	public  *ecdsa.PublicKey
+}
+
+// NewRemoteKeyWallet creates a wallet for signer, whose key has the public key public
+func NewRemoteKeyWallet(signer DigestSigner, public *ecdsa.PublicKey) *RemoteKeyWallet {
+	return &RemoteKeyWallet{
+		signer:  signer,
+		account: accounts.Account{Address: crypto.PubkeyToAddress(*public)},
+		public:  public,
+	}
+}
+
+// ParsePublicKeyDER decodes a DER encoded SubjectPublicKeyInfo of a secp256k1 key as returned by the KMS public key requests
+// x509 does not know the curve, so the structure is unpacked here
+func ParsePublicKeyDER(der []byte) (*ecdsa.PublicKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("invalid public key: trailing data")
+	}
+	return crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+}
+
+// Accounts returns the account of the remote key
+func (w *RemoteKeyWallet) Accounts() []accounts.Account {
+	return []accounts.Account{w.account}
+}
+
+// SignData signs text/plain data with the eth_sign prefix or EIP-712 typed data
+// like clef the returned signature has a v value of 27 or 28
+func (w *RemoteKeyWallet) SignData(account accounts.Account, mimetype string, data []byte) ([]byte, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+
+	hash, err := dataHash(mimetype, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := w.sign(hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// SignTx signs the transaction for the given chain
+func (w *RemoteKeyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+
+	signer := types.NewEIP155Signer(chainID)
+	sig, err := w.sign(signer.Hash(tx).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(signer, sig)
+}
+
+// secp256k1HalfN is half the order of the secp256k1 group, ethereum only accepts s values up to it
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+// sign has the remote key sign hash and returns the signature as r ++ s ++ v with v being 0 or 1
+func (w *RemoteKeyWallet) sign(hash []byte) ([]byte, error) {
+	der, err := w.signer.SignDigest(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &rs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote signature: %w", err)
+	}
+	if len(rest) != 0 || rs.R.Sign() <= 0 || rs.S.Sign() <= 0 || rs.R.BitLen() > 256 || rs.S.BitLen() > 256 {
+		return nil, errors.New("invalid remote signature")
+	}
+
+	// (r, n-s) is just as valid as (r, s), KMS services return either
+	if rs.S.Cmp(secp256k1HalfN) > 0 {
+		rs.S.Sub(crypto.S256().Params().N, rs.S)
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, math.PaddedBigBytes(rs.R, 32))
+	copy(sig[32:], math.PaddedBigBytes(rs.S, 32))
+
+	// the recovery id is not part of a DER signature, it is whichever of both recovers the remote key
+	for v := byte(0); v < 2; v++ {
+		sig[crypto.RecoveryIDOffset] = v
+		public, err := crypto.SigToPub(hash, sig)
+		if err == nil && crypto.PubkeyToAddress(*public) == w.account.Address {
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("remote signature was not made by %s", w.account.Address.Hex())
+}
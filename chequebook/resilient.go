@@ -0,0 +1,286 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ResilientOptions configures how a ResilientBackend retries, limits and fails over its requests
+type ResilientOptions struct {
+	RetryAttempts     int     // attempts of a request failing with a transient error on every endpoint, see WithRetry
+	RequestsPerSecond float64 // requests sent per second over all endpoints, 0 does not limit them
+	Burst             int     // requests sent at once before the rate limit applies, below 1 allows one
+}
+
+// ResilientBackend is an EthBackend spreading its requests over several endpoints of the same chain
+// a request failing with a transient error is sent to the next endpoint, which then stays in use,
+// and once all endpoints failed it is retried with backoff, all of it throttled by the rate limit
+type ResilientBackend struct {
+	endpoints []EthBackend
+	names     []string // urls of the endpoints for logging
+	attempts  int
+	limiter   *rateLimiter
+
+	mu     sync.Mutex
+	active int
+}
+
+// NewResilientBackend wraps the endpoints, which must all serve the same chain, in the order they are tried
+func NewResilientBackend(endpoints []EthBackend, names []string, opts ResilientOptions) *ResilientBackend {
+	b := &ResilientBackend{endpoints: endpoints, names: names, attempts: opts.RetryAttempts}
+	if opts.RequestsPerSecond > 0 {
+		b.limiter = newRateLimiter(opts.RequestsPerSecond, opts.Burst)
+	}
+	return b
+}
+
+// DialResilientBackend connects to every url like DialBackend and wraps them in a ResilientBackend
+// endpoints which cannot be dialed are left out with a warning, it only fails if none can be
+func DialResilientBackend(ctx context.Context, urls []string, header http.Header, opts ResilientOptions) (*ResilientBackend, error) {
+	var endpoints []EthBackend
+	var names []string
+	var dialErr error
+	for _, url := range urls {
+		backend, err := DialBackend(ctx, url, header)
+		if err != nil {
+			log.Warn("leaving out rpc endpoint", "url", url, "err", err)
+			dialErr = err
+			continue
+		}
+		endpoints = append(endpoints, backend)
+		names = append(names, url)
+	}
+	if len(endpoints) == 0 {
+		if dialErr == nil {
+			dialErr = errors.New("no rpc endpoint given")
+		}
+		return nil, dialErr
+	}
+	return NewResilientBackend(endpoints, names, opts), nil
+}
+
+// call runs fn on the active endpoint, failing over to the following ones on transient errors
+// and retrying the whole round with backoff once every endpoint failed
+func (b *ResilientBackend) call(ctx context.Context, fn func(backend EthBackend) error) error {
+	return WithRetry(ctx, b.attempts, func() error {
+		b.mu.Lock()
+		start := b.active
+		b.mu.Unlock()
+
+		var err error
+		for i := 0; i < len(b.endpoints); i++ {
+			index := (start + i) % len(b.endpoints)
+			if err = b.limiter.wait(ctx); err != nil {
+				return err
+			}
+			if err = fn(b.endpoints[index]); err == nil || !isTransient(err) {
+				b.use(index)
+				return err
+			}
+			log.Debug("rpc endpoint failed", "url", b.names[index], "err", err)
+		}
+		return err
+	})
+}
+
+// use makes the endpoint at index the active one, logging the failover
+func (b *ResilientBackend) use(index int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active != index {
+		log.Warn("failed over to rpc endpoint", "url", b.names[index], "from", b.names[b.active])
+		b.active = index
+	}
+}
+
+func (b *ResilientBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		code, err = backend.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (b *ResilientBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (output []byte, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		output, err = backend.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return output, err
+}
+
+func (b *ResilientBackend) PendingCodeAt(ctx context.Context, account common.Address) (code []byte, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		code, err = backend.PendingCodeAt(ctx, account)
+		return err
+	})
+	return code, err
+}
+
+func (b *ResilientBackend) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		nonce, err = backend.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+func (b *ResilientBackend) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		price, err = backend.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+func (b *ResilientBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (gas uint64, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		gas, err = backend.EstimateGas(ctx, call)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction resends a transaction whose sending failed on another endpoint, one which already has it counts as sent
+func (b *ResilientBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return b.call(ctx, func(backend EthBackend) error {
+		if err := backend.SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (b *ResilientBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		logs, err = backend.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+// SubscribeFilterLogs subscribes on the first endpoint accepting it, a failing subscription is not moved to another endpoint
+func (b *ResilientBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (sub ethereum.Subscription, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		sub, err = backend.SubscribeFilterLogs(ctx, query, ch)
+		return err
+	})
+	return sub, err
+}
+
+func (b *ResilientBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		receipt, err = backend.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+func (b *ResilientBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		nonce, err = backend.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+func (b *ResilientBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		balance, err = backend.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+func (b *ResilientBackend) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		header, err = backend.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (b *ResilientBackend) ChainID(ctx context.Context) (id *big.Int, err error) {
+	err = b.call(ctx, func(backend EthBackend) (err error) {
+		id, err = backend.ChainID(ctx)
+		return err
+	})
+	return id, err
+}
+
+// SubscribeNewHead subscribes on the first endpoint able to push heads, endpoints without subscriptions are skipped
+func (b *ResilientBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	for _, endpoint := range b.endpoints {
+		subscriber, ok := endpoint.(headSubscriber)
+		if !ok {
+			continue
+		}
+		if err := b.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		sub, err := subscriber.SubscribeNewHead(ctx, ch)
+		if err == nil || !errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			return sub, err
+		}
+	}
+	return nil, rpc.ErrNotificationsUnsupported
+}
+
+// rateLimiter is a token bucket refilled at a fixed rate, a nil limiter lets every request through
+type rateLimiter struct {
+	interval time.Duration // time to refill one token
+	burst    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// wait takes a token, sleeping until one is refilled or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	l.last = now
+	// the token is taken right away, a negative count makes later callers wait behind this one
+	l.tokens--
+	delay := time.Duration(-l.tokens * float64(l.interval))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
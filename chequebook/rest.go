@@ -0,0 +1,185 @@
+package chequebook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxRequestBody limits the size of REST request bodies, a cheque request is a few hundred bytes
+const maxRequestBody = 1 << 16
+
+// issueRequest is the body of POST /cheques
+type issueRequest struct {
+	Chequebook  common.Address `json:"chequebook"`
+	Beneficiary common.Address `json:"beneficiary"`
+	Amount      string         `json:"amount"`
+}
+
+// cashoutRequest is the body of POST /cashout, a missing recipient pays the beneficiary
+type cashoutRequest struct {
+	Cheque    *SignedCheque   `json:"cheque"`
+	Recipient *common.Address `json:"recipient"`
+}
+
+// restError is the body of every failed REST request
+type restError struct {
+	Error string `json:"error"`
+}
+
+// NewRESTHandler serves the operations of service as a json REST api:
+//
+//	POST /cheques            issue a cheque, body {"chequebook", "beneficiary", "amount"}
+//	GET  /cheques            list the issued cheques
+//	POST /cheques/verify     verify a received cheque, body is the signed cheque
+//	POST /cashout            cash a received cheque, body {"cheque", "recipient"}
+//	GET  /chequebook/<addr>  read the status of a chequebook
+//
+// bodies have to be sent as application/json and requests from the pages of another origin are refused,
+// so a web page open in the operator's browser cannot issue or cash cheques through a local listener
+func NewRESTHandler(service *ChequeService) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cheques", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req issueRequest
+			if !decodeRequest(w, r, &req) {
+				return
+			}
+			writeResult(w, http.StatusCreated)(service.IssueCheque(r.Context(), req.Chequebook, req.Beneficiary, req.Amount))
+		case http.MethodGet:
+			writeResult(w, http.StatusOK)(service.ListCheques())
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on /cheques", r.Method))
+		}
+	})
+	mux.HandleFunc("/cheques/verify", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		var cheque *SignedCheque
+		if !decodeRequest(w, r, &cheque) {
+			return
+		}
+		writeResult(w, http.StatusOK)(service.VerifyCheque(r.Context(), cheque))
+	})
+	mux.HandleFunc("/cashout", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		var req cashoutRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		writeResult(w, http.StatusOK)(service.CashCheque(r.Context(), req.Cheque, req.Recipient))
+	})
+	mux.HandleFunc("/chequebook/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		address := strings.TrimPrefix(r.URL.Path, "/chequebook/")
+		if !common.IsHexAddress(address) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid chequebook address %q", address))
+			return
+		}
+		writeResult(w, http.StatusOK)(service.ChequebookStatus(r.Context(), common.HexToAddress(address)))
+	})
+	return SameOrigin(mux)
+}
+
+// SameOrigin refuses requests whose Origin header names another host than the one they were sent to with 403
+// browsers send the header with every cross-origin POST, other clients usually send none and are let through
+func SameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			parsed, err := url.Parse(origin)
+			if err != nil || parsed.Host != r.Host {
+				writeError(w, http.StatusForbidden, fmt.Errorf("requests from origin %q are not allowed", origin))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireToken refuses requests without the bearer token in their Authorization header with 401
+func RequireToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireMethod rejects requests not using method
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on %s", r.Method, r.URL.Path))
+		return false
+	}
+	return true
+}
+
+// decodeRequest decodes the json body of r into v, answering with 415 if it is not sent as json and with 400 if it is invalid
+// other content types are refused since browsers send text/plain bodies across origins without asking first
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("request body has to be sent as application/json, not %q", r.Header.Get("Content-Type")))
+		return false
+	}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeResult returns a function writing the result of a service call with status, or its error
+func writeResult(w http.ResponseWriter, status int) func(result interface{}, err error) {
+	return func(result interface{}, err error) {
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writeJSON(w, status, result)
+	}
+}
+
+// errorStatus maps the errors of the service to http status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrChequeNotCoveredByBalance), errors.Is(err, ErrNonIncreasingPayout), errors.Is(err, ErrNothingToCash):
+		return http.StatusConflict
+	case errors.Is(err, ErrChequeInvalidSignature), errors.Is(err, ErrWouldRevert), errors.Is(err, ErrUnknownBytecode):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, restError{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,87 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultRetryAttempts is the default number of attempts for an rpc call failing with a transient error
+const DefaultRetryAttempts = 3
+
+// retryBaseDelay is the delay before the first retry, doubled after every further attempt
+const retryBaseDelay = 500 * time.Millisecond
+
+// deterministicErrors are node errors which will not go away by sending the same request again
+var deterministicErrors = []string{
+	"nonce too low",
+	"execution reverted",
+	"insufficient funds",
+	"replacement transaction underpriced",
+	"intrinsic gas too low",
+	"gas required exceeds allowance",
+}
+
+// isTransient reports whether err is a network or server side failure which is worth retrying
+func isTransient(err error) bool {
+	msg := err.Error()
+	for _, deterministic := range deterministicErrors {
+		if strings.Contains(msg, deterministic) {
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// the rpc client reports non-2xx http responses with the status line as the error message
+	if len(msg) >= 3 && (msg[0] == '5' || strings.HasPrefix(msg, "429")) && strings.IndexFunc(msg[:3], notDigit) == -1 {
+		return true
+	}
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused")
+}
+
+func notDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+// WithRetry calls fn up to attempts times as long as it fails with a transient error
+// retries are delayed with exponential backoff and jitter and stop once ctx is done
+func WithRetry(ctx context.Context, attempts int, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return err
+		}
+
+		// sleep between half and the full delay so concurrent clients do not retry in lockstep
+		sleep := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// isKnownTransaction reports whether err is the node rejecting a transaction it already has in its pool
+func isKnownTransaction(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "known transaction") || strings.Contains(msg, "already known")
+}
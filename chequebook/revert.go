@@ -0,0 +1,165 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// revertSelector is the selector of Error(string), which solidity uses to encode revert reasons
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// RevertError is the error of a transaction which was mined but failed
+type RevertError struct {
+	TxHash common.Hash
+	Block  *big.Int // block the transaction was mined in
+	Reason string   // revert reason reported by the node, empty if it did not return one
+	Err    error    // one of the SimpleSwap revert errors below if the reason is a known one, nil otherwise
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("transaction %s: execution reverted (no reason)", e.TxHash.Hex())
+	}
+	return fmt.Sprintf("transaction %s: execution reverted: %s", e.TxHash.Hex(), e.Reason)
+}
+
+// Unwrap makes errors.Is match the known SimpleSwap revert reasons
+func (e *RevertError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrTxReverted
+func (e *RevertError) Is(target error) bool {
+	return target == ErrTxReverted
+}
+
+// errors for the revert reasons of the SimpleSwap contracts, which reject calls with require messages rather than custom errors
+var (
+	ErrInvalidIssuerSignature      = fmt.Errorf("%w: rejected by the chequebook", ErrChequeInvalidSignature)
+	ErrInvalidBeneficiarySignature = errors.New("invalid beneficiary signature")
+	ErrCannotPayCaller             = errors.New("payout does not cover the caller payout")
+	ErrNotIssuer                   = errors.New("sender is not the issuer")
+	ErrHardDepositTooLow           = errors.New("hard deposit not sufficient")
+	ErrHardDepositTooHigh          = errors.New("hard deposit exceeds balance")
+	ErrHardDepositNotTimedOut      = errors.New("hard deposit decrease not yet timed out")
+)
+
+// simpleSwapReasons maps the require messages of ERC20SimpleSwap to their errors
+var simpleSwapReasons = map[string]error{
+	"SimpleSwap: invalid issuerSig":                        ErrInvalidIssuerSignature,
+	"SimpleSwap: invalid beneficiarySig":                   ErrInvalidBeneficiarySignature,
+	"SimpleSwap: cannot pay caller":                        ErrCannotPayCaller,
+	"SimpleSwap: not issuer":                               ErrNotIssuer,
+	"SimpleSwap: liquidBalance not sufficient":             ErrInsufficientLiquidBalance,
+	"SimpleSwap: hard deposit not sufficient":              ErrHardDepositTooLow,
+	"SimpleSwap: hard deposit cannot be more than balance": ErrHardDepositTooHigh,
+	"SimpleSwap: deposit not yet timed out":                ErrHardDepositNotTimedOut,
+}
+
+// simpleSwapError finds the error of a known SimpleSwap revert reason
+// nodes reporting the reason in an error message surround it with text of their own, so it is matched as a substring
+func simpleSwapError(reason string) error {
+	if reason == "" {
+		return nil
+	}
+	for message, err := range simpleSwapReasons {
+		if strings.Contains(reason, message) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrWouldRevert is returned instead of building a transaction whose call reverts against the pending state
+var ErrWouldRevert = errors.New("transaction would revert")
+
+func newWouldRevertError(reason string) error {
+	if reason == "" {
+		return fmt.Errorf("%w (no reason)", ErrWouldRevert)
+	}
+	return fmt.Errorf("%w: %s", ErrWouldRevert, reason)
+}
+
+// callRevertReason executes msg as a call against the latest state and reports whether it reverts and why
+// nodes either return the Error(string) data or report the revert in the error message
+func callRevertReason(ctx context.Context, backend ethereum.ContractCaller, msg ethereum.CallMsg) (string, bool) {
+	output, err := backend.CallContract(ctx, msg, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "revert") {
+			return err.Error(), true
+		}
+		return "", false
+	}
+	return decodeRevertReason(output)
+}
+
+// newRevertError replays the failed transaction tx to find the reason it reverted
+// the reason is obtained by replaying the call at the receipt's block, which sees the same state unless a later transaction in that block changed it
+func newRevertError(ctx context.Context, backend ethereum.ContractCaller, tx *types.Transaction, receipt *types.Receipt) *RevertError {
+	revertErr := &RevertError{TxHash: tx.Hash(), Block: receipt.BlockNumber}
+	defer func() { revertErr.Err = simpleSwapError(revertErr.Reason) }()
+
+	from, err := transactionSender(tx)
+	if err != nil {
+		return revertErr
+	}
+
+	output, err := backend.CallContract(ctx, ethereum.CallMsg{
+		From:     from,
+		To:       tx.To(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	}, receipt.BlockNumber)
+	if err != nil {
+		// some nodes report the reason only in the error message
+		if strings.Contains(err.Error(), "revert") {
+			revertErr.Reason = err.Error()
+		} else {
+			log.Debug("replaying reverted transaction failed", "tx", tx.Hash().Hex(), "err", err)
+		}
+		return revertErr
+	}
+
+	if reason, ok := decodeRevertReason(output); ok {
+		revertErr.Reason = reason
+	}
+	return revertErr
+}
+
+// checkReceipt turns the failed receipt of tx into a *RevertError, the receipt is returned either way
+func checkReceipt(ctx context.Context, backend ethereum.ContractCaller, tx *types.Transaction, receipt *types.Receipt) (*types.Receipt, error) {
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		return receipt, nil
+	}
+	return receipt, newRevertError(ctx, backend, tx, receipt)
+}
+
+// decodeRevertReason decodes the message of revert data encoded as Error(string)
+func decodeRevertReason(data []byte) (string, bool) {
+	if len(data) < len(revertSelector) || !bytes.Equal(data[:len(revertSelector)], revertSelector) {
+		return "", false
+	}
+
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		return "", false
+	}
+	values, err := abi.Arguments{{Type: stringType}}.UnpackValues(data[len(revertSelector):])
+	if err != nil || len(values) != 1 {
+		return "", false
+	}
+	reason, ok := values[0].(string)
+	return reason, ok
+}
@@ -0,0 +1,59 @@
+package chequebook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// headerTransport adds a fixed set of headers to every outgoing request
+type headerTransport struct {
+	header http.Header
+	base   http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// DialBackend connects to the rpc endpoint at url, adding the given headers to every http request
+// headers are only supported for http(s) endpoints, websocket endpoints are re-dialed when the connection drops
+func DialBackend(ctx context.Context, url string, header http.Header) (EthBackend, error) {
+	isWebsocket := strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://")
+	if len(header) == 0 && isWebsocket {
+		backend, err := dialReconnecting(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return backend, nil
+	}
+	if len(header) == 0 {
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("rpc headers are only supported for http endpoints, got %s", url)
+	}
+
+	client, err := rpc.DialHTTPWithClient(url, &http.Client{
+		Transport: &headerTransport{header: header, base: http.DefaultTransport},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
@@ -0,0 +1,290 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DefaultCashoutInterval is the default delay between two evaluations of the stored cheques
+const DefaultCashoutInterval = 10 * time.Minute
+
+// DefaultCashoutRetryDelay is the default delay before a cheque whose cashout failed is evaluated again
+// it doubles with every further failure up to the evaluation interval
+const DefaultCashoutRetryDelay = 30 * time.Second
+
+// CashoutScheduler periodically cashes the received cheques of a ChequeStore which are worth more than cashing them costs
+// a cheque is cashed once its uncashed value minus the gas cost converted into token units exceeds Margin
+// cheques past their validity window are left uncashed
+type CashoutScheduler struct {
+	backend EthBackend
+	wallet  WalletBackend // holds the beneficiary accounts of the stored cheques
+	store   *ChequeStore
+	price   TokenPriceSource
+
+	Interval   time.Duration // delay between two evaluations
+	RetryDelay time.Duration // delay before a failed cheque is retried, doubled per failure and jittered
+	Margin     *big.Int      // net value in token units a cashout has to exceed, nil cashes anything paying more than its gas
+	DryRun     bool          // only log the cheques which would be cashed
+
+	// Configure is applied to every chequebook the scheduler opens, nil keeps the defaults
+	Configure func(book *Chequebook)
+
+	failures map[chequeSlot]int       // consecutive failed cashouts per cheque
+	retryAt  map[chequeSlot]time.Time // earliest time a failed cheque is evaluated again
+}
+
+// chequeSlot identifies the cheques of one chequebook for one beneficiary
+type chequeSlot struct {
+	contract    common.Address
+	beneficiary common.Address
+}
+
+// CashoutDecision is the evaluation of one stored cheque
+type CashoutDecision struct {
+	Cheque  *SignedCheque
+	Payable *big.Int // part of the cheque cashing it now would pay out
+	Cost    *big.Int // estimated gas cost in token units
+	Net     *big.Int // Payable minus Cost
+	Cash    bool     // Net exceeds the margin
+}
+
+// NewCashoutScheduler creates a scheduler cashing the cheques in store with the beneficiary accounts of wallet
+// gas costs are converted into token units with price
+func NewCashoutScheduler(backend EthBackend, wallet WalletBackend, store *ChequeStore, price TokenPriceSource) *CashoutScheduler {
+	return &CashoutScheduler{
+		backend:    backend,
+		wallet:     wallet,
+		store:      store,
+		price:      price,
+		Interval:   DefaultCashoutInterval,
+		RetryDelay: DefaultCashoutRetryDelay,
+		failures:   make(map[chequeSlot]int),
+		retryAt:    make(map[chequeSlot]time.Time),
+	}
+}
+
+// open binds the chequebook at address with the scheduler's settings
+func (s *CashoutScheduler) open(address common.Address) (*Chequebook, error) {
+	book, err := NewChequebook(address, s.backend, s.wallet)
+	if err != nil {
+		return nil, err
+	}
+	if s.Configure != nil {
+		s.Configure(book)
+	}
+	book.TokenPrice = s.price
+	return book, nil
+}
+
+// Run evaluates the stored cheques every Interval until ctx is done
+// cheques are skipped while their retry delay has not passed yet
+func (s *CashoutScheduler) Run(ctx context.Context) error {
+	return s.RunUntil(ctx, ctx.Done())
+}
+
+// RunUntil evaluates the stored cheques like Run until stop is closed
+// no further cheque is evaluated then, a cashout in flight is still waited for and recorded in the store unless ctx is done as well
+func (s *CashoutScheduler) RunUntil(ctx context.Context, stop <-chan struct{}) error {
+	if s.price == nil {
+		return errors.New("no token price for gas configured")
+	}
+
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultCashoutInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.runOnce(ctx, stop); err != nil {
+			log.Warn("evaluating stored cheques failed", "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// RunOnce evaluates every outstanding cheque once and cashes the profitable ones, or logs them in DryRun mode
+// a failing cheque is logged and retried later, it does not stop the others
+func (s *CashoutScheduler) RunOnce(ctx context.Context) error {
+	return s.runOnce(ctx, nil)
+}
+
+// runOnce is RunOnce leaving out the remaining cheques once stop is closed
+func (s *CashoutScheduler) runOnce(ctx context.Context, stop <-chan struct{}) error {
+	outstanding, err := s.store.Outstanding()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range outstanding {
+		slot := chequeSlot{contract: entry.Cheque.Contract, beneficiary: entry.Cheque.Beneficiary}
+		if now.Before(s.retryAt[slot]) {
+			continue
+		}
+		if entry.Cheque.Expired(now) {
+			log.Debug("leaving expired cheque uncashed", "chequebook", slot.contract, "beneficiary", slot.beneficiary, "expired", entry.Cheque.Expires, "amount", entry.Amount)
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if err := s.process(ctx, entry.Cheque); err != nil {
+			delay := s.backoff(slot)
+			log.Warn("cashing stored cheque failed", "chequebook", slot.contract, "beneficiary", slot.beneficiary, "retryIn", delay, "err", err)
+			continue
+		}
+		delete(s.failures, slot)
+		delete(s.retryAt, slot)
+	}
+	return nil
+}
+
+// backoff records another failure of slot and returns the jittered delay until it is retried
+func (s *CashoutScheduler) backoff(slot chequeSlot) time.Duration {
+	s.failures[slot]++
+
+	delay := s.RetryDelay
+	if delay <= 0 {
+		delay = DefaultCashoutRetryDelay
+	}
+	for i := 1; i < s.failures[slot] && delay < s.Interval; i++ {
+		delay *= 2
+	}
+	if s.Interval > 0 && delay > s.Interval {
+		delay = s.Interval
+	}
+
+	// between half and the full delay so cheques failing together are not retried together
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	s.retryAt[slot] = time.Now().Add(delay)
+	return delay
+}
+
+// process evaluates cheque and cashes it if it is profitable
+func (s *CashoutScheduler) process(ctx context.Context, cheque *SignedCheque) error {
+	book, err := s.open(cheque.Contract)
+	if err != nil {
+		return err
+	}
+	if cheque.ChainID != nil {
+		book.ChainID = cheque.ChainID
+	}
+
+	decision, err := s.evaluate(ctx, book, cheque)
+	if err != nil {
+		return err
+	}
+	if decision.Payable.Sign() <= 0 && !s.DryRun {
+		return s.markIfPaid(ctx, book, cheque)
+	}
+	if !decision.Cash {
+		log.Debug("stored cheque not worth cashing", "chequebook", cheque.Contract, "beneficiary", cheque.Beneficiary, "payable", decision.Payable, "cost", decision.Cost)
+		return nil
+	}
+	if s.DryRun {
+		log.Info("would cash stored cheque", "chequebook", cheque.Contract, "beneficiary", cheque.Beneficiary, "payable", decision.Payable, "cost", decision.Cost, "net", decision.Net)
+		return nil
+	}
+
+	result, err := book.CashCheque(ctx, &cheque.ChequeParams, cheque.Beneficiary, cheque.Signature)
+	if err != nil {
+		return err
+	}
+	if result.Revert != nil {
+		return result.Revert
+	}
+	log.Info("cashed stored cheque", "chequebook", cheque.Contract, "beneficiary", cheque.Beneficiary, "tx", result.TxHash, "payout", result.Cashout.TotalPayout, "bounced", result.Cashout.Bounced)
+
+	// a bounced cheque stays outstanding for the part the chequebook could not cover
+	paidOut, err := book.PaidOut(ctx, cheque.Beneficiary)
+	if err != nil {
+		return err
+	}
+	return s.store.MarkCashed(cheque.Contract, cheque.Beneficiary, paidOut)
+}
+
+// markIfPaid marks cheque cashed if the chequebook paid out all of it, which happens when its cashout is confirmed
+// only after the scheduler stopped waiting, for instance because it was shut down while the transaction was pending
+func (s *CashoutScheduler) markIfPaid(ctx context.Context, book *Chequebook, cheque *SignedCheque) error {
+	paidOut, err := book.PaidOut(ctx, cheque.Beneficiary)
+	if err != nil {
+		return err
+	}
+	if paidOut.Cmp(cheque.CumulativePayout) < 0 {
+		return nil
+	}
+	log.Info("stored cheque was paid out without being recorded, marking it cashed", "chequebook", cheque.Contract, "beneficiary", cheque.Beneficiary, "paidOut", paidOut)
+	return s.store.MarkCashed(cheque.Contract, cheque.Beneficiary, paidOut)
+}
+
+// Evaluate reports whether cashing cheque now would pay more than Margin after its gas cost
+// a cheque expiring before the next evaluation only has to pay more than its gas
+func (s *CashoutScheduler) Evaluate(ctx context.Context, cheque *SignedCheque) (*CashoutDecision, error) {
+	book, err := s.open(cheque.Contract)
+	if err != nil {
+		return nil, err
+	}
+	return s.evaluate(ctx, book, cheque)
+}
+
+// expiresSoon reports whether cheque expires before the scheduler evaluates it again
+func (s *CashoutScheduler) expiresSoon(cheque *SignedCheque) bool {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultCashoutInterval
+	}
+	return cheque.Expired(time.Now().Add(interval))
+}
+
+func (s *CashoutScheduler) evaluate(ctx context.Context, book *Chequebook, cheque *SignedCheque) (*CashoutDecision, error) {
+	if s.price == nil {
+		return nil, errors.New("no token price for gas configured")
+	}
+
+	// estimating the gas of a cheque which pays nothing may fail, there is nothing to decide then anyway
+	coverage, err := book.Coverage(ctx, &cheque.ChequeParams)
+	if err != nil {
+		return nil, err
+	}
+	if coverage.Payable.Sign() <= 0 {
+		return &CashoutDecision{Cheque: cheque, Payable: coverage.Payable, Cost: new(big.Int), Net: new(big.Int)}, nil
+	}
+
+	cost, err := book.EstimateCashoutCost(ctx, cheque)
+	if err != nil {
+		return nil, err
+	}
+
+	margin := s.Margin
+	if margin == nil || s.expiresSoon(cheque) {
+		// a cheque lapsing before the next evaluation is cashed as long as it pays for its gas at all
+		margin = new(big.Int)
+	}
+	return &CashoutDecision{
+		Cheque:  cheque,
+		Payable: cost.Payable,
+		Cost:    cost.Token,
+		Net:     cost.Net,
+		Cash:    cost.Net.Cmp(margin) > 0,
+	}, nil
+}
@@ -0,0 +1,258 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrInvalidArgument is returned by the ChequeService for malformed arguments
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// ChequeService offers the cheque operations of a wallet to other processes
+// its exported methods are served over JSON-RPC in the swap namespace, amounts are decimal strings like in SignedCheque
+type ChequeService struct {
+	backend EthBackend
+	wallet  WalletBackend
+	store   *ChequeStore // cheques issued through the service
+	chainID *big.Int
+	typed   bool
+
+	// Configure is applied to every chequebook the service opens, nil keeps the defaults
+	Configure func(book *Chequebook)
+	// TTL is the validity window of the cheques the service issues, 0 issues cheques which never expire
+	TTL time.Duration
+	// Contracts is the release of every chequebook the service opens, nil detects it per chequebook
+	Contracts ContractVersion
+
+	mu      sync.Mutex
+	issuers map[common.Address]*Issuer
+}
+
+// ChequebookStatus is the state of a chequebook as reported by ChequeService.ChequebookStatus
+type ChequebookStatus struct {
+	Chequebook    common.Address `json:"chequebook"`
+	Issuer        common.Address `json:"issuer"`
+	Token         common.Address `json:"token"`
+	Symbol        string         `json:"symbol,omitempty"` // symbol of the token, the amounts are in base units of 10^-Decimals tokens
+	Decimals      uint8          `json:"decimals"`
+	Balance       string         `json:"balance"`
+	LiquidBalance string         `json:"liquidBalance"`
+	TotalPaidOut  string         `json:"totalPaidOut"`
+}
+
+// ChequeVerification is the result of a successful ChequeService.VerifyCheque
+type ChequeVerification struct {
+	Issuer    common.Address `json:"issuer"`
+	PaidOut   string         `json:"paidOut"`   // amount the chequebook already paid the beneficiary
+	Claimable string         `json:"claimable"` // part of the cumulative payout cashing the cheque would still pay
+	Payable   string         `json:"payable"`   // part of Claimable the liquid balance available to the beneficiary covers now
+	Coverage  CoverageGrade  `json:"coverage"`  // full, partial or bounce
+}
+
+// CashoutReply is the result of ChequeService.CashCheque
+type CashoutReply struct {
+	TxHash       common.Hash `json:"txHash"`
+	GasUsed      uint64      `json:"gasUsed"`
+	TotalPayout  string      `json:"totalPayout,omitempty"`
+	CallerPayout string      `json:"callerPayout,omitempty"`
+	Bounced      bool        `json:"bounced"`
+	Revert       string      `json:"revert,omitempty"` // why the mined transaction failed, empty if it succeeded
+}
+
+// NewChequeService creates a service signing with wallet and keeping the cheques it issues in store
+// a nil store disables issuing and listing cheques
+func NewChequeService(backend EthBackend, wallet WalletBackend, store *ChequeStore, chainID *big.Int, typed bool) *ChequeService {
+	return &ChequeService{
+		backend: backend,
+		wallet:  wallet,
+		store:   store,
+		chainID: chainID,
+		typed:   typed,
+		issuers: make(map[common.Address]*Issuer),
+	}
+}
+
+// open binds the chequebook at address with the service's settings
+func (s *ChequeService) open(ctx context.Context, address common.Address) (*Chequebook, error) {
+	book, err := openChequebookVersion(ctx, address, s.backend, s.wallet, s.Contracts)
+	if err != nil {
+		return nil, err
+	}
+	if s.Configure != nil {
+		s.Configure(book)
+	}
+	return book, nil
+}
+
+// parseAmount parses an amount argument of the chequebook's token, in base units or followed by its symbol in whole tokens
+// only an amount with a symbol reads the token's denomination
+func (s *ChequeService) parseAmount(ctx context.Context, chequebook common.Address, name string, value string) (*big.Int, error) {
+	if amount, ok := new(big.Int).SetString(value, 10); ok && amount.Sign() >= 0 {
+		return amount, nil
+	}
+	book, err := s.open(ctx, chequebook)
+	if err != nil {
+		return nil, err
+	}
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := denomination.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArgument, name, err)
+	}
+	return amount, nil
+}
+
+// IssueCheque signs a cheque of the chequebook paying amount more to beneficiary than the cheques issued so far
+func (s *ChequeService) IssueCheque(ctx context.Context, chequebook common.Address, beneficiary common.Address, amount string) (*SignedCheque, error) {
+	if s.store == nil {
+		return nil, errors.New("issuing cheques requires a cheque store")
+	}
+	value, err := s.parseAmount(ctx, chequebook, "amount", amount)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	issuer, ok := s.issuers[chequebook]
+	if !ok {
+		var book *Chequebook
+		book, err = s.open(ctx, chequebook)
+		if err == nil {
+			issuer, err = NewIssuer(ctx, book, s.store, s.chainID, s.typed || book.TypedCheques())
+		}
+		if err == nil {
+			issuer.TTL = s.TTL
+			s.issuers[chequebook] = issuer
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return issuer.Issue(ctx, beneficiary, value)
+}
+
+// VerifyCheque checks that a received cheque is signed by the owner of its chequebook and reports what cashing it would pay and how well that is covered
+func (s *ChequeService) VerifyCheque(ctx context.Context, cheque *SignedCheque) (*ChequeVerification, error) {
+	if cheque == nil {
+		return nil, fmt.Errorf("%w: missing cheque", ErrInvalidArgument)
+	}
+	book, err := s.open(ctx, cheque.Contract)
+	if err != nil {
+		return nil, err
+	}
+	accepted, err := book.AcceptCheque(ctx, cheque, s.chainID, s.typed || book.TypedCheques())
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := book.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paidOut, err := book.PaidOut(ctx, cheque.Beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChequeVerification{
+		Issuer:    issuer,
+		PaidOut:   paidOut.String(),
+		Claimable: accepted.Coverage.Owed.String(),
+		Payable:   accepted.Coverage.Payable.String(),
+		Coverage:  accepted.Grade,
+	}, nil
+}
+
+// CashCheque cashes a received cheque as its beneficiary to recipient, or to the beneficiary itself if recipient is nil
+func (s *ChequeService) CashCheque(ctx context.Context, cheque *SignedCheque, recipient *common.Address) (*CashoutReply, error) {
+	if cheque == nil {
+		return nil, fmt.Errorf("%w: missing cheque", ErrInvalidArgument)
+	}
+	book, err := s.open(ctx, cheque.Contract)
+	if err != nil {
+		return nil, err
+	}
+	if cheque.ChainID != nil {
+		book.ChainID = cheque.ChainID
+	}
+
+	to := cheque.Beneficiary
+	if recipient != nil {
+		to = *recipient
+	}
+
+	result, err := book.CashCheque(ctx, &cheque.ChequeParams, to, cheque.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &CashoutReply{TxHash: result.TxHash, GasUsed: result.GasUsed}
+	if result.Revert != nil {
+		reply.Revert = result.Revert.Error()
+		return reply, nil
+	}
+	reply.TotalPayout = result.Cashout.TotalPayout.String()
+	reply.CallerPayout = result.Cashout.CallerPayout.String()
+	reply.Bounced = result.Cashout.Bounced
+	return reply, nil
+}
+
+// ChequebookStatus reads the issuer, token and balances of the chequebook
+func (s *ChequeService) ChequebookStatus(ctx context.Context, chequebook common.Address) (*ChequebookStatus, error) {
+	book, err := s.open(ctx, chequebook)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ChequebookStatus{Chequebook: chequebook}
+	if status.Issuer, err = book.Issuer(ctx); err != nil {
+		return nil, err
+	}
+	if status.Token, err = book.Token(ctx); err != nil {
+		return nil, err
+	}
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Symbol, status.Decimals = denomination.Symbol, denomination.Decimals
+
+	for _, read := range []struct {
+		get  func(context.Context) (*big.Int, error)
+		into *string
+	}{
+		{book.Balance, &status.Balance},
+		{book.LiquidBalance, &status.LiquidBalance},
+		{book.TotalPaidOut, &status.TotalPaidOut},
+	} {
+		value, err := read.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		*read.into = value.String()
+	}
+	return status, nil
+}
+
+// ListCheques returns the last cheque issued through the service per chequebook and beneficiary
+func (s *ChequeService) ListCheques() ([]*SignedCheque, error) {
+	if s.store == nil {
+		return nil, errors.New("listing cheques requires a cheque store")
+	}
+	cheques, err := s.store.List()
+	if cheques == nil && err == nil {
+		cheques = []*SignedCheque{}
+	}
+	return cheques, err
+}
@@ -0,0 +1,232 @@
+package chequebook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrChequeExpired is returned for a cheque whose validity window has passed
+var ErrChequeExpired = errors.New("cheque expired")
+
+// SignedCheque is a cheque together with the issuer's signature as exchanged between payer and payee
+type SignedCheque struct {
+	ChequeParams
+	Signature []byte // 65 byte signature of the issuer
+
+	// the validity window is agreed off chain and not signed, the chequebook pays out a cheque at any time
+	IssuedAt time.Time // when the issuer signed the cheque, zero if unknown
+	Expires  time.Time // after this the beneficiary no longer cashes the cheque, zero if it never expires
+
+	ChainID *big.Int // chain the issuer issued the cheque for, not signed by personal-sign cheques, nil if unknown
+}
+
+// Expired reports whether the validity window of the cheque has passed at now
+func (c *SignedCheque) Expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// SetValidity records the cheque as issued at now and valid for ttl, a ttl of 0 leaves it without a validity window
+func (c *SignedCheque) SetValidity(now time.Time, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.IssuedAt = now.UTC().Truncate(time.Second)
+	c.Expires = c.IssuedAt.Add(ttl)
+}
+
+// checkValid returns ErrChequeExpired if the cheque expired at now
+func (c *SignedCheque) checkValid(now time.Time) error {
+	if c.Expired(now) {
+		return fmt.Errorf("%w: cheque of %s on %s expired at %v", ErrChequeExpired, c.Beneficiary.Hex(), c.Contract.Hex(), c.Expires)
+	}
+	return nil
+}
+
+// signedChequeJSON is the wire format of a SignedCheque
+// the payout is a decimal string so it is not limited by the precision of json numbers
+type signedChequeJSON struct {
+	Contract         common.Address `json:"contract"`
+	Beneficiary      common.Address `json:"beneficiary"`
+	CumulativePayout string         `json:"cumulativePayout"`
+	Signature        hexutil.Bytes  `json:"signature"`
+	IssuedAt         *time.Time     `json:"issuedAt,omitempty"`
+	Expires          *time.Time     `json:"expires,omitempty"`
+	ChainID          string         `json:"chainId,omitempty"`
+}
+
+// optionalTime is the json value of t, nil if it is zero
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// MarshalJSON encodes the signed cheque with hex addresses and signature and a decimal payout
+func (c SignedCheque) MarshalJSON() ([]byte, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedChequeJSON{
+		Contract:         c.Contract,
+		Beneficiary:      c.Beneficiary,
+		CumulativePayout: c.CumulativePayout.String(),
+		Signature:        c.Signature,
+		IssuedAt:         optionalTime(c.IssuedAt),
+		Expires:          optionalTime(c.Expires),
+		ChainID:          decimalString(c.ChainID),
+	})
+}
+
+// decimalString is n in decimal, empty for nil
+func decimalString(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// UnmarshalJSON decodes a signed cheque produced by MarshalJSON
+func (c *SignedCheque) UnmarshalJSON(data []byte) error {
+	var v signedChequeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	payout, ok := new(big.Int).SetString(v.CumulativePayout, 10)
+	if !ok {
+		return fmt.Errorf("invalid cumulative payout %q", v.CumulativePayout)
+	}
+
+	if len(v.Signature) != crypto.SignatureLength {
+		return errors.New("invalid signature length")
+	}
+
+	cheque := ChequeParams{
+		Contract:         v.Contract,
+		Beneficiary:      v.Beneficiary,
+		CumulativePayout: payout,
+	}
+	if err := cheque.validate(); err != nil {
+		return err
+	}
+
+	c.ChequeParams = cheque
+	c.Signature = v.Signature
+	c.IssuedAt, c.Expires = time.Time{}, time.Time{}
+	if v.IssuedAt != nil {
+		c.IssuedAt = *v.IssuedAt
+	}
+	if v.Expires != nil {
+		c.Expires = *v.Expires
+	}
+	c.ChainID = nil
+	if v.ChainID != "" {
+		chainID, ok := new(big.Int).SetString(v.ChainID, 10)
+		if !ok || chainID.Sign() <= 0 {
+			return fmt.Errorf("invalid chain id %q", v.ChainID)
+		}
+		c.ChainID = chainID
+	}
+	return nil
+}
+
+// signedChequeRLP is the compact binary format of a SignedCheque
+// Extra holds the unix seconds of IssuedAt and Expires and then the chain id, 0 for each unknown one
+// it is left out of cheques knowing none of them, as in older encodings, and the chain id is left out if it is unknown
+type signedChequeRLP struct {
+	Contract         common.Address
+	Beneficiary      common.Address
+	CumulativePayout *big.Int
+	Signature        []byte
+	Extra            []uint64 `rlp:"tail"`
+}
+
+// unixSeconds converts a time of the validity window for the binary format, 0 for a zero time
+func unixSeconds(t time.Time) uint64 {
+	if t.IsZero() || t.Unix() < 0 {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// fromUnixSeconds reverses unixSeconds
+func fromUnixSeconds(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0).UTC()
+}
+
+// MarshalBinary encodes the signed cheque as an RLP list of contract, beneficiary, payout and signature, followed by its validity window and chain if known
+// at about 140 bytes it is the compact alternative to the json format for passing cheques around
+func (c SignedCheque) MarshalBinary() ([]byte, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	v := signedChequeRLP{
+		Contract:         c.Contract,
+		Beneficiary:      c.Beneficiary,
+		CumulativePayout: c.CumulativePayout,
+		Signature:        c.Signature,
+	}
+	if !c.IssuedAt.IsZero() || !c.Expires.IsZero() || c.ChainID != nil {
+		v.Extra = []uint64{unixSeconds(c.IssuedAt), unixSeconds(c.Expires)}
+	}
+	if c.ChainID != nil {
+		if !c.ChainID.IsUint64() {
+			return nil, fmt.Errorf("chain id %v does not fit the binary format", c.ChainID)
+		}
+		v.Extra = append(v.Extra, c.ChainID.Uint64())
+	}
+	return rlp.EncodeToBytes(v)
+}
+
+// UnmarshalBinary decodes a signed cheque produced by MarshalBinary
+func (c *SignedCheque) UnmarshalBinary(data []byte) error {
+	var v signedChequeRLP
+	if err := rlp.DecodeBytes(data, &v); err != nil {
+		return err
+	}
+
+	if len(v.Signature) != crypto.SignatureLength {
+		return errors.New("invalid signature length")
+	}
+
+	cheque := ChequeParams{
+		Contract:         v.Contract,
+		Beneficiary:      v.Beneficiary,
+		CumulativePayout: v.CumulativePayout,
+	}
+	if err := cheque.validate(); err != nil {
+		return err
+	}
+
+	if len(v.Extra) == 1 || len(v.Extra) > 3 {
+		return errors.New("invalid cheque metadata")
+	}
+
+	c.ChequeParams = cheque
+	c.Signature = v.Signature
+	c.IssuedAt, c.Expires, c.ChainID = time.Time{}, time.Time{}, nil
+	if len(v.Extra) >= 2 {
+		c.IssuedAt, c.Expires = fromUnixSeconds(v.Extra[0]), fromUnixSeconds(v.Extra[1])
+	}
+	if len(v.Extra) == 3 && v.Extra[2] != 0 {
+		c.ChainID = new(big.Int).SetUint64(v.Extra[2])
+	}
+	return nil
+}
+
+// Issuer recovers the address which signed the cheque in the personal-sign format
+func (c *SignedCheque) Issuer() (common.Address, error) {
+	return VerifyCheque(&c.ChequeParams, c.Signature)
+}
@@ -0,0 +1,64 @@
+package chequebook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// simulatedGasLimit is the block gas limit of simulated chains, enough for the factory deployment
+const simulatedGasLimit = 8000000
+
+// simulatedFunding is the ether balance of each funded account of a simulated chain
+var simulatedFunding = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+
+// SimulatedBackend is an EthBackend on top of go-ethereum's in-memory simulated chain
+// every transaction is mined right away so WaitMined and WaitDeployed return without a separate Commit
+type SimulatedBackend struct {
+	*backends.SimulatedBackend
+}
+
+// NewSimulatedBackend creates a simulated chain on which each of the funded accounts holds 100 ether
+func NewSimulatedBackend(funded ...common.Address) *SimulatedBackend {
+	alloc := make(core.GenesisAlloc)
+	for _, address := range funded {
+		alloc[address] = core.GenesisAccount{Balance: simulatedFunding}
+	}
+	return &SimulatedBackend{backends.NewSimulatedBackend(alloc, simulatedGasLimit)}
+}
+
+// NewSimulatedEnvironment creates a simulated chain with n freshly generated funded accounts and a wallet holding their keys
+func NewSimulatedEnvironment(n int) (*SimulatedBackend, *KeyWallet, error) {
+	keys := make([]*ecdsa.PrivateKey, n)
+	funded := make([]common.Address, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i] = key
+		funded[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	return NewSimulatedBackend(funded...), NewKeyWallet(keys...), nil
+}
+
+// SendTransaction sends tx and mines it in a new block
+func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := b.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	b.Commit()
+	return nil
+}
+
+// ChainID returns the chain id the simulated chain is configured with
+func (b *SimulatedBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	return params.AllEthashProtocolChanges.ChainID, nil
+}
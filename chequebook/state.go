@@ -0,0 +1,282 @@
+package chequebook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// DeploymentState records the progress of the setup so an interrupted run can resume where it left off
+type DeploymentState struct {
+	path    string   // file the state is persisted to, empty disables persistence
+	chainID *big.Int // chain the state is kept under in a file of network states, nil for a file of a single state
+
+	Token           common.Address `json:"token"`
+	TokenTx         common.Hash    `json:"tokenTx"`
+	TokenBlock      uint64         `json:"tokenBlock,omitempty"`
+	Factory         common.Address `json:"factory"`
+	FactoryTx       common.Hash    `json:"factoryTx"`
+	FactoryBlock    uint64         `json:"factoryBlock,omitempty"`
+	Chequebook      common.Address `json:"chequebook"`
+	ChequebookTx    common.Hash    `json:"chequebookTx"`
+	ChequebookBlock uint64         `json:"chequebookBlock,omitempty"`
+	MintTx          common.Hash    `json:"mintTx"`
+}
+
+// LoadDeploymentState reads the deployment state from path
+// a missing file or an empty path yield an empty state
+func LoadDeploymentState(path string) (*DeploymentState, error) {
+	state := &DeploymentState{path: path}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// LoadNetworkState reads the deployment state of the chain from the file of network states at path
+// the file maps chain ids to their states, so one file keeps the deployments of every network apart
+// a file of a single state as written by LoadDeploymentState is taken as the chain's and converted on the next save
+func LoadNetworkState(path string, chainID *big.Int) (*DeploymentState, error) {
+	state := &DeploymentState{path: path, chainID: chainID}
+	entries, legacy, err := readNetworkStates(path)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := entries[chainID.String()]
+	if legacy != nil {
+		data, ok = legacy, true
+	}
+	if !ok {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state of chain %v in state file %s: %v", chainID, path, err)
+	}
+	return state, nil
+}
+
+// readNetworkStates reads the entries of the file of network states at path
+// a file of a single state is returned as legacy instead, a missing file or an empty path yield no entries
+func readNetworkStates(path string) (entries map[string]json.RawMessage, legacy json.RawMessage, err error) {
+	entries = make(map[string]json.RawMessage)
+	if path == "" {
+		return entries, nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	for key := range entries {
+		if _, err := strconv.ParseUint(key, 10, 64); err != nil {
+			return make(map[string]json.RawMessage), data, nil
+		}
+	}
+	return entries, nil, nil
+}
+
+// Save persists the state, replacing the previous file atomically
+// the state of a network replaces only its own entry, the states of other chains are kept
+func (s *DeploymentState) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	if s.chainID == nil {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(s.path, data)
+	}
+
+	entries, _, err := readNetworkStates(s.path)
+	if err != nil {
+		return err
+	}
+	entry, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	entries[s.chainID.String()] = entry
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary file in the same directory
+// so a crash never leaves a partially written file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// verifyDeployed checks that a contract recorded in the state still has code on chain
+func verifyDeployed(ctx context.Context, backend EthBackend, address common.Address) error {
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract code at %s recorded in state file", address.Hex())
+	}
+	return nil
+}
+
+// SetupToken binds to the token recorded in the state or deploys a new mintable token
+// a deployment is only recorded once it is buried under confirmations blocks
+func SetupToken(ctx context.Context, logger log.Logger, backend EthBackend, opts *bind.TransactOpts, state *DeploymentState, timeout time.Duration, confirmations uint64) (*simpleswapfactory.ERC20Mintable, error) {
+	if (state.Token != common.Address{}) {
+		if err := verifyDeployed(ctx, backend, state.Token); err != nil {
+			return nil, err
+		}
+
+		logger.Info("reusing token", "address", state.Token)
+		return simpleswapfactory.NewERC20Mintable(state.Token, backend)
+	}
+
+	_, tx, erc20, err := simpleswapfactory.DeployERC20Mintable(opts, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := waitDeployed(ctx, backend, tx, confirmations, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Token, state.TokenTx, state.TokenBlock = receipt.ContractAddress, tx.Hash(), receipt.BlockNumber.Uint64()
+	logger.Info("deployed token", "address", state.Token, "tx", state.TokenTx, "block", state.TokenBlock, "from", opts.From)
+	return erc20, state.Save()
+}
+
+// BindToken binds to an existing ERC20 token, checking that it has code and matches the token recorded in the state
+func BindToken(ctx context.Context, logger log.Logger, backend EthBackend, address common.Address, state *DeploymentState) (*simpleswapfactory.ERC20, error) {
+	if (state.Token != common.Address{}) && state.Token != address {
+		return nil, fmt.Errorf("token %s differs from token %s recorded in state file", address.Hex(), state.Token.Hex())
+	}
+
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no contract code at token address %s", address.Hex())
+	}
+
+	if (state.Token == common.Address{}) {
+		state.Token = address
+		if err := state.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("using token", "address", address)
+	return simpleswapfactory.NewERC20(address, backend)
+}
+
+// SetupFactory binds to the factory recorded in the state or deploys a new one for the state's token
+func SetupFactory(ctx context.Context, logger log.Logger, backend EthBackend, opts *bind.TransactOpts, state *DeploymentState, timeout time.Duration, confirmations uint64) (*simpleswapfactory.SimpleSwapFactory, error) {
+	if (state.Factory != common.Address{}) {
+		if err := verifyDeployed(ctx, backend, state.Factory); err != nil {
+			return nil, err
+		}
+
+		logger.Info("reusing factory", "address", state.Factory)
+		return simpleswapfactory.NewSimpleSwapFactory(state.Factory, backend)
+	}
+
+	_, tx, factory, err := simpleswapfactory.DeploySimpleSwapFactory(opts, backend, state.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := waitDeployed(ctx, backend, tx, confirmations, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Factory, state.FactoryTx, state.FactoryBlock = receipt.ContractAddress, tx.Hash(), receipt.BlockNumber.Uint64()
+	if err := state.Save(); err != nil {
+		return nil, err
+	}
+
+	logger.Info("deployed factory", "address", state.Factory, "tx", state.FactoryTx, "block", state.FactoryBlock, "from", opts.From)
+	return factory, nil
+}
+
+// SetupChequebook binds to the chequebook recorded in the state or deploys a new one for the transactor through the factory
+func SetupChequebook(ctx context.Context, logger log.Logger, backend EthBackend, wallet WalletBackend, opts *bind.TransactOpts, factory *simpleswapfactory.SimpleSwapFactory, state *DeploymentState, timeout time.Duration, confirmations uint64) (*Chequebook, error) {
+	if (state.Chequebook != common.Address{}) {
+		if err := verifyDeployed(ctx, backend, state.Chequebook); err != nil {
+			return nil, err
+		}
+
+		logger.Info("reusing chequebook", "address", state.Chequebook)
+		return NewChequebook(state.Chequebook, backend, wallet)
+	}
+
+	deployCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	chequebook, tx, err := Deploy(deployCtx, backend, wallet, opts, factory, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	chequebook.WaitTimeout = timeout
+	// Deploy waited for the deployment to be mined, with a single confirmation this only fetches its receipt
+	receipt, err := WaitConfirmed(ctx, backend, tx, confirmations, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Chequebook, state.ChequebookTx, state.ChequebookBlock = chequebook.Address(), tx.Hash(), receipt.BlockNumber.Uint64()
+	if err := state.Save(); err != nil {
+		return nil, err
+	}
+
+	logger.Info("deployed chequebook", "address", chequebook.Address(), "tx", state.ChequebookTx, "block", state.ChequebookBlock, "from", opts.From)
+	return chequebook, nil
+}
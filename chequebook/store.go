@@ -0,0 +1,215 @@
+package chequebook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrNonIncreasingPayout is returned if a cheque does not pay more than the last one stored for its chequebook and beneficiary
+var ErrNonIncreasingPayout = errors.New("cumulative payout does not increase")
+
+// chequeKeyPrefix prefixes the keys of stored cheques, followed by the chequebook and the beneficiary address
+var chequeKeyPrefix = []byte("cheque-")
+
+// ChequeStore persists the last cheque per chequebook and beneficiary in a LevelDB database
+// beneficiaries keep the cheques they received in it, an Issuer the cheques it issued
+type ChequeStore struct {
+	db *leveldb.DB
+	mu sync.Mutex // serializes the read-modify-write of Put and MarkCashed
+}
+
+// storedCheque is the record of a stored cheque
+type storedCheque struct {
+	Cheque *SignedCheque `json:"cheque"`
+	Cashed string        `json:"cashed"` // cumulative payout already cashed as a decimal string
+}
+
+// OutstandingCheque is the last cheque of a chequebook and beneficiary pair and the part of it not cashed yet
+type OutstandingCheque struct {
+	Cheque *SignedCheque
+	Amount *big.Int
+}
+
+// OpenChequeStore opens or creates the cheque store in the directory at path
+func OpenChequeStore(path string) (*ChequeStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ChequeStore{db: db}, nil
+}
+
+// NewMemoryChequeStore creates a cheque store which is kept in memory only
+func NewMemoryChequeStore() (*ChequeStore, error) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ChequeStore{db: db}, nil
+}
+
+// Close closes the underlying database
+func (s *ChequeStore) Close() error {
+	return s.db.Close()
+}
+
+func chequeKey(contract common.Address, beneficiary common.Address) []byte {
+	key := make([]byte, 0, len(chequeKeyPrefix)+2*common.AddressLength)
+	key = append(key, chequeKeyPrefix...)
+	key = append(key, contract.Bytes()...)
+	return append(key, beneficiary.Bytes()...)
+}
+
+func (s *ChequeStore) get(contract common.Address, beneficiary common.Address) (*storedCheque, error) {
+	data, err := s.db.Get(chequeKey(contract, beneficiary), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeStoredCheque(data)
+}
+
+func decodeStoredCheque(data []byte) (*storedCheque, error) {
+	var record storedCheque
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.Cheque == nil {
+		return nil, errors.New("stored cheque is null")
+	}
+	return &record, nil
+}
+
+func (s *ChequeStore) put(record *storedCheque) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(chequeKey(record.Cheque.Contract, record.Cheque.Beneficiary), data, nil)
+}
+
+// cashed returns the cumulative payout of the record which was already cashed
+func (r *storedCheque) cashed() (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(r.Cashed, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid cashed amount %q", r.Cashed)
+	}
+	return amount, nil
+}
+
+// Put stores the cheque as the last one of its chequebook and beneficiary
+// the cheque has to pay out more than the last stored one, or as much if it renews the validity window of an expired or expiring one
+// an expired cheque is refused, its signature is not checked
+func (s *ChequeStore) Put(cheque *SignedCheque) error {
+	if err := cheque.validate(); err != nil {
+		return err
+	}
+	if err := cheque.checkValid(time.Now()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.get(cheque.Contract, cheque.Beneficiary)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = &storedCheque{Cashed: "0"}
+	} else if cmp := cheque.CumulativePayout.Cmp(record.Cheque.CumulativePayout); cmp < 0 || cmp == 0 && !extendsValidity(record.Cheque, cheque) {
+		return fmt.Errorf("%w: %v after %v", ErrNonIncreasingPayout, cheque.CumulativePayout, record.Cheque.CumulativePayout)
+	}
+	record.Cheque = cheque
+	return s.put(record)
+}
+
+// extendsValidity reports whether cheque is valid for longer than the stored one, which has to carry an expiry
+func extendsValidity(stored *SignedCheque, cheque *SignedCheque) bool {
+	return !stored.Expires.IsZero() && (cheque.Expires.IsZero() || cheque.Expires.After(stored.Expires))
+}
+
+// Last returns the last cheque stored for the chequebook and beneficiary, nil if there is none
+func (s *ChequeStore) Last(contract common.Address, beneficiary common.Address) (*SignedCheque, error) {
+	record, err := s.get(contract, beneficiary)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return record.Cheque, nil
+}
+
+// MarkCashed records that the chequebook paid the beneficiary up to cumulativePayout
+func (s *ChequeStore) MarkCashed(contract common.Address, beneficiary common.Address, cumulativePayout *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.get(contract, beneficiary)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("no cheque stored for chequebook %s and beneficiary %s", contract.Hex(), beneficiary.Hex())
+	}
+	if cumulativePayout.Cmp(record.Cheque.CumulativePayout) > 0 {
+		return fmt.Errorf("cashed %v exceeds the stored cumulative payout %v", cumulativePayout, record.Cheque.CumulativePayout)
+	}
+	record.Cashed = cumulativePayout.String()
+	return s.put(record)
+}
+
+// each calls fn for every stored record
+func (s *ChequeStore) each(fn func(record *storedCheque) error) error {
+	it := s.db.NewIterator(util.BytesPrefix(chequeKeyPrefix), nil)
+	defer it.Release()
+
+	for it.Next() {
+		record, err := decodeStoredCheque(it.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// List returns the last cheque of every chequebook and beneficiary pair
+func (s *ChequeStore) List() ([]*SignedCheque, error) {
+	var cheques []*SignedCheque
+	err := s.each(func(record *storedCheque) error {
+		cheques = append(cheques, record.Cheque)
+		return nil
+	})
+	return cheques, err
+}
+
+// Outstanding lists the stored cheques which have not been cashed completely with the amount still to be cashed
+// expired cheques are listed as well, it is up to the caller to leave them be
+func (s *ChequeStore) Outstanding() ([]OutstandingCheque, error) {
+	var outstanding []OutstandingCheque
+	err := s.each(func(record *storedCheque) error {
+		cashed, err := record.cashed()
+		if err != nil {
+			return err
+		}
+
+		amount := new(big.Int).Sub(record.Cheque.CumulativePayout, cashed)
+		if amount.Sign() > 0 {
+			outstanding = append(outstanding, OutstandingCheque{Cheque: record.Cheque, Amount: amount})
+		}
+		return nil
+	})
+	return outstanding, err
+}
@@ -0,0 +1,180 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// DefaultTopUpInterval is the default delay between two checks of the liquid balance of a chequebook
+const DefaultTopUpInterval = 5 * time.Minute
+
+// TopUpAlert tells that the issuer cannot fund the top-up of a chequebook in full
+type TopUpAlert struct {
+	Chequebook common.Address `json:"chequebook"`
+	Issuer     common.Address `json:"issuer"`
+	Liquid     *big.Int       `json:"liquid"`    // liquid balance of the chequebook when checked
+	Needed     *big.Int       `json:"needed"`    // deposit bringing it up to the high-water mark
+	Available  *big.Int       `json:"available"` // tokens, or wei for a chequebook holding ether, the issuer holds
+	Reason     string         `json:"reason"`
+}
+
+// TopUpResult is the outcome of one check of a TopUpMonitor
+type TopUpResult struct {
+	Liquid    *big.Int       // liquid balance before the deposit
+	Deposited *big.Int       // amount deposited, nil if nothing was
+	Receipt   *types.Receipt // receipt of the deposit, nil if nothing was deposited
+}
+
+// TopUpMonitor keeps the liquid balance of a chequebook between two marks
+// once it falls below LowWater the issuer deposits enough to reach HighWater, or as much as it holds if that is less
+// Alert and the Notifier of the chequebook are told when the issuer lacks the tokens or the ether for gas, once until the shortfall is resolved
+type TopUpMonitor struct {
+	book      *Chequebook
+	lowWater  *big.Int
+	highWater *big.Int
+
+	Interval time.Duration // delay between two checks
+	DryRun   bool          // only log the deposits which would be made
+
+	// Alert is called besides the warning logged for a shortfall, nil only logs
+	Alert func(ctx context.Context, alert *TopUpAlert)
+
+	alerted bool // the current shortfall has been alerted already
+}
+
+// NewTopUpMonitor creates a monitor topping book up to highWater whenever its liquid balance is below lowWater
+func NewTopUpMonitor(book *Chequebook, lowWater *big.Int, highWater *big.Int) (*TopUpMonitor, error) {
+	if lowWater == nil || highWater == nil || lowWater.Sign() < 0 {
+		return nil, errors.New("top-up marks must not be negative")
+	}
+	if highWater.Cmp(lowWater) < 0 {
+		return nil, errors.New("the high-water mark of a top-up must not be below its low-water mark")
+	}
+	return &TopUpMonitor{book: book, lowWater: lowWater, highWater: highWater, Interval: DefaultTopUpInterval}, nil
+}
+
+// Run checks the liquid balance every Interval until ctx is done
+func (m *TopUpMonitor) Run(ctx context.Context) error {
+	return m.RunUntil(ctx, ctx.Done())
+}
+
+// RunUntil checks the liquid balance like Run until stop is closed, a deposit in flight is still waited for unless ctx is done
+func (m *TopUpMonitor) RunUntil(ctx context.Context, stop <-chan struct{}) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultTopUpInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.CheckOnce(ctx); err != nil {
+			log.Warn("topping up the chequebook failed", "chequebook", m.book.address, "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// CheckOnce deposits from the issuer if the liquid balance is below the low-water mark
+func (m *TopUpMonitor) CheckOnce(ctx context.Context) (*TopUpResult, error) {
+	liquid, err := m.book.LiquidBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &TopUpResult{Liquid: liquid}
+	if liquid.Cmp(m.lowWater) >= 0 {
+		m.alerted = false
+		return result, nil
+	}
+
+	issuer, err := m.book.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	needed := new(big.Int).Sub(m.highWater, liquid)
+	available, err := m.book.issuerFunds(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := m.book.backend.BalanceAt(ctx, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := needed
+	switch {
+	case gas.Sign() == 0:
+		m.alert(ctx, &TopUpAlert{m.book.address, issuer, liquid, needed, available, "issuer has no ether to pay for the deposit"})
+		return result, nil
+	case available.Sign() == 0:
+		m.alert(ctx, &TopUpAlert{m.book.address, issuer, liquid, needed, available, "issuer holds nothing to deposit"})
+		return result, nil
+	case available.Cmp(needed) < 0 && m.book.NativeToken():
+		// the gas of the deposit comes out of the same balance, so there is nothing left to send all of it
+		m.alert(ctx, &TopUpAlert{m.book.address, issuer, liquid, needed, available, "issuer holds less ether than the top-up needs"})
+		return result, nil
+	case available.Cmp(needed) < 0:
+		// a partial deposit still keeps cheques from bouncing for a while
+		m.alert(ctx, &TopUpAlert{m.book.address, issuer, liquid, needed, available, "issuer holds less than the top-up needs"})
+		amount = available
+	default:
+		m.alerted = false
+	}
+
+	if m.DryRun {
+		log.Info("would top up the chequebook", "chequebook", m.book.address, "liquid", liquid, "amount", amount)
+		return result, nil
+	}
+	receipt, err := m.book.Deposit(ctx, amount)
+	if err != nil {
+		return result, err
+	}
+	result.Deposited = amount
+	result.Receipt = receipt
+	log.Info("topped up the chequebook", "chequebook", m.book.address, "liquid", liquid, "amount", amount, "tx", receipt.TxHash)
+	return result, nil
+}
+
+// alert logs a shortfall and passes it to Alert unless it was alerted already
+func (m *TopUpMonitor) alert(ctx context.Context, alert *TopUpAlert) {
+	log.Warn("the issuer cannot top up the chequebook", "chequebook", alert.Chequebook, "issuer", alert.Issuer,
+		"liquid", alert.Liquid, "needed", alert.Needed, "available", alert.Available, "reason", alert.Reason)
+	if m.alerted {
+		return
+	}
+	m.alerted = true
+	m.book.Notifier.topUpShortfall(alert)
+	if m.Alert != nil {
+		m.Alert(ctx, alert)
+	}
+}
+
+// issuerFunds returns what issuer holds of the chequebook's token, its ether balance for a chequebook holding ether
+func (c *Chequebook) issuerFunds(ctx context.Context, issuer common.Address) (*big.Int, error) {
+	if c.NativeToken() {
+		return c.backend.BalanceAt(ctx, issuer, nil)
+	}
+	tokenAddress, err := c.instance.Token(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	token, err := simpleswapfactory.NewERC20(tokenAddress, c.backend)
+	if err != nil {
+		return nil, err
+	}
+	return token.BalanceOf(&bind.CallOpts{Context: ctx}, issuer)
+}
@@ -0,0 +1,96 @@
+package chequebook
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// chequeTypes are the EIP-712 type definitions of a cheque
+// the domain is the one the Bee chequebooks check and has no verifyingContract, the chequebook is bound by the chequebook field of the cheque instead
+var chequeTypes = core.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+	},
+	"Cheque": {
+		{Name: "chequebook", Type: "address"},
+		{Name: "beneficiary", Type: "address"},
+		{Name: "cumulativePayout", Type: "uint256"},
+	},
+}
+
+// typedData returns the cheque as EIP-712 typed data for the given chain
+func (cheque *ChequeParams) typedData(chainID *big.Int) core.TypedData {
+	return core.TypedData{
+		Types:       chequeTypes,
+		PrimaryType: "Cheque",
+		Domain: core.TypedDataDomain{
+			Name:    "Chequebook",
+			Version: "1.0",
+			ChainId: (*math.HexOrDecimal256)(chainID),
+		},
+		Message: core.TypedDataMessage{
+			"chequebook":       cheque.Contract.Hex(),
+			"beneficiary":      cheque.Beneficiary.Hex(),
+			"cumulativePayout": cheque.CumulativePayout.String(),
+		},
+	}
+}
+
+// typedDataHash computes the EIP-712 hash of the cheque which is signed in typed data mode
+func (cheque *ChequeParams) typedDataHash(chainID *big.Int) ([]byte, error) {
+	return hashTypedData(cheque.typedData(chainID))
+}
+
+// hashTypedData computes the EIP-712 hash of typed data as signed by clef
+func hashTypedData(typedData core.TypedData) ([]byte, error) {
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return nil, err
+	}
+
+	typedDataHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, typedDataHash), nil
+}
+
+// SignCheque signs the cheque with the wallet
+// if typed is set the cheque is signed as EIP-712 typed data for the given chain, otherwise the personal-sign format of the v0.2.3 contracts is used
+func SignCheque(wallet WalletBackend, account accounts.Account, cheque *ChequeParams, chainID *big.Int, typed bool) ([]byte, error) {
+	if err := cheque.validate(); err != nil {
+		return nil, err
+	}
+
+	if !typed {
+		id, err := cheque.chequeID()
+		if err != nil {
+			return nil, err
+		}
+		// clef applies the eth_sign prefix to text/plain data itself, so it is given the unprefixed hash
+		return wallet.SignData(account, accounts.MimetypeTextPlain, id.Bytes())
+	}
+
+	data, err := json.Marshal(cheque.typedData(chainID))
+	if err != nil {
+		return nil, err
+	}
+	return wallet.SignData(account, accounts.MimetypeTypedData, data)
+}
+
+// Issue signs the cheque with the wallet account of its issuer, see SignCheque
+func Issue(wallet WalletBackend, issuer accounts.Account, cheque *ChequeParams, chainID *big.Int, typed bool) (*SignedCheque, error) {
+	sig, err := SignCheque(wallet, issuer, cheque, chainID, typed)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedCheque{ChequeParams: *cheque, Signature: sig}, nil
+}
@@ -0,0 +1,146 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// decimalsSelector is the selector of the optional ERC20 decimals() getter
+var decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67}
+
+// TokenDecimals reads the decimals of the token, false is returned if the token does not implement decimals()
+// the plain ERC20 of the v0.2.3 contracts has no decimals, its amounts are shown in base units
+func TokenDecimals(ctx context.Context, backend ethereum.ContractCaller, token common.Address) (uint8, bool) {
+	output, err := backend.CallContract(ctx, ethereum.CallMsg{To: &token, Data: decimalsSelector}, nil)
+	if err != nil || len(output) != 32 {
+		return 0, false
+	}
+
+	decimals := new(big.Int).SetBytes(output)
+	if !decimals.IsUint64() || decimals.Uint64() > 255 {
+		return 0, false
+	}
+	return uint8(decimals.Uint64()), true
+}
+
+// FormatUnits formats an amount of base units as a decimal number of tokens with the given decimals
+// trailing zeros of the fraction are dropped
+func FormatUnits(amount *big.Int, decimals uint8) string {
+	if decimals == 0 {
+		return amount.String()
+	}
+
+	digits := new(big.Int).Abs(amount).String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// symbolSelector is the selector of the optional ERC20 symbol() getter
+var symbolSelector = []byte{0x95, 0xd8, 0x9b, 0x41}
+
+// TokenSymbol reads the symbol of the token, false is returned if the token does not implement symbol()
+func TokenSymbol(ctx context.Context, backend ethereum.ContractCaller, token common.Address) (string, bool) {
+	output, err := backend.CallContract(ctx, ethereum.CallMsg{To: &token, Data: symbolSelector}, nil)
+	if err != nil {
+		return "", false
+	}
+	// a string is returned as offset, length and the padded bytes
+	if len(output) < 64 || new(big.Int).SetBytes(output[:32]).Cmp(big.NewInt(32)) != 0 {
+		return "", false
+	}
+	length := new(big.Int).SetBytes(output[32:64])
+	if !length.IsUint64() || length.Uint64() > uint64(len(output)-64) || length.Sign() == 0 {
+		return "", false
+	}
+	return string(output[64 : 64+length.Uint64()]), true
+}
+
+// ErrPrecisionLoss is returned for amounts with more fractional digits than the token's decimals can represent
+var ErrPrecisionLoss = errors.New("amount more precise than the token's decimals")
+
+// ParseUnits parses a decimal number of tokens with the given decimals into base units
+// trailing zeros of the fraction are ignored, any other digit beyond the decimals fails with ErrPrecisionLoss
+func ParseUnits(value string, decimals uint8) (*big.Int, error) {
+	whole, fraction := value, ""
+	if dot := strings.IndexByte(value, '.'); dot >= 0 {
+		whole, fraction = value[:dot], value[dot+1:]
+		if fraction == "" {
+			return nil, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	if whole == "" || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("%w: %q has %d decimals, the token %d", ErrPrecisionLoss, value, len(fraction), decimals)
+	}
+	amount, _ := new(big.Int).SetString(whole+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10)
+	return amount, nil
+}
+
+// Denomination is how amounts of a token are written for people, as whole tokens followed by the token's symbol
+type Denomination struct {
+	Symbol   string // symbol() of the token, empty if it has none
+	Decimals uint8  // decimals() of the token, 0 if it has none and amounts stay in base units
+}
+
+// EtherDenomination writes the amounts of chequebooks holding ether
+var EtherDenomination = Denomination{Symbol: "ETH", Decimals: 18}
+
+// TokenDenomination reads the symbol and decimals of token, a token implementing neither is written in base units
+func TokenDenomination(ctx context.Context, backend ethereum.ContractCaller, token common.Address) Denomination {
+	symbol, _ := TokenSymbol(ctx, backend, token)
+	decimals, _ := TokenDecimals(ctx, backend, token)
+	return Denomination{Symbol: symbol, Decimals: decimals}
+}
+
+// Format writes amount as whole tokens followed by the symbol, like 1.5 BZZ, a token without symbol only as the number
+func (d Denomination) Format(amount *big.Int) string {
+	if d.Symbol == "" {
+		return FormatUnits(amount, d.Decimals)
+	}
+	return FormatUnits(amount, d.Decimals) + " " + d.Symbol
+}
+
+// Parse reads an amount written by Format: a number followed by the symbol is in whole tokens
+// a number without symbol is in base units and has to be an integer, which keeps plain amounts meaning what they always did
+// amounts are never negative, a symbol other than the token's or more precision than its decimals is an error
+func (d Denomination) Parse(value string) (*big.Int, error) {
+	number, unit := value, ""
+	if space := strings.IndexAny(value, " \t"); space >= 0 {
+		number, unit = value[:space], strings.TrimSpace(value[space:])
+	}
+	if unit == "" {
+		amount, ok := new(big.Int).SetString(number, 10)
+		if !ok || amount.Sign() < 0 {
+			if strings.Contains(number, ".") {
+				return nil, fmt.Errorf("%w: %q is in base units, follow it by the token's symbol to give whole tokens", ErrPrecisionLoss, value)
+			}
+			return nil, fmt.Errorf("invalid amount %q", value)
+		}
+		return amount, nil
+	}
+	if d.Symbol == "" || !strings.EqualFold(unit, d.Symbol) {
+		return nil, fmt.Errorf("amount %q is not in the token's unit %q", value, d.Symbol)
+	}
+	return ParseUnits(number, d.Decimals)
+}
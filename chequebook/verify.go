@@ -0,0 +1,207 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// VerifyCheque recovers the address which signed the cheque in the personal-sign format
+func VerifyCheque(cheque *ChequeParams, sig []byte) (common.Address, error) {
+	hash, err := cheque.sigHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return recoverSigner(hash, sig)
+}
+
+// VerifyTypedCheque recovers the address which signed the cheque as EIP-712 typed data for the given chain
+func VerifyTypedCheque(cheque *ChequeParams, chainID *big.Int, sig []byte) (common.Address, error) {
+	if err := cheque.validate(); err != nil {
+		return common.Address{}, err
+	}
+	hash, err := cheque.typedDataHash(chainID)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return recoverSigner(hash, sig)
+}
+
+// Verify recovers the address which signed the cheque, as EIP-712 typed data for the given chain if typed is set
+func Verify(signed *SignedCheque, chainID *big.Int, typed bool) (common.Address, error) {
+	if typed {
+		return VerifyTypedCheque(&signed.ChequeParams, chainID, signed.Signature)
+	}
+	return VerifyCheque(&signed.ChequeParams, signed.Signature)
+}
+
+// ErrWrongIssuer is returned if a cheque was not signed by the issuer of its chequebook
+var ErrWrongIssuer = fmt.Errorf("%w: cheque not signed by the chequebook issuer", ErrChequeInvalidSignature)
+
+// VerifyChequeIssuer checks that the personal-sign signature of the cheque was produced by expectedIssuer
+func VerifyChequeIssuer(cheque *ChequeParams, sig []byte, expectedIssuer common.Address) error {
+	signer, err := VerifyCheque(cheque, sig)
+	if err != nil {
+		return err
+	}
+	if signer != expectedIssuer {
+		return fmt.Errorf("%w: signed by %s, expected %s", ErrWrongIssuer, signer.Hex(), expectedIssuer.Hex())
+	}
+	return nil
+}
+
+// VerifyReceived checks a received cheque before cashing it: it has to be drawn on this chequebook
+// and signed by the issuer the contract reports, as EIP-712 typed data for the given chain if typed is set
+// a cheque recording the chain it was issued for, or a chequebook with a ChainID, has to be on the backend's chain
+// with TrustedFactories set the chequebook also has to be deployed by one of them
+func (c *Chequebook) VerifyReceived(ctx context.Context, signed *SignedCheque, chainID *big.Int, typed bool) error {
+	if signed.Contract != c.address {
+		return fmt.Errorf("cheque is drawn on %s, not on chequebook %s", signed.Contract.Hex(), c.address.Hex())
+	}
+	if err := checkTrustedFactory(ctx, c.backend, c.address, c.TrustedFactories); err != nil {
+		return err
+	}
+	if signed.ChainID != nil || c.ChainID != nil {
+		actual, err := c.backend.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		if err := checkChain("the cheque", signed.ChainID, actual); err != nil {
+			return err
+		}
+		if err := checkChain("chequebook "+c.address.Hex(), c.ChainID, actual); err != nil {
+			return err
+		}
+	}
+
+	signer, err := Verify(signed, chainID, typed)
+	if err != nil {
+		return err
+	}
+
+	issuer, err := c.Issuer(ctx)
+	if err != nil {
+		return err
+	}
+	if signer != issuer {
+		return fmt.Errorf("%w: signed by %s, chequebook %s is owned by %s", ErrWrongIssuer, signer.Hex(), c.address.Hex(), issuer.Hex())
+	}
+	return nil
+}
+
+// recoverSigner recovers the address which produced sig over hash
+// signatures with a v value of 27 or 28, as produced by eth_sign and clef, are accepted as well as 0 or 1
+func recoverSigner(hash []byte, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("%w: length %d", ErrChequeInvalidSignature, len(sig))
+	}
+
+	// copy the signature to avoid modifying the caller's slice when normalizing v
+	s := make([]byte, len(sig))
+	copy(s, sig)
+	if s[crypto.RecoveryIDOffset] >= 27 {
+		s[crypto.RecoveryIDOffset] -= 27
+	}
+	if s[crypto.RecoveryIDOffset] > 1 {
+		return common.Address{}, fmt.Errorf("%w: recovery id %d", ErrChequeInvalidSignature, sig[crypto.RecoveryIDOffset])
+	}
+
+	pubKey, err := crypto.SigToPub(hash, s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrChequeInvalidSignature, err)
+	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+// ErrHashMismatch is returned if the chequebook rejects a cheque whose signature recovers to its issuer locally
+var ErrHashMismatch = errors.New("cheque hashing differs from the chequebook contract")
+
+// HashVector is a cheque drawn on the chequebook under test whose hashing is cross-checked with the contract
+type HashVector struct {
+	Beneficiary      common.Address
+	CumulativePayout *big.Int
+}
+
+// DefaultHashVectors cover encodings which are easy to get wrong: leading and trailing zero bytes, all bits set and the largest payout
+// none of the beneficiaries has a known key, so the signed vectors can never be cashed
+var DefaultHashVectors = []HashVector{
+	{Beneficiary: common.HexToAddress("0x0000000000000000000000000000000000000001"), CumulativePayout: big.NewInt(1)},
+	{Beneficiary: common.HexToAddress("0x00000000000000000000000000000000000000ff"), CumulativePayout: big.NewInt(256)},
+	{Beneficiary: common.HexToAddress("0xff00000000000000000000000000000000000000"), CumulativePayout: new(big.Int).Lsh(big.NewInt(1), 255)},
+	{Beneficiary: common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"), CumulativePayout: math.MaxBig256},
+}
+
+// HashCheck is the outcome of cross-checking one vector
+type HashCheck struct {
+	Cheque   ChequeParams
+	Hash     common.Hash // hash the issuer signed, as computed locally
+	Accepted bool        // the contract recovered the issuer from the signature
+	Reason   string      // why the simulated cashout reverted if it was not accepted
+}
+
+// CrossCheckHashing signs every vector with the issuer's wallet account, checks that the signature recovers to the issuer locally
+// and has the contract recover it by simulating a cashout from the beneficiary with eth_call
+// a vector rejected for its issuer signature fails the check with ErrHashMismatch,
+// reverts for other reasons, such as a beneficiary already paid more than the vector, only leave the vector unaccepted
+func (c *Chequebook) CrossCheckHashing(ctx context.Context, vectors []HashVector) ([]*HashCheck, error) {
+	issuer, err := c.Issuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	account, err := walletAccount(c.wallet, issuer)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := c.backend.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	typed := c.TypedCheques()
+
+	checks := make([]*HashCheck, 0, len(vectors))
+	var mismatches []string
+	for _, vector := range vectors {
+		cheque := ChequeParams{Contract: c.address, Beneficiary: vector.Beneficiary, CumulativePayout: vector.CumulativePayout}
+		var hash []byte
+		if typed {
+			hash, err = cheque.typedDataHash(chainID)
+		} else {
+			hash, err = cheque.sigHash()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := SignCheque(c.wallet, account, &cheque, chainID, typed)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := recoverSigner(hash, sig)
+		if err != nil {
+			return nil, err
+		}
+		if signer != issuer {
+			return nil, fmt.Errorf("%w: the wallet signed cheque %s for %s, not for the hash %x computed here", ErrHashMismatch, vector.Beneficiary.Hex(), signer.Hex(), hash)
+		}
+
+		simulation, err := c.SimulateCashCheque(ctx, &cheque, cheque.Beneficiary, sig)
+		if err != nil {
+			return nil, err
+		}
+		check := &HashCheck{Cheque: cheque, Hash: common.BytesToHash(hash), Accepted: simulation.Success, Reason: simulation.Reason}
+		checks = append(checks, check)
+		if errors.Is(simulation.Err, ErrInvalidIssuerSignature) {
+			mismatches = append(mismatches, fmt.Sprintf("%s/%v", vector.Beneficiary.Hex(), vector.CumulativePayout))
+		}
+	}
+	if len(mismatches) > 0 {
+		return checks, fmt.Errorf("%w: chequebook %s rejected the issuer signature of %s", ErrHashMismatch, c.address.Hex(), strings.Join(mismatches, ", "))
+	}
+	return checks, nil
+}
@@ -0,0 +1,266 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// ErrUnsupportedByVersion is returned for operations the contracts a chequebook was deployed from do not support
+var ErrUnsupportedByVersion = errors.New("not supported by the chequebook's contract version")
+
+// ContractVersion is a release of the swap contracts
+// the chequebooks of all supported releases answer the calls of the v0.2.3 bindings, they differ in how cheques are signed,
+// how their factory deploys them and in their runtime code, and chequebooks holding ether have no token()
+type ContractVersion interface {
+	Name() string
+	TypedCheques() bool // cheques are signed as EIP-712 typed data instead of in the personal-sign format
+	NativeToken() bool  // the chequebook is funded and pays out in ether instead of an ERC20 token
+	// DeployChequebook sends the transaction deploying a chequebook for issuer through the factory at factory
+	DeployChequebook(opts *bind.TransactOpts, backend EthBackend, factory common.Address, issuer common.Address) (*types.Transaction, error)
+	// matches reports whether code is the runtime code of a chequebook of this release
+	matches(ctx context.Context, backend EthBackend, code []byte) (bool, error)
+}
+
+var (
+	// ContractsV023 are the v0.2.3 contracts the bindings of this package are generated from
+	ContractsV023 ContractVersion = v023Contracts{}
+	// ContractsBee are the later ERC20SimpleSwap releases used by Bee, whose factory deploys minimal proxies of one master chequebook
+	ContractsBee ContractVersion = beeContracts{}
+	// ContractsEther is the SimpleSwap holding ether, its factory deploys chequebooks through the deploySimpleSwap of v0.2.3
+	ContractsEther ContractVersion = etherContracts{}
+)
+
+// contractVersions are the supported releases in the order DetectVersion tries them
+var contractVersions = []ContractVersion{ContractsV023, ContractsBee, ContractsEther}
+
+// ContractVersionByName returns the supported release called name
+func ContractVersionByName(name string) (ContractVersion, error) {
+	for _, version := range contractVersions {
+		if version.Name() == name {
+			return version, nil
+		}
+	}
+	names := make([]string, 0, len(contractVersions))
+	for _, version := range contractVersions {
+		names = append(names, version.Name())
+	}
+	return nil, fmt.Errorf("unknown contract version %q, supported are %s", name, strings.Join(names, ", "))
+}
+
+// DetectVersion finds the release of the chequebook at address from its runtime code
+func DetectVersion(ctx context.Context, backend EthBackend, address common.Address) (ContractVersion, error) {
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("%w: no contract code at %s", ErrChequebookNotDeployed, address.Hex())
+	}
+	for _, version := range contractVersions {
+		ok, err := version.matches(ctx, backend, code)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return version, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: code at %s matches no supported contract version", ErrUnknownBytecode, address.Hex())
+}
+
+// VerifyChequebookVersion checks that the contract at address runs the chequebook code of version
+func VerifyChequebookVersion(ctx context.Context, backend EthBackend, address common.Address, version ContractVersion) error {
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("%w: no contract code at %s", ErrChequebookNotDeployed, address.Hex())
+	}
+	ok, err := version.matches(ctx, backend, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: code at %s is not a %s chequebook", ErrUnknownBytecode, address.Hex(), version.Name())
+	}
+	return nil
+}
+
+// OpenChequebook binds to the chequebook deployed at address and detects the release it was deployed from
+func OpenChequebook(ctx context.Context, address common.Address, backend EthBackend, wallet WalletBackend) (*Chequebook, error) {
+	version, err := DetectVersion(ctx, backend, address)
+	if err != nil {
+		return nil, err
+	}
+	book, err := NewChequebook(address, backend, wallet)
+	if err != nil {
+		return nil, err
+	}
+	book.Version = version
+	return book, nil
+}
+
+// openChequebookVersion binds to the chequebook at address of release version, detecting the release if version is nil
+func openChequebookVersion(ctx context.Context, address common.Address, backend EthBackend, wallet WalletBackend, version ContractVersion) (*Chequebook, error) {
+	if version == nil {
+		return OpenChequebook(ctx, address, backend, wallet)
+	}
+	if err := VerifyChequebookVersion(ctx, backend, address, version); err != nil {
+		return nil, err
+	}
+	book, err := NewChequebook(address, backend, wallet)
+	if err != nil {
+		return nil, err
+	}
+	book.Version = version
+	return book, nil
+}
+
+// DeployVersion deploys a new chequebook for issuer through the factory of version at factory, like Deploy does for v0.2.3
+func DeployVersion(ctx context.Context, backend EthBackend, wallet WalletBackend, opts *bind.TransactOpts, version ContractVersion, factory common.Address, issuer common.Address) (*Chequebook, *types.Transaction, error) {
+	tx, err := version.DeployChequebook(opts, backend, factory, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	// both releases emit the same SimpleSwapDeployed event
+	instance, err := simpleswapfactory.NewSimpleSwapFactory(factory, backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	book, err := deployedChequebook(ctx, backend, wallet, instance, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	book.Version = version
+	return book, tx, nil
+}
+
+type v023Contracts struct{}
+
+func (v023Contracts) Name() string { return "v0.2.3" }
+
+func (v023Contracts) TypedCheques() bool { return false }
+
+func (v023Contracts) NativeToken() bool { return false }
+
+func (v023Contracts) DeployChequebook(opts *bind.TransactOpts, backend EthBackend, factory common.Address, issuer common.Address) (*types.Transaction, error) {
+	instance, err := simpleswapfactory.NewSimpleSwapFactory(factory, backend)
+	if err != nil {
+		return nil, err
+	}
+	return instance.DeploySimpleSwap(opts, issuer, big.NewInt(0))
+}
+
+// matches looks for code verbatim in the creation code of the bindings, see VerifyChequebook
+func (v023Contracts) matches(ctx context.Context, backend EthBackend, code []byte) (bool, error) {
+	return len(code) >= minRuntimeLength && bytes.Contains(common.FromHex(simpleswapfactory.ERC20SimpleSwapBin), code), nil
+}
+
+// beeFactoryABI is the part of the later SimpleSwapFactory differing from v0.2.3, deployments take a salt for create2
+const beeFactoryABI = `[{"inputs":[{"internalType":"address","name":"issuer","type":"address"},{"internalType":"uint256","name":"defaultHardDepositTimeoutDuration","type":"uint256"},{"internalType":"bytes32","name":"salt","type":"bytes32"}],"name":"deploySimpleSwap","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"nonpayable","type":"function"}]`
+
+// EIP-1167 minimal proxy runtime code around the 20 byte address of the master copy
+var (
+	proxyPrefix = common.FromHex("363d3d373d3d3d363d73")
+	proxySuffix = common.FromHex("5af43d82803e903d91602b57fd5bf3")
+)
+
+// beeSelectors are functions whose selectors the master chequebook's dispatcher has to contain
+var beeSelectors = []string{
+	"issuer()",
+	"token()",
+	"paidOut(address)",
+	"cashChequeBeneficiary(address,uint256,bytes)",
+	"cashCheque(address,address,uint256,bytes,uint256,bytes)",
+	"withdraw(uint256)",
+}
+
+type beeContracts struct{}
+
+func (beeContracts) Name() string { return "bee" }
+
+func (beeContracts) TypedCheques() bool { return true }
+
+func (beeContracts) NativeToken() bool { return false }
+
+func (beeContracts) DeployChequebook(opts *bind.TransactOpts, backend EthBackend, factory common.Address, issuer common.Address) (*types.Transaction, error) {
+	parsed, err := abi.JSON(strings.NewReader(beeFactoryABI))
+	if err != nil {
+		return nil, err
+	}
+	// the salt only has to be new, every chequebook of the factory needs its own create2 address
+	var salt [32]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(factory, parsed, backend, backend, backend)
+	return contract.Transact(opts, "deploySimpleSwap", issuer, big.NewInt(0), salt)
+}
+
+// matches accepts a minimal proxy whose master copy dispatches the chequebook functions
+// the master is not built from bindings of this package, so unlike v0.2.3 its code can only be checked for the expected selectors
+func (beeContracts) matches(ctx context.Context, backend EthBackend, code []byte) (bool, error) {
+	if len(code) != len(proxyPrefix)+common.AddressLength+len(proxySuffix) || !bytes.HasPrefix(code, proxyPrefix) || !bytes.HasSuffix(code, proxySuffix) {
+		return false, nil
+	}
+	master := common.BytesToAddress(code[len(proxyPrefix) : len(proxyPrefix)+common.AddressLength])
+	masterCode, err := backend.CodeAt(ctx, master, nil)
+	if err != nil {
+		return false, err
+	}
+	return dispatches(masterCode, beeSelectors...), nil
+}
+
+// dispatches reports whether the dispatcher of code compares the call data with the selectors of all signatures
+func dispatches(code []byte, signatures ...string) bool {
+	for _, signature := range signatures {
+		push := append([]byte{0x63}, crypto.Keccak256([]byte(signature))[:4]...)
+		if !bytes.Contains(code, push) {
+			return false
+		}
+	}
+	return true
+}
+
+// etherSelectors are functions dispatched by an ether chequebook, which shares them with the ERC20 releases
+var etherSelectors = []string{
+	"issuer()",
+	"paidOut(address)",
+	"liquidBalance()",
+	"cashChequeBeneficiary(address,uint256,bytes)",
+	"withdraw(uint256)",
+}
+
+type etherContracts struct{}
+
+func (etherContracts) Name() string { return "ether" }
+
+func (etherContracts) TypedCheques() bool { return false }
+
+func (etherContracts) NativeToken() bool { return true }
+
+func (etherContracts) DeployChequebook(opts *bind.TransactOpts, backend EthBackend, factory common.Address, issuer common.Address) (*types.Transaction, error) {
+	return v023Contracts{}.DeployChequebook(opts, backend, factory, issuer)
+}
+
+// matches accepts code dispatching the chequebook functions but no token(), there are no bindings to compare it with either
+// proxies are left to the Bee release, ether chequebooks are deployed with their full code
+func (etherContracts) matches(ctx context.Context, backend EthBackend, code []byte) (bool, error) {
+	if bytes.HasPrefix(code, proxyPrefix) {
+		return false, nil
+	}
+	return dispatches(code, etherSelectors...) && !dispatches(code, "token()"), nil
+}
@@ -0,0 +1,241 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DefaultWaitTimeout is the default time to wait for a single transaction to be mined
+const DefaultWaitTimeout = 2 * time.Minute
+
+// DefaultConfirmations is the default number of blocks a transaction has to be buried under, 1 being its own block
+const DefaultConfirmations = 1
+
+// confirmationPollInterval is the delay between two checks for new confirmations
+var confirmationPollInterval = time.Second
+
+// minedPollInterval is the delay between two receipt checks on backends which cannot subscribe to new heads
+var minedPollInterval = time.Second
+
+// headSubscriber is implemented by backends which can push new chain heads, like websocket clients
+type headSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// notifyHeads signals on the returned channel whenever a new block may have arrived until ctx is done
+// backends which subscribe to new heads signal per head, all others and failed subscriptions fall back to polling every interval
+func notifyHeads(ctx context.Context, backend interface{}, interval time.Duration) <-chan struct{} {
+	notify := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+
+	var sub ethereum.Subscription
+	heads := make(chan *types.Header)
+	if subscriber, ok := backend.(headSubscriber); ok {
+		var err error
+		sub, err = subscriber.SubscribeNewHead(ctx, heads)
+		if err != nil {
+			// http endpoints report rpc.ErrNotificationsUnsupported, nothing to warn about
+			log.Trace("subscribing to new heads failed, polling", "err", err)
+			sub = nil
+		}
+	}
+
+	go func() {
+		if sub != nil {
+			defer sub.Unsubscribe()
+			for sub != nil {
+				select {
+				case <-heads:
+					signal()
+				case err := <-sub.Err():
+					log.Debug("new head subscription failed, polling", "err", err)
+					sub = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				signal()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return notify
+}
+
+// WaitMined waits at most timeout for tx to be mined
+// the receipt is checked on every new head where the backend can subscribe to them and polled for otherwise
+// the error includes the transaction hash so an interrupted wait can be followed up manually
+func WaitMined(ctx context.Context, backend bind.DeployBackend, tx *types.Transaction, timeout time.Duration) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return waitMined(ctx, backend, tx)
+}
+
+// waitMined waits for tx to be mined until ctx is done
+func waitMined(ctx context.Context, backend bind.DeployBackend, tx *types.Transaction) (*types.Receipt, error) {
+	heads := notifyHeads(ctx, backend, minedPollInterval)
+	for {
+		receipt, err := backend.TransactionReceipt(ctx, tx.Hash())
+		if err == nil && receipt != nil {
+			return receipt, nil
+		}
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			log.Trace("reading receipt failed", "tx", tx.Hash().Hex(), "err", err)
+		}
+
+		select {
+		case <-heads:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for transaction %s: %w", tx.Hash().Hex(), ctx.Err())
+		}
+	}
+}
+
+// waitDeployed waits at most timeout for the contract creation tx to be confirmed and returns its receipt naming the contract address
+// a reverted creation is reported as a *RevertError
+func waitDeployed(ctx context.Context, backend EthBackend, tx *types.Transaction, confirmations uint64, timeout time.Duration) (*types.Receipt, error) {
+	if tx.To() != nil {
+		return nil, fmt.Errorf("transaction %s is not a contract creation", tx.Hash().Hex())
+	}
+
+	receipt, err := WaitConfirmed(ctx, backend, tx, confirmations, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkReceipt(ctx, backend, tx, receipt); err != nil {
+		return nil, err
+	}
+	if (receipt.ContractAddress == common.Address{}) {
+		return nil, fmt.Errorf("deployment %s did not create a contract", tx.Hash().Hex())
+	}
+
+	// a failed creation leaves no code behind
+	code, err := backend.CodeAt(ctx, receipt.ContractAddress, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("deployment %s: %w", tx.Hash().Hex(), bind.ErrNoCodeAfterDeploy)
+	}
+	return receipt, nil
+}
+
+// ErrTransactionDropped is returned if a reorg dropped a mined transaction which then could not be included again
+var ErrTransactionDropped = errors.New("transaction dropped")
+
+// confirmationBackend is what WaitConfirmed needs to follow the chain
+type confirmationBackend interface {
+	bind.DeployBackend
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// transactionSender recovers the sender of the signed tx
+func transactionSender(tx *types.Transaction) (common.Address, error) {
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	return types.Sender(signer, tx)
+}
+
+// WaitConfirmed waits at most timeout for tx to be mined and buried under confirmations blocks, counting its own block
+// the receipt is re-read until then so a reorg moving the transaction to another block restarts the count from that block
+// and a reorg dropping it waits for it to be included again
+// ErrTransactionDropped is returned once another transaction of the sender took the nonce of a dropped transaction,
+// or if it is still dropped when timeout passes
+func WaitConfirmed(ctx context.Context, backend confirmationBackend, tx *types.Transaction, confirmations uint64, timeout time.Duration) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	receipt, err := WaitMined(ctx, backend, tx, timeout)
+	if err != nil || confirmations <= 1 {
+		return receipt, err
+	}
+
+	sender, senderErr := transactionSender(tx)
+	heads := notifyHeads(ctx, backend, confirmationPollInterval)
+	for {
+		// the nonce is read before the receipt so the transaction being included in between is not taken for a replacement
+		var nonce uint64
+		nonceErr := senderErr
+		if receipt == nil && senderErr == nil {
+			nonce, nonceErr = backend.NonceAt(ctx, sender, nil)
+		}
+
+		confirmed, err := isConfirmed(ctx, backend, tx, confirmations, &receipt)
+		if err != nil {
+			return nil, fmt.Errorf("waiting for confirmations of transaction %s: %w", tx.Hash().Hex(), err)
+		}
+		if confirmed {
+			return receipt, nil
+		}
+		if receipt == nil && nonceErr == nil && nonce > tx.Nonce() {
+			return nil, fmt.Errorf("%w: transaction %s was reorged out and its nonce %d used by another transaction", ErrTransactionDropped, tx.Hash().Hex(), tx.Nonce())
+		}
+
+		select {
+		case <-heads:
+		case <-ctx.Done():
+			if receipt == nil {
+				return nil, fmt.Errorf("%w: transaction %s was reorged out and not included again: %v", ErrTransactionDropped, tx.Hash().Hex(), ctx.Err())
+			}
+			return nil, fmt.Errorf("waiting for confirmations of transaction %s: %w", tx.Hash().Hex(), ctx.Err())
+		}
+	}
+}
+
+// isConfirmed reports whether the transaction is buried under confirmations blocks of the canonical chain
+// receipt is replaced with the current receipt of the transaction, or set to nil while a reorg dropped it
+func isConfirmed(ctx context.Context, backend confirmationBackend, tx *types.Transaction, confirmations uint64, receipt **types.Receipt) (bool, error) {
+	current, err := backend.TransactionReceipt(ctx, tx.Hash())
+	if errors.Is(err, ethereum.NotFound) {
+		if *receipt != nil {
+			log.Warn("transaction dropped by reorg, waiting for it to be included again", "tx", tx.Hash().Hex(), "block", (*receipt).BlockNumber)
+		}
+		*receipt = nil
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*receipt = current
+
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	depth := new(big.Int).Sub(head.Number, current.BlockNumber)
+	if depth.Sign() < 0 || depth.Uint64()+1 < confirmations {
+		return false, nil
+	}
+
+	// the receipt may still be served for a block which was reorged out
+	block, err := backend.HeaderByNumber(ctx, current.BlockNumber)
+	if err != nil {
+		return false, err
+	}
+	return block.Hash() == current.BlockHash, nil
+}
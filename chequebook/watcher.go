@@ -0,0 +1,271 @@
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+)
+
+// DefaultWatchPollInterval is the default delay between two log queries on backends which cannot subscribe
+const DefaultWatchPollInterval = 5 * time.Second
+
+// ChequeEventKind tells which chequebook event a ChequeEvent reports
+type ChequeEventKind int
+
+const (
+	ChequeCashedEvent  ChequeEventKind = iota // a cheque was cashed, Cashout holds the amounts
+	ChequeBouncedEvent                        // the cashout in the same transaction could not be covered completely
+)
+
+func (k ChequeEventKind) String() string {
+	if k == ChequeBouncedEvent {
+		return "ChequeBounced"
+	}
+	return "ChequeCashed"
+}
+
+// ChequeEvent is a ChequeCashed or ChequeBounced event of a watched chequebook
+type ChequeEvent struct {
+	Kind       ChequeEventKind
+	Chequebook common.Address
+	Cashout    *CashoutResult // amounts of a ChequeCashed event, nil for ChequeBounced
+	Log        types.Log      // Removed is set if a reorg dropped the event after it was delivered
+}
+
+// ChequeWatcher delivers the cashout events of a set of chequebooks
+// it subscribes to their logs and polls for them on backends which cannot subscribe, whenever a subscription fails
+// it resubscribes and first catches up on the blocks it missed
+type ChequeWatcher struct {
+	backend   EthBackend
+	addresses []common.Address
+	parser    *simpleswapfactory.ERC20SimpleSwapFilterer
+
+	FromBlock    *big.Int      // first block whose events are delivered, nil starts with the next block
+	PollInterval time.Duration // delay between two log queries when polling
+}
+
+// logPosition orders logs by block and index so events seen in the catch-up and the subscription are delivered once
+type logPosition struct {
+	block uint64
+	index uint
+}
+
+func (p logPosition) after(other logPosition) bool {
+	return p.block > other.block || (p.block == other.block && p.index > other.index)
+}
+
+// NewChequeWatcher creates a watcher for the chequebooks at addresses
+func NewChequeWatcher(backend EthBackend, addresses ...common.Address) (*ChequeWatcher, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no chequebook to watch")
+	}
+	// the event layout is the same for every chequebook, one filterer parses the logs of all of them
+	parser, err := simpleswapfactory.NewERC20SimpleSwapFilterer(addresses[0], backend)
+	if err != nil {
+		return nil, err
+	}
+	return &ChequeWatcher{
+		backend:      backend,
+		addresses:    addresses,
+		parser:       parser,
+		PollInterval: DefaultWatchPollInterval,
+	}, nil
+}
+
+func (w *ChequeWatcher) query(from *big.Int, to *big.Int) ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: w.addresses,
+		Topics:    [][]common.Hash{{chequeCashedTopic, chequeBouncedTopic}},
+	}
+}
+
+// Watch delivers the events of the watched chequebooks on sink until ctx is done
+// the events from FromBlock up to the current head are delivered first
+func (w *ChequeWatcher) Watch(ctx context.Context, sink chan<- ChequeEvent) error {
+	next := w.FromBlock
+	if next == nil {
+		head, err := w.backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		next = new(big.Int).Add(head.Number, big.NewInt(1))
+	}
+
+	state := &watchState{next: new(big.Int).Set(next)}
+	delay := retryBaseDelay
+	for {
+		err := w.subscribe(ctx, sink, state)
+		if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			log.Debug("backend cannot subscribe to logs, polling", "interval", w.PollInterval)
+			return w.poll(ctx, sink, state)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if state.progressed {
+			delay = retryBaseDelay
+			state.progressed = false
+		}
+
+		log.Warn("cheque event subscription failed, resubscribing", "retry", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay *= 2
+		if delay > maxReconnectBackoff {
+			delay = maxReconnectBackoff
+		}
+	}
+}
+
+// watchState is where a Watch continues after a failed subscription
+type watchState struct {
+	next       *big.Int    // first block not caught up on yet
+	last       logPosition // last delivered log
+	delivered  bool        // last is set
+	progressed bool        // the subscription was established since the last failure
+}
+
+// subscribe subscribes to the events, catches up to the head and then delivers the subscription until it fails
+func (w *ChequeWatcher) subscribe(ctx context.Context, sink chan<- ChequeEvent, state *watchState) error {
+	logs := make(chan types.Log)
+	// subscribing before the catch-up leaves no gap, logs seen by both are dropped by their position
+	sub, err := w.backend.SubscribeFilterLogs(ctx, w.query(nil, nil), logs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	state.progressed = true
+
+	if err := w.catchUp(ctx, sink, state); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case entry := <-logs:
+			if err := w.deliver(ctx, sink, state, entry); err != nil {
+				return err
+			}
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("subscription closed")
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// poll queries the logs of the blocks mined since the last query every PollInterval
+func (w *ChequeWatcher) poll(ctx context.Context, sink chan<- ChequeEvent, state *watchState) error {
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = DefaultWatchPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.catchUp(ctx, sink, state); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Warn("querying cheque events failed", "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// catchUp delivers the events from state.next up to the current head
+func (w *ChequeWatcher) catchUp(ctx context.Context, sink chan<- ChequeEvent, state *watchState) error {
+	head, err := w.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if head.Number.Cmp(state.next) < 0 {
+		return nil
+	}
+
+	var logs []types.Log
+	err = WithRetry(ctx, DefaultRetryAttempts, func() (err error) {
+		logs, err = w.backend.FilterLogs(ctx, w.query(state.next, head.Number))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range logs {
+		if err := w.deliver(ctx, sink, state, entry); err != nil {
+			return err
+		}
+	}
+	state.next = new(big.Int).Add(head.Number, big.NewInt(1))
+	return nil
+}
+
+// deliver parses entry and sends it to sink unless it was delivered before
+func (w *ChequeWatcher) deliver(ctx context.Context, sink chan<- ChequeEvent, state *watchState, entry types.Log) error {
+	if len(entry.Topics) == 0 {
+		return nil
+	}
+	position := logPosition{block: entry.BlockNumber, index: entry.Index}
+	if !entry.Removed && state.delivered && !position.after(state.last) {
+		return nil
+	}
+
+	event := ChequeEvent{Chequebook: entry.Address, Log: entry}
+	switch entry.Topics[0] {
+	case chequeCashedTopic:
+		cashed, err := w.parser.ParseChequeCashed(entry)
+		if err != nil {
+			return fmt.Errorf("parsing ChequeCashed event: %w", err)
+		}
+		event.Kind = ChequeCashedEvent
+		event.Cashout = &CashoutResult{
+			Beneficiary:      cashed.Beneficiary,
+			Recipient:        cashed.Recipient,
+			Caller:           cashed.Caller,
+			TotalPayout:      cashed.TotalPayout,
+			CumulativePayout: cashed.CumulativePayout,
+			CallerPayout:     cashed.CallerPayout,
+		}
+	case chequeBouncedTopic:
+		event.Kind = ChequeBouncedEvent
+	default:
+		return nil
+	}
+
+	select {
+	case sink <- event:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if !entry.Removed {
+		state.last = position
+		state.delivered = true
+		if next := new(big.Int).SetUint64(entry.BlockNumber); next.Cmp(state.next) > 0 {
+			// a resubscription catches up from the block of the last delivered log, its earlier logs are skipped
+			state.next = next
+		}
+	}
+	return nil
+}
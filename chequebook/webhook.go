@@ -0,0 +1,238 @@
+package chequebook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// kinds of the events posted by a Notifier
+const (
+	EventChequeIssued   = "cheque.issued"
+	EventChequeReceived = "cheque.received"
+	EventChequeCashed   = "cheque.cashed"
+	EventChequeBounced  = "cheque.bounced" // cashed while the chequebook could not pay all of it
+	EventTxFailed       = "tx.failed"      // a sent transaction reverted or was not confirmed
+	EventTopUpShortfall = "topup.shortfall"
+)
+
+const (
+	// WebhookSignatureHeader carries the hex HMAC-SHA256 of the body keyed with the webhook secret, prefixed with sha256=
+	WebhookSignatureHeader = "X-Swap-Signature"
+	// WebhookEventHeader carries the kind of the posted event
+	WebhookEventHeader = "X-Swap-Event"
+)
+
+// webhookTimeout bounds a single post of an event
+const webhookTimeout = 10 * time.Second
+
+// webhookAttempts is how often an event is posted before it is given up, with growing delays in between
+const webhookAttempts = 4
+
+// WebhookEvent is the json body posted for a cheque or transaction event
+type WebhookEvent struct {
+	Kind             string          `json:"kind"`
+	Time             time.Time       `json:"time"`
+	Chequebook       *common.Address `json:"chequebook,omitempty"`
+	Beneficiary      *common.Address `json:"beneficiary,omitempty"`
+	Recipient        *common.Address `json:"recipient,omitempty"`
+	CumulativePayout string          `json:"cumulativePayout,omitempty"`
+	Amount           string          `json:"amount,omitempty"` // added to the payout when issued, paid out when cashed
+	Tx               *common.Hash    `json:"tx,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	TopUp            *TopUpAlert     `json:"topUp,omitempty"`
+}
+
+// Notifier posts cheque and transaction events as json to webhooks, signed so receivers can tell them from forgeries
+// events are posted in the background and retried, a webhook which is down does not hold up cheques or cashouts
+// every method is a no-op on a nil *Notifier
+type Notifier struct {
+	urls   []string
+	secret []byte
+	client *http.Client
+
+	wg sync.WaitGroup
+}
+
+// NewNotifier creates a notifier posting to urls, signing every body with secret
+// without a secret the events are posted unsigned
+func NewNotifier(urls []string, secret []byte) *Notifier {
+	return &Notifier{urls: urls, secret: secret, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// SignWebhook returns the value of the WebhookSignatureHeader for body
+func SignWebhook(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is the WebhookSignatureHeader of body for secret
+func VerifyWebhook(secret []byte, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+// Notify posts event to every webhook in the background, its time is set to now if it has none
+func (n *Notifier) Notify(event *WebhookEvent) {
+	if n == nil || len(n.urls) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Error("failed to encode a webhook event", "kind", event.Kind, "err", err)
+		return
+	}
+	for _, url := range n.urls {
+		n.wg.Add(1)
+		go func(url string) {
+			defer n.wg.Done()
+			if err := n.post(url, event.Kind, body); err != nil {
+				log.Warn("giving up posting a webhook event", "webhook", url, "kind", event.Kind, "err", err)
+			}
+		}(url)
+	}
+}
+
+// post sends body to url until it is accepted or the attempts are used up
+func (n *Notifier) post(url string, kind string, body []byte) error {
+	var err error
+	delay := time.Second
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = n.postOnce(url, kind, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (n *Notifier) postOnce(url string, kind string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, kind)
+	if len(n.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(n.secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Close waits until the events posted so far are delivered or given up, or ctx is done
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// chequeEvent builds the event of kind for cheque
+func chequeEvent(kind string, cheque *ChequeParams, amount *big.Int) *WebhookEvent {
+	contract, beneficiary := cheque.Contract, cheque.Beneficiary
+	event := &WebhookEvent{Kind: kind, Chequebook: &contract, Beneficiary: &beneficiary, CumulativePayout: cheque.CumulativePayout.String()}
+	if amount != nil {
+		event.Amount = amount.String()
+	}
+	return event
+}
+
+// issued posts a cheque raising the payout of its beneficiary by amount
+func (n *Notifier) issued(cheque *SignedCheque, amount *big.Int) {
+	if n == nil {
+		return
+	}
+	n.Notify(chequeEvent(EventChequeIssued, &cheque.ChequeParams, amount))
+}
+
+// received posts a cheque accepted from an issuer
+func (n *Notifier) received(cheque *SignedCheque) {
+	if n == nil {
+		return
+	}
+	n.Notify(chequeEvent(EventChequeReceived, &cheque.ChequeParams, nil))
+}
+
+// cashout posts the outcome of a mined cashout of chequebook, a reverted one as a failed transaction
+func (n *Notifier) cashout(chequebook common.Address, result *CashResult) {
+	if n == nil {
+		return
+	}
+	tx := result.TxHash
+	if result.Revert != nil {
+		n.Notify(&WebhookEvent{Kind: EventTxFailed, Chequebook: &chequebook, Tx: &tx, Error: result.Revert.Error()})
+		return
+	}
+	cashout := result.Cashout
+	if cashout == nil {
+		return
+	}
+	kind := EventChequeCashed
+	if cashout.Bounced {
+		kind = EventChequeBounced
+	}
+	beneficiary, recipient := cashout.Beneficiary, cashout.Recipient
+	n.Notify(&WebhookEvent{
+		Kind:             kind,
+		Chequebook:       &chequebook,
+		Beneficiary:      &beneficiary,
+		Recipient:        &recipient,
+		CumulativePayout: cashout.CumulativePayout.String(),
+		Amount:           cashout.TotalPayout.String(),
+		Tx:               &tx,
+	})
+}
+
+// txFailed posts a transaction to contract which was sent but reverted or could not be confirmed
+func (n *Notifier) txFailed(contract common.Address, tx *types.Transaction, err error) {
+	if n == nil || err == nil {
+		return
+	}
+	hash := tx.Hash()
+	n.Notify(&WebhookEvent{Kind: EventTxFailed, Chequebook: &contract, Tx: &hash, Error: err.Error()})
+}
+
+// topUpShortfall posts that the issuer cannot top up a chequebook
+func (n *Notifier) topUpShortfall(alert *TopUpAlert) {
+	if n == nil {
+		return
+	}
+	chequebook := alert.Chequebook
+	n.Notify(&WebhookEvent{Kind: EventTopUpShortfall, Chequebook: &chequebook, TopUp: alert})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// closeAuditLog closes the audit log of the run and logs its head, which an operator can note to later detect a cut off end
+func closeAuditLog(logger log.Logger, audit *chequebook.AuditLog, cfg *options) {
+	entries, head := audit.Head()
+	if err := audit.Close(); err != nil {
+		logger.Warn("closing the audit log failed", "file", cfg.auditLog, "err", err)
+		return
+	}
+	logger.Info("audit log closed", "file", cfg.auditLog, "entries", entries, "head", head)
+}
+
+// runAudit verifies the hash chain of an audit log and prints its number of entries and head
+func runAudit(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	if len(cfg.commandArgs) == 0 || cfg.commandArgs[0] != "verify" {
+		return fmt.Errorf("usage: %s verify [-file path]", cfg.command)
+	}
+	cfg.commandArgs = cfg.commandArgs[1:]
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	file := fs.String("file", cfg.auditLog, "audit log `file` to verify, defaults to -audit-log")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("%s verify requires -file or -audit-log", cfg.command)
+	}
+
+	entries, head, err := chequebook.VerifyAuditLog(*file)
+	if err != nil {
+		// the entries up to the broken one still chain up, which tells where to look
+		logger.Error("audit log does not verify", "file", *file, "verified", entries, "head", head)
+		return err
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			File    string      `json:"file"`
+			Entries uint64      `json:"entries"`
+			Head    common.Hash `json:"head"`
+		}{*file, entries, head})
+	}
+	fmt.Printf("%s: %d entries, head %s\n", *file, entries, head.Hex())
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// readInput reads the whole file at path, or stdin if path is "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// readSignedCheques reads a json array of signed cheques from the file at path, or from stdin if path is "-"
+func readSignedCheques(path string) ([]*chequebook.SignedCheque, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cheques []*chequebook.SignedCheque
+	if err := json.Unmarshal(data, &cheques); err != nil {
+		return nil, err
+	}
+	for i, cheque := range cheques {
+		if cheque == nil {
+			return nil, fmt.Errorf("cheque %d is null", i)
+		}
+	}
+	return cheques, nil
+}
+
+// runBatch cashes all cheques in the batch file and prints a summary
+// it fails if any cheque could not be cashed
+func runBatch(ctx context.Context, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	if chequebook.IsReadOnly(wallet) {
+		return fmt.Errorf("%w: cashing cheques sends transactions", chequebook.ErrReadOnly)
+	}
+
+	cheques, err := readSignedCheques(cfg.batchFile)
+	if err != nil {
+		return err
+	}
+
+	results := chequebook.CashBatch(ctx, backend, wallet, cheques, cfg.recipient, batchOptions(cfg))
+	if cfg.jsonOutput {
+		return printBatch(results)
+	}
+	return printBatchTable(ctx, results, cfg)
+}
+
+// runCashAll cashes the uncashed part of every cheque in a store, whichever chequebook it is drawn on, and prints a summary like runBatch
+func runCashAll(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the received cheques")
+	parallelism := fs.Int("parallelism", 1, "number of beneficiaries whose cashouts are sent at the same time")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *storeDir == "" {
+		return errors.New("cash-all requires -store")
+	}
+	if *parallelism < 1 {
+		return fmt.Errorf("invalid -parallelism %d", *parallelism)
+	}
+	if chequebook.IsReadOnly(wallet) {
+		return fmt.Errorf("%w: cashing cheques sends transactions", chequebook.ErrReadOnly)
+	}
+
+	store, err := chequebook.OpenChequeStore(*storeDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	opts := batchOptions(cfg)
+	opts.Parallelism = *parallelism
+	results, err := chequebook.CashAll(ctx, backend, wallet, store, cfg.recipient, opts)
+	if err != nil {
+		return err
+	}
+	logger.Info("cashed stored cheques", "cheques", len(results), "store", *storeDir)
+
+	if cfg.jsonOutput {
+		return printBatch(results)
+	}
+	return printBatchTable(ctx, results, cfg)
+}
+
+// batchOptions are the batch settings of the gas, wait and retry flags
+func batchOptions(cfg *options) chequebook.BatchOptions {
+	return chequebook.BatchOptions{
+		GasBufferPercent: cfg.gasBufferPercent,
+		GasPrice:         cfg.gasPrice,
+		GasPricer:        cfg.gasPricer,
+		MaxFee:           cfg.maxFee,
+		GasCap:           cfg.gasCap,
+		MaxGasCostUSD:    cfg.maxGasCostUSD,
+		USDOracle:        cfg.usdOracle,
+		WaitTimeout:      cfg.waitTimeout,
+		Confirmations:    cfg.confirmations,
+		RetryAttempts:    cfg.retryAttempts,
+		RecipientConsent: cfg.recipientConsent,
+		Audit:            cfg.audit,
+		Notifier:         cfg.notifier,
+		TrustedFactories: cfg.trustedFactories,
+		Contracts:        cfg.contracts,
+		Typed:            cfg.typedData,
+	}
+}
+
+// printBatchTable prints the results of a batch as a table, failing if any cheque could not be cashed
+func printBatchTable(ctx context.Context, results []*chequebook.BatchResult, cfg *options) error {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHEQUEBOOK\tBENEFICIARY\tCUMULATIVE\tTX\tSTATUS\tCASHED")
+	for _, result := range results {
+		tx := "-"
+		if (result.TxHash != common.Hash{}) {
+			tx = result.TxHash.Hex()
+		}
+
+		var status string
+		var revert *chequebook.RevertError
+		cashed := "-"
+		switch {
+		case errors.Is(result.Err, ErrDryRun):
+			status = "dry run"
+		case errors.As(result.Err, &revert):
+			status = "reverted"
+			if revert.Reason != "" {
+				status += ": " + revert.Reason
+			}
+			failed++
+		case result.Err != nil:
+			status = "error: " + result.Err.Error()
+			failed++
+		case result.Cashout.Bounced:
+			status = "bounced"
+			cashed = result.Cashout.TotalPayout.String()
+		default:
+			status = "ok"
+			cashed = result.Cashout.TotalPayout.String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\n", displayAddress(ctx, result.Cheque.Contract, cfg), displayAddress(ctx, result.Cheque.Beneficiary, cfg), result.Cheque.CumulativePayout, tx, status, cashed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cheques could not be cashed", failed, len(results))
+	}
+	return nil
+}
+
+// batchOutput is the json printed per cheque of a batch
+type batchOutput struct {
+	Cheque      *chequebook.SignedCheque `json:"cheque"`
+	TxHash      *common.Hash             `json:"txHash,omitempty"`
+	Status      uint64                   `json:"status"`
+	TotalPayout string                   `json:"totalPayout,omitempty"`
+	Bounced     bool                     `json:"bounced"`
+	DryRun      bool                     `json:"dryRun,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// printBatch prints the results of a batch as a json array, failing like the table if any cheque could not be cashed
+func printBatch(results []*chequebook.BatchResult) error {
+	failed := 0
+	out := make([]batchOutput, 0, len(results))
+	for _, result := range results {
+		item := batchOutput{Cheque: result.Cheque, Status: result.Status}
+		if (result.TxHash != common.Hash{}) {
+			hash := result.TxHash
+			item.TxHash = &hash
+		}
+		switch {
+		case errors.Is(result.Err, ErrDryRun):
+			item.DryRun = true
+		case result.Err != nil:
+			item.Error = result.Err.Error()
+			failed++
+		default:
+			item.TotalPayout = result.Cashout.TotalPayout.String()
+			item.Bounced = result.Cashout.Bounced
+		}
+		out = append(out, item)
+	}
+	if err := printJSON(out); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cheques could not be cashed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runBench issues and cashes -cheques cheques to -beneficiaries generated accounts and prints the measured latencies and throughput
+func runBench(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook the cheques are drawn on, defaults to the active one of -registry")
+	cheques := fs.Int("cheques", 100, "`number` of cheques issued and cashed")
+	beneficiaries := fs.Int("beneficiaries", 4, "`number` of generated beneficiaries cashing in parallel")
+	amount := fs.String("amount", "1", "`amount` of every cheque in base units, or in tokens when followed by the token's symbol")
+	funding := fs.String("funding", "0.1 ETH", "`amount` of wei, or ether followed by ETH, sent to every beneficiary for the gas of its cashouts")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	value, err := parseTokenAmount(ctx, book, "amount", *amount)
+	if err != nil {
+		return err
+	}
+	fundingValue, err := chequebook.EtherDenomination.Parse(*funding)
+	if err != nil {
+		return fmt.Errorf("invalid -funding: %w", err)
+	}
+
+	logger.Warn("the bench pays out real cheques to throwaway accounts, only run it against a development chain", "chequebook", contractAddress)
+	report, err := book.Bench(ctx, chequebook.BenchOptions{
+		Cheques:       *cheques,
+		Beneficiaries: *beneficiaries,
+		Amount:        value,
+		Funding:       fundingValue,
+		Typed:         typedCheques(book, cfg),
+	})
+	if err != nil && report == nil {
+		return err
+	}
+	if report.FirstErr != nil {
+		logger.Warn("cheques failed during the bench", "failed", report.Failed, "first", report.FirstErr)
+	}
+
+	if cfg.jsonOutput {
+		if printErr := printJSON(benchOutput(report)); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+	fmt.Printf("issued %d, cashed %d, failed %d in %s, %.2f cashouts/s, %d gas\n\n", report.Issued, report.Cashed, report.Failed, report.Duration.Round(time.Millisecond), report.TxPerSecond, report.GasUsed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LATENCY\tCOUNT\tMEAN\tMEDIAN\tP95\tMAX")
+	for _, row := range []struct {
+		name  string
+		stats chequebook.LatencyStats
+	}{
+		{"signer", report.Signing},
+		{"issue", report.Issuing},
+		{"cashout", report.Cashing},
+		{"end to end", report.EndToEnd},
+	} {
+		s := row.stats
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", row.name, s.Count, s.Mean.Round(time.Microsecond), s.Median.Round(time.Microsecond), s.P95.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	}
+	if flushErr := w.Flush(); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+// latencyOutput is the json form of chequebook.LatencyStats with the durations in milliseconds
+type latencyOutput struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"meanMs"`
+	Median float64 `json:"medianMs"`
+	P95    float64 `json:"p95Ms"`
+	Max    float64 `json:"maxMs"`
+}
+
+func newLatencyOutput(s chequebook.LatencyStats) latencyOutput {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return latencyOutput{Count: s.Count, Mean: ms(s.Mean), Median: ms(s.Median), P95: ms(s.P95), Max: ms(s.Max)}
+}
+
+// benchOutput is the json form of a chequebook.BenchReport
+func benchOutput(report *chequebook.BenchReport) interface{} {
+	firstErr := ""
+	if report.FirstErr != nil {
+		firstErr = report.FirstErr.Error()
+	}
+	return struct {
+		Issued      int           `json:"issued"`
+		Cashed      int           `json:"cashed"`
+		Failed      int           `json:"failed"`
+		FirstErr    string        `json:"firstError,omitempty"`
+		Duration    float64       `json:"durationMs"`
+		TxPerSecond float64       `json:"txPerSecond"`
+		GasUsed     uint64        `json:"gasUsed"`
+		Signing     latencyOutput `json:"signing"`
+		Issuing     latencyOutput `json:"issuing"`
+		Cashing     latencyOutput `json:"cashing"`
+		EndToEnd    latencyOutput `json:"endToEnd"`
+	}{
+		Issued:      report.Issued,
+		Cashed:      report.Cashed,
+		Failed:      report.Failed,
+		FirstErr:    firstErr,
+		Duration:    float64(report.Duration) / float64(time.Millisecond),
+		TxPerSecond: report.TxPerSecond,
+		GasUsed:     report.GasUsed,
+		Signing:     newLatencyOutput(report.Signing),
+		Issuing:     newLatencyOutput(report.Issuing),
+		Cashing:     newLatencyOutput(report.Cashing),
+		EndToEnd:    newLatencyOutput(report.EndToEnd),
+	}
+}
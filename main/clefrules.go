@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runClefRules writes a clef rules.js approving cheques of known chequebooks up to an amount cap and optionally attests it
+func runClefRules(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contracts := fs.String("chequebook", "", "comma separated `addresses` of the chequebooks whose cheques are approved, defaults to those of -registry on the backend's chain")
+	maxIncrement := fs.String("max-cheque", "", "most a cheque may raise its beneficiary's cumulative payout, in base units, larger cheques are left to manual approval")
+	storeDir := fs.String("store", "", "`dir`ectory of the issuer's cheque store, its cheques are where the cap of every beneficiary starts")
+	approveTxs := fs.Bool("approve-txs", true, "also approve transactions to the chequebooks which send no ether, such as cashouts and withdrawals")
+	out := fs.String("out", "rules.js", "`file` the rules are written to, - prints them")
+	attest := fs.Bool("attest", false, "attest the written rules with clef, which asks for its master password")
+	configDir := fs.String("clef-configdir", "./config", "clef's config `dir`ectory the attestation is stored in")
+	clefBinary := fs.String("clef-binary", "clef", "clef `executable` run for -attest")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *maxIncrement == "" {
+		return fmt.Errorf("%s requires -max-cheque", cfg.command)
+	}
+	increment, ok := new(big.Int).SetString(*maxIncrement, 10)
+	if !ok {
+		return fmt.Errorf("invalid -max-cheque %q", *maxIncrement)
+	}
+	if *attest && *out == "-" {
+		return errors.New("-attest needs the rules written to a file with -out")
+	}
+
+	chainID := cfg.chainID
+	if chainID == nil {
+		var err error
+		if chainID, err = backend.ChainID(ctx); err != nil {
+			return err
+		}
+	}
+	chequebooks, err := clefRulesChequebooks(logger, *contracts, chainID, cfg)
+	if err != nil {
+		return err
+	}
+
+	var issued []*chequebook.SignedCheque
+	if *storeDir != "" {
+		store, err := chequebook.OpenChequeStore(*storeDir)
+		if err != nil {
+			return err
+		}
+		issued, err = store.List()
+		store.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	rules, err := chequebook.GenerateClefRules(chequebook.ClefRulesOptions{
+		ChainID:      chainID,
+		Chequebooks:  chequebooks,
+		MaxIncrement: increment,
+		Issued:       issued,
+		ApproveTxs:   *approveTxs,
+	})
+	if err != nil {
+		return err
+	}
+	hash := chequebook.ClefRulesHash(rules)
+	if *out == "-" {
+		_, err := os.Stdout.Write(rules)
+		return err
+	}
+	if err := ioutil.WriteFile(*out, rules, 0644); err != nil {
+		return err
+	}
+	logger.Info("wrote clef rules", "file", *out, "chequebooks", len(chequebooks), "maxCheque", increment, "sha256", hash)
+
+	if !*attest {
+		fmt.Printf("clef --configdir %s attest %s\n", *configDir, hash)
+		return nil
+	}
+	// clef reads the master password from the terminal, so it gets ours
+	cmd := exec.CommandContext(ctx, *clefBinary, "--configdir", *configDir, "attest", hash)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("clef attest: %w", err)
+	}
+	logger.Info("attested clef rules", "sha256", hash)
+	return nil
+}
+
+// clefRulesChequebooks returns the chequebooks of -chequebook, or those registered for chainID in -registry
+func clefRulesChequebooks(logger log.Logger, value string, chainID *big.Int, cfg *options) ([]common.Address, error) {
+	var chequebooks []common.Address
+	if value != "" {
+		for _, field := range strings.Split(value, ",") {
+			address, err := requireAddress(logger, "chequebook", strings.TrimSpace(field), cfg)
+			if err != nil {
+				return nil, err
+			}
+			chequebooks = append(chequebooks, address)
+		}
+		return chequebooks, nil
+	}
+
+	registry, err := openRegistry(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("%s requires -chequebook or -registry", cfg.command)
+	}
+	for _, book := range registry.List() {
+		if book.ChainID == nil || book.ChainID.Cmp(chainID) == 0 {
+			chequebooks = append(chequebooks, book.Address)
+		}
+	}
+	if len(chequebooks) == 0 {
+		return nil, fmt.Errorf("registry %s has no chequebooks on chain %v", cfg.registryPath, chainID)
+	}
+	return chequebooks, nil
+}
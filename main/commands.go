@@ -0,0 +1,704 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+	"signing/chequebook"
+)
+
+// command is a subcommand working with existing contracts instead of running the whole setup and cashout flow
+type command struct {
+	usage       string
+	readOnly    bool // the command only reads from the chain and needs no signer
+	longRunning bool // the command runs until interrupted and then gets -shutdown-timeout to finish its work in flight
+	run         func(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error
+}
+
+var commands map[string]command
+
+func init() {
+	// assigned in init because the commands refer to the usage printed from the map
+	commands = map[string]command{
+		"deploy-factory":      {usage: "deploy a chequebook factory for an ERC20 token", run: runDeployFactory},
+		"deploy-chequebook":   {usage: "deploy a chequebook owned by the selected account through a factory unless it deployed one before", run: runDeployChequebook},
+		"issue-cheque":        {usage: "sign a cheque drawn on a chequebook of the selected account and print it as json", run: runIssueCheque},
+		"cash-cheque":         {usage: "cash a json signed cheque as its beneficiary, or for it with -beneficiary-sig", run: runCashCheque},
+		"estimate-cashout":    {usage: "estimate the gas cost and net payout of cashing a json signed cheque as its beneficiary", readOnly: true, run: runEstimateCashout},
+		"sign-cashout":        {usage: "sign the beneficiary's authorization for another account to cash a json signed cheque", run: runSignCashout},
+		"cash-all":            {usage: "cash the uncashed part of every stored received cheque, across chequebooks", run: runCashAll},
+		"auto-cashout":        {usage: "periodically cash the stored received cheques worth more than their gas cost", longRunning: true, run: runAutoCashout},
+		"deposit":             {usage: "transfer tokens of the owner to a chequebook", run: runDeposit},
+		"top-up":              {usage: "deposit from the issuer whenever the liquid balance of a chequebook falls below a low-water mark", longRunning: true, run: runTopUp},
+		"withdraw":            {usage: "withdraw tokens of the liquid balance of a chequebook to its owner", run: runWithdraw},
+		"serve":               {usage: "serve issueCheque, verifyCheque, cashCheque, chequebookStatus and listCheques over JSON-RPC and REST", readOnly: true, longRunning: true, run: runServe},
+		"export-cheque":       {usage: "encode a json signed cheque in the compact binary format, hex encoded unless -raw", readOnly: true, run: runExportCheque},
+		"import-cheque":       {usage: "decode and verify a cheque in the binary, hex or json format and print it as json", readOnly: true, run: runImportCheque},
+		"renew-cheques":       {usage: "list the issued cheques which expired unpaid and with -renew supersede them with fresh ones for the same payout", run: runRenewCheques},
+		"exchange-serve":      {usage: "issue cheques to beneficiaries requesting them over tcp", longRunning: true, run: runExchangeServe},
+		"exchange-request":    {usage: "request a cheque from an exchange-serve issuer, verify and store it", readOnly: true, run: runExchangeRequest},
+		"history":             {usage: "index and print the deployment, deposits, cashouts and withdrawals of a chequebook", readOnly: true, run: runHistory},
+		"watch":               {usage: "print the ChequeCashed and ChequeBounced events of chequebooks as json lines", readOnly: true, longRunning: true, run: runWatch},
+		"balance":             {usage: "print the balances of a chequebook", readOnly: true, run: runBalance},
+		"status":              {usage: "print issuer, token, balances and paid out amounts of a chequebook", readOnly: true, run: runBalance},
+		"chequebooks":         {usage: "list the chequebooks of -registry with their token, network and beneficiaries", readOnly: true, run: runListChequebooks},
+		"select-chequebook":   {usage: "select the chequebook of -registry used by commands without -chequebook", readOnly: true, run: runSelectChequebook},
+		"register-chequebook": {usage: "add a chequebook deployed elsewhere to -registry", readOnly: true, run: runRegisterChequebook},
+		"verify-hashing":      {usage: "check that the cheque hashing of this tool matches a chequebook's contract by simulating cashouts of test cheques", run: runVerifyHashing},
+		"dashboard":           {usage: "show a chequebook's balances, cheques, pending transactions and cashouts live and issue, cash or withdraw from the keyboard", run: runDashboard},
+		"bench":               {usage: "issue and cash many cheques to generated beneficiaries on a development chain, measuring signer latency and cashout throughput", run: runBench},
+		"audit":               {usage: "verify the hash chain of -audit-log or another audit log file: audit verify [-file path]", readOnly: true, run: runAudit},
+		"clef-rules":          {usage: "write a clef rules.js approving cheques of known chequebooks up to an amount cap, and optionally attest it", readOnly: true, run: runClefRules},
+	}
+}
+
+// usage prints the global flags and the available commands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [flags] [command [command flags]]\n\nwithout a command the whole setup and cashout flow is run\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-20s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(out, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// parseCommandFlags parses the arguments of the current command into fs
+func parseCommandFlags(fs *flag.FlagSet, cfg *options) error {
+	if err := fs.Parse(cfg.commandArgs); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	return nil
+}
+
+// requireAddress parses the value of the address flag name of a command, which must be set, and logs checksum warnings
+func requireAddress(logger log.Logger, name string, value string, cfg *options) (common.Address, error) {
+	if value == "" {
+		return common.Address{}, fmt.Errorf("%s requires -%s", cfg.command, name)
+	}
+
+	warnings := len(cfg.warnings)
+	address, err := parseAddress(name, value, cfg)
+	for _, warning := range cfg.warnings[warnings:] {
+		logger.Warn(warning)
+	}
+	return address, err
+}
+
+func runDeployFactory(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	token := fs.String("token", "", "`address` of the ERC20 token held by the factory's chequebooks")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	tokenAddress, err := requireAddress(logger, "token", *token, cfg)
+	if err != nil {
+		return err
+	}
+
+	_, opts, _, err := newTransactor(ctx, logger, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.contracts != nil && cfg.contracts.NativeToken() {
+		return fmt.Errorf("%s deploys the ERC20 factory of the v0.2.3 contracts, ether chequebooks need an existing factory", cfg.command)
+	}
+
+	state := &chequebook.DeploymentState{Token: tokenAddress}
+	if _, err := chequebook.SetupFactory(ctx, logger, backend, opts, state, cfg.waitTimeout, cfg.confirmations); err != nil {
+		return err
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Factory   common.Address `json:"factory"`
+			FactoryTx common.Hash    `json:"factoryTx"`
+			Token     common.Address `json:"token"`
+		}{state.Factory, state.FactoryTx, state.Token})
+	}
+	fmt.Println(state.Factory.Hex())
+	return nil
+}
+
+func runDeployChequebook(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	factory := fs.String("factory", "", "`address` of the factory deploying the chequebook")
+	fromBlock := fs.Uint64("from-block", 0, "first `block` searched for a chequebook the factory already deployed for the account")
+	deployNew := fs.Bool("new", false, "deploy a new chequebook even if the factory already deployed one for the account")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	factoryAddress, err := requireAddress(logger, "factory", *factory, cfg)
+	if err != nil {
+		return err
+	}
+
+	_, opts, _, err := newTransactor(ctx, logger, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+
+	instance, err := simpleswapfactory.NewSimpleSwapFactory(factoryAddress, backend)
+	if err != nil {
+		return err
+	}
+
+	state := &chequebook.DeploymentState{Factory: factoryAddress}
+	if !*deployNew {
+		found, err := chequebook.DiscoverChequebook(ctx, backend, factoryAddress, opts.From, *fromBlock)
+		switch {
+		case err == nil:
+			logger.Info("reusing chequebook the factory deployed before", "address", found)
+			state.Chequebook = found
+		case !errors.Is(err, chequebook.ErrChequebookNotFound):
+			return err
+		}
+	}
+	var book *chequebook.Chequebook
+	if (state.Chequebook == common.Address{}) && cfg.contracts != nil && cfg.contracts != chequebook.ContractsV023 {
+		book, err = deployVersion(ctx, logger, backend, wallet, opts, state, cfg)
+	} else {
+		book, err = chequebook.SetupChequebook(ctx, logger, backend, wallet, opts, instance, state, cfg.waitTimeout, cfg.confirmations)
+	}
+	if err != nil {
+		return err
+	}
+	if err := registerChequebook(ctx, backend, cfg, book, factoryAddress); err != nil {
+		return err
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Chequebook   common.Address `json:"chequebook"`
+			ChequebookTx common.Hash    `json:"chequebookTx"`
+			Factory      common.Address `json:"factory"`
+			Issuer       common.Address `json:"issuer"`
+		}{book.Address(), state.ChequebookTx, state.Factory, opts.From})
+	}
+	fmt.Println(book.Address().Hex())
+	return nil
+}
+
+func runIssueCheque(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook the cheque is drawn on, defaults to the active one of -registry")
+	beneficiary := fs.String("beneficiary", "", "`address` of the cheque's beneficiary")
+	payout := fs.String("payout", "", "cumulative payout `amount` of the cheque in base units, or in tokens followed by the token's symbol")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+	beneficiaryAddress, err := requireAddress(logger, "beneficiary", *beneficiary, cfg)
+	if err != nil {
+		return err
+	}
+
+	account, _, chainID, err := newTransactor(ctx, logger, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+
+	// a cheque not signed by the owner would only be rejected by the beneficiary later
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	cumulativePayout, err := parseTokenAmount(ctx, book, "payout", *payout)
+	if err != nil {
+		return err
+	}
+	issuer, err := book.Issuer(ctx)
+	if err != nil {
+		return err
+	}
+	if issuer != account.Address {
+		return fmt.Errorf("chequebook %s is owned by %s, not by %s", contractAddress.Hex(), issuer.Hex(), account.Address.Hex())
+	}
+
+	signed, err := chequebook.Issue(wallet, account, &chequebook.ChequeParams{
+		Contract:         contractAddress,
+		Beneficiary:      beneficiaryAddress,
+		CumulativePayout: cumulativePayout,
+	}, chainID, typedCheques(book, cfg))
+	if err != nil {
+		return err
+	}
+	signed.SetValidity(time.Now(), cfg.chequeTTL)
+	if err := registerChequebook(ctx, backend, cfg, book, common.Address{}, beneficiaryAddress); err != nil {
+		return err
+	}
+
+	return printJSON(signed)
+}
+
+func runCashCheque(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	chequeFile := fs.String("cheque", "-", "`file` containing the json signed cheque (- for stdin)")
+	beneficiarySig := fs.String("beneficiary-sig", "", "hex `signature` from sign-cashout, cashes the cheque for its beneficiary from the selected account")
+	callerPayout := fs.String("caller-payout", "0", "`amount` the beneficiary signed to pay the selected account for cashing")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+
+	signed, err := readSignedCheque(*chequeFile)
+	if err != nil {
+		return err
+	}
+
+	book, err := openChequebook(ctx, signed.Contract, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	if signed.ChainID != nil {
+		book.ChainID = signed.ChainID
+	}
+
+	recipient := cfg.recipient
+	if (recipient == common.Address{}) {
+		recipient = signed.Beneficiary
+	}
+
+	var result *chequebook.CashResult
+	if *beneficiarySig == "" {
+		result, err = book.CashCheque(ctx, &signed.ChequeParams, recipient, signed.Signature)
+	} else {
+		var sig []byte
+		sig, err = hexutil.Decode(*beneficiarySig)
+		if err != nil {
+			return fmt.Errorf("invalid -beneficiary-sig: %v", err)
+		}
+		var payout *big.Int
+		if payout, err = parseTokenAmount(ctx, book, "caller-payout", *callerPayout); err != nil {
+			return err
+		}
+
+		var caller accounts.Account
+		caller, err = selectAccount(wallet, cfg)
+		if err != nil {
+			return err
+		}
+		result, err = book.CashChequeFor(ctx, caller.Address, &signed.ChequeParams, recipient, sig, payout, signed.Signature)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("cashout mined", "chequebook", book.Address(), "beneficiary", signed.Beneficiary, "tx", result.TxHash, "status", result.Receipt.Status, "gasUsed", result.GasUsed)
+	if cfg.jsonOutput {
+		// a reverted cashout is printed with its receipt and still fails the command
+		if err := printJSON(newCashoutOutput(book, signed.Beneficiary, result)); err != nil {
+			return err
+		}
+		if result.Revert != nil {
+			return result.Revert
+		}
+		return nil
+	}
+	if result.Revert != nil {
+		return result.Revert
+	}
+
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("tx:            %s\n", result.TxHash.Hex())
+	fmt.Printf("recipient:     %s\n", result.Cashout.Recipient.Hex())
+	fmt.Printf("total payout:  %s\n", formatAmount(denomination, result.Cashout.TotalPayout))
+	fmt.Printf("caller payout: %s\n", formatAmount(denomination, result.Cashout.CallerPayout))
+	fmt.Printf("bounced:       %v\n", result.Cashout.Bounced)
+	return nil
+}
+
+func runSignCashout(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	chequeFile := fs.String("cheque", "-", "`file` containing the json signed cheque (- for stdin)")
+	caller := fs.String("caller", "", "`address` of the account allowed to send the cashout")
+	callerPayout := fs.String("caller-payout", "0", "`amount` of the cheque paid to the caller for cashing")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	callerAddress, err := requireAddress(logger, "caller", *caller, cfg)
+	if err != nil {
+		return err
+	}
+	payout, ok := new(big.Int).SetString(*callerPayout, 10)
+	if !ok || payout.Sign() < 0 {
+		return fmt.Errorf("invalid -caller-payout %q", *callerPayout)
+	}
+
+	signed, err := readSignedCheque(*chequeFile)
+	if err != nil {
+		return err
+	}
+	if payout.Cmp(signed.CumulativePayout) > 0 {
+		return fmt.Errorf("caller payout %v exceeds the cumulative payout %v", payout, signed.CumulativePayout)
+	}
+
+	recipient := cfg.recipient
+	if (recipient == common.Address{}) {
+		recipient = signed.Beneficiary
+	}
+
+	// only the beneficiary can authorize cashing its cheque
+	account, err := chequebook.SelectAccount(wallet, signed.Beneficiary)
+	if err != nil {
+		return err
+	}
+	// the caller cannot change where the payout goes, the consent is given once here
+	if recipient != signed.Beneficiary && cfg.recipientConsent != nil {
+		if err := cfg.recipientConsent(ctx, &signed.ChequeParams, recipient); err != nil {
+			return err
+		}
+	}
+	sig, err := chequebook.SignCashout(wallet, account, &signed.ChequeParams, callerAddress, recipient, payout)
+	if err != nil {
+		return err
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Signature hexutil.Bytes  `json:"signature"`
+			Caller    common.Address `json:"caller"`
+			Recipient common.Address `json:"recipient"`
+			Payout    string         `json:"callerPayout"`
+		}{sig, callerAddress, recipient, payout.String()})
+	}
+	fmt.Println(hexutil.Encode(sig))
+	return nil
+}
+
+func runExportCheque(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	chequeFile := fs.String("cheque", "-", "`file` containing the json signed cheque (- for stdin)")
+	raw := fs.Bool("raw", false, "write the binary encoding itself instead of its hex form")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+
+	signed, err := readSignedCheque(*chequeFile)
+	if err != nil {
+		return err
+	}
+	data, err := signed.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if *raw {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Cheque hexutil.Bytes `json:"cheque"`
+		}{data})
+	}
+	fmt.Println(hexutil.Encode(data))
+	return nil
+}
+
+func runImportCheque(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	in := fs.String("in", "-", "`file` containing the cheque as binary, hex or json (- for stdin)")
+	verify := fs.Bool("verify", true, "check the cheque is signed by the owner of its chequebook and grade how well its liquid balance covers the cheque")
+	storeDir := fs.String("store", "", "`dir`ectory of a cheque database to keep the imported cheque in")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	signed, err := decodeCheque(data)
+	if err != nil {
+		return err
+	}
+
+	if *verify {
+		book, err := openChequebook(ctx, signed.Contract, backend, wallet, cfg)
+		if err != nil {
+			return err
+		}
+		typed := typedCheques(book, cfg)
+		var chainID *big.Int
+		if typed {
+			if chainID, err = backend.ChainID(ctx); err != nil {
+				return err
+			}
+		}
+		accepted, err := book.AcceptCheque(ctx, signed, chainID, typed)
+		if err != nil {
+			return err
+		}
+		logger.Info("cheque verified", "chequebook", signed.Contract, "beneficiary", signed.Beneficiary, "coverage", accepted.Grade, "uncashed", accepted.Coverage.Owed, "payable", accepted.Coverage.Payable)
+		if accepted.Grade != chequebook.FullyCovered {
+			logger.Warn("the chequebook cannot pay all of the cheque now", "shortfall", accepted.Coverage.Shortfall())
+		}
+	}
+
+	if *storeDir != "" {
+		store, err := chequebook.OpenChequeStore(*storeDir)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if err := store.Put(signed); err != nil {
+			return err
+		}
+	}
+
+	return printJSON(signed)
+}
+
+// decodeCheque decodes a signed cheque in the json format, the binary format or its hex form
+func decodeCheque(data []byte) (*chequebook.SignedCheque, error) {
+	signed := new(chequebook.SignedCheque)
+	text := strings.TrimSpace(string(data))
+	switch {
+	case strings.HasPrefix(text, "{"):
+		if err := json.Unmarshal([]byte(text), signed); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(text, "0x"):
+		binary, err := hexutil.Decode(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex cheque: %v", err)
+		}
+		if err := signed.UnmarshalBinary(binary); err != nil {
+			return nil, err
+		}
+	default:
+		if err := signed.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return signed, nil
+}
+
+// parseFundingFlags parses the -chequebook and -amount flags of the deposit and withdraw commands
+// define adds the flags only one of the commands has, it may be nil
+func parseFundingFlags(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options, verb string, define func(fs *flag.FlagSet)) (*chequebook.Chequebook, *big.Int, error) {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook, defaults to the active one of -registry")
+	amount := fs.String("amount", "", "`amount` to "+verb+" in base units, or in tokens when followed by the token's symbol like \"1.5 BZZ\"")
+	if define != nil {
+		define(fs)
+	}
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return nil, nil, err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	configureChequebook(book, cfg)
+	value, err := parseTokenAmount(ctx, book, "amount", *amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("invalid -amount %q", *amount)
+	}
+	return book, value, nil
+}
+
+// parseTokenAmount parses the amount given to the flag name in base units, or followed by the symbol of book's token in whole tokens
+func parseTokenAmount(ctx context.Context, book *chequebook.Chequebook, name string, value string) (*big.Int, error) {
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := denomination.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return amount, nil
+}
+
+func runDeposit(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	var permit *bool
+	var relayer *string
+	var validity *time.Duration
+	book, value, err := parseFundingFlags(ctx, logger, backend, wallet, cfg, "deposit", func(fs *flag.FlagSet) {
+		permit = fs.Bool("permit", false, "let the owner sign an EIP-2612 permit which -relayer submits before pulling the tokens in, instead of a transfer by the owner")
+		relayer = fs.String("relayer", "", "`address` of the wallet account sending and paying the transactions of -permit, defaults to the owner")
+		validity = fs.Duration("permit-validity", time.Hour, "`duration` after which the token rejects the permit")
+	})
+	if err != nil {
+		return err
+	}
+
+	var receipt *types.Receipt
+	if *permit {
+		var sender common.Address
+		if *relayer != "" {
+			if sender, err = requireAddress(logger, "relayer", *relayer, cfg); err != nil {
+				return err
+			}
+		} else if sender, err = book.Issuer(ctx); err != nil {
+			return err
+		}
+		logger.Info("depositing with a permit", "chequebook", book.Address(), "relayer", sender, "validity", *validity)
+		receipt, err = book.DepositWithPermit(ctx, value, sender, time.Now().Add(*validity))
+	} else {
+		receipt, err = book.Deposit(ctx, value)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("deposit mined", "chequebook", book.Address(), "tx", receipt.TxHash, "status", receipt.Status, "gasUsed", receipt.GasUsed)
+	if cfg.jsonOutput {
+		return printFunding(ctx, book, receipt, value)
+	}
+	return logBalances(ctx, logger, book, "after deposit")
+}
+
+func runWithdraw(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	book, value, err := parseFundingFlags(ctx, logger, backend, wallet, cfg, "withdraw", nil)
+	if err != nil {
+		return err
+	}
+
+	receipt, err := book.Withdraw(ctx, value)
+	if err != nil {
+		return err
+	}
+	logger.Info("withdrawal mined", "chequebook", book.Address(), "tx", receipt.TxHash, "status", receipt.Status, "gasUsed", receipt.GasUsed)
+	if cfg.jsonOutput {
+		return printFunding(ctx, book, receipt, value)
+	}
+	return logBalances(ctx, logger, book, "after withdrawal")
+}
+
+func runBalance(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook, defaults to the active one of -registry")
+	beneficiary := fs.String("beneficiary", "", "`address` of a beneficiary whose paid out amount is printed as well")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+
+	var beneficiaryAddress common.Address
+	if *beneficiary != "" {
+		beneficiaryAddress, err = requireAddress(logger, "beneficiary", *beneficiary, cfg)
+		if err != nil {
+			return err
+		}
+	}
+	return runStatus(ctx, backend, contractAddress, beneficiaryAddress, cfg)
+}
+
+// runVerifyHashing signs chequebook.DefaultHashVectors with the chequebook's issuer and prints whether the contract accepts each signature
+// the cheques pay beneficiaries without known keys and are only simulated, nothing is sent
+func runVerifyHashing(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of a chequebook issued by the selected account, defaults to the active one of -registry")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+
+	checks, checkErr := book.CrossCheckHashing(ctx, chequebook.DefaultHashVectors)
+	if checks == nil {
+		return checkErr
+	}
+	if cfg.jsonOutput {
+		out := make([]hashCheckOutput, 0, len(checks))
+		for _, check := range checks {
+			out = append(out, hashCheckOutput{
+				Beneficiary:      check.Cheque.Beneficiary,
+				CumulativePayout: check.Cheque.CumulativePayout.String(),
+				Hash:             check.Hash,
+				Accepted:         check.Accepted,
+				Reason:           check.Reason,
+			})
+		}
+		if err := printJSON(out); err != nil {
+			return err
+		}
+		return checkErr
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BENEFICIARY\tCUMULATIVE\tHASH\tCONTRACT")
+	for _, check := range checks {
+		result := "accepted"
+		if !check.Accepted {
+			result = "reverted: " + check.Reason
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", check.Cheque.Beneficiary.Hex(), check.Cheque.CumulativePayout, check.Hash.Hex(), result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return checkErr
+}
+
+// hashCheckOutput is the json printed per test cheque by verify-hashing
+type hashCheckOutput struct {
+	Beneficiary      common.Address `json:"beneficiary"`
+	CumulativePayout string         `json:"cumulativePayout"`
+	Hash             common.Hash    `json:"hash"`
+	Accepted         bool           `json:"accepted"`
+	Reason           string         `json:"reason,omitempty"`
+}
+
+// readSignedCheque reads a single json signed cheque from the file at path, or from stdin if path is "-"
+func readSignedCheque(path string) (*chequebook.SignedCheque, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed *chequebook.SignedCheque
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, err
+	}
+	if signed == nil {
+		return nil, errors.New("cheque is null")
+	}
+	return signed, nil
+}
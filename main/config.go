@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+const (
+	defaultBackendURL = "http://localhost:8545"
+	defaultClefIPC    = "./config/clef.ipc"
+)
+
+// options holds the settings configurable from the command line
+type options struct {
+	backendURL       string                      // url of the ethereum node, or comma separated urls of nodes of the same chain to fail over between
+	rateLimit        float64                     // rpc requests per second over all nodes, 0 does not limit them
+	rateBurst        int                         // rpc requests sent at once before rateLimit applies
+	rpcRetries       int                         // rounds over all nodes for a request failing with a transient error
+	clefIPC          string                      // path to the clef ipc socket or url of its http rpc
+	clefHeader       http.Header                 // extra headers sent with every request to an http clef
+	clefUser         string                      // basic auth user of an http clef, empty sends no credentials
+	clefPassword     string                      // basic auth password of an http clef
+	clefCA           string                      // certificate authorities trusted for an https clef, empty uses the system roots
+	clefCert         string                      // client certificate presented to an https clef
+	clefKey          string                      // key of clefCert
+	maxGasCostUSD    *big.Float                  // maximum gas cost of the cashout in USD, nil disables the check
+	usdOracle        chequebook.USDOracle        // oracle used to convert gas into USD
+	rpcHeader        http.Header                 // extra headers sent with every rpc request
+	statePath        string                      // file recording the deployments of every chain, empty disables resuming
+	registryPath     string                      // file of the chequebook registry, empty disables it
+	contracts        chequebook.ContractVersion  // release of the swap contracts, nil detects it per chequebook
+	nonceJournal     string                      // file recording sent transactions so nonces survive restarts, empty keeps them in memory
+	auditLog         string                      // hash-chained log of every signing request, broadcast and cashout, empty keeps none
+	audit            *chequebook.AuditLog        // the opened auditLog, nil until the wallet is set up or without one
+	notifier         *chequebook.Notifier        // posts cheque and transaction events to the webhooks, nil without any
+	chequeTTL        time.Duration               // validity window of the cheques an Issuer signs, 0 never expires them
+	verifyPayout     bool                        // check the recipient's token balance changed by the expected payout
+	minPayout        *big.Int                    // refuse to cash if the simulated payout is below this, nil disables the check
+	minCashout       *big.Int                    // refuse to cash a cheque paying less than this on top of what was already paid out
+	readOnly         bool                        // run without a signer, only read operations are possible
+	simulated        bool                        // run against an in-memory chain with a generated funded account instead of a node and signer
+	account          common.Address              // wallet account to use, zero selects the only account
+	accountIndex     int                         // position of the wallet account to use instead of account, -1 if not given
+	status           common.Address              // chequebook to only print the status of, zero runs the setup
+	startPayout      *big.Int                    // cumulative payout of the first issued cheque
+	increment        *big.Int                    // amount every further cheque pays on top of the previous one
+	chequeCount      int                         // number of incrementing cheques to issue, only the last one is cashed
+	issueOnly        bool                        // only issue and print the cheques without cashing
+	dryRun           bool                        // log transactions instead of sending them
+	metricsAddr      string                      // address serving prometheus metrics on /metrics, empty disables them
+	metrics          *chequebook.Metrics         // metrics recorded by the run, nil unless metricsAddr is set
+	stats            bool                        // record the duration and gas of each step of the run
+	logLevel         log.Lvl                     // most verbose level which is logged
+	logJSON          bool                        // log json records instead of human readable lines
+	jsonOutput       bool                        // print the results of the run or command as json on stdout
+	batchFile        string                      // file with signed cheques to cash instead of running the setup, "-" reads stdin
+	recipient        common.Address              // recipient of cashouts, zero pays each cheque's beneficiary
+	recipientConsent chequebook.RecipientConsent // asked before cashing to a recipient other than the beneficiary, nil pays any recipient
+	command          string                      // subcommand to run instead of the setup and cashout flow, empty runs the flow
+	commandArgs      []string                    // arguments following the subcommand, parsed by the subcommand itself
+	warnings         []string                    // problems with the flags which are logged once logging is set up
+	deposit          *big.Int                    // amount the owner transfers to the chequebook before cashing, nil skips the deposit
+	withdraw         *big.Int                    // amount the owner withdraws from the chequebook after cashing, nil skips the withdrawal
+	signer           string                      // kind of wallet to sign with, empty picks it from the key and keystore settings
+	privateKey       string                      // hex encoded private key to sign with instead of clef
+	keystoreDir      string                      // keystore directory to sign with instead of clef
+	keystorePassword string                      // password of the keys in keystoreDir
+	hdPath           string                      // derivation path of the hardware wallet account
+	kmsKey           string                      // id, arn or alias of the AWS KMS key of -signer kms
+	kmsRegion        string                      // aws region of the KMS key
+	kmsEndpoint      string                      // url of the KMS api, empty uses the regional endpoint
+	typedData        bool                        // sign cheques as EIP-712 typed data instead of the personal-sign format
+	gasBufferPercent uint64                      // safety margin added on top of gas estimates in percent
+	gasPrice         *big.Int                    // gas price of cashouts in wei, nil asks gasPricer
+	gasPricer        chequebook.GasPricer        // strategy of -gas-pricing, nil uses the node's suggestion
+	maxFee           *big.Int                    // gas price in wei above which a cashout is not sent, nil leaves it unlimited
+	gasCap           uint64                      // maximum gas limit of cashouts, 0 disables the cap
+	bumpTimeout      time.Duration               // pending time after which a cashout is resent with a higher gas price, 0 never resends
+	maxGasPrice      *big.Int                    // gas price resent cashouts never exceed, nil leaves it unlimited
+	nonce            *uint64                     // nonce of the cashout, nil uses the pending nonce
+	chainID          *big.Int                    // expected chain id, nil accepts whatever the backend reports
+	token            common.Address              // existing ERC20 token to use, zero deploys and mints a new one
+	networks         chequebook.NetworkRegistry  // canonical factories per chain which are used instead of deploying one
+	network          string                      // name of the -network profile, empty without one
+	multicall        common.Address              // Multicall3 contract aggregating state reads, zero uses the network's
+	deployFactory    bool                        // deploy a new factory even if the chain has a canonical one
+	trustedFactories []common.Address            // factories received and cashed cheques have to be drawn on chequebooks of, empty trusts any
+	waitTimeout      time.Duration               // maximum time to wait for a single transaction to be mined
+	confirmations    uint64                      // blocks deployments, cashouts and other token movements have to be buried under
+	beneficiary      common.Address              // beneficiary of the demo cheque, zero uses the owner's own account
+	retryAttempts    int                         // attempts for rpc calls failing with a transient error
+	shutdownTimeout  time.Duration               // time long-running commands get to finish their work in flight after an interrupt
+	stop             <-chan struct{}             // closed on the first interrupt, long-running commands take no new work after it
+	ensRegistry      common.Address              // ENS registry resolving names given for addresses, zero uses chequebook.DefaultENSRegistry
+	ensReverse       bool                        // show the primary ENS names of addresses in human readable output
+	ens              *chequebook.ENSResolver     // resolver of ENS names, nil until the backend is connected
+	ensNames         []deferredENSName           // global address flags given as ENS names, resolved once the backend is connected
+}
+
+// parseFlags parses the command line flags into options
+func parseFlags() (*options, error) {
+	backendURL := flag.String("backend", "", "`url` of the ethereum node, several comma separated urls fail over to each other (default $SWAP_BACKEND_URL or "+defaultBackendURL+")")
+	rateLimit := flag.Float64("rate-limit", 0, "most rpc `requests` per second sent to the nodes together (0 does not limit them)")
+	rateBurst := flag.Int("rate-burst", 1, "`number` of rpc requests sent at once before -rate-limit applies")
+	rpcRetries := flag.Int("rpc-retries", 1, "`rounds` over all -backend nodes for a request failing with a transient error, retried with backoff")
+	clefIPC := flag.String("clef", "", "`path` to the clef ipc socket or http(s) url of its rpc (default $CLEF_IPC or "+defaultClefIPC+")")
+	var clefHeaders headerFlags
+	flag.Var(&clefHeaders, "clef-header", "extra `key:value` header sent with every request to an http clef (repeatable)")
+	clefAuth := flag.String("clef-auth", "", "`user:password` for basic auth against an http clef (default $CLEF_AUTH)")
+	clefCA := flag.String("clef-ca", "", "pem `file` of the certificate authorities trusted for an https clef")
+	clefCert := flag.String("clef-cert", "", "pem `file` of the client certificate presented to an https clef")
+	clefKey := flag.String("clef-key", "", "pem `file` of the key of -clef-cert")
+	maxGasCostUSD := flag.Float64("max-gas-cost-usd", 0, "abort the cashout if its gas cost exceeds this amount in USD (0 disables the check)")
+	usdPerGas := flag.Float64("usd-per-gas", 0, "fixed cost of one unit of gas in USD used for -max-gas-cost-usd")
+	var rpcHeaders headerFlags
+	flag.Var(&rpcHeaders, "rpc-header", "extra `key:value` header sent with every rpc request (repeatable)")
+	statePath := flag.String("state", "", "`file` recording the deployed contracts per chain so an interrupted setup resumes and reruns reuse them")
+	registryPath := flag.String("registry", "", "json `file` registering the deployed chequebooks, commands without -chequebook use its active one")
+	auditLog := flag.String("audit-log", "", "append-only `file` recording every signing request, broadcast transaction and cashout in a hash chain, checked with the audit verify command")
+	webhooks := flag.String("webhook", "", "comma separated `urls` receiving json events of issued, received, cashed and bounced cheques and failed transactions")
+	webhookSecret := flag.String("webhook-secret", "", "`secret` keying the HMAC-SHA256 signature of every webhook event (default $SWAP_WEBHOOK_SECRET)")
+	chequeTTL := flag.Duration("cheque-ttl", 0, "validity `duration` of issued cheques, after which their beneficiaries no longer cash them (0 never expires them)")
+	nonceJournal := flag.String("nonce-journal", "", "`file` recording sent transactions so a restarted run continues their nonces and resends those the node lost")
+	verifyPayout := flag.Bool("verify-payout", true, "verify the recipient's token balance increased by the expected payout after cashing")
+	minPayout := flag.String("min-payout", "", "refuse to cash the cheque if the simulated payout is below this `amount`")
+	minCashout := flag.String("min-cashout", "", "refuse to cash a cheque whose cumulative payout exceeds what was already paid out by less than this `amount`")
+	readOnly := flag.Bool("read-only", false, "do not connect to clef, only read operations are available")
+	simulated := flag.Bool("simulated", false, "run against an in-memory chain which mines every transaction right away, signing with a generated funded key instead of -backend and clef")
+	typedData := flag.Bool("typed-data", false, "sign cheques as EIP-712 typed data (requires a chequebook contract verifying typed data)")
+	contracts := flag.String("contracts", "auto", "`version` of the swap contracts, v0.2.3, bee or ether, auto detects it from the chequebook's code")
+	gasPrice := flag.String("gas-price", "", "gas price in `gwei` of the cashout instead of the node's suggestion")
+	gasPricing := flag.String("gas-pricing", "suggested", "`strategy` pricing cashouts without -gas-price: suggested, suggested:<percent>, fixed:<gwei>, fee-history:<percentile> or oracle:<url>[#field]")
+	maxFee := flag.String("max-fee", "", "gas price in `gwei` above which a cashout is not sent at all")
+	nonce := flag.String("nonce", "", "`nonce` of the cashout, reuse a pending nonce with a higher -gas-price to replace a stuck transaction")
+	bumpTimeout := flag.Duration("bump-after", 0, "resend a cashout still pending after this `duration` with a higher gas price (0 never resends)")
+	maxGasPrice := flag.String("max-gas-price", "", "gas price in `gwei` a resent cashout never exceeds")
+	gasCap := flag.Uint64("gas-cap", 0, "maximum gas `limit` of a cashout, a larger estimate aborts it (0 disables the cap)")
+	gasBufferPercent := flag.Uint64("gas-buffer", chequebook.DefaultGasBufferPercent, "safety margin in `percent` added on top of the estimated gas limit")
+	chainID := flag.Uint64("chain-id", 0, "abort unless the backend reports this chain `id` (0 accepts any)")
+	networksFile := flag.String("networks", "", "json `file` mapping chain ids to network profiles {name, factory, token, multicall, rpc, gasPrice, maxGasPrice, gasBuffer, confirmations}")
+	network := flag.String("network", "", "`name` of the network profile in -networks to use (bundled: dev, sepolia, gnosis), which sets the chain id, endpoint, gas policy and confirmations not given otherwise")
+	trustedFactories := flag.String("trusted-factories", "", "comma separated `addresses` of the factories whose chequebooks' cheques are accepted and cashed (default any factory)")
+	multicall := flag.String("multicall", "", "`address` of a Multicall3 contract reading chequebook states in one call (default the network's from -networks)")
+	deployFactory := flag.Bool("deploy-factory", false, "deploy a new token and factory even if the chain has a canonical factory")
+	token := flag.String("token", "", "`address` of an existing ERC20 token to use instead of deploying and minting a new one, eth for chequebooks holding ether, erc20 is the default")
+	status := flag.String("status", "", "only print the status of the chequebook at `address` (-beneficiary adds its paid out amount)")
+	startPayout := flag.String("start-payout", "100", "cumulative payout `amount` of the first cheque")
+	increment := flag.String("increment", "100", "`amount` each further cheque adds to the cumulative payout")
+	chequeCount := flag.Int("cheques", 1, "`number` of incrementing cheques to issue, only the last one is cashed")
+	issueOnly := flag.Bool("issue-only", false, "only issue and print the cheques without cashing the last one")
+	metricsAddr := flag.String("metrics", "", "`address` to serve prometheus metrics on /metrics at, such as 127.0.0.1:6060")
+	stats := flag.Bool("stats", false, "record the duration and gas used of each step and log a summary at the end")
+	dryRun := flag.Bool("dry-run", false, "run up to the first transaction and log it with its decoded call instead of signing and sending it, simulating cashouts with eth_call first")
+	logLevel := flag.String("log-level", "info", "most verbose `level` to log (trace, debug, info, warn, error, crit)")
+	flag.StringVar(logLevel, "loglevel", "info", "deprecated alias of -log-level")
+	logJSON := flag.Bool("log-json", false, "log json records instead of human readable lines")
+	jsonOutput := flag.Bool("json", false, "print deployed addresses, transactions, cheques and balances as json on stdout, logs stay on stderr")
+	batchFile := flag.String("cash-batch", "", "cash the json array of signed cheques in `file` (- for stdin) instead of running the setup")
+	recipient := flag.String("recipient", "", "`address` receiving the cashout (defaults to the cheque's beneficiary)")
+	recipientPolicy := flag.String("recipient-policy", "", "json `file` of the third-party recipients cheques may be cashed to, others are refused unless -confirm-recipient approves them")
+	confirmRecipient := flag.Bool("confirm-recipient", false, "ask on the terminal before cashing a cheque to a recipient other than its beneficiary")
+	deposit := flag.String("deposit", "", "`amount` of tokens to transfer from the owner to the chequebook before cashing")
+	withdraw := flag.String("withdraw", "", "`amount` of tokens to withdraw from the chequebook to the owner after cashing")
+	account := flag.String("account", "", "`address` or index of the wallet account to use, asked for on the terminal if the wallet has several accounts (default $SWAP_ACCOUNT)")
+	signer := flag.String("signer", "", "`kind` of signer: "+signerNames()+" (default key with -key, keystore with -keystore, clef otherwise)")
+	privateKey := flag.String("key", "", "hex encoded private `key` to sign with instead of clef (default $SWAP_PRIVATE_KEY)")
+	keystoreDir := flag.String("keystore", "", "keystore `dir`ectory to sign with instead of clef")
+	kmsKey := flag.String("kms-key", "", "id, arn or alias of the ECC_SECG_P256K1 AWS KMS `key` used with -signer kms")
+	kmsRegion := flag.String("kms-region", "", "aws `region` of the KMS key (default $AWS_REGION)")
+	kmsEndpoint := flag.String("kms-endpoint", "", "`url` of the KMS api, for VPC endpoints or local KMS emulators (default the regional endpoint)")
+	hdPath := flag.String("hd-path", accounts.DefaultBaseDerivationPath.String(), "derivation `path` of the account used with -signer hardware")
+	passwordFile := flag.String("password-file", "", "`file` containing the password of the -keystore keys (default $KEYSTORE_PASSWORD)")
+	beneficiary := flag.String("beneficiary", "", "`address` of the demo cheque's beneficiary, must be a clef account to cash it (defaults to the owner)")
+	waitTimeout := flag.Duration("timeout", chequebook.DefaultWaitTimeout, "maximum `duration` to wait for a single transaction to be mined")
+	confirmations := flag.Uint64("confirmations", chequebook.DefaultConfirmations, "`number` of blocks a deployment, mint, cashout, deposit or withdrawal has to be buried under, counting its own block")
+	retryAttempts := flag.Int("retries", chequebook.DefaultRetryAttempts, "number of `attempts` for rpc calls failing with network or server errors")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "`duration` serve, exchange-serve, auto-cashout, top-up and watch get to finish their transactions in flight after an interrupt, a second interrupt stops them at once")
+	ensRegistry := flag.String("ens-registry", "", "`address` of the ENS registry resolving names given for addresses (default the registry of mainnet and the public testnets)")
+	ensReverse := flag.Bool("ens-reverse", false, "show the primary ENS name next to addresses in human readable output")
+	configFile := flag.String("config", "", "TOML `file` of flag = value settings, flags given on the command line take precedence (default $SWAP_CONFIG)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if path := stringOption(*configFile, "SWAP_CONFIG", ""); path != "" {
+		if err := applyConfigFile(flag.CommandLine, path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &options{
+		backendURL:       stringOption(*backendURL, "SWAP_BACKEND_URL", defaultBackendURL),
+		rateLimit:        *rateLimit,
+		rateBurst:        *rateBurst,
+		rpcRetries:       *rpcRetries,
+		clefIPC:          stringOption(*clefIPC, "CLEF_IPC", defaultClefIPC),
+		clefHeader:       clefHeaders.header,
+		clefCA:           *clefCA,
+		clefCert:         *clefCert,
+		clefKey:          *clefKey,
+		rpcHeader:        rpcHeaders.header,
+		statePath:        *statePath,
+		registryPath:     *registryPath,
+		nonceJournal:     *nonceJournal,
+		auditLog:         *auditLog,
+		chequeTTL:        *chequeTTL,
+		verifyPayout:     *verifyPayout,
+		readOnly:         *readOnly,
+		simulated:        *simulated,
+		signer:           *signer,
+		privateKey:       stringOption(*privateKey, "SWAP_PRIVATE_KEY", ""),
+		keystoreDir:      *keystoreDir,
+		hdPath:           *hdPath,
+		kmsKey:           *kmsKey,
+		kmsRegion:        stringOption(*kmsRegion, "AWS_REGION", ""),
+		kmsEndpoint:      *kmsEndpoint,
+		chequeCount:      *chequeCount,
+		issueOnly:        *issueOnly,
+		dryRun:           *dryRun,
+		metricsAddr:      *metricsAddr,
+		stats:            *stats,
+		logJSON:          *logJSON,
+		jsonOutput:       *jsonOutput,
+		batchFile:        *batchFile,
+		typedData:        *typedData,
+		networks:         chequebook.DefaultNetworks(),
+		deployFactory:    *deployFactory,
+		gasBufferPercent: *gasBufferPercent,
+		gasCap:           *gasCap,
+		bumpTimeout:      *bumpTimeout,
+		waitTimeout:      *waitTimeout,
+		confirmations:    *confirmations,
+		retryAttempts:    *retryAttempts,
+		shutdownTimeout:  *shutdownTimeout,
+		ensReverse:       *ensReverse,
+	}
+	if args := flag.Args(); len(args) > 0 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown command %q", args[0])
+		}
+		if cfg.batchFile != "" || *status != "" {
+			return nil, fmt.Errorf("command %s cannot be combined with -cash-batch or -status", args[0])
+		}
+		cfg.command = args[0]
+		cfg.commandArgs = args[1:]
+		if cmd.readOnly {
+			cfg.readOnly = true
+		}
+	}
+	if *token != "" && *token != "eth" && *token != "erc20" {
+		if err := addressOption("token", *token, cfg, &cfg.token); err != nil {
+			return nil, err
+		}
+	}
+	lvl, err := log.LvlFromString(*logLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q", *logLevel)
+	}
+	cfg.logLevel = lvl
+
+	if *status != "" {
+		if err := addressOption("status", *status, cfg, &cfg.status); err != nil {
+			return nil, err
+		}
+		// the status is read without signing anything
+		cfg.readOnly = true
+	}
+	if *recipient != "" {
+		if err := addressOption("recipient", *recipient, cfg, &cfg.recipient); err != nil {
+			return nil, err
+		}
+		// a name resolves to a nonzero address or fails
+		if (cfg.recipient == common.Address{}) && !chequebook.IsENSName(*recipient) {
+			return nil, errors.New("-recipient must not be the zero address")
+		}
+	}
+	if cfg.recipientConsent, err = recipientConsent(*recipientPolicy, *confirmRecipient); err != nil {
+		return nil, err
+	}
+	if cfg.notifier, err = newNotifier(*webhooks, stringOption(*webhookSecret, "SWAP_WEBHOOK_SECRET", "")); err != nil {
+		return nil, err
+	}
+	if auth := stringOption(*clefAuth, "CLEF_AUTH", ""); auth != "" {
+		parts := strings.SplitN(auth, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("-clef-auth must be user:password")
+		}
+		cfg.clefUser, cfg.clefPassword = parts[0], parts[1]
+	}
+
+	cfg.accountIndex = -1
+	if value := stringOption(*account, "SWAP_ACCOUNT", ""); value != "" {
+		// a short decimal number is an index into the signer's accounts, anything else has to be an address
+		if index, err := strconv.Atoi(value); err == nil && index >= 0 && len(value) < 2*common.AddressLength {
+			cfg.accountIndex = index
+		} else {
+			if err := addressOption("account", value, cfg, &cfg.account); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if *beneficiary != "" {
+		if err := addressOption("beneficiary", *beneficiary, cfg, &cfg.beneficiary); err != nil {
+			return nil, err
+		}
+	}
+	if *ensRegistry != "" {
+		address, err := parseAddress("ens-registry", *ensRegistry, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ensRegistry = address
+	}
+	if *gasPrice != "" {
+		price, err := chequebook.ParseGwei(*gasPrice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -gas-price: %v", err)
+		}
+		cfg.gasPrice = price
+	}
+	if *maxGasPrice != "" {
+		price, err := chequebook.ParseGwei(*maxGasPrice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -max-gas-price: %v", err)
+		}
+		cfg.maxGasPrice = price
+	}
+	if *contracts != "auto" {
+		version, err := chequebook.ContractVersionByName(*contracts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -contracts: %v", err)
+		}
+		cfg.contracts = version
+	}
+	// ether chequebooks are their own family of contracts, -token picks it or any of the ERC20 releases
+	switch native := cfg.contracts != nil && cfg.contracts.NativeToken(); {
+	case *token == "eth" && cfg.contracts == nil:
+		cfg.contracts = chequebook.ContractsEther
+	case *token == "eth" && !native:
+		return nil, fmt.Errorf("-token eth cannot be combined with -contracts %s", cfg.contracts.Name())
+	case *token != "" && *token != "eth" && native:
+		return nil, fmt.Errorf("-contracts %s chequebooks hold ether, they cannot be used with -token %s", cfg.contracts.Name(), *token)
+	}
+	if *networksFile != "" {
+		networks, err := chequebook.LoadNetworks(*networksFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.networks = networks
+	}
+	if *trustedFactories != "" {
+		factories := strings.Split(*trustedFactories, ",")
+		cfg.trustedFactories = make([]common.Address, len(factories))
+		for i, factory := range factories {
+			if err := addressOption("trusted-factories", strings.TrimSpace(factory), cfg, &cfg.trustedFactories[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if *multicall != "" {
+		address, err := parseAddress("multicall", *multicall, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.multicall = address
+	}
+	if *network != "" {
+		if err := applyNetwork(cfg, *network); err != nil {
+			return nil, err
+		}
+	}
+	// after -network, which may set the endpoint the fee history is read from
+	pricer, err := newGasPricer(*gasPricing, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -gas-pricing: %v", err)
+	}
+	cfg.gasPricer = pricer
+	if *maxFee != "" {
+		price, err := chequebook.ParseGwei(*maxFee)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -max-fee: %v", err)
+		}
+		cfg.maxFee = price
+	}
+	if *nonce != "" {
+		n, err := strconv.ParseUint(*nonce, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -nonce %q", *nonce)
+		}
+		if cfg.batchFile != "" {
+			return nil, errors.New("-nonce cannot be used with -cash-batch, which sends several transactions")
+		}
+		cfg.nonce = &n
+	}
+	if *chainID != 0 {
+		cfg.chainID = new(big.Int).SetUint64(*chainID)
+	}
+	if *confirmations < 1 {
+		return nil, errors.New("-confirmations must be at least 1")
+	}
+	if *chequeTTL < 0 {
+		return nil, fmt.Errorf("invalid -cheque-ttl %v", *chequeTTL)
+	}
+	if *shutdownTimeout < 0 {
+		return nil, fmt.Errorf("invalid -shutdown-timeout %v", *shutdownTimeout)
+	}
+	if *rateLimit < 0 {
+		return nil, fmt.Errorf("invalid -rate-limit %v", *rateLimit)
+	}
+	if *chequeCount < 1 {
+		return nil, fmt.Errorf("invalid -cheques %d, at least one cheque has to be issued", *chequeCount)
+	}
+	start, ok := new(big.Int).SetString(*startPayout, 10)
+	if !ok || start.Sign() < 0 {
+		return nil, fmt.Errorf("invalid -start-payout %q", *startPayout)
+	}
+	cfg.startPayout = start
+	step, ok := new(big.Int).SetString(*increment, 10)
+	if !ok || step.Sign() < 0 {
+		return nil, fmt.Errorf("invalid -increment %q", *increment)
+	}
+	cfg.increment = step
+	if *deposit != "" {
+		amount, ok := new(big.Int).SetString(*deposit, 10)
+		if !ok || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid -deposit %q", *deposit)
+		}
+		cfg.deposit = amount
+	}
+	if *withdraw != "" {
+		amount, ok := new(big.Int).SetString(*withdraw, 10)
+		if !ok || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid -withdraw %q", *withdraw)
+		}
+		cfg.withdraw = amount
+	}
+	if *minPayout != "" {
+		amount, ok := new(big.Int).SetString(*minPayout, 10)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("invalid -min-payout %q", *minPayout)
+		}
+		cfg.minPayout = amount
+	}
+	if *minCashout != "" {
+		amount, ok := new(big.Int).SetString(*minCashout, 10)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("invalid -min-cashout %q", *minCashout)
+		}
+		cfg.minCashout = amount
+	}
+	if *maxGasCostUSD > 0 {
+		if *usdPerGas <= 0 {
+			return nil, errors.New("-max-gas-cost-usd requires a positive -usd-per-gas")
+		}
+		cfg.maxGasCostUSD = big.NewFloat(*maxGasCostUSD)
+		cfg.usdOracle = &chequebook.FixedRateOracle{Rate: big.NewFloat(*usdPerGas)}
+	}
+
+	if cfg.privateKey != "" && cfg.keystoreDir != "" {
+		return nil, errors.New("-key and -keystore are mutually exclusive")
+	}
+	// the simulated chain starts empty on every run and only knows its generated account
+	if cfg.simulated && (cfg.privateKey != "" || cfg.keystoreDir != "" || cfg.readOnly || cfg.statePath != "" || cfg.nonceJournal != "") {
+		return nil, errors.New("-simulated cannot be combined with -key, -keystore, -read-only, -state or -nonce-journal")
+	}
+	if cfg.keystoreDir != "" {
+		if *passwordFile != "" {
+			password, err := ioutil.ReadFile(*passwordFile)
+			if err != nil {
+				return nil, err
+			}
+			cfg.keystorePassword = strings.TrimRight(string(password), "\r\n")
+		} else {
+			cfg.keystorePassword = os.Getenv("KEYSTORE_PASSWORD")
+		}
+	}
+	return cfg, nil
+}
+
+// parseAddress strictly parses the value of an address flag as 0x-prefixed 20 byte hex
+// mixed case input is checked against its EIP-55 checksum and a mismatch is recorded as a warning in cfg
+// an ENS name is resolved through cfg.ens instead
+func parseAddress(name string, value string, cfg *options) (common.Address, error) {
+	if chequebook.IsENSName(value) {
+		return resolveENSName(name, value, cfg)
+	}
+	if !strings.HasPrefix(value, "0x") || len(value) != 2+2*common.AddressLength || !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("invalid -%s address %q, expected 0x followed by 40 hex digits", name, value)
+	}
+
+	address := common.HexToAddress(value)
+	hex := value[2:]
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && address.Hex() != value {
+		cfg.warnings = append(cfg.warnings, fmt.Sprintf("-%s address %s does not match its checksum %s", name, value, address.Hex()))
+	}
+	return address, nil
+}
+
+// stringOption returns the flag value if set, otherwise the value of the environment variable env, otherwise the fallback
+func stringOption(flagValue string, env string, fallback string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return fallback
+}
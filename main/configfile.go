@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configEntry is a single key = value line of a config file
+type configEntry struct {
+	line  int
+	key   string
+	value string
+}
+
+// parseConfigFile parses a flat TOML file of `flag = value` lines
+// only the subset needed for flag values is supported: comments, bare values and double quoted strings, no tables or arrays
+func parseConfigFile(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		i := strings.Index(text, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		key := strings.TrimSpace(text[:i])
+		value := strings.TrimSpace(text[i+1:])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", line)
+		}
+
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", line, value)
+			}
+			value = unquoted
+		} else {
+			if i := strings.Index(value, "#"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			if value == "" {
+				return nil, fmt.Errorf("line %d: missing value of %s", line, key)
+			}
+		}
+		entries = append(entries, configEntry{line: line, key: key, value: value})
+	}
+	return entries, scanner.Err()
+}
+
+// applyConfigFile sets the flags of fs named in the config file at path which were not given on the command line
+// a key may be repeated for repeatable flags such as rpc-header
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, entry := range entries {
+		if entry.key == "config" || fs.Lookup(entry.key) == nil {
+			return fmt.Errorf("config %s line %d: unknown setting %q", path, entry.line, entry.key)
+		}
+		if explicit[entry.key] {
+			continue
+		}
+		if err := fs.Set(entry.key, entry.value); err != nil {
+			return fmt.Errorf("config %s line %d: invalid %s: %v", path, entry.line, entry.key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"signing/chequebook"
+)
+
+// recipientConsent builds the consent asked before cashing to a third-party recipient from -recipient-policy and -confirm-recipient
+// it is nil, approving every recipient, if neither is given
+func recipientConsent(policyFile string, confirm bool) (chequebook.RecipientConsent, error) {
+	var consent chequebook.RecipientConsent
+	if confirm {
+		consent = newTerminalConsent().confirm
+	}
+	if policyFile == "" {
+		return consent, nil
+	}
+	policy, err := chequebook.LoadRecipientPolicy(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Consent(consent), nil
+}
+
+// terminalConsent asks on the terminal before a cheque is cashed to a recipient other than its beneficiary
+// an approval holds for the rest of the run, so a batch asks once per beneficiary and recipient
+type terminalConsent struct {
+	mu       sync.Mutex // one question at a time, batches cash several beneficiaries in parallel
+	approved map[[2]common.Address]bool
+}
+
+func newTerminalConsent() *terminalConsent {
+	return &terminalConsent{approved: make(map[[2]common.Address]bool)}
+}
+
+func (c *terminalConsent) confirm(ctx context.Context, cheque *chequebook.ChequeParams, recipient common.Address) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pair := [2]common.Address{cheque.Beneficiary, recipient}
+	if c.approved[pair] {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("%w: no terminal to confirm %s", chequebook.ErrRecipientNotApproved, recipient.Hex())
+	}
+
+	fmt.Fprintf(os.Stderr, "cheque of %s drawn on %s for a cumulative %v\n", cheque.Beneficiary.Hex(), cheque.Contract.Hex(), cheque.CumulativePayout)
+	answer, err := promptLine(fmt.Sprintf("pay it out to the third party %s instead of the beneficiary? [y/N]: ", recipient.Hex()))
+	if err != nil {
+		return err
+	}
+	if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+		return fmt.Errorf("%w: %s declined", chequebook.ErrRecipientNotApproved, recipient.Hex())
+	}
+	c.approved[pair] = true
+	return nil
+}
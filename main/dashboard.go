@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// dashboardEvents is how many of the latest cashout events the dashboard shows
+const dashboardEvents = 8
+
+// dashboardKeys explains the keys the dashboard reads, each followed by enter as the terminal stays in line mode
+const dashboardKeys = "i <beneficiary> <amount> issue   c <beneficiary> cash   w <amount> withdraw   r refresh   q quit"
+
+// dashboard is what the dashboard command shows, only the loop of runDashboard touches it
+type dashboard struct {
+	logger       log.Logger
+	cfg          *options
+	book         *chequebook.Chequebook
+	store        *chequebook.ChequeStore
+	issuer       *chequebook.Issuer
+	denomination chequebook.Denomination
+
+	updated      time.Time
+	balance      *big.Int
+	liquid       *big.Int
+	hardDeposits *big.Int
+	cheques      []dashboardCheque
+	readErr      error // why the last refresh failed, the previous values stay on screen
+
+	pending map[int]string // descriptions of the actions waiting for their transactions
+	nextID  int
+	events  []chequebook.ChequeEvent // latest first
+	message string                   // outcome of the last action
+}
+
+// dashboardCheque is the last cheque issued to a beneficiary and what of it is not cashed yet
+type dashboardCheque struct {
+	beneficiary common.Address
+	issued      *big.Int
+	uncashed    *big.Int
+	hardDeposit *big.Int
+}
+
+// dashboardResult is the outcome of an action sent from the goroutine waiting for its transaction
+type dashboardResult struct {
+	id      int
+	message string
+}
+
+// runDashboard shows balances, hard deposits, outstanding cheques, pending transactions and cashouts of a chequebook
+// and issues, cashes and withdraws on the keys read from stdin until q is entered or ctx is cancelled
+func runDashboard(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook, defaults to the active one of -registry")
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the issued cheques, without it they are only kept until the dashboard exits")
+	interval := fs.Duration("interval", 2*time.Second, "`duration` between refreshes of the balances")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return err
+	}
+
+	var store *chequebook.ChequeStore
+	if *storeDir != "" {
+		store, err = chequebook.OpenChequeStore(*storeDir)
+	} else {
+		logger.Warn("issued cheques are lost when the dashboard exits, keep them with -store")
+		store, err = chequebook.NewMemoryChequeStore()
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	issuer, err := chequebook.NewIssuer(ctx, book, store, chainID, typedCheques(book, cfg))
+	if err != nil {
+		return err
+	}
+	issuer.TTL = cfg.chequeTTL
+
+	watcher, err := chequebook.NewChequeWatcher(backend, contractAddress)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan chequebook.ChequeEvent)
+	errs := make(chan error, 1)
+	go func() { errs <- watcher.Watch(ctx, events) }()
+
+	lines := make(chan string)
+	go readLines(os.Stdin, lines)
+
+	d := &dashboard{
+		logger:       logger,
+		cfg:          cfg,
+		book:         book,
+		store:        store,
+		issuer:       issuer,
+		denomination: denomination,
+		pending:      make(map[int]string),
+	}
+	results := make(chan dashboardResult)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	d.refresh(ctx)
+	for {
+		d.render(os.Stdout)
+		select {
+		case <-ticker.C:
+			d.refresh(ctx)
+		case event := <-events:
+			d.events = append([]chequebook.ChequeEvent{event}, d.events...)
+			if len(d.events) > dashboardEvents {
+				d.events = d.events[:dashboardEvents]
+			}
+			d.refresh(ctx)
+		case line, ok := <-lines:
+			if !ok {
+				// without input the dashboard keeps showing the chequebook until it is interrupted
+				lines = nil
+				continue
+			}
+			if strings.TrimSpace(line) == "q" {
+				return nil
+			}
+			d.handle(ctx, line, results)
+		case result := <-results:
+			delete(d.pending, result.id)
+			d.message = result.message
+			d.refresh(ctx)
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// readLines sends the lines of r to lines and closes it at the end of the input
+func readLines(r io.Reader, lines chan<- string) {
+	defer close(lines)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines <- scanner.Text()
+	}
+}
+
+// refresh reads the balances, hard deposits and the uncashed part of the cheques issued per beneficiary
+func (d *dashboard) refresh(ctx context.Context) {
+	d.readErr = d.read(ctx)
+	if d.readErr == nil {
+		d.updated = time.Now()
+	}
+}
+
+func (d *dashboard) read(ctx context.Context) error {
+	balance, err := d.book.Balance(ctx)
+	if err != nil {
+		return err
+	}
+	liquid, err := d.book.LiquidBalance(ctx)
+	if err != nil {
+		return err
+	}
+	hardDeposits, err := d.book.TotalHardDeposit(ctx)
+	if err != nil {
+		return err
+	}
+
+	issued, err := d.store.List()
+	if err != nil {
+		return err
+	}
+	var cheques []dashboardCheque
+	for _, cheque := range issued {
+		if cheque.Contract != d.book.Address() {
+			continue
+		}
+		paidOut, err := d.book.PaidOut(ctx, cheque.Beneficiary)
+		if err != nil {
+			return err
+		}
+		deposit, err := d.book.HardDeposit(ctx, cheque.Beneficiary)
+		if err != nil {
+			return err
+		}
+		uncashed := new(big.Int).Sub(cheque.CumulativePayout, paidOut)
+		if uncashed.Sign() < 0 {
+			uncashed.SetInt64(0)
+		}
+		cheques = append(cheques, dashboardCheque{
+			beneficiary: cheque.Beneficiary,
+			issued:      cheque.CumulativePayout,
+			uncashed:    uncashed,
+			hardDeposit: deposit.Amount,
+		})
+	}
+
+	d.balance, d.liquid, d.hardDeposits, d.cheques = balance, liquid, hardDeposits, cheques
+	return nil
+}
+
+// handle runs the action of an entered line, transactions are waited for in the background and report to results
+func (d *dashboard) handle(ctx context.Context, line string, results chan<- dashboardResult) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch {
+	case fields[0] == "r" && len(fields) == 1:
+		d.refresh(ctx)
+		d.message = ""
+	case fields[0] == "i" && len(fields) >= 3:
+		beneficiary, err := requireAddress(d.logger, "beneficiary", fields[1], d.cfg)
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		amount, err := d.denomination.Parse(strings.Join(fields[2:], " "))
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		cheque, err := d.issuer.Issue(ctx, beneficiary, amount)
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		d.message = fmt.Sprintf("issued cheque to %s, cumulative payout %s", beneficiary.Hex(), d.denomination.Format(cheque.CumulativePayout))
+		d.refresh(ctx)
+	case fields[0] == "c" && len(fields) == 2:
+		beneficiary, err := requireAddress(d.logger, "beneficiary", fields[1], d.cfg)
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		cheque, err := d.store.Last(d.book.Address(), beneficiary)
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		d.start(ctx, "cashing the cheque of "+beneficiary.Hex(), results, func() string {
+			// the cheque is cashed to the beneficiary, whose account has to be in the wallet as well
+			result, err := d.book.CashCheque(ctx, &cheque.ChequeParams, beneficiary, cheque.Signature)
+			if err != nil {
+				return err.Error()
+			}
+			if result.Revert != nil {
+				return fmt.Sprintf("cashout %s reverted: %v", result.TxHash.Hex(), result.Revert)
+			}
+			if err := d.store.MarkCashed(d.book.Address(), beneficiary, cheque.CumulativePayout); err != nil {
+				return err.Error()
+			}
+			return fmt.Sprintf("cashed %s to %s in %s", d.denomination.Format(result.Cashout.TotalPayout), beneficiary.Hex(), result.TxHash.Hex())
+		})
+	case fields[0] == "w" && len(fields) >= 2:
+		amount, err := d.denomination.Parse(strings.Join(fields[1:], " "))
+		if err != nil {
+			d.message = err.Error()
+			return
+		}
+		d.start(ctx, "withdrawing "+d.denomination.Format(amount), results, func() string {
+			receipt, err := d.book.Withdraw(ctx, amount)
+			if err != nil {
+				return err.Error()
+			}
+			return fmt.Sprintf("withdrew %s in %s", d.denomination.Format(amount), receipt.TxHash.Hex())
+		})
+	default:
+		d.message = fmt.Sprintf("unknown input %q", line)
+	}
+}
+
+// start runs action in the background, listing it as pending until it reports its outcome
+func (d *dashboard) start(ctx context.Context, description string, results chan<- dashboardResult, action func() string) {
+	id := d.nextID
+	d.nextID++
+	d.pending[id] = description
+	go func() {
+		message := action()
+		select {
+		case results <- dashboardResult{id: id, message: message}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// render redraws the whole screen
+func (d *dashboard) render(out io.Writer) {
+	amount := func(value *big.Int) string {
+		if value == nil {
+			return "-"
+		}
+		return d.denomination.Format(value)
+	}
+
+	// move the cursor home and clear the screen
+	fmt.Fprint(out, "\x1b[H\x1b[2J")
+	fmt.Fprintf(out, "chequebook %s   updated %s\n", d.book.Address().Hex(), d.updated.Format("15:04:05"))
+	if d.readErr != nil {
+		fmt.Fprintf(out, "refresh failed: %v\n", d.readErr)
+	}
+	fmt.Fprintf(out, "\nbalance:        %s\nliquid balance: %s\nhard deposits:  %s\n\n", amount(d.balance), amount(d.liquid), amount(d.hardDeposits))
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BENEFICIARY\tISSUED\tUNCASHED\tHARD DEPOSIT")
+	for _, cheque := range d.cheques {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cheque.beneficiary.Hex(), amount(cheque.issued), amount(cheque.uncashed), amount(cheque.hardDeposit))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\npending transactions:\n")
+	for id := 0; id < d.nextID; id++ {
+		if description, ok := d.pending[id]; ok {
+			fmt.Fprintf(out, "  %s\n", description)
+		}
+	}
+
+	fmt.Fprintf(out, "\nrecent cashouts:\n")
+	for _, event := range d.events {
+		line := fmt.Sprintf("  block %d  %s", event.Log.BlockNumber, event.Kind)
+		if event.Cashout != nil {
+			line += fmt.Sprintf("  %s to %s", amount(event.Cashout.TotalPayout), event.Cashout.Beneficiary.Hex())
+		}
+		if event.Log.Removed {
+			line += "  (removed by a reorg)"
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	if d.message != "" {
+		fmt.Fprintf(out, "\n%s\n", d.message)
+	}
+	fmt.Fprintf(out, "\n%s\n> ", dashboardKeys)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+	"signing/chequebook"
+)
+
+// ErrDryRun is returned instead of broadcasting a transaction in dry-run mode
+var ErrDryRun = errors.New("dry run, transaction not sent")
+
+// dryRunABIs are the contracts whose calls are decoded when logging a dry-run transaction
+var dryRunABIs = []string{
+	simpleswapfactory.ERC20SimpleSwapABI,
+	simpleswapfactory.SimpleSwapFactoryABI,
+	simpleswapfactory.ERC20MintableABI,
+}
+
+// dryRunBackend is an EthBackend which logs transactions instead of sending them
+type dryRunBackend struct {
+	chequebook.EthBackend
+	logger log.Logger
+}
+
+// SendTransaction logs the transaction and its decoded call and returns ErrDryRun
+func (b *dryRunBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	fields := []interface{}{"nonce", tx.Nonce(), "value", tx.Value(), "gas", tx.Gas(), "gasPrice", tx.GasPrice()}
+	if tx.To() == nil {
+		fields = append(fields, "to", "contract creation")
+	} else {
+		fields = append(fields, "to", *tx.To())
+	}
+	b.logger.Info("dry run transaction", fields...)
+
+	if method, args, ok := decodeCall(tx.Data()); ok {
+		fields := []interface{}{"method", method.Name}
+		for i, input := range method.Inputs {
+			fields = append(fields, input.Name, args[i])
+		}
+		b.logger.Info("dry run call", fields...)
+	}
+	return ErrDryRun
+}
+
+// decodeCall decodes call data of one of the dryRunABIs
+func decodeCall(data []byte) (*abi.Method, []interface{}, bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+
+	for _, definition := range dryRunABIs {
+		parsed, err := abi.JSON(strings.NewReader(definition))
+		if err != nil {
+			continue
+		}
+
+		method, err := parsed.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+
+		args, err := method.Inputs.UnpackValues(data[4:])
+		if err != nil || len(args) != len(method.Inputs) {
+			continue
+		}
+		return method, args, true
+	}
+	return nil, nil, false
+}
+
+// dryRunWallet is a WalletBackend which leaves transactions unsigned so the signer is not asked to approve them
+// data such as cheques is still signed by the wrapped wallet
+type dryRunWallet struct {
+	chequebook.WalletBackend
+}
+
+func (w dryRunWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return tx, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"signing/chequebook"
+)
+
+// ensLookupTimeout bounds a single name lookup of an address flag, which is parsed without the run's context
+const ensLookupTimeout = 30 * time.Second
+
+// deferredENSName is a global address flag given as an ENS name, resolved once the backend is connected
+type deferredENSName struct {
+	flag   string
+	name   string
+	target *common.Address
+}
+
+// addressOption parses the value of the global address flag name into target
+// ENS names cannot be resolved before the backend is dialed and are recorded in cfg for resolveENSNames instead
+func addressOption(name string, value string, cfg *options, target *common.Address) error {
+	if chequebook.IsENSName(value) && cfg.ens == nil {
+		cfg.ensNames = append(cfg.ensNames, deferredENSName{flag: name, name: value, target: target})
+		return nil
+	}
+	address, err := parseAddress(name, value, cfg)
+	if err != nil {
+		return err
+	}
+	*target = address
+	return nil
+}
+
+// setupENS creates the resolver of address flags and resolves the global flags given as ENS names
+func setupENS(ctx context.Context, backend chequebook.EthBackend, cfg *options) error {
+	resolver, err := chequebook.NewENSResolver(backend, cfg.ensRegistry)
+	if err != nil {
+		return err
+	}
+	cfg.ens = resolver
+	for _, deferred := range cfg.ensNames {
+		address, err := resolver.Resolve(ctx, deferred.name)
+		if err != nil {
+			return fmt.Errorf("resolving -%s %s: %w", deferred.flag, deferred.name, err)
+		}
+		*deferred.target = address
+	}
+	cfg.ensNames = nil
+	return nil
+}
+
+// resolveENSName resolves the ENS name given for the address flag name
+func resolveENSName(name string, value string, cfg *options) (common.Address, error) {
+	if cfg.ens == nil {
+		return common.Address{}, fmt.Errorf("-%s %s is an ens name, which needs a connected backend to resolve", name, value)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ensLookupTimeout)
+	defer cancel()
+	address, err := cfg.ens.Resolve(ctx, value)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("resolving -%s %s: %w", name, value, err)
+	}
+	return address, nil
+}
+
+// displayAddress formats address for human readable output, with -ens-reverse its verified primary name comes first
+// a lookup failing for any reason falls back to the bare address
+func displayAddress(ctx context.Context, address common.Address, cfg *options) string {
+	if !cfg.ensReverse || cfg.ens == nil || (address == common.Address{}) {
+		return address.Hex()
+	}
+	ctx, cancel := context.WithTimeout(ctx, ensLookupTimeout)
+	defer cancel()
+	name, err := cfg.ens.Reverse(ctx, address)
+	if err != nil {
+		return address.Hex()
+	}
+	return fmt.Sprintf("%s (%s)", name, address.Hex())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runRenewCheques lists the issued cheques which expired before being paid out in full and with -renew supersedes them
+// a renewed cheque pays the same cumulative amount with a fresh -cheque-ttl window and has to be passed on to its beneficiary
+func runRenewCheques(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook the cheques are drawn on, defaults to the active one of -registry")
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the issued cheques")
+	renew := fs.Bool("renew", false, "sign the renewed cheques instead of only listing the expired ones")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *storeDir == "" {
+		return fmt.Errorf("%s requires -store", cfg.command)
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := chequebook.OpenChequeStore(*storeDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	issuer, err := chequebook.NewIssuer(ctx, book, store, chainID, typedCheques(book, cfg))
+	if err != nil {
+		return err
+	}
+	issuer.TTL = cfg.chequeTTL
+
+	expired, err := issuer.Expired(ctx)
+	if err != nil {
+		return err
+	}
+	if !*renew {
+		for _, entry := range expired {
+			logger.Info("expired cheque", "beneficiary", entry.Cheque.Beneficiary, "cumulativePayout", entry.Cheque.CumulativePayout, "unpaid", entry.Amount, "expired", entry.Cheque.Expires)
+		}
+		return printJSON(expiredCheques(expired))
+	}
+	if cfg.chequeTTL == 0 {
+		logger.Warn("renewing without -cheque-ttl, the renewed cheques never expire")
+	}
+
+	renewed := make([]*chequebook.SignedCheque, 0, len(expired))
+	for _, entry := range expired {
+		cheque, err := issuer.Renew(ctx, entry.Cheque.Beneficiary)
+		if err != nil {
+			return err
+		}
+		logger.Info("renewed cheque", "beneficiary", cheque.Beneficiary, "cumulativePayout", cheque.CumulativePayout, "expires", cheque.Expires)
+		renewed = append(renewed, cheque)
+	}
+	if len(renewed) == 0 {
+		return errors.New("no expired cheques to renew")
+	}
+	return printJSON(renewed)
+}
+
+// expiredCheques returns the cheques of entries for printing
+func expiredCheques(entries []chequebook.OutstandingCheque) []*chequebook.SignedCheque {
+	cheques := make([]*chequebook.SignedCheque, 0, len(entries))
+	for _, entry := range entries {
+		cheques = append(cheques, entry.Cheque)
+	}
+	return cheques
+}
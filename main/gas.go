@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"signing/chequebook"
+)
+
+// newGasPricer creates the strategy of -gas-pricing, nil for the node's plain suggestion
+func newGasPricer(spec string, cfg *options) (chequebook.GasPricer, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "", "suggested":
+		if arg == "" {
+			return nil, nil
+		}
+		percent, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil || percent == 0 {
+			return nil, fmt.Errorf("invalid percentage %q of the suggestion", arg)
+		}
+		return &chequebook.SuggestedGasPrice{Percent: percent}, nil
+	case "fixed":
+		price, err := chequebook.ParseGwei(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &chequebook.FixedGasPrice{Price: price}, nil
+	case "fee-history":
+		percentile, err := strconv.ParseFloat(arg, 64)
+		if err != nil || percentile < 0 || percentile > 100 {
+			return nil, fmt.Errorf("invalid percentile %q, expected a number between 0 and 100", arg)
+		}
+		if cfg.simulated {
+			return nil, errors.New("the simulated chain serves no fee history")
+		}
+		// the fee history is read from the first node, failing over is left to the transactions themselves
+		client, err := rpc.Dial(strings.Split(cfg.backendURL, ",")[0])
+		if err != nil {
+			return nil, err
+		}
+		return &chequebook.FeeHistoryGasPrice{Client: client, Percentile: percentile}, nil
+	case "oracle":
+		parsed, err := url.Parse(arg)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid oracle url %q", arg)
+		}
+		field := parsed.Fragment
+		parsed.Fragment = ""
+		return &chequebook.OracleGasPrice{URL: parsed.String(), Field: field}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q, expected suggested, fixed, fee-history or oracle", kind)
+}
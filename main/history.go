@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runHistory indexes the past events of a chequebook and prints who was paid how much and when
+func runHistory(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook, defaults to the active one of -registry")
+	factory := fs.String("factory", "", "`address` of the factory which deployed the chequebook, adds the deployment to the history")
+	fromBlock := fs.Uint64("from-block", 0, "first `block` scanned when the chequebook is not indexed yet")
+	indexFile := fs.String("index", "", "json `file` keeping the indexed history so later runs only scan new blocks, empty scans everything every time")
+	blockRange := fs.Uint64("block-range", chequebook.DefaultHistoryBlockRange, "`blocks` covered by a single log query")
+	asJSON := fs.Bool("json", false, "print the history as json instead of a table, implied by the global -json")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+	var factoryAddress common.Address
+	if *factory != "" {
+		if factoryAddress, err = requireAddress(logger, "factory", *factory, cfg); err != nil {
+			return err
+		}
+	}
+
+	index, err := chequebook.OpenHistoryIndex(backend, *indexFile)
+	if err != nil {
+		return err
+	}
+	index.BlockRange = *blockRange
+
+	history, err := index.Update(ctx, contractAddress, factoryAddress, *fromBlock)
+	if err != nil {
+		return err
+	}
+	logger.Debug("indexed chequebook history", "chequebook", contractAddress, "entries", len(history.Entries), "scannedTo", history.ScannedTo)
+
+	if *asJSON || cfg.jsonOutput {
+		return printJSON(history)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BLOCK\tTIME\tKIND\tACCOUNT\tAMOUNT\tTX")
+	for _, entry := range history.Entries {
+		kind := entry.Kind
+		if entry.Bounced {
+			kind += " (bounced)"
+		}
+		amount := entry.Amount
+		if amount == "" {
+			amount = "-"
+		}
+		when := time.Unix(int64(entry.Time), 0).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", entry.Block, when, kind, entry.Account.Hex(), amount, entry.TxHash.Hex())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	paid := history.Paid()
+	beneficiaries := make([]common.Address, 0, len(paid))
+	for beneficiary := range paid {
+		beneficiaries = append(beneficiaries, beneficiary)
+	}
+	sort.Slice(beneficiaries, func(a, b int) bool { return beneficiaries[a].Hex() < beneficiaries[b].Hex() })
+	for _, beneficiary := range beneficiaries {
+		fmt.Printf("paid %s: %v\n", beneficiary.Hex(), paid[beneficiary])
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// newLogger installs a handler writing records up to level to stderr on the root logger and returns it
+// helpers which are not passed a logger log through the root logger and end up in the same output
+func newLogger(level log.Lvl, json bool) log.Logger {
+	format := log.TerminalFormat(false)
+	if json {
+		format = log.JSONFormat()
+	}
+
+	logger := log.Root()
+	logger.SetHandler(log.LvlFilterHandler(level, log.StreamHandler(os.Stderr, format)))
+	return logger
+}
@@ -2,226 +2,572 @@ package main
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethersphere/go-sw3/contracts-v0-2-3/simpleswapfactory"
+	"signing/chequebook"
 )
 
-var (
-	backendURL = "http://localhost:8545"
-)
+func main() {
+	cfg, err := parseFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-type EthBackend interface {
-	bind.ContractBackend
-	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
-}
+	logger := newLogger(cfg.logLevel, cfg.logJSON)
+	for _, warning := range cfg.warnings {
+		logger.Warn(warning)
+	}
 
-// WalletBackend is minimum needed from go-ethereums wallet abstraction to support swap functions
-type WalletBackend interface {
-	Accounts() []accounts.Account
-	SignData(account accounts.Account, mimetype string, text []byte) ([]byte, error)
-	SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// only long-running commands get time to finish their work once interrupted
+	var grace time.Duration
+	if commands[cfg.command].longRunning {
+		grace = cfg.shutdownTimeout
+	}
+	stop, ctx, cancel := shutdownContexts(grace)
+	defer cancel()
+	cfg.stop = stop.Done()
+
+	if err := run(ctx, logger, cfg); err != nil {
+		if errors.Is(err, ErrDryRun) {
+			logger.Info("dry run finished before sending a transaction")
+			return
+		}
+		if ctx.Err() != nil {
+			logger.Error("interrupted", "err", err)
+		} else {
+			logger.Error("failed", "err", err)
+		}
+		cancel()
+		os.Exit(1)
+	}
 }
 
-func main() {
-	if err := run(); err != nil {
-		panic(err)
+func run(ctx context.Context, logger log.Logger, cfg *options) error {
+	var ethBackend chequebook.EthBackend
+	var wallet chequebook.WalletBackend
+	if cfg.simulated {
+		backend, keys, err := chequebook.NewSimulatedEnvironment(1)
+		if err != nil {
+			return err
+		}
+		logger.Info("running against a simulated chain", "account", keys.Accounts()[0].Address)
+		ethBackend, wallet = backend, keys
+	} else {
+		var err error
+		ethBackend, err = dialBackend(ctx, cfg)
+		if err != nil {
+			return err
+		}
 	}
-}
 
-func run() error {
-	ethBackend, err := ethclient.Dial(backendURL)
-	if err != nil {
+	defer closeNotifier(logger, cfg)
+
+	if cfg.metricsAddr != "" {
+		cfg.metrics = chequebook.NewMetrics()
+		if err := serveMetrics(ctx, logger, cfg.metricsAddr, cfg.metrics); err != nil {
+			return err
+		}
+		ethBackend = chequebook.NewMeteredBackend(ethBackend, cfg.metrics)
+	}
+
+	if err := checkBackendChain(ctx, ethBackend, cfg); err != nil {
 		return err
 	}
 
-	var wallet WalletBackend
-	wallet, err = external.NewExternalSigner("./config/clef.ipc")
-	if err != nil {
+	if err := setupENS(ctx, ethBackend, cfg); err != nil {
 		return err
 	}
 
-	return runChequebook(ethBackend, wallet)
-}
+	if (cfg.status != common.Address{}) {
+		return runStatus(ctx, ethBackend, cfg.status, cfg.beneficiary, cfg)
+	}
+
+	// only the accounts of the simulated chain's own wallet are funded on it
+	var err error
+	if wallet == nil {
+		wallet, err = newWallet(ctx, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.metrics != nil && !chequebook.IsReadOnly(wallet) {
+		wallet = chequebook.NewMeteredWallet(wallet, cfg.metrics)
+	}
 
-func NewWalletTransactor(wallet WalletBackend, account accounts.Account) *bind.TransactOpts {
-	return &bind.TransactOpts{
-		From: account.Address,
-		Signer: func(signer types.Signer, address common.Address, transaction *types.Transaction) (*types.Transaction, error) {
-			if address != account.Address {
-				return nil, errors.New("not authorized to sign this account")
+	if !chequebook.IsReadOnly(wallet) && cfg.auditLog != "" {
+		audit, err := chequebook.OpenAuditLog(cfg.auditLog)
+		if err != nil {
+			return err
+		}
+		defer closeAuditLog(logger, audit, cfg)
+		cfg.audit = audit
+		ethBackend = chequebook.NewAuditedBackend(ethBackend, audit)
+		wallet = chequebook.NewAuditedWallet(wallet, audit)
+	}
+
+	if !chequebook.IsReadOnly(wallet) {
+		if cfg.nonceJournal != "" {
+			journaled, err := chequebook.NewPersistentNonceBackend(ethBackend, cfg.nonceJournal)
+			if err != nil {
+				return err
+			}
+			ethBackend = journaled
+			if commands[cfg.command].longRunning {
+				if err := resumeInFlight(ctx, logger, journaled, cfg); err != nil {
+					return err
+				}
+				defer reportInFlight(logger, journaled, cfg)
 			}
-			return wallet.SignTx(account, transaction, nil)
-		},
+		} else {
+			ethBackend = chequebook.NewNonceTrackingBackend(ethBackend)
+		}
 	}
-}
 
-func runChequebook(ethBackend EthBackend, wallet WalletBackend) error {
-	account := wallet.Accounts()[0]
-	opts := NewWalletTransactor(wallet, account)
-	fmt.Printf("selecting account %s\n", account.Address.Hex())
+	if cfg.dryRun && !chequebook.IsReadOnly(wallet) {
+		ethBackend = &dryRunBackend{EthBackend: ethBackend, logger: logger}
+		wallet = dryRunWallet{wallet}
+	}
 
-	_, tx, erc20, err := simpleswapfactory.DeployERC20Mintable(opts, ethBackend)
-	if err != nil {
-		return err
+	if cfg.command != "" {
+		cmd := commands[cfg.command]
+		if !cmd.readOnly && chequebook.IsReadOnly(wallet) {
+			return fmt.Errorf("%w: %s sends transactions", chequebook.ErrReadOnly, cfg.command)
+		}
+		return cmd.run(ctx, logger, ethBackend, wallet, cfg)
 	}
 
-	erc20Address, err := bind.WaitDeployed(context.TODO(), ethBackend, tx)
-	if err != nil {
-		return err
+	if cfg.batchFile != "" {
+		return runBatch(ctx, ethBackend, wallet, cfg)
 	}
 
-	factoryAddress, tx, factory, err := simpleswapfactory.DeploySimpleSwapFactory(opts, ethBackend, erc20Address)
+	stats, err := runChequebook(ctx, logger, ethBackend, wallet, cfg)
+	stats.log(logger)
+	return err
+}
+
+// resumeInFlight waits for the transactions a previous run of a long-running command left in flight
+// so the cheques they cash or issue are seen as done on chain before the command evaluates them again
+func resumeInFlight(ctx context.Context, logger log.Logger, backend *chequebook.NonceTrackingBackend, cfg *options) error {
+	inFlight, err := backend.Recover(ctx)
 	if err != nil {
 		return err
 	}
+	for _, tx := range inFlight {
+		logger.Info("waiting for transaction left in flight by the previous run", "tx", tx.Hash(), "nonce", tx.Nonce())
+		if _, err := chequebook.WaitConfirmed(ctx, backend, tx, cfg.confirmations, cfg.waitTimeout); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// a replacement with the same nonce may have been mined instead, the nonce journal continues after either
+			logger.Warn("transaction of the previous run not confirmed", "tx", tx.Hash(), "err", err)
+		}
+	}
+	return nil
+}
 
-	_, err = bind.WaitDeployed(context.TODO(), ethBackend, tx)
+// reportInFlight logs the transactions still pending when a long-running command returns, the next start waits for them
+func reportInFlight(logger log.Logger, backend *chequebook.NonceTrackingBackend, cfg *options) {
+	// the command's context is over by now, the check gets a bounded one of its own
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.waitTimeout)
+	defer cancel()
+	inFlight, err := backend.Recover(ctx)
 	if err != nil {
-		return err
+		logger.Warn("checking the transactions in flight failed", "journal", cfg.nonceJournal, "err", err)
+		return
 	}
+	for _, tx := range inFlight {
+		logger.Warn("transaction still pending, the next start waits for it", "tx", tx.Hash(), "nonce", tx.Nonce(), "journal", cfg.nonceJournal)
+	}
+}
 
-	fmt.Printf("deployed factory to %s\n", factoryAddress.Hex())
+// dialBackend connects to the node of -backend, several comma separated nodes, -rate-limit or -rpc-retries
+// wrap them in a backend failing over between them, limiting and retrying the requests
+func dialBackend(ctx context.Context, cfg *options) (chequebook.EthBackend, error) {
+	urls := strings.Split(cfg.backendURL, ",")
+	for i := range urls {
+		urls[i] = strings.TrimSpace(urls[i])
+	}
+	if len(urls) == 1 && cfg.rateLimit == 0 && cfg.rpcRetries <= 1 {
+		return chequebook.DialBackend(ctx, urls[0], cfg.rpcHeader)
+	}
+	return chequebook.DialResilientBackend(ctx, urls, cfg.rpcHeader, chequebook.ResilientOptions{
+		RetryAttempts:     cfg.rpcRetries,
+		RequestsPerSecond: cfg.rateLimit,
+		Burst:             cfg.rateBurst,
+	})
+}
 
-	tx, err = factory.DeploySimpleSwap(opts, opts.From, big.NewInt(0))
-	if err != nil {
+// newTransactor checks the chain of the backend against -chain-id and creates transaction options for the selected wallet account
+func newTransactor(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) (accounts.Account, *bind.TransactOpts, *big.Int, error) {
+	var chainID *big.Int
+	err := chequebook.WithRetry(ctx, cfg.retryAttempts, func() (err error) {
+		chainID, err = backend.ChainID(ctx)
 		return err
+	})
+	if err != nil {
+		return accounts.Account{}, nil, nil, err
+	}
+	if cfg.chainID != nil && cfg.chainID.Cmp(chainID) != 0 {
+		return accounts.Account{}, nil, nil, fmt.Errorf("backend reports chain id %v, expected %v", chainID, cfg.chainID)
 	}
 
-	receipt, err := bind.WaitMined(context.TODO(), ethBackend, tx)
+	account, err := selectAccount(wallet, cfg)
 	if err != nil {
-		return err
+		return accounts.Account{}, nil, nil, err
 	}
+	opts := chequebook.NewWalletTransactor(wallet, account, chainID)
+	opts.Context = ctx
+	logger.Info("selected account", "account", account.Address)
+	return account, opts, chainID, nil
+}
 
-	address := common.Address{}
-	for _, log := range receipt.Logs {
-		if event, err := factory.ParseSimpleSwapDeployed(*log); err == nil {
-			address = event.ContractAddress
-			break
-		}
+// configureChequebook applies the gas, wait and retry settings of cfg to book
+func configureChequebook(book *chequebook.Chequebook, cfg *options) {
+	book.GasBufferPercent = cfg.gasBufferPercent
+	book.MaxGasCostUSD = cfg.maxGasCostUSD
+	book.USDOracle = cfg.usdOracle
+	book.WaitTimeout = cfg.waitTimeout
+	book.Confirmations = cfg.confirmations
+	book.RetryAttempts = cfg.retryAttempts
+	book.BumpTimeout = cfg.bumpTimeout
+	book.MaxGasPrice = cfg.maxGasPrice
+	book.Overrides = chequebook.TxOverrides{GasPrice: cfg.gasPrice, GasPricer: cfg.gasPricer, MaxFee: cfg.maxFee, Nonce: cfg.nonce, GasCap: cfg.gasCap}
+	// a dry run reports what the cashout would pay before logging the transaction it stops at
+	book.Simulate = cfg.dryRun
+	book.MinCashout = cfg.minCashout
+	book.RecipientConsent = cfg.recipientConsent
+	book.Audit = cfg.audit
+	book.Metrics = cfg.metrics
+	book.Notifier = cfg.notifier
+	if book.ChainID == nil {
+		book.ChainID = cfg.chainID
 	}
-	if (address == common.Address{}) {
-		return errors.New("contract deployment failed")
+	if cfg.contracts != nil {
+		book.Version = cfg.contracts
 	}
+}
 
-	fmt.Printf("deployed simpleswap to %s\n", address.Hex())
+// runChequebook runs the chequebook setup and cashout flow
+// the returned stats are nil unless cfg.stats is set and cover the steps taken so far if the run failed
+func runChequebook(ctx context.Context, logger log.Logger, ethBackend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) (*RunStats, error) {
+	var stats *RunStats
+	if cfg.stats {
+		stats = &RunStats{}
+	}
+	err := runChequebookSteps(ctx, logger, ethBackend, wallet, cfg, stats)
+	return stats, err
+}
 
-	tx, err = erc20.Mint(opts, address, big.NewInt(50000))
+// runChequebookSteps deploys or resumes the setup, issues the cheques and cashes the last one, recording each step in stats
+func runChequebookSteps(ctx context.Context, logger log.Logger, ethBackend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options, stats *RunStats) error {
+	if chequebook.IsReadOnly(wallet) {
+		return fmt.Errorf("%w: the chequebook setup sends transactions", chequebook.ErrReadOnly)
+	}
+
+	account, opts, chainID, err := newTransactor(ctx, logger, ethBackend, wallet, cfg)
 	if err != nil {
 		return err
 	}
 
-	receipt, err = bind.WaitMined(context.TODO(), ethBackend, tx)
+	if duration, err := chequebook.EstimateSetupDuration(ctx, ethBackend, cfg.confirmations); err == nil {
+		logger.Info("estimated setup duration", "duration", duration)
+	} else {
+		logger.Warn("could not estimate setup duration", "err", err)
+	}
+
+	// the state file keeps the deployments of every chain, a rerun on the same chain operates on the contracts deployed before
+	state, err := chequebook.LoadNetworkState(cfg.statePath, chainID)
 	if err != nil {
 		return err
 	}
 
-	cheque := &ChequeParams{
-		Contract:         address,
-		Beneficiary:      account.Address,
-		CumulativePayout: 100,
+	// ether chequebooks are not deployed by the setup, it resumes them or finds them through the factory of the state file
+	native := cfg.contracts != nil && cfg.contracts.NativeToken()
+	if native && (state.Chequebook == common.Address{}) {
+		if (state.Factory == common.Address{}) {
+			return fmt.Errorf("the setup only deploys ERC20 factories, put the factory of the ether chequebooks into the state file or deploy a chequebook with deploy-chequebook -token eth")
+		}
+		if _, err := chequebook.DiscoverChequebook(ctx, ethBackend, state.Factory, account.Address, state.FactoryBlock); err != nil {
+			return fmt.Errorf("the setup deploys ERC20 chequebooks, deploy an ether chequebook with deploy-chequebook: %w", err)
+		}
 	}
 
-	sig, err := wallet.SignData(account, accounts.MimetypeTextPlain, cheque.sigHash())
+	// public chains come with a canonical factory, only private and development chains get a fresh one
+	token := cfg.token
+	if network, ok := cfg.networks.Lookup(chainID); ok && (network.Factory != common.Address{}) && !native && !cfg.deployFactory && (state.Factory == common.Address{}) {
+		logger.Info("using canonical factory", "network", network.Name, "factory", network.Factory)
+		state.Factory = network.Factory
+		if (token == common.Address{}) {
+			token = network.Token
+		}
+		if (token == common.Address{}) {
+			return fmt.Errorf("network %s has no canonical token, set -token to the token of factory %s", network.Name, network.Factory.Hex())
+		}
+	}
+
+	// the development flow deploys and mints a fresh token while an existing token is only bound to
+	var erc20 chequebook.BalanceReader
+	var mintable *simpleswapfactory.ERC20Mintable
+	start, before := time.Now(), state.TokenTx
+	if native {
+		erc20 = chequebook.EtherBalances{Backend: ethBackend}
+	} else if (token != common.Address{}) {
+		erc20, err = chequebook.BindToken(ctx, logger, ethBackend, token, state)
+	} else {
+		mintable, err = chequebook.SetupToken(ctx, logger, ethBackend, opts, state, cfg.waitTimeout, cfg.confirmations)
+		erc20 = mintable
+	}
 	if err != nil {
 		return err
 	}
+	stats.recordSetup(ctx, ethBackend, "token", start, before, state.TokenTx)
+
+	start, before = time.Now(), state.FactoryTx
+	var factory *simpleswapfactory.SimpleSwapFactory
+	if !native || (state.Factory != common.Address{}) {
+		factory, err = chequebook.SetupFactory(ctx, logger, ethBackend, opts, state, cfg.waitTimeout, cfg.confirmations)
+		if err != nil {
+			return err
+		}
+	}
+	stats.recordSetup(ctx, ethBackend, "factory deploy", start, before, state.FactoryTx)
 
-	rec := common.HexToAddress("0xAd4F6Efc6594fE9305bF9A69BAb8bd942aDAECDB")
+	// the setup only deploys v0.2.3 chequebooks, a chequebook of another release has to exist already
+	if version := cfg.contracts; version != nil && version != chequebook.ContractsV023 && !native && (state.Chequebook == common.Address{}) {
+		if _, err := chequebook.DiscoverChequebook(ctx, ethBackend, state.Factory, account.Address, state.FactoryBlock); err != nil {
+			return fmt.Errorf("the setup deploys %s chequebooks, deploy a %s chequebook with deploy-chequebook: %w", chequebook.ContractsV023.Name(), version.Name(), err)
+		}
+	}
 
-	tx, err = CashChequeBeneficiaryRequest(ethBackend, address, rec, cheque, sig)
+	start, before = time.Now(), state.ChequebookTx
+	book, err := chequebook.EnsureChequebook(ctx, logger, ethBackend, wallet, opts, factory, state, cfg.waitTimeout, cfg.confirmations)
 	if err != nil {
 		return err
 	}
+	if book.Version = cfg.contracts; book.Version == nil {
+		if book.Version, err = chequebook.DetectVersion(ctx, ethBackend, book.Address()); err != nil {
+			return err
+		}
+	}
+	stats.recordSetup(ctx, ethBackend, "chequebook deploy", start, before, state.ChequebookTx)
+	configureChequebook(book, cfg)
+	out := &flowOutput{Deployment: state}
 
-	tx, err = wallet.SignTx(account, tx, nil)
-	if err != nil {
+	if err := book.VerifyWiring(ctx, state.Token, account.Address); err != nil {
 		return err
 	}
 
-	err = ethBackend.SendTransaction(context.Background(), tx)
+	if mintable != nil && (state.MintTx == common.Hash{}) {
+		start := time.Now()
+		tx, err := mintable.Mint(opts, book.Address(), big.NewInt(50000))
+		if err != nil {
+			return err
+		}
+
+		receipt, err := chequebook.WaitConfirmed(ctx, ethBackend, tx, cfg.confirmations, cfg.waitTimeout)
+		if err != nil {
+			return err
+		}
+		stats.record("mint", start, receipt)
+
+		state.MintTx = tx.Hash()
+		if err := state.Save(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.deposit != nil {
+		if err := logBalances(ctx, logger, book, "before deposit"); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		receipt, err := book.Deposit(ctx, cfg.deposit)
+		if err != nil {
+			return err
+		}
+		stats.record("deposit", start, receipt)
+		logger.Info("deposit mined", "chequebook", book.Address(), "tx", receipt.TxHash, "status", receipt.Status, "gasUsed", receipt.GasUsed)
+		deposit := newTxOutput(book, receipt)
+		out.Deposit = &deposit
+
+		if err := logBalances(ctx, logger, book, "after deposit"); err != nil {
+			return err
+		}
+	}
+
+	beneficiary := cfg.beneficiary
+	if (beneficiary == common.Address{}) {
+		beneficiary = account.Address
+	}
+
+	base := &chequebook.ChequeParams{
+		Contract:         book.Address(),
+		Beneficiary:      beneficiary,
+		CumulativePayout: cfg.startPayout,
+	}
+
+	start = time.Now()
+	typed := typedCheques(book, cfg)
+	cheques, err := chequebook.IssueIncrementingCheques(wallet, account, base, cfg.increment, cfg.chequeCount, chainID, typed)
 	if err != nil {
 		return err
 	}
+	for _, signed := range cheques {
+		signed.SetValidity(start, cfg.chequeTTL)
+	}
+	stats.record("sign", start, nil)
 
-	receipt, err = bind.WaitMined(context.TODO(), ethBackend, tx)
+	owner, err := book.Issuer(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("got receipt with status %v\n", receipt.Status)
+	for i, signed := range cheques {
+		issuer, err := chequebook.Verify(signed, chainID, typed)
+		if err != nil {
+			return err
+		}
+		if issuer != owner {
+			return fmt.Errorf("cheque signed by %s instead of the chequebook owner %s", issuer.Hex(), owner.Hex())
+		}
 
-	b, err := erc20.BalanceOf(nil, rec)
-	if err != nil {
+		logger.Info("issued cheque", "index", i, "cumulativePayout", signed.CumulativePayout, "signature", hexutil.Encode(signed.Signature))
+	}
+
+	out.Cheques = cheques
+	if err := registerChequebook(ctx, ethBackend, cfg, book, state.Factory, beneficiary); err != nil {
 		return err
 	}
 
-	fmt.Printf("balance: %v\n", b)
+	if cfg.issueOnly {
+		return out.print(cfg)
+	}
 
-	return nil
-}
+	// only the latest cheque is cashed, it covers all payouts of the earlier ones
+	cheque := &cheques[len(cheques)-1].ChequeParams
+	sig := cheques[len(cheques)-1].Signature
 
-// ChequeParams encapsulate all cheque parameters
-type ChequeParams struct {
-	Contract         common.Address // address of chequebook, needed to avoid cross-contract submission
-	Beneficiary      common.Address // address of the beneficiary, the contract which will redeem the cheque
-	CumulativePayout uint64         // cumulative amount of the cheque in currency
-}
+	rec := cfg.recipient
+	if (rec == common.Address{}) {
+		rec = cheque.Beneficiary
+	}
 
-// encodeForSignature encodes the cheque params in the format used in the signing procedure
-func (cheque *ChequeParams) encodeForSignature() []byte {
-	cumulativePayoutBytes := make([]byte, 32)
-	// we need to write the last 8 bytes as we write a uint64 into a 32-byte array
-	// encoded in BigEndian because EVM uses BigEndian encoding
-	binary.BigEndian.PutUint64(cumulativePayoutBytes[24:], cheque.CumulativePayout)
-	// construct the actual cheque
-	input := cheque.Contract.Bytes()
-	input = append(input, cheque.Beneficiary.Bytes()...)
-	input = append(input, cumulativePayoutBytes[:]...)
-	return input
-}
+	if cfg.minPayout != nil {
+		payout, err := chequebook.SimulateCashout(ctx, ethBackend, book.Address(), rec, cheque, sig)
+		if err != nil {
+			return err
+		}
 
-// sigHash hashes the cheque params using the prefix that would be added by eth_Sign
-func (cheque *ChequeParams) sigHash() []byte {
-	// we can ignore the error because it is always nil
-	encoded := cheque.encodeForSignature()
-	input := crypto.Keccak256(encoded)
-	withPrefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(input), input)
-	return crypto.Keccak256([]byte(withPrefix))
-}
+		if payout.Cmp(cfg.minPayout) < 0 {
+			return fmt.Errorf("%w: payout %v, minimum %v", chequebook.ErrPayoutBelowMinimum, payout, cfg.minPayout)
+		}
+	}
 
-func CashChequeBeneficiaryRequest(backend EthBackend, to common.Address, recipient common.Address, cheque *ChequeParams, ownerSig []byte) (*types.Transaction, error) {
-	abi, err := abi.JSON(strings.NewReader(simpleswapfactory.ERC20SimpleSwapABI))
+	coverage, err := book.Coverage(ctx, cheque)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if coverage.Owed.Sign() <= 0 {
+		logger.Warn("cheque pays out nothing new, it was already cashed", "cumulativePayout", cheque.CumulativePayout)
+	} else if shortfall := coverage.Shortfall(); shortfall.Sign() > 0 {
+		logger.Warn("chequebook cannot cover the cheque in full, it will bounce", "owed", coverage.Owed, "payable", coverage.Payable, "shortfall", shortfall)
+	} else {
+		logger.Info("chequebook covers the cheque", "owed", coverage.Owed)
 	}
 
-	callData, err := abi.Pack("cashChequeBeneficiary", recipient, big.NewInt(int64(cheque.CumulativePayout)), ownerSig)
-	if err != nil {
-		return nil, err
+	// the beneficiary pays the gas of the cashout in ether, which its balance would not tell apart from the payout
+	verifyPayout := cfg.verifyPayout
+	if native && verifyPayout && rec == cheque.Beneficiary {
+		logger.Warn("not verifying the payout, the recipient also pays the cashout gas", "recipient", rec)
+		verifyPayout = false
+	}
+
+	var expected, balanceBefore *big.Int
+	if verifyPayout {
+		expected, err = book.ExpectedPayout(ctx, cheque, big.NewInt(0))
+		if err != nil {
+			return err
+		}
+
+		balanceBefore, err = erc20.BalanceOf(&bind.CallOpts{Context: ctx}, rec)
+		if err != nil {
+			return err
+		}
 	}
 
-	nonce, err := backend.PendingNonceAt(context.Background(), cheque.Beneficiary)
+	start = time.Now()
+	result, err := book.CashCheque(ctx, cheque, rec, sig)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	stats.record("cash", start, result.Receipt)
+
+	logger.Info("cashout mined", "chequebook", book.Address(), "beneficiary", cheque.Beneficiary, "recipient", rec, "tx", result.TxHash, "status", result.Receipt.Status, "gasUsed", result.GasUsed)
+	cashout := newCashoutOutput(book, cheque.Beneficiary, result)
+	out.Cashout = &cashout
+	if result.Revert != nil {
+		if err := out.print(cfg); err != nil {
+			return err
+		}
+		return result.Revert
+	}
+
+	if cashout := result.Cashout; cashout != nil {
+		if shortfall := new(big.Int).Sub(coverage.Owed, cashout.TotalPayout); cashout.Bounced || shortfall.Sign() > 0 {
+			logger.Warn("cheque only partially paid", "owed", coverage.Owed, "totalPayout", cashout.TotalPayout, "shortfall", shortfall, "bounced", cashout.Bounced, "cumulativePayout", cashout.CumulativePayout, "callerPayout", cashout.CallerPayout)
+		} else {
+			logger.Info("cheque honored", "totalPayout", cashout.TotalPayout, "cumulativePayout", cashout.CumulativePayout, "callerPayout", cashout.CallerPayout)
+		}
 	}
 
-	gasPrice, err := backend.SuggestGasPrice(context.Background())
+	b, err := erc20.BalanceOf(&bind.CallOpts{Context: ctx}, rec)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	logger.Info("recipient balance", "recipient", rec, "balance", b)
+	out.RecipientBalance = b.String()
+
+	if verifyPayout && result.Receipt.Status == types.ReceiptStatusSuccessful {
+		if err := chequebook.VerifyPayout(ctx, erc20, rec, balanceBefore, expected); err != nil {
+			return err
+		}
+	}
+
+	if cfg.withdraw != nil {
+		if err := logBalances(ctx, logger, book, "before withdraw"); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		receipt, err := book.Withdraw(ctx, cfg.withdraw)
+		if err != nil {
+			return err
+		}
+		stats.record("withdraw", start, receipt)
+		logger.Info("withdraw mined", "chequebook", book.Address(), "tx", receipt.TxHash, "status", receipt.Status, "gasUsed", receipt.GasUsed)
+		withdrawal := newTxOutput(book, receipt)
+		out.Withdrawal = &withdrawal
+
+		if err := logBalances(ctx, logger, book, "after withdraw"); err != nil {
+			return err
+		}
 	}
 
-	return types.NewTransaction(nonce, to, big.NewInt(0), 1000000, gasPrice, callData), nil
+	return out.print(cfg)
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+const testWaitTimeout = 10 * time.Second
+
+// newTestEnvironment creates a simulated backend with a single funded account held by an in-memory wallet
+func newTestEnvironment(t *testing.T) (*chequebook.SimulatedBackend, *chequebook.KeyWallet) {
+	backend, wallet, err := chequebook.NewSimulatedEnvironment(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend, wallet
+}
+
+func TestRunChequebook(t *testing.T) {
+	backend, wallet := newTestEnvironment(t)
+
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &options{
+		statePath:        filepath.Join(dir, "state.json"),
+		verifyPayout:     true,
+		startPayout:      big.NewInt(100),
+		increment:        big.NewInt(100),
+		chequeCount:      3,
+		gasBufferPercent: chequebook.DefaultGasBufferPercent,
+		waitTimeout:      testWaitTimeout,
+		retryAttempts:    1,
+		stats:            true,
+	}
+
+	// runChequebook cashes the last of the three cheques and verifies the recipient's balance increased by its full payout
+	stats, err := runChequebook(context.Background(), log.Root(), backend, wallet, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Steps) == 0 || stats.TotalGas() == 0 {
+		t.Fatalf("no steps or gas recorded: %+v", stats)
+	}
+
+	chainID, err := backend.ChainID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := chequebook.LoadNetworkState(cfg.statePath, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (state.Token == common.Address{}) || (state.Factory == common.Address{}) || (state.Chequebook == common.Address{}) || (state.MintTx == common.Hash{}) || state.ChequebookBlock == 0 {
+		t.Fatalf("incomplete deployment state %+v", state)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "swap-clef-test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	config := "# node settings\nbackend = \"http://node:8545\"\ngas-buffer = 50 # percent\nretries = 7\n"
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	backend := fs.String("backend", "", "")
+	gasBuffer := fs.Uint64("gas-buffer", 20, "")
+	retries := fs.Int("retries", 3, "")
+	if err := fs.Parse([]string{"-retries", "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfigFile(fs, f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if *backend != "http://node:8545" {
+		t.Fatalf("backend %q, expected the config file value", *backend)
+	}
+	if *gasBuffer != 50 {
+		t.Fatalf("gas buffer %d, expected 50", *gasBuffer)
+	}
+	if *retries != 1 {
+		t.Fatalf("retries %d, expected the command line value 1", *retries)
+	}
+
+	if _, err := parseConfigFile(strings.NewReader("backend\n")); err == nil {
+		t.Fatal("expected an error for a line without =")
+	}
+}
+
+// parseArgs runs parseFlags on args with fresh command line flags
+func parseArgs(args ...string) (*options, error) {
+	commandLine, osArgs := flag.CommandLine, os.Args
+	defer func() { flag.CommandLine, os.Args = commandLine, osArgs }()
+	flag.CommandLine = flag.NewFlagSet("swap", flag.ContinueOnError)
+	os.Args = append([]string{"swap"}, args...)
+	return parseFlags()
+}
+
+func TestParseSimulatedWithoutClef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg, err := parseArgs("-simulated", "-clef", filepath.Join(dir, "clef.ipc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.simulated {
+		t.Fatal("expected a simulated run")
+	}
+}
+
+func TestParseRemoteClef(t *testing.T) {
+	cfg, err := parseArgs("-clef", "https://clef.example.org:8550")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.clefIPC != "https://clef.example.org:8550" {
+		t.Fatalf("clef endpoint %q", cfg.clefIPC)
+	}
+}
+
+func TestClefSocketOnlyForClef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "clef.ipc")
+
+	// every other signer parses and is created without clef running
+	if _, err := parseArgs("-signer", "hardware", "-clef", missing); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseArgs("-signer", "key", "-key", "0x4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d", "-clef", missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newWallet(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = parseArgs("-signer", "clef", "-clef", missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newWallet(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "clef ipc socket not found") {
+		t.Fatalf("expected the missing socket to be reported, got %v", err)
+	}
+}
+
+func TestParseTrustedFactories(t *testing.T) {
+	first := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	second := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	cfg, err := parseArgs("-trusted-factories", first.Hex()+", "+second.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.trustedFactories) != 2 || cfg.trustedFactories[0] != first || cfg.trustedFactories[1] != second {
+		t.Fatalf("trusted factories %v", cfg.trustedFactories)
+	}
+
+	f, err := ioutil.TempFile("", "swap-clef-test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("trusted-factories = \"" + second.Hex() + "\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	cfg, err = parseArgs("-config", f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.trustedFactories) != 1 || cfg.trustedFactories[0] != second {
+		t.Fatalf("trusted factories %v from the config file", cfg.trustedFactories)
+	}
+
+	if _, err := parseArgs("-trusted-factories", "0x1234"); err == nil {
+		t.Fatal("expected an error for an invalid factory address")
+	}
+}
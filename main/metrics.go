@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// serveMetrics serves the prometheus metrics of m on /metrics at address until ctx is cancelled
+// the listener is opened before returning so a taken address fails the run right away
+func serveMetrics(ctx context.Context, logger log.Logger, address string, m *chequebook.Metrics) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Warn("metrics listener failed", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("serving metrics", "address", listener.Addr())
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"signing/chequebook"
+)
+
+// applyNetwork selects the profile of -network, its settings apply to every flag not given on the command line, in the config file or the environment
+// the profile's chain is required of the backend, and a -chain-id naming another chain is refused
+func applyNetwork(cfg *options, name string) error {
+	chainID, network, ok := cfg.networks.ByName(name)
+	if !ok {
+		return fmt.Errorf("unknown -network %q, known are %s", name, strings.Join(cfg.networks.Names(), ", "))
+	}
+	if cfg.chainID != nil && cfg.chainID.Cmp(chainID) != 0 {
+		return fmt.Errorf("-chain-id %v contradicts -network %s on chain %v", cfg.chainID, network.Name, chainID)
+	}
+	cfg.chainID = chainID
+	cfg.network = network.Name
+
+	given := make(map[string]bool)
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if network.RPC != "" && !given["backend"] && os.Getenv("SWAP_BACKEND_URL") == "" {
+		cfg.backendURL = network.RPC
+	}
+	if network.GasPrice != "" && !given["gas-price"] {
+		price, err := chequebook.ParseGwei(network.GasPrice)
+		if err != nil {
+			return fmt.Errorf("invalid gasPrice of network %s: %v", network.Name, err)
+		}
+		cfg.gasPrice = price
+	}
+	if network.MaxGasPrice != "" && !given["max-gas-price"] {
+		price, err := chequebook.ParseGwei(network.MaxGasPrice)
+		if err != nil {
+			return fmt.Errorf("invalid maxGasPrice of network %s: %v", network.Name, err)
+		}
+		cfg.maxGasPrice = price
+	}
+	if network.GasBuffer != nil && !given["gas-buffer"] {
+		cfg.gasBufferPercent = *network.GasBuffer
+	}
+	if network.Confirmations != nil && !given["confirmations"] {
+		if *network.Confirmations < 1 {
+			return fmt.Errorf("the confirmations of network %s must be at least 1", network.Name)
+		}
+		cfg.confirmations = *network.Confirmations
+	}
+	return nil
+}
+
+// checkBackendChain refuses a backend on another chain than -chain-id or -network before any command touches it
+func checkBackendChain(ctx context.Context, backend chequebook.EthBackend, cfg *options) error {
+	if cfg.chainID == nil {
+		return nil
+	}
+	var actual *big.Int
+	err := chequebook.WithRetry(ctx, cfg.retryAttempts, func() (err error) {
+		actual, err = backend.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if actual.Cmp(cfg.chainID) != 0 {
+		if cfg.network != "" {
+			return fmt.Errorf("%w: backend %s reports chain id %v, network %s is chain %v", chequebook.ErrChainMismatch, cfg.backendURL, actual, cfg.network, cfg.chainID)
+		}
+		return fmt.Errorf("%w: backend reports chain id %v, expected %v", chequebook.ErrChainMismatch, actual, cfg.chainID)
+	}
+	return nil
+}
+
+// registeredChain returns the chain -registry records for the chequebook at address, nil if it records none
+func registeredChain(address common.Address, cfg *options) *big.Int {
+	registry, err := openRegistry(cfg)
+	if err != nil || registry == nil {
+		return nil
+	}
+	registered, err := registry.Get(address)
+	if err != nil {
+		return nil
+	}
+	return registered.ChainID
+}
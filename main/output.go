@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"signing/chequebook"
+)
+
+// printJSON writes value as indented json to stdout, the only thing printed there with -json
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// decimal formats an amount as a decimal string like the cheque json does, nil yields an empty string
+func decimal(value *big.Int) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+// txOutput is the json printed for a mined transaction
+type txOutput struct {
+	Chequebook common.Address `json:"chequebook"`
+	TxHash     common.Hash    `json:"txHash"`
+	Status     uint64         `json:"status"`
+	Block      uint64         `json:"block"`
+	GasUsed    uint64         `json:"gasUsed"`
+	Receipt    *types.Receipt `json:"receipt"`
+}
+
+func newTxOutput(book *chequebook.Chequebook, receipt *types.Receipt) txOutput {
+	return txOutput{
+		Chequebook: book.Address(),
+		TxHash:     receipt.TxHash,
+		Status:     receipt.Status,
+		Block:      receipt.BlockNumber.Uint64(),
+		GasUsed:    receipt.GasUsed,
+		Receipt:    receipt,
+	}
+}
+
+// cashoutOutput is the json printed for a cashout
+type cashoutOutput struct {
+	txOutput
+	Beneficiary      common.Address  `json:"beneficiary"`
+	Recipient        *common.Address `json:"recipient,omitempty"`
+	TotalPayout      string          `json:"totalPayout,omitempty"`
+	CumulativePayout string          `json:"cumulativePayout,omitempty"`
+	CallerPayout     string          `json:"callerPayout,omitempty"`
+	Bounced          bool            `json:"bounced"`
+	Revert           string          `json:"revert,omitempty"` // reason of a failed cashout
+}
+
+func newCashoutOutput(book *chequebook.Chequebook, beneficiary common.Address, result *chequebook.CashResult) cashoutOutput {
+	out := cashoutOutput{txOutput: newTxOutput(book, result.Receipt), Beneficiary: beneficiary}
+	if cashout := result.Cashout; cashout != nil {
+		out.Recipient = &cashout.Recipient
+		out.TotalPayout = decimal(cashout.TotalPayout)
+		out.CumulativePayout = decimal(cashout.CumulativePayout)
+		out.CallerPayout = decimal(cashout.CallerPayout)
+		out.Bounced = cashout.Bounced
+	}
+	if result.Revert != nil {
+		out.Revert = result.Revert.Error()
+	}
+	return out
+}
+
+// fundingOutput is the json printed for a deposit or withdrawal together with the balances after it
+type fundingOutput struct {
+	txOutput
+	Amount        string `json:"amount"`
+	Balance       string `json:"balance"`
+	LiquidBalance string `json:"liquidBalance"`
+}
+
+// flowOutput is the json printed at the end of the setup and cashout flow
+type flowOutput struct {
+	Deployment       *chequebook.DeploymentState `json:"deployment"`
+	Deposit          *txOutput                   `json:"deposit,omitempty"`
+	Cheques          []*chequebook.SignedCheque  `json:"cheques"`
+	Cashout          *cashoutOutput              `json:"cashout,omitempty"`
+	RecipientBalance string                      `json:"recipientBalance,omitempty"`
+	Withdrawal       *txOutput                   `json:"withdrawal,omitempty"`
+}
+
+// print prints the output of a finished flow if cfg asks for json
+func (out *flowOutput) print(cfg *options) error {
+	if !cfg.jsonOutput {
+		return nil
+	}
+	return printJSON(out)
+}
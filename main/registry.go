@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// openRegistry opens the chequebook registry of -registry, nil if none is configured
+func openRegistry(cfg *options) (*chequebook.ChequebookRegistry, error) {
+	if cfg.registryPath == "" {
+		return nil, nil
+	}
+	return chequebook.OpenChequebookRegistry(cfg.registryPath)
+}
+
+// requireRegistry opens the chequebook registry of -registry for the commands managing it
+func requireRegistry(cfg *options) (*chequebook.ChequebookRegistry, error) {
+	if cfg.registryPath == "" {
+		return nil, fmt.Errorf("%s requires -registry", cfg.command)
+	}
+	return openRegistry(cfg)
+}
+
+// chequebookAddress parses the -chequebook flag of a command, an empty value selects the active chequebook of -registry
+func chequebookAddress(logger log.Logger, value string, cfg *options) (common.Address, error) {
+	if value != "" || cfg.registryPath == "" {
+		return requireAddress(logger, "chequebook", value, cfg)
+	}
+
+	registry, err := openRegistry(cfg)
+	if err != nil {
+		return common.Address{}, err
+	}
+	active, ok := registry.Active()
+	if !ok {
+		return common.Address{}, fmt.Errorf("%s requires -chequebook, registry %s has no active chequebook", cfg.command, cfg.registryPath)
+	}
+	logger.Debug("using active chequebook", "chequebook", active, "registry", cfg.registryPath)
+	return active, nil
+}
+
+// registerChequebook records book in -registry with its issuer, token and network, it does nothing without -registry
+func registerChequebook(ctx context.Context, backend chequebook.EthBackend, cfg *options, book *chequebook.Chequebook, factory common.Address, beneficiaries ...common.Address) error {
+	registry, err := openRegistry(cfg)
+	if registry == nil || err != nil {
+		return err
+	}
+
+	issuer, err := book.Issuer(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := book.Token(ctx)
+	if err != nil {
+		return err
+	}
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry := chequebook.RegisteredChequebook{
+		Address:       book.Address(),
+		Issuer:        issuer,
+		Token:         token,
+		Factory:       factory,
+		ChainID:       chainID,
+		Beneficiaries: beneficiaries,
+	}
+	if network, ok := cfg.networks.Lookup(chainID); ok {
+		entry.Network = network.Name
+	}
+	return registry.Register(entry)
+}
+
+// runListChequebooks prints the chequebooks of -registry and marks the active one
+// with -balances their balances and the amounts paid out to their beneficiaries are read from the chain, together in one multicall
+func runListChequebooks(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	issuer := fs.String("issuer", "", "only list the chequebooks issued by `address`")
+	balances := fs.Bool("balances", false, "read the balances and paid out amounts of the listed chequebooks from the chain")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	registry, err := requireRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	books := registry.List()
+	if *issuer != "" {
+		issuerAddress, err := requireAddress(logger, "issuer", *issuer, cfg)
+		if err != nil {
+			return err
+		}
+		books = registry.IssuedBy(issuerAddress)
+	}
+	active, _ := registry.Active()
+
+	var states []*chequebook.ChequebookState
+	if *balances {
+		reader, err := stateReader(ctx, backend, cfg)
+		if err != nil {
+			return err
+		}
+		queries := make([]chequebook.StateQuery, len(books))
+		for i, book := range books {
+			queries[i] = chequebook.StateQuery{Chequebook: book.Address, Beneficiaries: book.Beneficiaries}
+		}
+		if states, err = reader.Read(ctx, queries); err != nil {
+			return err
+		}
+	}
+
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Active      common.Address                     `json:"active"`
+			Chequebooks []*chequebook.RegisteredChequebook `json:"chequebooks"`
+			States      []chequebookStateOutput            `json:"states,omitempty"`
+		}{active, books, newChequebookStateOutputs(states)})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if *balances {
+		fmt.Fprintln(w, "\tCHEQUEBOOK\tISSUER\tTOKEN\tNETWORK\tBALANCE\tLIQUID\tPAID OUT\tBENEFICIARIES")
+	} else {
+		fmt.Fprintln(w, "\tCHEQUEBOOK\tISSUER\tTOKEN\tNETWORK\tBENEFICIARIES")
+	}
+	for i, book := range books {
+		marker := ""
+		if book.Address == active {
+			marker = "*"
+		}
+		network := book.Network
+		if network == "" && book.ChainID != nil {
+			network = "chain " + book.ChainID.String()
+		}
+		beneficiaries := make([]string, 0, len(book.Beneficiaries))
+		for _, beneficiary := range book.Beneficiaries {
+			if states != nil {
+				beneficiaries = append(beneficiaries, fmt.Sprintf("%s:%v", displayAddress(ctx, beneficiary, cfg), states[i].PaidOut[beneficiary]))
+				continue
+			}
+			beneficiaries = append(beneficiaries, displayAddress(ctx, beneficiary, cfg))
+		}
+		if states != nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\t%v\t%v\t%s\n", marker, displayAddress(ctx, book.Address, cfg), displayAddress(ctx, book.Issuer, cfg), displayAddress(ctx, book.Token, cfg), network, states[i].Balance, states[i].LiquidBalance, states[i].TotalPaidOut, strings.Join(beneficiaries, ","))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, displayAddress(ctx, book.Address, cfg), displayAddress(ctx, book.Issuer, cfg), displayAddress(ctx, book.Token, cfg), network, strings.Join(beneficiaries, ","))
+	}
+	return w.Flush()
+}
+
+// chequebookStateOutput is the json printed per chequebook by list-chequebooks -balances, amounts are in base units
+type chequebookStateOutput struct {
+	Chequebook       common.Address            `json:"chequebook"`
+	Balance          string                    `json:"balance"`
+	LiquidBalance    string                    `json:"liquidBalance"`
+	TotalPaidOut     string                    `json:"totalPaidOut"`
+	TotalHardDeposit string                    `json:"totalHardDeposit"`
+	PaidOut          map[common.Address]string `json:"paidOut,omitempty"`
+	HardDeposits     map[common.Address]string `json:"hardDeposits,omitempty"`
+}
+
+func newChequebookStateOutputs(states []*chequebook.ChequebookState) []chequebookStateOutput {
+	var out []chequebookStateOutput
+	for _, state := range states {
+		item := chequebookStateOutput{
+			Chequebook:       state.Chequebook,
+			Balance:          state.Balance.String(),
+			LiquidBalance:    state.LiquidBalance.String(),
+			TotalPaidOut:     state.TotalPaidOut.String(),
+			TotalHardDeposit: state.TotalHardDeposit.String(),
+			PaidOut:          make(map[common.Address]string),
+			HardDeposits:     make(map[common.Address]string),
+		}
+		for beneficiary, paidOut := range state.PaidOut {
+			item.PaidOut[beneficiary] = paidOut.String()
+		}
+		for beneficiary, deposit := range state.HardDeposits {
+			item.HardDeposits[beneficiary] = deposit.Amount.String()
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// runSelectChequebook makes a chequebook of -registry the one used by commands without -chequebook
+func runSelectChequebook(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the registered chequebook to select")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := requireAddress(logger, "chequebook", *contract, cfg)
+	if err != nil {
+		return err
+	}
+	registry, err := requireRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := registry.Select(contractAddress); err != nil {
+		if errors.Is(err, chequebook.ErrUnknownChequebook) {
+			return fmt.Errorf("%w, add it with register-chequebook first", err)
+		}
+		return err
+	}
+	logger.Info("selected chequebook", "chequebook", contractAddress, "registry", cfg.registryPath)
+	return nil
+}
+
+// runRegisterChequebook adds a chequebook deployed elsewhere to -registry
+func runRegisterChequebook(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook to register")
+	factory := fs.String("factory", "", "`address` of the factory which deployed the chequebook")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := requireAddress(logger, "chequebook", *contract, cfg)
+	if err != nil {
+		return err
+	}
+	var factoryAddress common.Address
+	if *factory != "" {
+		if factoryAddress, err = requireAddress(logger, "factory", *factory, cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.registryPath == "" {
+		return fmt.Errorf("%s requires -registry", cfg.command)
+	}
+
+	if err := chequebook.VerifyChequebook(ctx, backend, contractAddress); err != nil {
+		return err
+	}
+	book, err := chequebook.NewChequebook(contractAddress, backend, wallet)
+	if err != nil {
+		return err
+	}
+	if err := registerChequebook(ctx, backend, cfg, book, factoryAddress); err != nil {
+		return err
+	}
+	logger.Info("registered chequebook", "chequebook", contractAddress, "registry", cfg.registryPath)
+	return nil
+}
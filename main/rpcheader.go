@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// headerFlags collects repeated -rpc-header key:value flags
+type headerFlags struct {
+	header http.Header
+}
+
+func (h *headerFlags) String() string {
+	if h == nil || h.header == nil {
+		return ""
+	}
+	var pairs []string
+	for key, values := range h.header {
+		for _, value := range values {
+			pairs = append(pairs, key+":"+value)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set parses and validates a single key:value header
+func (h *headerFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid rpc header %q, expected key:value", value)
+	}
+	key := strings.TrimSpace(parts[0])
+	if key == "" || strings.ContainsAny(key, " \t\r\n") {
+		return fmt.Errorf("invalid rpc header name %q", parts[0])
+	}
+	if h.header == nil {
+		h.header = make(http.Header)
+	}
+	h.header.Add(key, strings.TrimSpace(parts[1]))
+	return nil
+}
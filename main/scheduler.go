@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runAutoCashout cashes the profitable cheques of a store of received cheques periodically until ctx is cancelled
+// with -dry-run the cheques which would be cashed are only logged
+func runAutoCashout(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the received cheques")
+	interval := fs.Duration("interval", chequebook.DefaultCashoutInterval, "delay between two evaluations of the stored cheques")
+	retryDelay := fs.Duration("retry-delay", chequebook.DefaultCashoutRetryDelay, "delay before a failed cashout is retried, doubled per failure")
+	margin := fs.String("margin", "0", "`amount` of tokens a cashout has to pay on top of its gas cost")
+	tokenPerWei := fs.String("token-per-wei", "", "token base units one wei of gas cost is worth, used to convert the gas cost")
+	once := fs.Bool("once", false, "evaluate the stored cheques once and exit")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *storeDir == "" {
+		return errors.New("auto-cashout requires -store")
+	}
+	marginValue, ok := new(big.Int).SetString(*margin, 10)
+	if !ok || marginValue.Sign() < 0 {
+		return fmt.Errorf("invalid -margin %q", *margin)
+	}
+	rate, ok := new(big.Float).SetString(*tokenPerWei)
+	if !ok || rate.Sign() < 0 {
+		return fmt.Errorf("invalid -token-per-wei %q", *tokenPerWei)
+	}
+
+	store, err := chequebook.OpenChequeStore(*storeDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	scheduler := chequebook.NewCashoutScheduler(backend, wallet, store, &chequebook.FixedTokenPrice{Rate: rate})
+	scheduler.Interval = *interval
+	scheduler.RetryDelay = *retryDelay
+	scheduler.Margin = marginValue
+	scheduler.DryRun = cfg.dryRun
+	scheduler.Configure = func(book *chequebook.Chequebook) { configureChequebook(book, cfg) }
+
+	if *once {
+		return scheduler.RunOnce(ctx)
+	}
+	logger.Info("cashing stored cheques periodically", "interval", *interval, "margin", marginValue, "dryRun", cfg.dryRun)
+	return scheduler.RunUntil(ctx, stopped(ctx, cfg))
+}
+
+// runEstimateCashout prints what cashing a json signed cheque as its beneficiary would cost and pay now
+func runEstimateCashout(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	chequeFile := fs.String("cheque", "-", "`file` containing the json signed cheque (- for stdin)")
+	tokenPerWei := fs.String("token-per-wei", "", "token base units one wei of gas cost is worth, empty only reports the cost in wei")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+
+	signed, err := readSignedCheque(*chequeFile)
+	if err != nil {
+		return err
+	}
+
+	book, err := openChequebook(ctx, signed.Contract, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	if *tokenPerWei != "" {
+		rate, ok := new(big.Float).SetString(*tokenPerWei)
+		if !ok || rate.Sign() < 0 {
+			return fmt.Errorf("invalid -token-per-wei %q", *tokenPerWei)
+		}
+		book.TokenPrice = &chequebook.FixedTokenPrice{Rate: rate}
+	}
+
+	cost, err := book.EstimateCashoutCost(ctx, signed)
+	if err != nil {
+		return err
+	}
+	if cost.Net != nil && cost.Net.Sign() <= 0 {
+		logger.Warn("cashing the cheque costs more than it pays")
+	}
+	if cfg.jsonOutput {
+		return printJSON(struct {
+			Gas       uint64 `json:"gas"`
+			GasPrice  string `json:"gasPrice"`
+			GasCost   string `json:"gasCost"`
+			Payable   string `json:"payable"`
+			TokenCost string `json:"tokenCost,omitempty"`
+			Net       string `json:"net,omitempty"`
+		}{cost.Gas, cost.GasPrice.String(), cost.Wei.String(), cost.Payable.String(), decimal(cost.Token), decimal(cost.Net)})
+	}
+
+	fmt.Printf("gas:        %d\n", cost.Gas)
+	fmt.Printf("gas price:  %v wei\n", cost.GasPrice)
+	fmt.Printf("gas cost:   %v wei\n", cost.Wei)
+	fmt.Printf("payable:    %v\n", cost.Payable)
+	if cost.Token != nil {
+		fmt.Printf("token cost: %v\n", cost.Token)
+		fmt.Printf("net:        %v\n", cost.Net)
+	}
+	return nil
+}
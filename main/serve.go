@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"signing/chequebook"
+)
+
+// runServe serves the cheque operations over JSON-RPC until interrupted
+// the requests running then, such as cashouts waiting for their transaction, are finished before it returns unless ctx is cancelled first
+func runServe(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	httpAddr := fs.String("http", "", "`address` to serve JSON-RPC and the REST api over http on, such as 127.0.0.1:8555")
+	httpToken := fs.String("http-token", "", "bearer `token` every http request has to carry in its Authorization header (default $SWAP_HTTP_TOKEN, none required if unset)")
+	ipcPath := fs.String("ipc", "", "`path` of a unix socket to serve JSON-RPC on")
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping issued cheques, required for swap_issueCheque and swap_listCheques")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *httpAddr == "" && *ipcPath == "" {
+		return errors.New("serve requires -http or -ipc")
+	}
+
+	var chainID *big.Int
+	err := chequebook.WithRetry(ctx, cfg.retryAttempts, func() (err error) {
+		chainID, err = backend.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if cfg.chainID != nil && cfg.chainID.Cmp(chainID) != 0 {
+		return fmt.Errorf("backend reports chain id %v, expected %v", chainID, cfg.chainID)
+	}
+
+	var store *chequebook.ChequeStore
+	if *storeDir != "" {
+		store, err = chequebook.OpenChequeStore(*storeDir)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	service := chequebook.NewChequeService(backend, wallet, store, chainID, cfg.typedData)
+	service.Configure = func(book *chequebook.Chequebook) { configureChequebook(book, cfg) }
+	service.TTL = cfg.chequeTTL
+	service.Contracts = cfg.contracts
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("swap", service); err != nil {
+		return err
+	}
+
+	errs := make(chan error, 2)
+	if *httpAddr != "" {
+		listener, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			return err
+		}
+		// the REST api shares the listener, JSON-RPC requests are posted to any other path
+		rest := chequebook.NewRESTHandler(service)
+		mux := http.NewServeMux()
+		mux.Handle("/", server)
+		for _, path := range []string{"/cheques", "/cheques/verify", "/cashout", "/chequebook/"} {
+			mux.Handle(path, rest)
+		}
+		// JSON-RPC issues and cashes cheques as well, so it gets the same origin check as the REST api
+		handler := chequebook.SameOrigin(mux)
+		if token := stringOption(*httpToken, "SWAP_HTTP_TOKEN", ""); token != "" {
+			handler = chequebook.RequireToken(token, handler)
+		}
+		httpServer := &http.Server{Handler: handler}
+		go func() { errs <- httpServer.Serve(listener) }()
+		defer func() {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				logger.Warn("requests still running were cut off", "err", err)
+			}
+		}()
+		logger.Info("serving JSON-RPC and REST over http", "address", listener.Addr())
+	}
+	if *ipcPath != "" {
+		// a socket left behind by a previous run would make listening fail
+		if err := os.Remove(*ipcPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		listener, err := net.Listen("unix", *ipcPath)
+		if err != nil {
+			return err
+		}
+		go func() { errs <- server.ServeListener(listener) }()
+		defer listener.Close()
+		logger.Info("serving JSON-RPC over ipc", "path", *ipcPath)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stopped(ctx, cfg):
+		logger.Info("stopping JSON-RPC server, finishing running requests", "timeout", cfg.shutdownTimeout)
+		return nil
+	}
+}
+
+// runExchangeServe answers cheque requests of beneficiaries with cheques of a chequebook of the selected account
+func runExchangeServe(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8556", "tcp `address` to accept cheque requests on")
+	contract := fs.String("chequebook", "", "`address` of the chequebook the cheques are drawn on, defaults to the active one of -registry")
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the issued cheques")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+	if *storeDir == "" {
+		return errors.New("exchange-serve requires -store")
+	}
+
+	_, _, chainID, err := newTransactor(ctx, logger, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := chequebook.OpenChequeStore(*storeDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	issuer, err := chequebook.NewIssuer(ctx, book, store, chainID, typedCheques(book, cfg))
+	if err != nil {
+		return err
+	}
+	issuer.TTL = cfg.chequeTTL
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	logger.Info("accepting cheque requests", "address", listener.Addr(), "chequebook", contractAddress)
+	return chequebook.ServeChequeExchangeUntil(ctx, stopped(ctx, cfg), listener, issuer)
+}
+
+// runExchangeRequest requests a cheque from an issuer running exchange-serve and keeps it once verified
+func runExchangeRequest(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	peer := fs.String("peer", "127.0.0.1:8556", "tcp `address` of the issuer")
+	beneficiary := fs.String("beneficiary", "", "`address` the cheque should pay")
+	amount := fs.String("amount", "", "`amount` the cheque should pay on top of the previous ones")
+	storeDir := fs.String("store", "", "`dir`ectory of the database keeping the received cheques")
+	minCoverage := fs.String("min-coverage", "bounce", "lowest `coverage` of the uncashed payout by the chequebook's liquid balance a cheque is kept with: full, partial or bounce")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	grade, err := chequebook.ParseCoverageGrade(*minCoverage)
+	if err != nil {
+		return fmt.Errorf("invalid -min-coverage: %v", err)
+	}
+	beneficiaryAddress, err := requireAddress(logger, "beneficiary", *beneficiary, cfg)
+	if err != nil {
+		return err
+	}
+	value, ok := new(big.Int).SetString(*amount, 10)
+	if !ok || value.Sign() <= 0 {
+		return fmt.Errorf("invalid -amount %q", *amount)
+	}
+	if *storeDir == "" {
+		return errors.New("exchange-request requires -store")
+	}
+
+	var chainID *big.Int
+	if cfg.typedData {
+		if chainID, err = backend.ChainID(ctx); err != nil {
+			return err
+		}
+	}
+
+	store, err := chequebook.OpenChequeStore(*storeDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	receiver := chequebook.NewChequeReceiver(backend, store, beneficiaryAddress, chainID, cfg.typedData)
+	receiver.Metrics = cfg.metrics
+	receiver.Notifier = cfg.notifier
+	receiver.MinCoverage = grade
+	receiver.Contracts = cfg.contracts
+	cheque, err := receiver.Request(ctx, *peer, value)
+	if err != nil {
+		return err
+	}
+	logger.Info("received cheque", "chequebook", cheque.Contract, "cumulativePayout", cheque.CumulativePayout)
+
+	return printJSON(cheque)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownContexts returns a stop context which is cancelled on the first SIGINT or SIGTERM and a work context which outlives it by grace
+// long-running commands stop taking new work once stop is done and finish what is in flight under work,
+// which is cancelled right away on a second signal, with a grace of 0 both are cancelled together
+func shutdownContexts(grace time.Duration) (stop context.Context, work context.Context, cancel context.CancelFunc) {
+	work, cancelWork := context.WithCancel(context.Background())
+	stop, cancelStop := context.WithCancel(work)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case <-signals:
+			cancelStop()
+		case <-work.Done():
+			return
+		}
+		if grace <= 0 {
+			cancelWork()
+			return
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-signals:
+		case <-timer.C:
+		case <-work.Done():
+		}
+		cancelWork()
+	}()
+	return stop, work, func() {
+		cancelStop()
+		cancelWork()
+	}
+}
+
+// stopped returns the channel closed once a long-running command should take no new work, ctx.Done() if no interrupt handler was set up
+func stopped(ctx context.Context, cfg *options) <-chan struct{} {
+	if cfg.stop == nil {
+		return ctx.Done()
+	}
+	return cfg.stop
+}
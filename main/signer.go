@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"signing/chequebook"
+)
+
+// signers creates the wallet of each -signer kind from the settings in cfg
+var signers = map[string]func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error){
+	"clef": func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+		// an http(s) clef is only reached when it is dialed, a socket has to exist before
+		if !strings.HasPrefix(cfg.clefIPC, "http://") && !strings.HasPrefix(cfg.clefIPC, "https://") {
+			if _, err := os.Stat(cfg.clefIPC); err != nil {
+				return nil, fmt.Errorf("clef ipc socket not found at %s (set -clef or $CLEF_IPC): %v", cfg.clefIPC, err)
+			}
+		}
+		opts := chequebook.ClefOptions{Header: cfg.clefHeader, Username: cfg.clefUser, Password: cfg.clefPassword}
+		if cfg.clefCA != "" || cfg.clefCert != "" || cfg.clefKey != "" {
+			config, err := chequebook.LoadClientTLS(cfg.clefCA, cfg.clefCert, cfg.clefKey)
+			if err != nil {
+				return nil, err
+			}
+			opts.TLS = config
+		}
+		return chequebook.DialClef(ctx, cfg.clefIPC, opts)
+	},
+	"keystore": func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+		if cfg.keystoreDir == "" {
+			return nil, errors.New("-signer keystore requires -keystore")
+		}
+		return chequebook.LoadKeystoreWallet(cfg.keystoreDir, cfg.keystorePassword)
+	},
+	"key": func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+		if cfg.privateKey == "" {
+			return nil, errors.New("-signer key requires -key or $SWAP_PRIVATE_KEY")
+		}
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.privateKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		return chequebook.NewKeyWallet(key), nil
+	},
+	"kms": func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+		if cfg.kmsKey == "" {
+			return nil, errors.New("-signer kms requires -kms-key")
+		}
+		// the credentials are taken from the environment like the aws tools do, they are never passed as flags
+		return chequebook.NewAWSKMSWallet(ctx, &chequebook.AWSKMSSigner{
+			KeyID:           cfg.kmsKey,
+			Region:          cfg.kmsRegion,
+			Endpoint:        cfg.kmsEndpoint,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	},
+	"hardware": func(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+		path, err := accounts.ParseDerivationPath(cfg.hdPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -hd-path %q: %w", cfg.hdPath, err)
+		}
+		return chequebook.OpenHardwareWallet(chequebook.HardwareWalletConfig{
+			Path:   path,
+			Choose: chooseHardwareWallet,
+			PIN:    promptTrezorPIN,
+		})
+	},
+}
+
+// promptLine prints question to stderr and reads the answer from stdin
+func promptLine(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// chooseHardwareWallet lists the connected devices and asks which one to use
+func chooseHardwareWallet(wallets []accounts.Wallet) (int, error) {
+	for i, wallet := range wallets {
+		status, _ := wallet.Status()
+		fmt.Fprintf(os.Stderr, "[%d] %s %s\n", i, wallet.URL(), status)
+	}
+	answer, err := promptLine("hardware wallet to use: ")
+	if err != nil {
+		return 0, err
+	}
+	index, err := strconv.Atoi(answer)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hardware wallet %q", answer)
+	}
+	return index, nil
+}
+
+// promptTrezorPIN asks for the PIN of a locked Trezor, entered using the scrambled keypad shown on the device
+func promptTrezorPIN(wallet accounts.Wallet) (string, error) {
+	return promptLine(fmt.Sprintf("PIN of %s, using the layout shown on the device (7 8 9 top row, 1 2 3 bottom row): ", wallet.URL()))
+}
+
+// signerNames lists the -signer kinds for usage and error messages
+func signerNames() string {
+	names := make([]string, 0, len(signers))
+	for name := range signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// newWallet creates the wallet selected by -signer
+// without -signer a key or keystore given is used instead of clef so existing invocations keep working
+func newWallet(ctx context.Context, cfg *options) (chequebook.WalletBackend, error) {
+	if cfg.readOnly {
+		return chequebook.ReadOnlyWallet{}, nil
+	}
+
+	kind := cfg.signer
+	if kind == "" {
+		switch {
+		case cfg.privateKey != "":
+			kind = "key"
+		case cfg.keystoreDir != "":
+			kind = "keystore"
+		default:
+			kind = "clef"
+		}
+	}
+
+	create, ok := signers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q, expected one of %s", kind, signerNames())
+	}
+	return create(ctx, cfg)
+}
+
+// selectAccount picks the wallet account given by -account
+// without one a wallet with several accounts lets the user choose on the terminal
+func selectAccount(wallet chequebook.WalletBackend, cfg *options) (accounts.Account, error) {
+	if cfg.accountIndex >= 0 {
+		return chequebook.AccountAt(wallet, cfg.accountIndex)
+	}
+
+	account, err := chequebook.SelectAccount(wallet, cfg.account)
+	if errors.Is(err, chequebook.ErrAmbiguousAccount) && isTerminal(os.Stdin) {
+		return promptAccount(wallet)
+	}
+	return account, err
+}
+
+// promptAccount lists the wallet accounts and asks which one to use
+func promptAccount(wallet chequebook.WalletBackend) (accounts.Account, error) {
+	for i, account := range wallet.Accounts() {
+		fmt.Fprintf(os.Stderr, "[%d] %s\n", i, account.Address.Hex())
+	}
+	answer, err := promptLine("account to use: ")
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	index, err := strconv.Atoi(answer)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("invalid account %q", answer)
+	}
+	return chequebook.AccountAt(wallet, index)
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// StepStats is the wall-clock duration of one step of a run and the gas used by its transaction
+// steps sending a transaction include waiting for it to be mined
+type StepStats struct {
+	Name     string
+	Duration time.Duration
+	GasUsed  uint64 // 0 for steps which did not send a transaction
+}
+
+// RunStats collects the steps of a chequebook run in the order they were taken
+// all methods are no-ops on a nil RunStats, which is how recording is disabled
+type RunStats struct {
+	Steps []StepStats
+}
+
+// record adds the step name which started at start, taking its gas used from receipt if it is not nil
+func (s *RunStats) record(name string, start time.Time, receipt *types.Receipt) {
+	if s == nil {
+		return
+	}
+
+	step := StepStats{Name: name, Duration: time.Since(start)}
+	if receipt != nil {
+		step.GasUsed = receipt.GasUsed
+	}
+	s.Steps = append(s.Steps, step)
+}
+
+// recordSetup adds a setup step which recorded its transaction in the deployment state
+// the transaction's gas is only counted if it was sent by this run, that is if the recorded hash changed from before to after
+func (s *RunStats) recordSetup(ctx context.Context, backend chequebook.EthBackend, name string, start time.Time, before common.Hash, after common.Hash) {
+	if s == nil {
+		return
+	}
+
+	var receipt *types.Receipt
+	if after != before && (after != common.Hash{}) {
+		var err error
+		receipt, err = backend.TransactionReceipt(ctx, after)
+		if err != nil {
+			log.Debug("receipt for run stats unavailable", "step", name, "tx", after.Hex(), "err", err)
+		}
+	}
+	s.record(name, start, receipt)
+}
+
+// TotalGas is the gas used by all steps
+func (s *RunStats) TotalGas() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	var total uint64
+	for _, step := range s.Steps {
+		total += step.GasUsed
+	}
+	return total
+}
+
+// TotalDuration is the time taken by all steps
+func (s *RunStats) TotalDuration() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	var total time.Duration
+	for _, step := range s.Steps {
+		total += step.Duration
+	}
+	return total
+}
+
+// Slowest returns the step which took the longest, ok is false if no step was recorded
+func (s *RunStats) Slowest() (step StepStats, ok bool) {
+	if s == nil {
+		return StepStats{}, false
+	}
+
+	for i, candidate := range s.Steps {
+		if i == 0 || candidate.Duration > step.Duration {
+			step = candidate
+		}
+	}
+	return step, len(s.Steps) > 0
+}
+
+// log logs every step followed by a summary
+func (s *RunStats) log(logger log.Logger) {
+	if s == nil {
+		return
+	}
+
+	for _, step := range s.Steps {
+		logger.Info("step", "name", step.Name, "duration", step.Duration, "gasUsed", step.GasUsed)
+	}
+
+	fields := []interface{}{"steps", len(s.Steps), "totalGas", s.TotalGas(), "totalDuration", s.TotalDuration()}
+	if slowest, ok := s.Slowest(); ok {
+		fields = append(fields, "slowest", slowest.Name, "slowestDuration", slowest.Duration)
+	}
+	logger.Info("run stats", fields...)
+}
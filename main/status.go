@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runStatus prints the state of an existing chequebook using only read calls
+// amounts are shown in tokens if the token reports its decimals or symbol, and always in base units
+// if beneficiary is not zero the amount already paid out to it is printed as well, with -json everything is printed as json
+func runStatus(ctx context.Context, backend chequebook.EthBackend, address common.Address, beneficiary common.Address, cfg *options) error {
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract code at chequebook address %s", address.Hex())
+	}
+
+	book, err := chequebook.NewChequebook(address, backend, chequebook.ReadOnlyWallet{})
+	if err != nil {
+		return err
+	}
+	// the status is read from any chequebook, the release only tells whether it holds ether
+	if book.Version = cfg.contracts; book.Version == nil {
+		if version, err := chequebook.DetectVersion(ctx, backend, address); err == nil {
+			book.Version = version
+		}
+	}
+
+	reader, err := stateReader(ctx, backend, cfg)
+	if err != nil {
+		return err
+	}
+	query := chequebook.StateQuery{Chequebook: address}
+	if (beneficiary != common.Address{}) {
+		query.Beneficiaries = []common.Address{beneficiary}
+	}
+	states, err := reader.Read(ctx, []chequebook.StateQuery{query})
+	if err != nil {
+		return err
+	}
+	state := states[0]
+	issuer, token, balance, liquidBalance, totalPaidOut := state.Issuer, state.Token, state.Balance, state.LiquidBalance, state.TotalPaidOut
+
+	decimals, hasDecimals := chequebook.TokenDecimals(ctx, backend, token)
+	if book.NativeToken() {
+		decimals, hasDecimals = 18, true
+	}
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return err
+	}
+	if cfg.jsonOutput {
+		out := statusOutput{
+			Chequebook:    address,
+			Issuer:        issuer,
+			Token:         token,
+			Ether:         book.NativeToken(),
+			Symbol:        denomination.Symbol,
+			Balance:       balance.String(),
+			LiquidBalance: liquidBalance.String(),
+			TotalPaidOut:  totalPaidOut.String(),
+		}
+		if hasDecimals {
+			out.Decimals = &decimals
+		}
+		if (beneficiary != common.Address{}) {
+			out.Beneficiary = &beneficiary
+			out.PaidOut = state.PaidOut[beneficiary].String()
+		}
+		return printJSON(out)
+	}
+
+	amount := func(value *big.Int) string { return formatAmount(denomination, value) }
+
+	fmt.Printf("chequebook:     %s\n", displayAddress(ctx, address, cfg))
+	fmt.Printf("issuer:         %s\n", displayAddress(ctx, issuer, cfg))
+	if book.NativeToken() {
+		fmt.Printf("token:          ether\n")
+	} else {
+		fmt.Printf("token:          %s\n", displayAddress(ctx, token, cfg))
+	}
+	fmt.Printf("balance:        %s\n", amount(balance))
+	fmt.Printf("liquid balance: %s\n", amount(liquidBalance))
+	fmt.Printf("total paid out: %s\n", amount(totalPaidOut))
+
+	if (beneficiary != common.Address{}) {
+		fmt.Printf("paid out to %s: %s\n", displayAddress(ctx, beneficiary, cfg), amount(state.PaidOut[beneficiary]))
+	}
+	return nil
+}
+
+// stateReader reads chequebook states through the Multicall3 contract of -multicall or of the chain's network
+// without either every read is sent on its own
+func stateReader(ctx context.Context, backend chequebook.EthBackend, cfg *options) (*chequebook.StateReader, error) {
+	multicall := cfg.multicall
+	if (multicall == common.Address{}) {
+		chainID, err := backend.ChainID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if network, ok := cfg.networks.Lookup(chainID); ok {
+			multicall = network.Multicall
+		}
+	}
+	return chequebook.NewStateReader(backend, multicall)
+}
+
+// statusOutput is the json printed by runStatus, amounts are in base units
+type statusOutput struct {
+	Chequebook    common.Address  `json:"chequebook"`
+	Issuer        common.Address  `json:"issuer"`
+	Token         common.Address  `json:"token"`
+	Ether         bool            `json:"ether,omitempty"` // the chequebook holds ether, its token is the zero address
+	Symbol        string          `json:"symbol,omitempty"`
+	Decimals      *uint8          `json:"decimals,omitempty"`
+	Balance       string          `json:"balance"`
+	LiquidBalance string          `json:"liquidBalance"`
+	TotalPaidOut  string          `json:"totalPaidOut"`
+	Beneficiary   *common.Address `json:"beneficiary,omitempty"`
+	PaidOut       string          `json:"paidOut,omitempty"`
+}
+
+// printFunding prints a mined deposit or withdrawal of amount and the balances after it as json
+func printFunding(ctx context.Context, book *chequebook.Chequebook, receipt *types.Receipt, amount *big.Int) error {
+	balance, err := book.Balance(ctx)
+	if err != nil {
+		return err
+	}
+
+	liquid, err := book.LiquidBalance(ctx)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(fundingOutput{
+		txOutput:      newTxOutput(book, receipt),
+		Amount:        amount.String(),
+		Balance:       balance.String(),
+		LiquidBalance: liquid.String(),
+	})
+}
+
+// logBalances logs the total and liquid balance of the chequebook
+func logBalances(ctx context.Context, logger log.Logger, book *chequebook.Chequebook, label string) error {
+	balance, err := book.Balance(ctx)
+	if err != nil {
+		return err
+	}
+
+	liquid, err := book.LiquidBalance(ctx)
+	if err != nil {
+		return err
+	}
+
+	denomination, err := book.Denomination(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("chequebook balance "+label, "balance", formatAmount(denomination, balance), "liquid", formatAmount(denomination, liquid))
+	return nil
+}
+
+// formatAmount writes an amount in tokens followed by its base units, or only in base units for a token without decimals or symbol
+func formatAmount(denomination chequebook.Denomination, value *big.Int) string {
+	if denomination == (chequebook.Denomination{}) {
+		return value.String()
+	}
+	return fmt.Sprintf("%s (%v)", denomination.Format(value), value)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// runTopUp keeps the liquid balance of a chequebook above -low by depositing from the issuer up to -high until interrupted
+// shortfalls of the issuer are logged and posted to the webhooks of -webhook
+func runTopUp(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contract := fs.String("chequebook", "", "`address` of the chequebook, defaults to the active one of -registry")
+	low := fs.String("low", "", "liquid balance below which the chequebook is topped up, in base units or followed by the token's symbol")
+	high := fs.String("high", "", "liquid balance a top-up brings the chequebook to, defaults to -low")
+	interval := fs.Duration("interval", chequebook.DefaultTopUpInterval, "delay between two checks of the liquid balance")
+	once := fs.Bool("once", false, "check the liquid balance once and exit")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+	if *low == "" {
+		return errors.New("top-up requires -low")
+	}
+	if *high == "" {
+		high = low
+	}
+	contractAddress, err := chequebookAddress(logger, *contract, cfg)
+	if err != nil {
+		return err
+	}
+
+	book, err := openChequebook(ctx, contractAddress, backend, wallet, cfg)
+	if err != nil {
+		return err
+	}
+	configureChequebook(book, cfg)
+	lowWater, err := parseTokenAmount(ctx, book, "low", *low)
+	if err != nil {
+		return err
+	}
+	highWater, err := parseTokenAmount(ctx, book, "high", *high)
+	if err != nil {
+		return err
+	}
+
+	monitor, err := chequebook.NewTopUpMonitor(book, lowWater, highWater)
+	if err != nil {
+		return err
+	}
+	monitor.Interval = *interval
+	monitor.DryRun = cfg.dryRun
+
+	if *once {
+		result, err := monitor.CheckOnce(ctx)
+		if err != nil {
+			return err
+		}
+		if cfg.jsonOutput {
+			return printJSON(struct {
+				Liquid    string `json:"liquid"`
+				Deposited string `json:"deposited,omitempty"`
+				Tx        string `json:"tx,omitempty"`
+			}{result.Liquid.String(), decimal(result.Deposited), topUpTx(result)})
+		}
+		return nil
+	}
+	logger.Info("topping up the chequebook", "chequebook", contractAddress, "low", lowWater, "high", highWater, "interval", *interval, "dryRun", cfg.dryRun)
+	return monitor.RunUntil(ctx, stopped(ctx, cfg))
+}
+
+// topUpTx returns the hash of the deposit of result, empty if nothing was deposited
+func topUpTx(result *chequebook.TopUpResult) string {
+	if result.Receipt == nil {
+		return ""
+	}
+	return result.Receipt.TxHash.Hex()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// openChequebook binds to the chequebook at address as a release of -contracts, detecting the release without it
+func openChequebook(ctx context.Context, address common.Address, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) (*chequebook.Chequebook, error) {
+	var book *chequebook.Chequebook
+	var err error
+	if cfg.contracts == nil {
+		book, err = chequebook.OpenChequebook(ctx, address, backend, wallet)
+	} else if book, err = chequebook.NewChequebook(address, backend, wallet); err == nil {
+		book.Version = cfg.contracts
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a chequebook registered on one chain never cashes on another, even where the same address exists
+	book.ChainID = registeredChain(address, cfg)
+	// cheques of a chequebook outside the allowlist are refused whichever command accepts or cashes them
+	book.TrustedFactories = cfg.trustedFactories
+	return book, nil
+}
+
+// typedCheques tells whether cheques drawn on book are signed as typed data, which -typed-data forces for every release
+func typedCheques(book *chequebook.Chequebook, cfg *options) bool {
+	return cfg.typedData || book.TypedCheques()
+}
+
+// deployVersion deploys a chequebook of the release -contracts through the factory of state and records it in state
+func deployVersion(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, opts *bind.TransactOpts, state *chequebook.DeploymentState, cfg *options) (*chequebook.Chequebook, error) {
+	deployCtx, cancel := context.WithTimeout(ctx, cfg.waitTimeout)
+	defer cancel()
+
+	book, tx, err := chequebook.DeployVersion(deployCtx, backend, wallet, opts, cfg.contracts, state.Factory, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := chequebook.WaitConfirmed(ctx, backend, tx, cfg.confirmations, cfg.waitTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Chequebook, state.ChequebookTx, state.ChequebookBlock = book.Address(), tx.Hash(), receipt.BlockNumber.Uint64()
+	logger.Info("deployed chequebook", "address", book.Address(), "tx", state.ChequebookTx, "block", state.ChequebookBlock, "from", opts.From, "contracts", cfg.contracts.Name())
+	return book, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// watchedEvent is the json line printed per event by the watch command
+type watchedEvent struct {
+	Event            string          `json:"event"`
+	Chequebook       common.Address  `json:"chequebook"`
+	Block            uint64          `json:"block"`
+	TxHash           common.Hash     `json:"txHash"`
+	Removed          bool            `json:"removed,omitempty"`
+	Beneficiary      *common.Address `json:"beneficiary,omitempty"`
+	Recipient        *common.Address `json:"recipient,omitempty"`
+	TotalPayout      string          `json:"totalPayout,omitempty"`
+	CumulativePayout string          `json:"cumulativePayout,omitempty"`
+	CallerPayout     string          `json:"callerPayout,omitempty"`
+}
+
+// runWatch prints the ChequeCashed and ChequeBounced events of chequebooks as json lines until interrupted
+// it then logs the -from-block which continues with the events after the last printed one
+func runWatch(ctx context.Context, logger log.Logger, backend chequebook.EthBackend, wallet chequebook.WalletBackend, cfg *options) error {
+	fs := flag.NewFlagSet(cfg.command, flag.ContinueOnError)
+	contracts := fs.String("chequebook", "", "comma separated `addresses` of the chequebooks to watch, defaults to the active one of -registry")
+	fromBlock := fs.Int64("from-block", -1, "first `block` whose events are printed, -1 only prints new events")
+	if err := parseCommandFlags(fs, cfg); err != nil {
+		return err
+	}
+
+	var addresses []common.Address
+	for _, value := range strings.Split(*contracts, ",") {
+		address, err := chequebookAddress(logger, strings.TrimSpace(value), cfg)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, address)
+	}
+
+	watcher, err := chequebook.NewChequeWatcher(backend, addresses...)
+	if err != nil {
+		return err
+	}
+	if *fromBlock >= 0 {
+		watcher.FromBlock = big.NewInt(*fromBlock)
+	}
+
+	events := make(chan chequebook.ChequeEvent)
+	errs := make(chan error, 1)
+	go func() { errs <- watcher.Watch(ctx, events) }()
+
+	encoder := json.NewEncoder(os.Stdout)
+	var printed *uint64 // block of the last printed event
+	for {
+		select {
+		case event := <-events:
+			line := watchedEvent{
+				Event:      event.Kind.String(),
+				Chequebook: event.Chequebook,
+				Block:      event.Log.BlockNumber,
+				TxHash:     event.Log.TxHash,
+				Removed:    event.Log.Removed,
+			}
+			if event.Cashout != nil {
+				line.Beneficiary = &event.Cashout.Beneficiary
+				line.Recipient = &event.Cashout.Recipient
+				line.TotalPayout = event.Cashout.TotalPayout.String()
+				line.CumulativePayout = event.Cashout.CumulativePayout.String()
+				line.CallerPayout = event.Cashout.CallerPayout.String()
+			}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+			printed = &line.Block
+		case err := <-errs:
+			return err
+		case <-stopped(ctx, cfg):
+			if printed != nil {
+				// events of the last block are printed again when resuming from it, a block is not complete until the next one is seen
+				logger.Info("stopped watching, resume with -from-block", "block", *printed)
+			}
+			return nil
+		}
+	}
+}
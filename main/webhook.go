@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"signing/chequebook"
+)
+
+// newNotifier creates the notifier posting to the comma separated urls of -webhook, nil if there are none
+func newNotifier(value string, secret string) (*chequebook.Notifier, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var urls []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if parsed, err := url.Parse(field); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid -webhook %q", field)
+		}
+		urls = append(urls, field)
+	}
+	return chequebook.NewNotifier(urls, []byte(secret)), nil
+}
+
+// closeNotifier gives the events still being posted -shutdown-timeout to be delivered, also after an interrupt
+func closeNotifier(logger log.Logger, cfg *options) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	if err := cfg.notifier.Close(ctx); err != nil {
+		logger.Warn("webhook events were still being posted at exit", "err", err)
+	}
+}